@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"strconv"
@@ -26,16 +27,49 @@ type Config struct {
 	GCSBucketName   string
 	GCSBucketAudio  string
 	GCSBucketImages string
+	// GCSUniformAccess skips per-object ACLs on buckets with uniform bucket-level
+	// access; make the image bucket public through IAM instead
+	GCSUniformAccess bool
+	// SignedURLExpiry is how long links to private files such as voice recordings last
+	SignedURLExpiry string
 
 	// Google AI Services
 	SpeechToTextModel string
 	VertexAILocation  string
 	VertexAIModel     string
+	// Prompt templates come from a JSON file or are edited by admins
+	PromptTemplateSource string
+	PromptTemplatesFile  string
 
 	// API Keys
 	WhatsAppAPIKey  string
 	InstagramAPIKey string
 
+	// Payments
+	PaymentProvider       string // razorpay or fake
+	PaymentExpiry         string
+	AllowFakePayments     bool // the fake provider must be enabled explicitly
+	FakePaymentSecret     string
+	RazorpayKeyID         string
+	RazorpayKeySecret     string
+	RazorpayWebhookSecret string
+
+	// Shipment tracking
+	TrackingPollInterval string
+	FakeCarrierEnabled   bool
+	FakeCarrierSecret    string
+
+	// Shipping rates (JSON rate card; built-in defaults when empty)
+	ShippingRatesFile string
+
+	// GST rates (JSON rate card; built-in defaults when empty)
+	TaxRatesFile string
+
+	// Currencies: orders settle in BaseCurrency; rates come from a file or admin entry
+	BaseCurrency       string
+	CurrencyRateSource string
+	ExchangeRatesFile  string
+
 	// CORS Configuration
 	CORSOrigins []string
 
@@ -43,11 +77,35 @@ type Config struct {
 	RateLimitRequests int
 	RateLimitWindow   int
 
-	// File Upload Limits
+	// File Upload Limits (sizes like "10MB"; types are matched against the file content)
 	MaxAudioSize      string
 	MaxImageSize      string
 	AllowedAudioTypes []string
 	AllowedImageTypes []string
+	MaxImageDimension int
+	MaxImagePixels    int
+
+	// Direct-to-bucket uploads: how long a signed upload URL stays valid
+	UploadSessionExpiry string
+
+	// Malware scanning of uploads: "" (off) or "clamd"
+	MalwareScanner string
+	ClamdAddress   string
+
+	// Image processing: "cwebp" adds WebP renditions using libwebp's cwebp/dwebp
+	ImageWebPEncoder string
+
+	// Photo enhancement: "" (off), "basic" (pure Go) or "imagen" (Imagen background swap)
+	ImageEnhancer   string
+	ImagenEditModel string
+
+	// AI image generation: "" (off), "placeholder" (rendered locally) or "imagen" (Vertex AI)
+	ImageGenerator         string
+	ImagenModel            string
+	AllowPlaceholderImages bool // the placeholder generator must be enabled explicitly
+
+	// How often unreferenced images are deleted from storage ("0" disables the sweep)
+	ImageGCInterval string
 
 	// JWT Configuration
 	JWTSecret string
@@ -82,19 +140,48 @@ func Load() *Config {
 		FirebaseDatabaseURL: getEnv("FIREBASE_DATABASE_URL", ""),
 
 		// Google Cloud Storage
-		GCSBucketName:   getEnv("GCS_BUCKET_NAME", "voicecraft-market-uploads"),
-		GCSBucketAudio:  getEnv("GCS_BUCKET_AUDIO", "voicecraft-market-audio"),
-		GCSBucketImages: getEnv("GCS_BUCKET_IMAGES", "voicecraft-market-images"),
+		GCSBucketName:    getEnv("GCS_BUCKET_NAME", "voicecraft-market-uploads"),
+		GCSBucketAudio:   getEnv("GCS_BUCKET_AUDIO", "voicecraft-market-audio"),
+		GCSBucketImages:  getEnv("GCS_BUCKET_IMAGES", "voicecraft-market-images"),
+		GCSUniformAccess: getBoolEnv("GCS_UNIFORM_ACCESS", false),
+		SignedURLExpiry:  getEnv("SIGNED_URL_EXPIRY", "15m"),
 
 		// Google AI Services
-		SpeechToTextModel: getEnv("SPEECH_TO_TEXT_MODEL", "latest_long"),
-		VertexAILocation:  getEnv("VERTEX_AI_LOCATION", "us-central1"),
-		VertexAIModel:     getEnv("VERTEX_AI_MODEL", "gemini-1.5-pro"),
+		SpeechToTextModel:    getEnv("SPEECH_TO_TEXT_MODEL", "latest_long"),
+		VertexAILocation:     getEnv("VERTEX_AI_LOCATION", "us-central1"),
+		VertexAIModel:        getEnv("VERTEX_AI_MODEL", "gemini-1.5-pro"),
+		PromptTemplateSource: getEnv("PROMPT_TEMPLATE_SOURCE", "firestore"),
+		PromptTemplatesFile:  getEnv("PROMPT_TEMPLATES_FILE", ""),
 
 		// API Keys
 		WhatsAppAPIKey:  getEnv("WHATSAPP_API_KEY", ""),
 		InstagramAPIKey: getEnv("INSTAGRAM_API_KEY", ""),
 
+		// Payments
+		PaymentProvider:       getEnv("PAYMENT_PROVIDER", "razorpay"),
+		PaymentExpiry:         getEnv("PAYMENT_EXPIRY", "15m"),
+		AllowFakePayments:     getBoolEnv("ALLOW_FAKE_PAYMENTS", false),
+		FakePaymentSecret:     getEnv("FAKE_PAYMENT_SECRET", ""),
+		RazorpayKeyID:         getEnv("RAZORPAY_KEY_ID", ""),
+		RazorpayKeySecret:     getEnv("RAZORPAY_KEY_SECRET", ""),
+		RazorpayWebhookSecret: getEnv("RAZORPAY_WEBHOOK_SECRET", ""),
+
+		// Shipment tracking
+		TrackingPollInterval: getEnv("TRACKING_POLL_INTERVAL", "30m"),
+		FakeCarrierEnabled:   getBoolEnv("FAKE_CARRIER_ENABLED", false),
+		FakeCarrierSecret:    getEnv("FAKE_CARRIER_SECRET", ""),
+
+		// Shipping rates
+		ShippingRatesFile: getEnv("SHIPPING_RATES_FILE", ""),
+
+		// GST rates
+		TaxRatesFile: getEnv("TAX_RATES_FILE", ""),
+
+		// Currencies
+		BaseCurrency:       getEnv("BASE_CURRENCY", "INR"),
+		CurrencyRateSource: getEnv("CURRENCY_RATE_SOURCE", "firestore"),
+		ExchangeRatesFile:  getEnv("EXCHANGE_RATES_FILE", ""),
+
 		// CORS Configuration
 		CORSOrigins: getSliceEnv("CORS_ORIGINS", []string{"http://localhost:5173", "http://localhost:3000"}),
 
@@ -105,8 +192,26 @@ func Load() *Config {
 		// File Upload Limits
 		MaxAudioSize:      getEnv("MAX_AUDIO_SIZE", "50MB"),
 		MaxImageSize:      getEnv("MAX_IMAGE_SIZE", "10MB"),
-		AllowedAudioTypes: getSliceEnv("ALLOWED_AUDIO_TYPES", []string{"audio/mpeg", "audio/wav", "audio/mp3", "audio/m4a"}),
+		AllowedAudioTypes: getSliceEnv("ALLOWED_AUDIO_TYPES", []string{"audio/mpeg", "audio/wav", "audio/mp3", "audio/m4a", "audio/flac", "audio/webm"}),
 		AllowedImageTypes: getSliceEnv("ALLOWED_IMAGE_TYPES", []string{"image/jpeg", "image/png", "image/webp"}),
+		MaxImageDimension: getIntEnv("MAX_IMAGE_DIMENSION", 12000),
+		MaxImagePixels:    getIntEnv("MAX_IMAGE_PIXELS", 50000000),
+
+		// Direct uploads
+		UploadSessionExpiry: getEnv("UPLOAD_SESSION_EXPIRY", "1h"),
+
+		// Malware scanning
+		MalwareScanner: getEnv("MALWARE_SCANNER", ""),
+		ClamdAddress:   getEnv("CLAMD_ADDRESS", "localhost:3310"),
+
+		// Image processing
+		ImageWebPEncoder:       getEnv("IMAGE_WEBP_ENCODER", ""),
+		ImageEnhancer:          getEnv("IMAGE_ENHANCER", "basic"),
+		ImagenEditModel:        getEnv("IMAGEN_EDIT_MODEL", "imagen-3.0-capability-001"),
+		ImageGenerator:         getEnv("IMAGE_GENERATOR", ""),
+		ImagenModel:            getEnv("IMAGEN_MODEL", "imagen-3.0-generate-002"),
+		AllowPlaceholderImages: getBoolEnv("ALLOW_PLACEHOLDER_IMAGES", false),
+		ImageGCInterval:        getEnv("IMAGE_GC_INTERVAL", "24h"),
 
 		// JWT Configuration
 		JWTSecret: getEnv("JWT_SECRET", "your_jwt_secret_key_here"),
@@ -147,6 +252,29 @@ func getSliceEnv(key string, defaultValue []string) []string {
 	return defaultValue
 }
 
+// ParseSize reads a size such as "10MB", "512KB", "1GB" or a plain number of bytes.
+// Units are binary, so "1MB" is 1048576 bytes.
+func ParseSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return size * multiplier, nil
+}
+
 func getBoolEnv(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
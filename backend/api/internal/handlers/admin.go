@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/models"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	firestoreService    *services.FirestoreService
+	notificationService *services.NotificationService
+}
+
+func NewAdminHandler(firestoreService *services.FirestoreService, notificationService *services.NotificationService) *AdminHandler {
+	return &AdminHandler{
+		firestoreService:    firestoreService,
+		notificationService: notificationService,
+	}
+}
+
+// GetStats returns marketplace metrics aggregated over a date range.
+// Query parameters: from and to (YYYY-MM-DD, default the last 30 days) and top (default 10).
+func (h *AdminHandler) GetStats(c *gin.Context) {
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	top, _ := strconv.Atoi(c.DefaultQuery("top", "10"))
+	if top < 1 || top > 100 {
+		top = 10
+	}
+
+	stats, err := h.firestoreService.GetMarketplaceStats(from, to, top)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stats": stats})
+}
+
+// GetPendingProducts retrieves the moderation queue, oldest submissions first
+func (h *AdminHandler) GetPendingProducts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	filters := map[string]interface{}{
+		"status": models.ProductStatusPendingReview,
+	}
+
+	products, total, err := h.firestoreService.GetProductsWithFilters(filters, "created_at", "asc", limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pending products"})
+		return
+	}
+
+	totalPages := (total + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"products": products,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+			"has_next":    page < totalPages,
+			"has_prev":    page > 1,
+		},
+	})
+}
+
+// ApproveProduct publishes a product that is awaiting review
+func (h *AdminHandler) ApproveProduct(c *gin.Context) {
+	var request struct {
+		Reason string `json:"reason"`
+	}
+
+	// The body is optional for approvals
+	_ = c.ShouldBindJSON(&request)
+
+	h.moderateProduct(c, models.ModerationActionApprove, request.Reason)
+}
+
+// RejectProduct rejects a product with a reason shown to the artisan
+func (h *AdminHandler) RejectProduct(c *gin.Context) {
+	var request struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A rejection reason is required"})
+		return
+	}
+
+	h.moderateProduct(c, models.ModerationActionReject, request.Reason)
+}
+
+// RequestProductChanges sends a product back to the artisan for edits
+func (h *AdminHandler) RequestProductChanges(c *gin.Context) {
+	var request struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A description of the requested changes is required"})
+		return
+	}
+
+	h.moderateProduct(c, models.ModerationActionRequestChanges, request.Reason)
+}
+
+// GetProductModerationHistory returns the audit trail of moderation decisions for a product
+func (h *AdminHandler) GetProductModerationHistory(c *gin.Context) {
+	productID := c.Param("id")
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product ID is required"})
+		return
+	}
+
+	logs, err := h.firestoreService.GetModerationLogs(productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": productID,
+		"history":    logs,
+	})
+}
+
+func (h *AdminHandler) moderateProduct(c *gin.Context, action models.ModerationAction, reason string) {
+	adminID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	productID := c.Param("id")
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product ID is required"})
+		return
+	}
+
+	if _, err := h.firestoreService.GetProduct(productID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	product, entry, published, err := h.firestoreService.ModerateProduct(productID, adminID, action, reason)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidModerationTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record moderation decision"})
+		return
+	}
+
+	// Re-approving an edited listing does not announce it again
+	if published {
+		go h.firestoreService.RecordProductPublished()
+		go notifyFollowers(h.firestoreService, h.notificationService, product.ArtisanID, "new_product")
+	}
+
+	go notifyUser(h.firestoreService, product.ArtisanID, func(token string) error {
+		return h.notificationService.SendModerationNotification(token, product.ID, product.Title, string(action), reason)
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"product":    product,
+		"moderation": entry,
+	})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"regexp"
 	"strconv"
 
 	"voicecraft-market/internal/middleware"
@@ -11,15 +12,20 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// gstinPattern matches a GSTIN: state code, PAN, entity number, "Z" and check character
+var gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+
 type ArtisanHandler struct {
 	firestoreService *services.FirestoreService
 	storageService   *services.StorageService
+	uploadValidator  *services.UploadValidator
 }
 
-func NewArtisanHandler(firestoreService *services.FirestoreService, storageService *services.StorageService) *ArtisanHandler {
+func NewArtisanHandler(firestoreService *services.FirestoreService, storageService *services.StorageService, uploadValidator *services.UploadValidator) *ArtisanHandler {
 	return &ArtisanHandler{
 		firestoreService: firestoreService,
 		storageService:   storageService,
+		uploadValidator:  uploadValidator,
 	}
 }
 
@@ -90,6 +96,7 @@ func (h *ArtisanHandler) GetArtisan(c *gin.Context) {
 	// Get artisan's products
 	filters := map[string]interface{}{
 		"artisan_id": artisanID,
+		"status":     models.PublicProductStatuses,
 	}
 
 	products, _, err := h.firestoreService.GetProductsWithFilters(filters, "created_at", "desc", 10, 0)
@@ -139,12 +146,46 @@ func (h *ArtisanHandler) UpdateArtisanProfile(c *gin.Context) {
 	delete(updates, "id")
 	delete(updates, "user_id")
 	delete(updates, "created_at")
+	delete(updates, "rating")
+	delete(updates, "review_count")
+	delete(updates, "rating_sum")
+	delete(updates, "follower_count")
+	delete(updates, "total_sales")
+
+	if postalCode, ok := updates["postal_code"]; ok {
+		code, isString := postalCode.(string)
+		if !isString || (code != "" && !services.ValidPostalCode(code)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "postal_code must be a 6-digit PIN code"})
+			return
+		}
+	}
+	if gstin, ok := updates["gstin"]; ok {
+		value, isString := gstin.(string)
+		if !isString || (value != "" && !gstinPattern.MatchString(value)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "gstin must be a 15-character GSTIN"})
+			return
+		}
+	}
+	if threshold, ok := updates["free_shipping_threshold"]; ok {
+		if value, isNumber := threshold.(float64); !isNumber || value < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "free_shipping_threshold must be a non-negative amount"})
+			return
+		}
+	}
+	if capacity, ok := updates["made_to_order_capacity"]; ok {
+		value, isNumber := capacity.(float64)
+		if !isNumber || value < 0 || value != float64(int(value)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "made_to_order_capacity must be a whole number (0 for no limit)"})
+			return
+		}
+		updates["made_to_order_capacity"] = int(value)
+	}
 
 	// Check if artisan profile exists
 	existingArtisan, err := h.firestoreService.GetArtisan(userID)
 	if err != nil {
-		// Create new artisan profile
-		artisan := models.ArtisanProfile{}
+		// Create new artisan profile keyed by the user's ID
+		artisan := models.ArtisanProfile{ID: userID}
 
 		// Apply updates to new profile
 		if craft, ok := updates["craft"]; ok {
@@ -156,6 +197,21 @@ func (h *ArtisanHandler) UpdateArtisanProfile(c *gin.Context) {
 		if location, ok := updates["location"]; ok {
 			artisan.Location = location.(string)
 		}
+		if postalCode, ok := updates["postal_code"]; ok {
+			artisan.PostalCode = postalCode.(string)
+		}
+		if state, ok := updates["state"].(string); ok {
+			artisan.State = state
+		}
+		if gstin, ok := updates["gstin"]; ok {
+			artisan.GSTIN = gstin.(string)
+		}
+		if threshold, ok := updates["free_shipping_threshold"]; ok {
+			artisan.FreeShippingThreshold = threshold.(float64)
+		}
+		if capacity, ok := updates["made_to_order_capacity"]; ok {
+			artisan.MadeToOrderCapacity = capacity.(int)
+		}
 		if specialties, ok := updates["specialties"]; ok {
 			if specArray, ok := specialties.([]interface{}); ok {
 				artisan.Specialties = make([]string, len(specArray))
@@ -172,6 +228,9 @@ func (h *ArtisanHandler) UpdateArtisanProfile(c *gin.Context) {
 		}
 
 		artisan.ID = artisanID
+
+		go h.firestoreService.RecordUserSignup(models.RoleArtisan)
+
 		c.JSON(http.StatusCreated, gin.H{"artisan": artisan})
 		return
 	}
@@ -202,22 +261,21 @@ func (h *ArtisanHandler) UploadArtisanAvatar(c *gin.Context) {
 	}
 
 	// Handle file upload
-	file, header, err := c.Request.FormFile("avatar")
+	header, err := c.FormFile("avatar")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar file is required"})
 		return
 	}
-	defer file.Close()
 
-	// Validate file type
-	allowedTypes := []string{"jpeg", "jpg", "png", "webp"}
-	if !h.storageService.ValidateFileType(header.Filename, allowedTypes) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only JPEG, PNG, and WebP are allowed"})
+	// Validate the image from its content
+	avatar, err := h.uploadValidator.ValidateImage(c.Request.Context(), header)
+	if err != nil {
+		uploadError(c, header.Filename, err)
 		return
 	}
 
 	// Upload to storage
-	result, err := h.storageService.UploadImage(file, header, userID)
+	result, err := h.storageService.UploadImage(avatar, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload avatar"})
 		return
@@ -246,3 +304,65 @@ func (h *ArtisanHandler) UploadArtisanAvatar(c *gin.Context) {
 		"avatar_url": result.URL,
 	})
 }
+
+// GetAnalytics returns the current artisan's views, likes, orders, revenue and
+// conversion over a date range (from/to query parameters), with a per-product breakdown
+func (h *ArtisanHandler) GetAnalytics(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	analytics, err := h.firestoreService.GetArtisanAnalytics(userID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"analytics": analytics})
+}
+
+// GetProductAnalytics returns the daily time series for one of the current artisan's products
+func (h *ArtisanHandler) GetProductAnalytics(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	productID := c.Param("id")
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product ID is required"})
+		return
+	}
+
+	product, err := h.firestoreService.GetProduct(productID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if product.ArtisanID != userID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only view analytics for your own products"})
+		return
+	}
+
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	analytics, err := h.firestoreService.GetProductAnalytics(product, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"analytics": analytics})
+}
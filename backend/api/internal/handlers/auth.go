@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -62,6 +63,8 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 			return
 		}
 
+		go h.firestoreService.RecordUserSignup(newUser.Role)
+
 		user, _ = h.firestoreService.GetUser(userID)
 	}
 
@@ -86,6 +89,15 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 	delete(updates, "id")
 	delete(updates, "created_at")
 
+	if currency, ok := updates["preferred_currency"]; ok && currency != "" {
+		code, err := services.NormalizeCurrency(fmt.Sprint(currency))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["preferred_currency"] = code
+	}
+
 	// If this is a new user signup with artisan profile, update role
 	if artisanProfile, ok := updates["artisan_profile"].(map[string]interface{}); ok && artisanProfile != nil {
 		updates["role"] = "artisan"
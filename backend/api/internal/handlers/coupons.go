@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/models"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CouponHandler struct {
+	firestoreService    *services.FirestoreService
+	notificationService *services.NotificationService
+	pricing             *services.OrderPricing
+}
+
+func NewCouponHandler(firestoreService *services.FirestoreService, notificationService *services.NotificationService, pricing *services.OrderPricing) *CouponHandler {
+	return &CouponHandler{
+		firestoreService:    firestoreService,
+		notificationService: notificationService,
+		pricing:             pricing,
+	}
+}
+
+// CreateArtisanCoupon creates a coupon for the artisan's own products (artisan only)
+func (h *CouponHandler) CreateArtisanCoupon(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	h.createCoupon(c, userID, userID)
+}
+
+// CreatePlatformCoupon creates a coupon that applies across artisans (admin only)
+func (h *CouponHandler) CreatePlatformCoupon(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	h.createCoupon(c, "", userID)
+}
+
+func (h *CouponHandler) createCoupon(c *gin.Context, artisanID, createdBy string) {
+	var coupon models.Coupon
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	coupon.Code = services.NormalizeCouponCode(coupon.Code)
+	coupon.ArtisanID = artisanID
+	coupon.CreatedBy = createdBy
+	coupon.Currency = h.pricing.Currency.Base()
+	if err := services.ValidateCoupon(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.firestoreService.CreateCoupon(&coupon); err != nil {
+		if errors.Is(err, services.ErrCouponExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create coupon"})
+		return
+	}
+
+	// Let followers know about artisan offers that can be used right away
+	now := time.Now()
+	if artisanID != "" && coupon.Active && (coupon.StartsAt == nil || !coupon.StartsAt.After(now)) {
+		go notifyFollowers(h.firestoreService, h.notificationService, artisanID, "special_offer")
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"coupon": coupon})
+}
+
+// GetArtisanCoupons lists the artisan's own coupons (artisan only)
+func (h *CouponHandler) GetArtisanCoupons(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	coupons, err := h.firestoreService.GetCoupons(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"coupons": coupons})
+}
+
+// GetAllCoupons lists coupons, optionally for one artisan or artisan_id=platform (admin only)
+func (h *CouponHandler) GetAllCoupons(c *gin.Context) {
+	coupons, err := h.firestoreService.GetCoupons(c.Query("artisan_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"coupons": coupons})
+}
+
+// UpdateCoupon changes a coupon's terms or deactivates it. Artisans can update their own
+// coupons and admins any coupon; the code, owner and usage count cannot change.
+func (h *CouponHandler) UpdateCoupon(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	existing, err := h.firestoreService.GetCoupon(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	if existing.ArtisanID != userID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own coupons"})
+		return
+	}
+
+	// Fields missing from the request keep their current values
+	coupon := *existing
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	coupon.ID = existing.ID
+	coupon.Code = existing.Code
+	coupon.ArtisanID = existing.ArtisanID
+	coupon.Currency = existing.Currency
+	coupon.UsedCount = existing.UsedCount
+	coupon.CreatedBy = existing.CreatedBy
+	coupon.CreatedAt = existing.CreatedAt
+
+	if err := services.ValidateCoupon(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.firestoreService.UpdateCoupon(&coupon); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"coupon": coupon})
+}
+
+// ValidateCoupon previews a coupon against a cart without redeeming it
+func (h *CouponHandler) ValidateCoupon(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var request struct {
+		Code  string `json:"code" binding:"required"`
+		Items []struct {
+			ProductID string `json:"product_id" binding:"required"`
+			VariantID string `json:"variant_id"`
+			Quantity  int    `json:"quantity" binding:"required,min=1"`
+		} `json:"items" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and items (product_id, quantity) are required"})
+		return
+	}
+
+	items := make([]models.OrderItem, 0, len(request.Items))
+	for _, item := range request.Items {
+		items = append(items, models.OrderItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
+	}
+
+	coupon, items, discount, err := h.firestoreService.PreviewCoupon(request.Code, userID, items, h.pricing)
+	if err != nil {
+		if errors.Is(err, services.ErrCouponRejected) || errors.Is(err, services.ErrProductUnavailable) ||
+			errors.Is(err, services.ErrNoExchangeRate) {
+			c.JSON(http.StatusBadRequest, gin.H{"valid": false, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":          true,
+		"code":           coupon.Code,
+		"type":           coupon.Type,
+		"description":    coupon.Description,
+		"currency":       h.pricing.Currency.Base(),
+		"items":          items,
+		"discount_total": discount,
+		"free_shipping":  coupon.Type == models.CouponTypeFreeShipping,
+	})
+}
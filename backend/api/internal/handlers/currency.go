@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/models"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CurrencyHandler struct {
+	currencyService *services.CurrencyService
+}
+
+func NewCurrencyHandler(currencyService *services.CurrencyService) *CurrencyHandler {
+	return &CurrencyHandler{currencyService: currencyService}
+}
+
+// GetCurrencies lists the currencies prices can be displayed in and the current rates
+func (h *CurrencyHandler) GetCurrencies(c *gin.Context) {
+	rates, err := h.currencyService.Rates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load exchange rates"})
+		return
+	}
+
+	available := []string{h.currencyService.Base()}
+	for currency := range rates.Rates {
+		if currency != h.currencyService.Base() {
+			available = append(available, currency)
+		}
+	}
+	sort.Strings(available[1:])
+
+	c.JSON(http.StatusOK, gin.H{
+		"base":       h.currencyService.Base(),
+		"currencies": available,
+		"rates":      rates,
+	})
+}
+
+// GetExchangeRates returns the exchange rates in use (admin only)
+func (h *CurrencyHandler) GetExchangeRates(c *gin.Context) {
+	rates, err := h.currencyService.Rates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load exchange rates"})
+		return
+	}
+
+	supported := services.SupportedCurrencies()
+	sort.Strings(supported)
+
+	c.JSON(http.StatusOK, gin.H{
+		"rates":     rates,
+		"source":    h.currencyService.Source().Name(),
+		"supported": supported,
+	})
+}
+
+// UpdateExchangeRates replaces the admin-entered exchange rates (admin only)
+func (h *CurrencyHandler) UpdateExchangeRates(c *gin.Context) {
+	var request struct {
+		Rates map[string]float64 `json:"rates" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rates are required"})
+		return
+	}
+
+	rates, err := h.currencyService.SetRates(c.Request.Context(), &services.ExchangeRates{
+		Base:  h.currencyService.Base(),
+		Rates: request.Rates,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrReadOnlyRates) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Exchange rates are loaded from a file; set CURRENCY_RATE_SOURCE=firestore to edit them"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rates": rates})
+}
+
+// displayCurrency picks the currency to show prices in: the currency query parameter,
+// then the X-Currency header, then the signed-in buyer's preference. An empty result
+// means prices are shown as listed.
+func displayCurrency(c *gin.Context, firestoreService *services.FirestoreService) (string, error) {
+	requested := c.Query("currency")
+	if requested == "" {
+		requested = c.GetHeader("X-Currency")
+	}
+	if requested == "" {
+		if userID, err := middleware.GetUserID(c); err == nil {
+			if user, err := firestoreService.GetUser(userID); err == nil {
+				requested = user.PreferredCurrency
+			}
+		}
+	}
+	if requested == "" {
+		return "", nil
+	}
+	return services.NormalizeCurrency(requested)
+}
+
+// setDisplayPrices converts product prices into the display currency. Products whose
+// currency has no exchange rate keep only their listed price.
+func setDisplayPrices(rates *services.ExchangeRates, currency string, products ...*models.Product) {
+	if rates == nil || currency == "" {
+		return
+	}
+	for _, product := range products {
+		if display, err := rates.Convert(services.ProductPrice(product), currency); err == nil {
+			product.DisplayPrice = &display
+		}
+		for i, variant := range product.Variants {
+			if variant.PriceMinor == 0 {
+				continue
+			}
+			if display, err := rates.Convert(services.VariantPrice(product, variant.ID), currency); err == nil {
+				product.Variants[i].DisplayPrice = &display
+			}
+		}
+	}
+}
+
+// catalogueRates resolves the display currency for a catalogue request and the rates to
+// convert with, writing a 400 response for unsupported currencies
+func catalogueRates(c *gin.Context, firestoreService *services.FirestoreService, currencyService *services.CurrencyService) (*services.ExchangeRates, string, bool) {
+	currency, err := displayCurrency(c, firestoreService)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+	if currency == "" {
+		return nil, "", true
+	}
+
+	rates, err := currencyService.Rates(c.Request.Context())
+	if err != nil {
+		// Listed prices are still correct; only the conversion is missing
+		return nil, currency, true
+	}
+	return rates, currency, true
+}
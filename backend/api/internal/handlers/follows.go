@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FollowHandler struct {
+	firestoreService *services.FirestoreService
+}
+
+func NewFollowHandler(firestoreService *services.FirestoreService) *FollowHandler {
+	return &FollowHandler{
+		firestoreService: firestoreService,
+	}
+}
+
+// FollowArtisan follows an artisan for the authenticated user
+func (h *FollowHandler) FollowArtisan(c *gin.Context) {
+	h.setFollow(c, true)
+}
+
+// UnfollowArtisan removes the authenticated user's follow of an artisan
+func (h *FollowHandler) UnfollowArtisan(c *gin.Context) {
+	h.setFollow(c, false)
+}
+
+func (h *FollowHandler) setFollow(c *gin.Context, follow bool) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	artisanID := c.Param("id")
+	if artisanID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Artisan ID is required"})
+		return
+	}
+
+	if _, err := h.firestoreService.GetArtisan(artisanID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Artisan not found"})
+		return
+	}
+
+	changed, err := h.firestoreService.SetFollow(userID, artisanID, follow)
+	if err != nil {
+		if errors.Is(err, services.ErrCannotFollowSelf) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update follow"})
+		return
+	}
+
+	artisan, err := h.firestoreService.GetArtisan(artisanID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch artisan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"artisan_id":     artisanID,
+		"following":      follow,
+		"changed":        changed,
+		"follower_count": artisan.FollowerCount,
+	})
+}
+
+// GetFollowing lists the artisans the authenticated user follows
+func (h *FollowHandler) GetFollowing(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	follows, err := h.firestoreService.GetFollowing(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch followed artisans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"following": follows,
+		"total":     len(follows),
+	})
+}
+
+// GetFeed lists recent products from the artisans the authenticated user follows.
+// Query parameters: limit (default 20) and cursor (the next_cursor of the previous page).
+func (h *FollowHandler) GetFeed(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	products, nextCursor, err := h.firestoreService.GetFollowingFeed(userID, c.Query("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"products":    products,
+		"next_cursor": nextCursor,
+		"has_next":    nextCursor != "",
+	})
+}
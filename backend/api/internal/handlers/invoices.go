@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/models"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InvoiceHandler struct {
+	firestoreService *services.FirestoreService
+	invoiceService   *services.InvoiceService
+}
+
+func NewInvoiceHandler(firestoreService *services.FirestoreService, invoiceService *services.InvoiceService) *InvoiceHandler {
+	return &InvoiceHandler{
+		firestoreService: firestoreService,
+		invoiceService:   invoiceService,
+	}
+}
+
+// GetOrderInvoices lists an order's GST invoices. Buyers and admins see every
+// invoice; artisans see the invoices for their own items.
+func (h *InvoiceHandler) GetOrderInvoices(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	orderID := c.Param("id")
+	if orderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+		return
+	}
+
+	order, err := h.firestoreService.GetOrder(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	sellsOnOrder := false
+	for _, item := range order.Items {
+		if item.ArtisanID == userID {
+			sellsOnOrder = true
+		}
+	}
+	fullAccess := order.BuyerID == userID || middleware.IsAdmin(c)
+	if !fullAccess && !sellsOnOrder {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only view invoices for your own orders"})
+		return
+	}
+
+	invoices, err := h.invoiceService.GetOrderInvoices(order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoices"})
+		return
+	}
+
+	if !fullAccess {
+		own := []models.Invoice{}
+		for _, invoice := range invoices {
+			if invoice.ArtisanID == userID {
+				own = append(own, invoice)
+			}
+		}
+		invoices = own
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id": orderID,
+		"invoices": invoices,
+	})
+}
+
+// DownloadInvoice returns an invoice as a PDF to the order's buyer, the issuing artisan or an admin
+func (h *InvoiceHandler) DownloadInvoice(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	invoiceID := c.Param("id")
+	if invoiceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invoice ID is required"})
+		return
+	}
+
+	invoice, err := h.firestoreService.GetInvoice(invoiceID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+
+	if invoice.BuyerID != userID && invoice.ArtisanID != userID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only download your own invoices"})
+		return
+	}
+
+	fileName := strings.ReplaceAll(invoice.Number, "/", "-") + ".pdf"
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="invoice-%s"`, fileName))
+	c.Data(http.StatusOK, "application/pdf", h.invoiceService.PDF(invoice))
+}
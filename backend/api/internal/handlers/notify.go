@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"log"
+
+	"voicecraft-market/internal/services"
+)
+
+// notifyUser looks up the user's device token and passes it to send.
+// Users without a registered token are skipped and failures are only logged,
+// so notifications never fail the request that triggered them.
+func notifyUser(firestoreService *services.FirestoreService, userID string, send func(token string) error) {
+	user, err := firestoreService.GetUser(userID)
+	if err != nil || user.FCMToken == "" {
+		return
+	}
+
+	if err := send(user.FCMToken); err != nil {
+		log.Printf("Failed to notify user %s: %v", userID, err)
+	}
+}
+
+// notifyBackInStock tells followers of each product's artisan, and buyers who saved it to a
+// wishlist, that a sold-out product is available again
+func notifyBackInStock(firestoreService *services.FirestoreService, notificationService *services.NotificationService, wishlistWatcher *services.WishlistWatcher, productIDs []string) {
+	for _, productID := range productIDs {
+		if product, err := firestoreService.GetProduct(productID); err == nil && product.Status.IsPublic() {
+			go notifyFollowers(firestoreService, notificationService, product.ArtisanID, "back_in_stock")
+			go wishlistWatcher.StockChanged(productID, 0)
+		}
+	}
+}
+
+// notifyFollowers sends an artisan notification ("new_product", "back_in_stock", ...)
+// to every follower of the artisan who has a registered device token
+func notifyFollowers(firestoreService *services.FirestoreService, notificationService *services.NotificationService, artisanID, action string) {
+	followerIDs, err := firestoreService.GetFollowerIDs(artisanID)
+	if err != nil {
+		log.Printf("Failed to load followers of artisan %s: %v", artisanID, err)
+		return
+	}
+
+	tokens, err := firestoreService.GetUserTokens(followerIDs)
+	if err != nil {
+		log.Printf("Failed to load device tokens for followers of artisan %s: %v", artisanID, err)
+		return
+	}
+
+	artisanName := "An artisan you follow"
+	if artisan, err := firestoreService.GetUser(artisanID); err == nil && artisan.Name != "" {
+		artisanName = artisan.Name
+	}
+
+	for _, token := range tokens {
+		if err := notificationService.SendArtisanNotification(token, artisanName, action); err != nil {
+			log.Printf("Failed to send %s notification for artisan %s: %v", action, artisanID, err)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"voicecraft-market/internal/middleware"
 	"voicecraft-market/internal/models"
@@ -11,15 +16,30 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// shipmentRequest describes the parcel an artisan hands to a carrier
+type shipmentRequest struct {
+	Carrier           string     `json:"carrier"`
+	TrackingNumber    string     `json:"tracking_number"`
+	EstimatedDelivery *time.Time `json:"estimated_delivery"`
+}
+
 type OrderHandler struct {
 	firestoreService    *services.FirestoreService
 	notificationService *services.NotificationService
+	paymentService      *services.PaymentService
+	trackingService     *services.TrackingService
+	pricing             *services.OrderPricing
+	wishlistWatcher     *services.WishlistWatcher
 }
 
-func NewOrderHandler(firestoreService *services.FirestoreService, notificationService *services.NotificationService) *OrderHandler {
+func NewOrderHandler(firestoreService *services.FirestoreService, notificationService *services.NotificationService, paymentService *services.PaymentService, trackingService *services.TrackingService, pricing *services.OrderPricing, wishlistWatcher *services.WishlistWatcher) *OrderHandler {
 	return &OrderHandler{
 		firestoreService:    firestoreService,
 		notificationService: notificationService,
+		paymentService:      paymentService,
+		trackingService:     trackingService,
+		pricing:             pricing,
+		wishlistWatcher:     wishlistWatcher,
 	}
 }
 
@@ -122,55 +142,57 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Set user ID and status
-	order.BuyerID = userID
-	order.Status = "pending"
-
-	// Calculate total amount
-	var totalAmount float64
-	for i, item := range order.Items {
-		// Get product to verify price and availability
-		product, err := h.firestoreService.GetProduct(item.ProductID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found: " + item.ProductID})
-			return
-		}
-
-		if product.Stock < item.Quantity {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock for product: " + product.Title})
+	for _, item := range order.Items {
+		if item.ProductID == "" || item.Quantity < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each item needs a product ID and a quantity of at least 1"})
 			return
 		}
-
-		// Set correct price from product
-		order.Items[i].Price = product.Price
-		totalAmount += product.Price * float64(item.Quantity)
 	}
 
-	order.TotalAmount = totalAmount
-
-	// Create order in Firestore
-	orderID, err := h.firestoreService.CreateOrder(&order)
+	// Orders are charged in the base currency; the total is also shown in the buyer's currency
+	if order.DisplayCurrency != "" {
+		order.DisplayCurrency, err = services.NormalizeCurrency(order.DisplayCurrency)
+	} else {
+		order.DisplayCurrency, err = displayCurrency(c, h.firestoreService)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	order.ID = orderID
+	// Set user ID; prices, shipping, tax, totals and status are set when the order is stored
+	order.BuyerID = userID
 
-	// Update product stock
-	for _, item := range order.Items {
-		err := h.firestoreService.UpdateProductStock(item.ProductID, -item.Quantity)
-		if err != nil {
-			// Log error but don't fail the order creation
-			// In production, this should be handled with transactions
-			// TODO: Implement proper transaction handling
+	// Create the order and reserve its stock until payment is captured
+	if err := h.firestoreService.CreateOrderWithReservation(&order, h.pricing); err != nil {
+		if errors.Is(err, services.ErrProductUnavailable) || errors.Is(err, services.ErrInsufficientStock) ||
+			errors.Is(err, services.ErrInvalidPostalCode) || errors.Is(err, services.ErrNoExchangeRate) ||
+			errors.Is(err, services.ErrCouponRejected) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrMadeToOrderCapacity) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
 	}
 
-	// Send notification to user
-	// TODO: Get user's FCM token and send notification
+	// Open the payment; without one the order can never be confirmed, so release it
+	payment, err := h.paymentService.StartPayment(c.Request.Context(), &order)
+	if err != nil {
+		if _, _, releaseErr := h.firestoreService.ReleaseOrderReservation(order.ID, models.PaymentStatusCancelled); releaseErr != nil {
+			log.Printf("Failed to release reservation for order %s: %v", order.ID, releaseErr)
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to start payment"})
+		return
+	}
 
-	c.JSON(http.StatusCreated, gin.H{"order": order})
+	c.JSON(http.StatusCreated, gin.H{
+		"order":   order,
+		"payment": payment,
+	})
 }
 
 // CancelOrder cancels an order
@@ -205,27 +227,37 @@ func (h *OrderHandler) CancelOrder(c *gin.Context) {
 		return
 	}
 
-	// Update order status
-	updates := map[string]interface{}{
-		"status": "cancelled",
+	// Unpaid orders only hold a stock reservation, which is released with the cancellation
+	if order.Status == models.OrderStatusPending && order.PaymentStatus != models.PaymentStatusCaptured {
+		if _, err := h.paymentService.CancelUnpaidOrder(orderID); err != nil {
+			if errors.Is(err, services.ErrPaymentNotPending) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Order cannot be cancelled"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Order cancelled successfully"})
+		return
 	}
 
-	err = h.firestoreService.UpdateOrder(orderID, updates)
+	// Paid orders are cancelled and refunded in full together; the refund restores the stock
+	_, refund, restocked, err := h.paymentService.CancelPaidOrder(orderID, services.OrderCancellation{
+		BuyerID: userID,
+		Reason:  "Order cancelled by buyer",
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+		cancelError(c, err)
 		return
 	}
 
-	// Restore product stock
-	for _, item := range order.Items {
-		err := h.firestoreService.UpdateProductStock(item.ProductID, item.Quantity)
-		if err != nil {
-			// Log error but don't fail the cancellation
-			// TODO: Implement proper transaction handling
-		}
-	}
+	notifyBackInStock(h.firestoreService, h.notificationService, h.wishlistWatcher, restocked)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order cancelled successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Order cancelled successfully",
+		"refund":  refund,
+	})
 }
 
 // GetArtisanOrders retrieves orders for the authenticated artisan
@@ -286,7 +318,8 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	}
 
 	var request struct {
-		Status string `json:"status" binding:"required"`
+		Status   string           `json:"status" binding:"required"`
+		Shipment *shipmentRequest `json:"shipment"` // required when marking an order as shipped
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -295,7 +328,8 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	}
 
 	// Validate status
-	validStatuses := []string{"pending", "confirmed", "processing", "shipped", "delivered", "cancelled"}
+	// Orders are confirmed by payment capture, so artisans can only move them on from there
+	validStatuses := []string{"processing", "shipped", "delivered", "cancelled"}
 	isValidStatus := false
 	for _, status := range validStatuses {
 		if request.Status == status {
@@ -330,23 +364,175 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// Update order status
-	updates := map[string]interface{}{
-		"status": request.Status,
+	if order.Status == models.OrderStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is awaiting payment"})
+		return
 	}
 
-	err = h.firestoreService.UpdateOrder(orderID, updates)
+	if request.Status == string(models.OrderStatusShipped) {
+		h.shipOrder(c, order, userID, hasProduct, request.Shipment)
+		return
+	}
+
+	if request.Status == string(models.OrderStatusCancelled) {
+		h.cancelOrderItems(c, order, userID)
+		return
+	}
+
+	updated, changed, err := h.firestoreService.SetOrderStatus(orderID, models.OrderStatus(request.Status))
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidOrderTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Order cannot move from %s to %s", order.Status, request.Status)})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
 		return
 	}
 
-	// Send notification to user
-	// TODO: Get user's FCM token and send notification
+	if changed {
+		go h.firestoreService.RecordOrderStatusChange(request.Status)
+		go notifyUser(h.firestoreService, order.BuyerID, func(token string) error {
+			return h.notificationService.SendOrderNotification(token, orderID, request.Status)
+		})
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "Order status updated successfully",
 		"order_id": orderID,
-		"status":   request.Status,
+		"status":   updated.Status,
+	})
+}
+
+// cancelOrderItems cancels and refunds a seller's items on an order, and the order
+// itself once nothing else is left on it. Admins cancel the whole order.
+func (h *OrderHandler) cancelOrderItems(c *gin.Context, order *models.Order, userID string) {
+	cancellation := services.OrderCancellation{Reason: "Order cancelled by seller"}
+	if !middleware.IsAdmin(c) {
+		cancellation.ArtisanID = userID
+	}
+
+	updated, refund, restocked, err := h.paymentService.CancelPaidOrder(order.ID, cancellation)
+	if err != nil {
+		cancelError(c, err)
+		return
+	}
+
+	if updated.Status == models.OrderStatusCancelled {
+		go notifyUser(h.firestoreService, order.BuyerID, func(token string) error {
+			return h.notificationService.SendOrderNotification(token, order.ID, string(models.OrderStatusCancelled))
+		})
+	}
+	notifyBackInStock(h.firestoreService, h.notificationService, h.wishlistWatcher, restocked)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Order cancelled successfully",
+		"order_id": order.ID,
+		"status":   updated.Status,
+		"refund":   refund,
+	})
+}
+
+// cancelError writes the response for a failed cancellation of a paid order
+func cancelError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidOrderTransition), errors.Is(err, services.ErrRefundNotAllowed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Order cannot be cancelled in its current status"})
+	case errors.Is(err, services.ErrRefundInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": "A refund for this order is already in progress"})
+	case errors.Is(err, services.ErrNothingToCancel):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+	}
+}
+
+// StartProduction marks the artisan's made-to-order items on a paid order as being made
+// and tells the buyer (artisan only). Admins without items on the order start every item.
+func (h *OrderHandler) StartProduction(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	order, err := h.firestoreService.GetOrder(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	artisanID := userID
+	hasProduct := false
+	for _, item := range order.Items {
+		if item.ArtisanID == userID {
+			hasProduct = true
+			break
+		}
+	}
+	if !hasProduct {
+		if !middleware.IsAdmin(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only update orders containing your products"})
+			return
+		}
+		artisanID = ""
+	}
+
+	updated, err := h.firestoreService.StartProduction(order.ID, artisanID)
+	if err != nil {
+		if errors.Is(err, services.ErrNothingToProduce) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start production"})
+		return
+	}
+
+	if updated.Status != order.Status {
+		go h.firestoreService.RecordOrderStatusChange(string(updated.Status))
+	}
+	go notifyUser(h.firestoreService, order.BuyerID, func(token string) error {
+		return h.notificationService.SendOrderNotification(token, order.ID, "in_production")
+	})
+
+	c.JSON(http.StatusOK, gin.H{"order": updated})
+}
+
+// shipOrder registers a shipment for the seller's items and marks the order shipped.
+// Admins without items on the order ship every item.
+func (h *OrderHandler) shipOrder(c *gin.Context, order *models.Order, userID string, hasProduct bool, request *shipmentRequest) {
+	if request == nil || strings.TrimSpace(request.Carrier) == "" || strings.TrimSpace(request.TrackingNumber) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A shipment with carrier and tracking_number is required to mark an order as shipped"})
+		return
+	}
+
+	artisanID := userID
+	if !hasProduct {
+		artisanID = ""
+	}
+
+	shipment, updated, changed, err := h.trackingService.Ship(order, artisanID, request.Carrier, request.TrackingNumber, request.EstimatedDelivery)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotShippable), errors.Is(err, services.ErrShipmentExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidTrackingNumber), errors.Is(err, services.ErrNothingToShip):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ship order"})
+		}
+		return
+	}
+
+	if changed {
+		go h.firestoreService.RecordOrderStatusChange(string(models.OrderStatusShipped))
+		go notifyUser(h.firestoreService, order.BuyerID, func(token string) error {
+			return h.notificationService.SendOrderNotification(token, order.ID, string(models.OrderStatusShipped))
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Order shipped successfully",
+		"order":    updated,
+		"shipment": shipment,
 	})
 }
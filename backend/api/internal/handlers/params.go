@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseDateRange reads the from and to query parameters (YYYY-MM-DD, UTC).
+// Missing values default to the 30 days ending today. On invalid input it
+// writes a 400 response and returns ok=false.
+func parseDateRange(c *gin.Context) (from, to time.Time, ok bool) {
+	to = time.Now().UTC()
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return from, to, false
+		}
+		to = parsed
+	}
+
+	from = to.AddDate(0, 0, -29)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+			return from, to, false
+		}
+		from = parsed
+	}
+
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return from, to, false
+	}
+	if to.Sub(from) > 365*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date range cannot exceed one year"})
+		return from, to, false
+	}
+
+	return from, to, true
+}
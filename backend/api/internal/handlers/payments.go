@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBodySize bounds provider webhook payloads
+const maxWebhookBodySize = 1 << 20
+
+type PaymentHandler struct {
+	firestoreService *services.FirestoreService
+	paymentService   *services.PaymentService
+}
+
+func NewPaymentHandler(firestoreService *services.FirestoreService, paymentService *services.PaymentService) *PaymentHandler {
+	return &PaymentHandler{
+		firestoreService: firestoreService,
+		paymentService:   paymentService,
+	}
+}
+
+// VerifyPayment confirms an order with the signed result the checkout returned to the buyer
+func (h *PaymentHandler) VerifyPayment(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	orderID := c.Param("id")
+	if orderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+		return
+	}
+
+	var request struct {
+		PaymentOrderID string `json:"payment_order_id" binding:"required"`
+		PaymentID      string `json:"payment_id" binding:"required"`
+		Signature      string `json:"signature" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "payment_order_id, payment_id and signature are required"})
+		return
+	}
+
+	order, err := h.firestoreService.GetOrder(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if order.BuyerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only pay for your own orders"})
+		return
+	}
+
+	order, refund, err := h.paymentService.ConfirmCheckout(order, request.PaymentOrderID, request.PaymentID, request.Signature)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidSignature):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Payment could not be verified"})
+		case errors.Is(err, services.ErrPaymentNotPending):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm payment"})
+		}
+		return
+	}
+
+	if refund != nil {
+		// The buyer paid after the order was cancelled; the payment is being returned
+		c.JSON(http.StatusOK, gin.H{
+			"order":   order,
+			"refund":  refund,
+			"message": "This order was cancelled before your payment arrived, so the payment is being refunded",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"order": order})
+}
+
+// HandleWebhook receives payment events from the payment provider
+func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	if err := h.paymentService.HandleWebhook(c.Request.Header, body); err != nil {
+		if errors.Is(err, services.ErrInvalidSignature) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
+			return
+		}
+		// A non-2xx response makes the provider redeliver the event
+		log.Printf("Failed to process payment webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
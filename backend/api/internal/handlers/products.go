@@ -1,6 +1,10 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -12,19 +16,142 @@ import (
 )
 
 type ProductHandler struct {
-	firestoreService *services.FirestoreService
-	storageService   *services.StorageService
-	aiService        *services.VertexAIService
+	firestoreService    *services.FirestoreService
+	storageService      *services.StorageService
+	aiService           *services.VertexAIService
+	notificationService *services.NotificationService
+	currencyService     *services.CurrencyService
+	wishlistWatcher     *services.WishlistWatcher
+	imagePipeline       *services.ImagePipeline
+	uploadValidator     *services.UploadValidator
+	imageGeneration     *services.ImageGenerationService
 }
 
-func NewProductHandler(firestoreService *services.FirestoreService, storageService *services.StorageService, aiService *services.VertexAIService) *ProductHandler {
+func NewProductHandler(firestoreService *services.FirestoreService, storageService *services.StorageService, aiService *services.VertexAIService, notificationService *services.NotificationService, currencyService *services.CurrencyService, wishlistWatcher *services.WishlistWatcher, imagePipeline *services.ImagePipeline, uploadValidator *services.UploadValidator, imageGeneration *services.ImageGenerationService) *ProductHandler {
 	return &ProductHandler{
-		firestoreService: firestoreService,
-		storageService:   storageService,
-		aiService:        aiService,
+		firestoreService:    firestoreService,
+		storageService:      storageService,
+		aiService:           aiService,
+		notificationService: notificationService,
+		currencyService:     currencyService,
+		wishlistWatcher:     wishlistWatcher,
+		imagePipeline:       imagePipeline,
+		uploadValidator:     uploadValidator,
+		imageGeneration:     imageGeneration,
 	}
 }
 
+// setDisplayPrices adds prices in the requested display currency to catalogue results
+func (h *ProductHandler) setDisplayPrices(c *gin.Context, products []models.Product) (string, bool) {
+	rates, currency, ok := catalogueRates(c, h.firestoreService, h.currencyService)
+	if !ok {
+		return "", false
+	}
+	for i := range products {
+		setDisplayPrices(rates, currency, &products[i])
+	}
+	return currency, true
+}
+
+// decodeUpdate decodes a field of a partial update into its typed form, leaving
+// target unchanged when the field is not part of the update
+func decodeUpdate(updates map[string]interface{}, field string, target interface{}) error {
+	value, ok := updates[field]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// reviewedFields are the listing content an admin approves; changing any of them on a
+// live product sends it back for review. Images change through the image endpoints,
+// which do the same when they add an image.
+var reviewedFields = []string{"title", "description", "category", "tags", "materials", "price_minor", "currency", "options", "variants", "voice_story", "video_url"}
+
+// changesReviewedContent reports whether updates change any reviewed field of product
+func changesReviewedContent(product *models.Product, updates map[string]interface{}) bool {
+	current := map[string]interface{}{
+		"title":       product.Title,
+		"description": product.Description,
+		"category":    product.Category,
+		"tags":        product.Tags,
+		"materials":   product.Materials,
+		"price_minor": product.PriceMinor,
+		"currency":    product.Currency,
+		"options":     product.Options,
+		"variants":    reviewedVariants(product.Variants),
+		"voice_story": product.VoiceStory,
+		"video_url":   product.VideoURL,
+	}
+	for _, field := range reviewedFields {
+		value, ok := updates[field]
+		if !ok {
+			continue
+		}
+		if variants, ok := value.([]models.ProductVariant); ok {
+			value = reviewedVariants(variants)
+		}
+		before, _ := json.Marshal(current[field])
+		after, err := json.Marshal(value)
+		if err != nil || string(before) != string(after) {
+			return true
+		}
+	}
+	return false
+}
+
+// reviewedVariants copies variants without their stock, which sellers keep up to date
+// on a live product without review
+func reviewedVariants(variants []models.ProductVariant) []models.ProductVariant {
+	reviewed := make([]models.ProductVariant, len(variants))
+	for i, variant := range variants {
+		variant.Stock = 0
+		variant.ReservedStock = 0
+		reviewed[i] = variant
+	}
+	return reviewed
+}
+
+// setGenerationDetails records what AI content was generated with from details, the
+// server's record of the generation, clearing them when there is none
+func setGenerationDetails(content *models.AIGeneratedContent, details *models.AIGeneratedContent) {
+	if details == nil {
+		details = &models.AIGeneratedContent{}
+	}
+	content.GeneratedAt = details.GeneratedAt
+	content.ModelVersion = details.ModelVersion
+	content.PromptTemplate = details.PromptTemplate
+	content.PromptVersion = details.PromptVersion
+	content.Confidence = details.Confidence
+}
+
+// normalizePrice keeps a product's major- and minor-unit prices in step, preferring
+// price_minor when both are given
+func (h *ProductHandler) normalizePrice(product *models.Product) error {
+	if product.Currency == "" {
+		product.Currency = h.currencyService.Base()
+	}
+	currency, err := services.NormalizeCurrency(product.Currency)
+	if err != nil {
+		return err
+	}
+	product.Currency = currency
+
+	if product.PriceMinor > 0 {
+		product.Price = services.FromMinorUnits(product.PriceMinor, currency)
+	} else {
+		product.PriceMinor = services.ToMinorUnits(product.Price, currency)
+	}
+	if product.PriceMinor <= 0 {
+		return fmt.Errorf("price must be positive")
+	}
+	return nil
+}
+
 // GetProducts retrieves products with pagination and filters
 func (h *ProductHandler) GetProducts(c *gin.Context) {
 	// Parse query parameters
@@ -45,8 +172,10 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	// Build filter conditions
-	filters := make(map[string]interface{})
+	// Build filter conditions; buyers only ever see approved products
+	filters := map[string]interface{}{
+		"status": models.PublicProductStatuses,
+	}
 	if category != "" {
 		filters["category"] = category
 	}
@@ -65,13 +194,19 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 		return
 	}
 
+	currency, ok := h.setDisplayPrices(c, products)
+	if !ok {
+		return
+	}
+
 	// Calculate pagination info
 	totalPages := (total + limit - 1) / limit
 	hasNext := page < totalPages
 	hasPrev := page > 1
 
 	c.JSON(http.StatusOK, gin.H{
-		"products": products,
+		"products":         products,
+		"display_currency": currency,
 		"pagination": gin.H{
 			"page":        page,
 			"limit":       limit,
@@ -92,13 +227,19 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 	}
 
 	product, err := h.firestoreService.GetProduct(productID)
-	if err != nil {
+	if err != nil || !product.Status.IsPublic() {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
+	rates, currency, ok := catalogueRates(c, h.firestoreService, h.currencyService)
+	if !ok {
+		return
+	}
+	setDisplayPrices(rates, currency, product)
+
 	// Increment view count (async)
-	go h.firestoreService.IncrementProductViews(productID)
+	go h.firestoreService.IncrementProductViews(productID, product.ArtisanID)
 
 	c.JSON(http.StatusOK, gin.H{"product": product})
 }
@@ -111,21 +252,73 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
-	var product models.Product
-	if err := c.ShouldBindJSON(&product); err != nil {
+	var request struct {
+		models.Product
+		DraftID string `json:"draft_id"` // the saved generation the AI content came from
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
+	product := request.Product
 
 	// Validate required fields
-	if product.Title == "" || product.Description == "" || product.Price <= 0 {
+	if product.Title == "" || product.Description == "" || (product.Price <= 0 && product.PriceMinor <= 0) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Name, description, and price are required"})
 		return
 	}
+	if err := h.normalizePrice(&product); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	product.DisplayPrice = nil
+	product.ImageRecords = nil
+	product.ReservedStock = 0
+
+	// Ratings and counters start from zero; reviews and buyer activity maintain them
+	product.Rating = 0
+	product.ReviewCount = 0
+	product.RatingSum = 0
+	product.ViewCount = 0
+	product.LikeCount = 0
+	product.ShareCount = 0
+	product.SalesCount = 0
+
+	if err := services.NormalizeVariants(&product, nil); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.NormalizeFulfillment(&product); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// What generated the AI content is taken from the saved generation, never the client
+	if product.AIGeneratedContent != nil {
+		var details *models.AIGeneratedContent
+		if request.DraftID != "" {
+			generation, err := h.firestoreService.GetDraftGeneration(request.DraftID, userID)
+			if err != nil {
+				if errors.Is(err, services.ErrDraftNotFound) {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load draft"})
+				return
+			}
+			details = generation.GenerationDetails()
+		}
+		setGenerationDetails(product.AIGeneratedContent, details)
+	}
 
 	// Set artisan ID from authenticated user
 	product.ArtisanID = userID
 
+	// Every new listing, including AI-generated ones, goes through moderation
+	product.Status = models.ProductStatusPendingReview
+	product.Moderation = nil
+	product.PublishedAt = nil
+
 	// Validate and set category
 	validCategories := []string{"pottery", "textiles", "jewelry", "woodwork", "metalwork", "glass", "leather", "other"}
 	isValidCategory := false
@@ -187,10 +380,197 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	delete(updates, "id")
 	delete(updates, "artisan_id")
 	delete(updates, "created_at")
+	delete(updates, "moderation")
+	delete(updates, "published_at")
+	delete(updates, "rating")
+	delete(updates, "review_count")
+	delete(updates, "rating_sum")
+	delete(updates, "sales_count")
+	delete(updates, "view_count")
+	delete(updates, "like_count")
+	delete(updates, "share_count")
+	delete(updates, "display_price")
+	delete(updates, "reserved_stock")
+	delete(updates, "images")
+	delete(updates, "image_records")
+	delete(updates, "generated_images")
+
+	// Edited AI content keeps the generation details recorded when it was created
+	if _, ok := updates["ai_generated_content"]; ok {
+		var content *models.AIGeneratedContent
+		if err := decodeUpdate(updates, "ai_generated_content", &content); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ai_generated_content is not valid generated content"})
+			return
+		}
+		if content != nil {
+			setGenerationDetails(content, existingProduct.AIGeneratedContent)
+		}
+		updates["ai_generated_content"] = content
+	}
+
+	// Prices are stored in both major and minor units, so any price change sets both
+	_, priceSet := updates["price"]
+	_, minorSet := updates["price_minor"]
+	_, currencySet := updates["currency"]
+	if priceSet || minorSet || currencySet {
+		priced := models.Product{Price: existingProduct.Price, Currency: existingProduct.Currency}
+		if currency, ok := updates["currency"].(string); ok {
+			priced.Currency = currency
+		} else if currencySet {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "currency must be a currency code"})
+			return
+		}
+		if price, ok := updates["price"].(float64); ok {
+			priced.Price = price
+		} else if priceSet {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "price must be a number"})
+			return
+		}
+		if minor, ok := updates["price_minor"].(float64); ok {
+			priced.PriceMinor = int64(minor)
+		} else if minorSet {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "price_minor must be a number"})
+			return
+		}
+
+		if err := h.normalizePrice(&priced); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["price"] = priced.Price
+		updates["price_minor"] = priced.PriceMinor
+		updates["currency"] = priced.Currency
+	}
+
+	// Options and variants are replaced as a whole; variant stock then sets the product's stock
+	_, optionsSet := updates["options"]
+	_, variantsSet := updates["variants"]
+	var varied *models.Product
+	if optionsSet || variantsSet || (currencySet && len(existingProduct.Variants) > 0) {
+		varied = &models.Product{
+			Images:   existingProduct.Images,
+			Currency: existingProduct.Currency,
+			Status:   existingProduct.Status,
+			Stock:    existingProduct.Stock,
+			Options:  append([]models.ProductOption(nil), existingProduct.Options...),
+			Variants: append([]models.ProductVariant(nil), existingProduct.Variants...),
+		}
+		if optionsSet {
+			varied.Options = nil
+		}
+		if variantsSet {
+			varied.Variants = nil
+		}
+		if currency, ok := updates["currency"].(string); ok {
+			varied.Currency = currency
+		}
+		if err := decodeUpdate(updates, "options", &varied.Options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "options must be a list of {name, values}"})
+			return
+		}
+		if err := decodeUpdate(updates, "variants", &varied.Variants); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "variants must be a list of variants"})
+			return
+		}
+
+		if err := services.NormalizeVariants(varied, existingProduct); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["options"] = varied.Options
+		updates["variants"] = varied.Variants
+	} else if _, stockSet := updates["stock"]; stockSet && len(existingProduct.Variants) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock is set on each variant for products with variants"})
+		return
+	}
+
+	// Made-to-order and pre-order products need a lead time
+	_, fulfillmentSet := updates["fulfillment"]
+	_, leadTimeSet := updates["lead_time"]
+	_, releaseSet := updates["release_date"]
+	if fulfillmentSet || leadTimeSet || releaseSet {
+		fulfilled := models.Product{
+			Fulfillment:  existingProduct.Fulfillment,
+			LeadTime:     existingProduct.LeadTime,
+			ReleaseDate:  existingProduct.ReleaseDate,
+			CraftingTime: existingProduct.CraftingTime,
+		}
+		if craftingTime, ok := updates["crafting_time"].(string); ok {
+			fulfilled.CraftingTime = craftingTime
+		}
+		if leadTimeSet {
+			fulfilled.LeadTime = nil
+		}
+		if releaseSet {
+			fulfilled.ReleaseDate = nil
+		}
+		if err := decodeUpdate(updates, "fulfillment", &fulfilled.Fulfillment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "fulfillment must be in_stock, made_to_order or pre_order"})
+			return
+		}
+		if err := decodeUpdate(updates, "lead_time", &fulfilled.LeadTime); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lead_time must have min_days and max_days"})
+			return
+		}
+		if err := decodeUpdate(updates, "release_date", &fulfilled.ReleaseDate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "release_date must be an RFC 3339 time"})
+			return
+		}
+
+		if err := services.NormalizeFulfillment(&fulfilled); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["fulfillment"] = fulfilled.Fulfillment
+		updates["lead_time"] = fulfilled.LeadTime
+		updates["release_date"] = fulfilled.ReleaseDate
+	}
+
+	// Publishing is an admin decision; artisans may only withdraw a listing or resubmit it for review
+	if status, ok := updates["status"]; ok && !middleware.IsAdmin(c) {
+		switch models.ProductStatus(fmt.Sprint(status)) {
+		case models.ProductStatusDraft, models.ProductStatusArchived, models.ProductStatusPendingReview:
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Products can only be published after admin review"})
+			return
+		}
+	}
+
+	// Approval covers the listing as reviewed, so content edits to a live product need review again
+	if _, statusSet := updates["status"]; !statusSet && !middleware.IsAdmin(c) &&
+		existingProduct.Status.IsPublic() && changesReviewedContent(existingProduct, updates) {
+		updates["status"] = models.ProductStatusPendingReview
+	}
+
+	// Keep live products in step with their stock level; UpdateProductVariants does this
+	// for variant products against the stock it reads
+	if _, statusSet := updates["status"]; !statusSet && varied == nil {
+		stocked := models.Product{Status: existingProduct.Status, Stock: existingProduct.Stock, Fulfillment: existingProduct.Fulfillment}
+		switch stock := updates["stock"].(type) {
+		case float64:
+			stocked.Stock = int(stock)
+		case int:
+			stocked.Stock = stock
+		}
+		if mode, ok := updates["fulfillment"].(models.FulfillmentMode); ok {
+			stocked.Fulfillment = mode
+		}
+		if stocked.SyncStock(); stocked.Status != existingProduct.Status {
+			updates["status"] = stocked.Status
+		}
+	}
 
 	// Update product in Firestore
-	err = h.firestoreService.UpdateProduct(productID, updates)
+	if varied != nil {
+		err = h.firestoreService.UpdateProductVariants(productID, varied, updates)
+	} else {
+		err = h.firestoreService.UpdateProduct(productID, updates)
+	}
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidVariants) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
@@ -202,6 +582,13 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
+	if existingProduct.Stock <= 0 && updatedProduct.Stock > 0 && updatedProduct.Status.IsPublic() {
+		go notifyFollowers(h.firestoreService, h.notificationService, updatedProduct.ArtisanID, "back_in_stock")
+	}
+
+	// Buyers who saved the product hear about price drops and restocks
+	go h.wishlistWatcher.ProductChanged(existingProduct, updatedProduct)
+
 	c.JSON(http.StatusOK, gin.H{"product": updatedProduct})
 }
 
@@ -238,12 +625,18 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	// TODO: Delete associated images from storage
+	// Delete the product's processed images; older images are left to the storage sweeper
+	for _, record := range existingProduct.ImageRecords {
+		h.imagePipeline.DeleteProductImage(record)
+	}
+	for _, record := range existingProduct.GeneratedImages {
+		h.imagePipeline.DeleteProductImage(record)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
 
-// UploadProductImages handles product image uploads
+// UploadProductImages adds uploaded images after a product's existing ones
 func (h *ProductHandler) UploadProductImages(c *gin.Context) {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
@@ -280,56 +673,342 @@ func (h *ProductHandler) UploadProductImages(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No images provided"})
 		return
 	}
+	if len(existingProduct.Images)+len(files) > services.MaxProductImages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrTooManyImages.Error()})
+		return
+	}
 
-	var uploadedImages []string
-	allowedTypes := []string{"jpeg", "jpg", "png", "webp"}
+	// Photos can be cropped and colour-corrected, optionally onto a studio backdrop
+	enhance, err := services.ParseEnhanceMode(c.PostForm("enhance"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if enhance != nil && !h.imagePipeline.CanEnhance() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrEnhancementDisabled.Error()})
+		return
+	}
 
-	for _, fileHeader := range files {
-		// Validate file type
-		if !h.storageService.ValidateFileType(fileHeader.Filename, allowedTypes) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only JPEG, PNG, and WebP are allowed"})
-			return
+	var imageRecords []models.ProductImage
+	discard := func() {
+		for _, record := range imageRecords {
+			h.imagePipeline.DeleteProductImage(record)
 		}
+	}
 
-		// Open file
-		file, err := fileHeader.Open()
+	for _, fileHeader := range files {
+		// Check the type, size and dimensions from the content before decoding
+		photo, err := h.uploadValidator.ValidateImage(c.Request.Context(), fileHeader)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+			discard()
+			uploadError(c, fileHeader.Filename, err)
 			return
 		}
 
-		// Upload to storage
-		result, err := h.storageService.UploadImage(file, fileHeader, userID)
+		// Resize into renditions without the photo's metadata, then upload
+		var record *models.ProductImage
+		if enhance != nil {
+			record, err = h.imagePipeline.StoreEnhancedProductImage(c.Request.Context(), photo.Data, userID, *enhance)
+		} else {
+			record, err = h.imagePipeline.StoreProductImage(photo.Data, userID)
+		}
 		if err != nil {
-			file.Close()
+			discard()
+			if errors.Is(err, services.ErrUnsupportedImage) || errors.Is(err, services.ErrInvalidImage) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fileHeader.Filename + ": " + err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image"})
 			return
 		}
 
-		uploadedImages = append(uploadedImages, result.URL)
-		file.Close()
+		imageRecords = append(imageRecords, *record)
 	}
 
-	// Update product with new images
-	updates := map[string]interface{}{
-		"images": uploadedImages,
+	// Add the new images after the existing ones
+	// Images an artisan adds send a live product back for review
+	product, err := h.firestoreService.AddProductImages(productID, imageRecords, !middleware.IsAdmin(c))
+	if err != nil {
+		discard()
+		if errors.Is(err, services.ErrTooManyImages) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product with images"})
+		return
 	}
 
-	err = h.firestoreService.UpdateProduct(productID, updates)
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Images uploaded successfully",
+		"images":        product.Images,
+		"image_records": product.ImageRecords,
+	})
+}
+
+// ownProductForImages loads a product whose images the caller may manage. On failure
+// it writes the response and returns nil.
+func (h *ProductHandler) ownProductForImages(c *gin.Context) *models.Product {
+	userID, err := middleware.GetUserID(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product with images"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil
+	}
+
+	product, err := h.firestoreService.GetProduct(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return nil
+	}
+	if product.ArtisanID != userID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage images of your own products"})
+		return nil
+	}
+	return product
+}
+
+// imageResponse writes a product's images after a change, or the error that stopped it
+func imageResponse(c *gin.Context, product *models.Product, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrImageNotFound), errors.Is(err, services.ErrGeneratedImageNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidImageOrder), errors.Is(err, services.ErrTooManyImages):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product images"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"images":        product.Images,
+		"image_records": product.ImageRecords,
+	})
+}
+
+// ReorderProductImages puts a product's images in a new order, given as image IDs or
+// URLs; the first image is the cover
+func (h *ProductHandler) ReorderProductImages(c *gin.Context) {
+	product := h.ownProductForImages(c)
+	if product == nil {
+		return
+	}
+
+	var request struct {
+		Images []string `json:"images" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	product, err := h.firestoreService.ReorderProductImages(product.ID, request.Images)
+	imageResponse(c, product, err)
+}
+
+// SetCoverImage makes one of a product's images its cover
+func (h *ProductHandler) SetCoverImage(c *gin.Context) {
+	product := h.ownProductForImages(c)
+	if product == nil {
+		return
+	}
+
+	var request struct {
+		Image string `json:"image" binding:"required"` // image ID or URL
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	product, err := h.firestoreService.SetCoverImage(product.ID, request.Image)
+	imageResponse(c, product, err)
+}
+
+// DeleteProductImage removes one image from a product and deletes its files
+func (h *ProductHandler) DeleteProductImage(c *gin.Context) {
+	product := h.ownProductForImages(c)
+	if product == nil {
+		return
+	}
+
+	product, removed, err := h.firestoreService.RemoveProductImage(product.ID, c.Param("imageId"))
+	if err == nil {
+		h.imagePipeline.DeleteProductImage(*removed)
+	}
+	imageResponse(c, product, err)
+}
+
+// GetGeneratedImages lists the AI-generated images awaiting the artisan's approval
+func (h *ProductHandler) GetGeneratedImages(c *gin.Context) {
+	product := h.ownProductForImages(c)
+	if product == nil {
+		return
+	}
+
+	generated := product.GeneratedImages
+	if generated == nil {
+		generated = []models.ProductImage{}
+	}
+	c.JSON(http.StatusOK, gin.H{"generated_images": generated})
+}
+
+// GenerateProductImages generates lifestyle or marketing images of a product. They
+// are held for the artisan's approval and do not appear in the gallery until approved.
+func (h *ProductHandler) GenerateProductImages(c *gin.Context) {
+	product := h.ownProductForImages(c)
+	if product == nil {
+		return
+	}
+
+	var request struct {
+		Prompt        string `json:"prompt"`
+		InstagramPost *int   `json:"instagram_post"` // use the image prompt of this generated Instagram post
+		Style         string `json:"style"`
+		AspectRatio   string `json:"aspect_ratio"`
+		Count         int    `json:"count"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(product.GeneratedImages)+max(request.Count, 1) > services.MaxGeneratedImages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrTooManyGeneratedImages.Error()})
+		return
+	}
+
+	// Without a prompt of its own, use the one written for an Instagram post or have
+	// one written from the listing
+	prompt := request.Prompt
+	if prompt == "" && request.InstagramPost != nil {
+		var posts []models.InstagramPost
+		if product.AIGeneratedContent != nil {
+			posts = product.AIGeneratedContent.SocialMedia.InstagramPosts
+		}
+		if i := *request.InstagramPost; i >= 0 && i < len(posts) {
+			prompt = posts[i].ImagePrompt
+		}
+		if prompt == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "That Instagram post has no image prompt"})
+			return
+		}
+	}
+	if prompt == "" {
+		var err error
+		if prompt, err = h.aiService.GenerateImagePrompt(product.Title, product.Description, product.Category); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write an image prompt"})
+			return
+		}
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	images, err := h.imageGeneration.GenerateProductImages(c.Request.Context(), product.ID, userID, services.ProductImageGeneration{
+		Prompt:      prompt,
+		Style:       request.Style,
+		AspectRatio: request.AspectRatio,
+		Count:       request.Count,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidImageGeneration), errors.Is(err, services.ErrTooManyGeneratedImages),
+			errors.Is(err, services.ErrImageGenerationDisabled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNoImagesGenerated):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Failed to generate images for product %s: %v", product.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate images"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"prompt":           prompt,
+		"generated_images": images,
+	})
+}
+
+// ApproveGeneratedImage adds a generated image to the end of the product's gallery
+func (h *ProductHandler) ApproveGeneratedImage(c *gin.Context) {
+	product := h.ownProductForImages(c)
+	if product == nil {
+		return
+	}
+
+	product, err := h.imageGeneration.ApproveGeneratedImage(product.ID, c.Param("imageId"), !middleware.IsAdmin(c))
+	imageResponse(c, product, err)
+}
+
+// RejectGeneratedImage discards a generated image
+func (h *ProductHandler) RejectGeneratedImage(c *gin.Context) {
+	product := h.ownProductForImages(c)
+	if product == nil {
+		return
+	}
+
+	if err := h.imageGeneration.RejectGeneratedImage(product.ID, c.Param("imageId")); err != nil {
+		if errors.Is(err, services.ErrGeneratedImageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discard generated image"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Generated image discarded"})
+}
+
+// GetVoiceStoryAudio returns a short-lived link to a product's voice story recording.
+// Recordings are private, so only the product's artisan and admins can listen to them.
+func (h *ProductHandler) GetVoiceStoryAudio(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	product, err := h.firestoreService.GetProduct(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if product.ArtisanID != userID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only listen to your own voice stories"})
+		return
+	}
+	if product.VoiceStory == nil || product.VoiceStory.AudioURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product has no voice story recording"})
+		return
+	}
+
+	// Recordings stored before files were private still have a public URL
+	if !services.IsPrivateURL(product.VoiceStory.AudioURL) {
+		c.JSON(http.StatusOK, gin.H{"url": product.VoiceStory.AudioURL})
 		return
 	}
 
+	url, expiresAt, err := h.storageService.SignedFileURL(product.VoiceStory.AudioURL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create a link to the recording"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Images uploaded successfully",
-		"images":  uploadedImages,
+		"url":        url,
+		"expires_at": expiresAt,
 	})
 }
 
-// GetProductsByArtisan retrieves all products by a specific artisan
+// GetProductsByArtisan retrieves all products by a specific artisan.
+// On the public route only approved products are listed; on the artisan
+// dashboard route the caller sees their own products in every status.
 func (h *ProductHandler) GetProductsByArtisan(c *gin.Context) {
-	artisanID := c.Param("artisan_id")
+	artisanID := c.Param("id")
+	publicOnly := artisanID != ""
+	if !publicOnly {
+		artisanID, _ = middleware.GetUserID(c)
+	}
 	if artisanID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Artisan ID is required"})
 		return
@@ -350,6 +1029,11 @@ func (h *ProductHandler) GetProductsByArtisan(c *gin.Context) {
 	filters := map[string]interface{}{
 		"artisan_id": artisanID,
 	}
+	if publicOnly {
+		filters["status"] = models.PublicProductStatuses
+	} else if status := c.Query("status"); status != "" {
+		filters["status"] = status
+	}
 
 	products, total, err := h.firestoreService.GetProductsWithFilters(filters, "created_at", "desc", limit, offset)
 	if err != nil {
@@ -357,10 +1041,16 @@ func (h *ProductHandler) GetProductsByArtisan(c *gin.Context) {
 		return
 	}
 
+	currency, ok := h.setDisplayPrices(c, products)
+	if !ok {
+		return
+	}
+
 	totalPages := (total + limit - 1) / limit
 
 	c.JSON(http.StatusOK, gin.H{
-		"products": products,
+		"products":         products,
+		"display_currency": currency,
 		"pagination": gin.H{
 			"page":        page,
 			"limit":       limit,
@@ -396,6 +1086,7 @@ func (h *ProductHandler) SearchProducts(c *gin.Context) {
 	// For now, use basic text search
 	filters := map[string]interface{}{
 		"search": query,
+		"status": models.PublicProductStatuses,
 	}
 
 	products, total, err := h.firestoreService.GetProductsWithFilters(filters, "created_at", "desc", limit, offset)
@@ -404,10 +1095,16 @@ func (h *ProductHandler) SearchProducts(c *gin.Context) {
 		return
 	}
 
+	currency, ok := h.setDisplayPrices(c, products)
+	if !ok {
+		return
+	}
+
 	totalPages := (total + limit - 1) / limit
 
 	c.JSON(http.StatusOK, gin.H{
-		"products": products,
+		"products":         products,
+		"display_currency": currency,
 		"pagination": gin.H{
 			"page":        page,
 			"limit":       limit,
@@ -419,3 +1116,65 @@ func (h *ProductHandler) SearchProducts(c *gin.Context) {
 		"search_type": "text",
 	})
 }
+
+// LikeProduct adds the product to the authenticated user's likes
+func (h *ProductHandler) LikeProduct(c *gin.Context) {
+	h.setProductLike(c, true)
+}
+
+// UnlikeProduct removes the product from the authenticated user's likes
+func (h *ProductHandler) UnlikeProduct(c *gin.Context) {
+	h.setProductLike(c, false)
+}
+
+func (h *ProductHandler) setProductLike(c *gin.Context, liked bool) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	productID := c.Param("id")
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product ID is required"})
+		return
+	}
+
+	product, err := h.firestoreService.GetProduct(productID)
+	if err != nil || !product.Status.IsPublic() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if _, err := h.firestoreService.SetProductLike(userID, product, liked); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update like"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": productID,
+		"liked":      liked,
+	})
+}
+
+// ShareProduct records that a product was shared
+func (h *ProductHandler) ShareProduct(c *gin.Context) {
+	productID := c.Param("id")
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product ID is required"})
+		return
+	}
+
+	product, err := h.firestoreService.GetProduct(productID)
+	if err != nil || !product.Status.IsPublic() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	if err := h.firestoreService.RecordProductShare(productID, product.ArtisanID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record share"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share recorded"})
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PromptHandler struct {
+	aiService *services.VertexAIService
+}
+
+func NewPromptHandler(aiService *services.VertexAIService) *PromptHandler {
+	return &PromptHandler{aiService: aiService}
+}
+
+// GetPromptTemplates lists every version of every prompt template and the variables
+// each prompt can use (admin only)
+func (h *PromptHandler) GetPromptTemplates(c *gin.Context) {
+	templates, err := h.aiService.Prompts().Templates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load prompt templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"variables": services.PromptVariables,
+		"source":    h.aiService.Prompts().Source().Name(),
+		"model":     h.aiService.Model(),
+	})
+}
+
+// SavePromptTemplate stores a new version of the template for a prompt, category and
+// language; generation uses it from then on (admin only)
+func (h *PromptHandler) SavePromptTemplate(c *gin.Context) {
+	var request struct {
+		Name     string `json:"name" binding:"required"`
+		Category string `json:"category"`
+		Language string `json:"language"`
+		Text     string `json:"text" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name and text are required"})
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(c)
+	template, err := h.aiService.Prompts().Save(c.Request.Context(), &services.PromptTemplate{
+		Name:      request.Name,
+		Category:  request.Category,
+		Language:  request.Language,
+		Text:      request.Text,
+		CreatedBy: adminID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidPromptTemplate):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrReadOnlyPrompts):
+			c.JSON(http.StatusConflict, gin.H{"error": "Prompt templates are loaded from a file; set PROMPT_TEMPLATE_SOURCE=firestore to edit them"})
+		case errors.Is(err, services.ErrPromptVersionConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save prompt template"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"template": template})
+}
+
+// PreviewPromptTemplate renders a template against sample data, such as a sample
+// transcript, and with generate set also runs it through the model. The template is
+// the one generation would pick for the category and language, a stored version, or
+// unsaved text (admin only).
+func (h *PromptHandler) PreviewPromptTemplate(c *gin.Context) {
+	var request struct {
+		Name     string              `json:"name" binding:"required"`
+		Category string              `json:"category"`
+		Language string              `json:"language"`
+		Version  *int                `json:"version"` // a stored version instead of the current one
+		Text     string              `json:"text"`    // unsaved template text to try
+		Sample   services.PromptData `json:"sample"`
+		Generate bool                `json:"generate"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if _, ok := services.PromptVariables[request.Name]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown prompt " + request.Name})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var template *services.PromptTemplate
+	var err error
+	switch {
+	case request.Text != "":
+		template = &services.PromptTemplate{Name: request.Name, Category: request.Category, Language: request.Language, Text: request.Text}
+	case request.Version != nil:
+		template, err = h.aiService.Prompts().Version(ctx, request.Name, request.Category, request.Language, *request.Version)
+	default:
+		template, err = h.aiService.Prompts().Select(ctx, request.Name, request.Category, request.Language)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrPromptTemplateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load prompt template"})
+		return
+	}
+
+	// Fill in the variables generation would derive from the category and language
+	sample := request.Sample
+	if request.Name == services.PromptProductListing {
+		if sample.Language == "" {
+			sample.Language = services.LanguageName(request.Language)
+		}
+		if sample.Category == "" {
+			sample.Category = request.Category
+		}
+	}
+
+	preview, err := h.aiService.PreviewPrompt(ctx, template, sample, request.Generate)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPromptTemplate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Prompt preview failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to generate from prompt template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preview": preview})
+}
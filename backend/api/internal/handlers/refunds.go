@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/models"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RefundHandler struct {
+	firestoreService    *services.FirestoreService
+	notificationService *services.NotificationService
+	paymentService      *services.PaymentService
+	wishlistWatcher     *services.WishlistWatcher
+}
+
+func NewRefundHandler(firestoreService *services.FirestoreService, notificationService *services.NotificationService, paymentService *services.PaymentService, wishlistWatcher *services.WishlistWatcher) *RefundHandler {
+	return &RefundHandler{
+		firestoreService:    firestoreService,
+		notificationService: notificationService,
+		paymentService:      paymentService,
+		wishlistWatcher:     wishlistWatcher,
+	}
+}
+
+// RequestRefund lets a buyer request a refund for some or all items of a paid order.
+// Omitting items requests a refund of everything not yet refunded.
+func (h *RefundHandler) RequestRefund(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	orderID := c.Param("id")
+	if orderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+		return
+	}
+
+	var request struct {
+		Items []struct {
+			ProductID string `json:"product_id" binding:"required"`
+			VariantID string `json:"variant_id"`
+			Quantity  int    `json:"quantity" binding:"required"`
+		} `json:"items"`
+		Reason string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required and each item needs a product_id and quantity"})
+		return
+	}
+
+	quantities := make(map[string]int, len(request.Items))
+	for _, item := range request.Items {
+		quantities[models.LineKey(item.ProductID, item.VariantID)] += item.Quantity
+	}
+
+	order, err := h.firestoreService.GetOrder(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if order.BuyerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only request refunds for your own orders"})
+		return
+	}
+
+	refund, err := h.paymentService.RequestRefund(orderID, userID, quantities, strings.TrimSpace(request.Reason))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRefundInProgress):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrRefundNotAllowed), errors.Is(err, services.ErrInvalidRefundItems):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request refund"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"refund": refund})
+}
+
+// GetOrderRefunds lists the refunds for an order (its buyer or an admin)
+func (h *RefundHandler) GetOrderRefunds(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	orderID := c.Param("id")
+	if orderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+		return
+	}
+
+	order, err := h.firestoreService.GetOrder(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if order.BuyerID != userID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only view refunds for your own orders"})
+		return
+	}
+
+	refunds, err := h.firestoreService.GetOrderRefunds(orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id":        orderID,
+		"refund_status":   order.RefundStatus,
+		"refunded_amount": order.RefundedAmount,
+		"refunds":         refunds,
+	})
+}
+
+// GetRefunds lists refunds for the authenticated artisan's items, or all refunds for admins.
+// Query parameters: status, page and limit.
+func (h *RefundHandler) GetRefunds(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	status := c.Query("status")
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	artisanID := userID
+	if middleware.IsAdmin(c) {
+		artisanID = c.Query("artisan_id")
+	}
+
+	refunds, err := h.firestoreService.GetRefunds(artisanID, status, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"refunds": refunds,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// ApproveRefund approves a refund and sends it to the payment provider.
+// Approving a failed refund retries it.
+func (h *RefundHandler) ApproveRefund(c *gin.Context) {
+	userID, refund, ok := h.getReviewableRefund(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Note string `json:"note"`
+	}
+	_ = c.ShouldBindJSON(&request)
+
+	// Retrying a failed refund is an admin action
+	if refund.Status == models.RefundStatusFailed && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can retry failed refunds"})
+		return
+	}
+
+	refund, restocked, err := h.paymentService.ApproveRefund(refund.ID, userID, strings.TrimSpace(request.Note))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefundTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve refund"})
+		return
+	}
+
+	notifyBackInStock(h.firestoreService, h.notificationService, h.wishlistWatcher, restocked)
+
+	c.JSON(http.StatusOK, gin.H{"refund": refund})
+}
+
+// ReceiveReturn records that the items of a refund on a shipped or delivered order have
+// come back to the seller, which puts them back into stock
+func (h *RefundHandler) ReceiveReturn(c *gin.Context) {
+	_, refund, ok := h.getReviewableRefund(c)
+	if !ok {
+		return
+	}
+
+	refund, restocked, err := h.firestoreService.ReceiveReturn(refund.ID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefundTransition) || errors.Is(err, services.ErrReturnNotExpected) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record returned items"})
+		return
+	}
+
+	notifyBackInStock(h.firestoreService, h.notificationService, h.wishlistWatcher, restocked)
+
+	c.JSON(http.StatusOK, gin.H{"refund": refund})
+}
+
+// RejectRefund declines a refund request
+func (h *RefundHandler) RejectRefund(c *gin.Context) {
+	userID, refund, ok := h.getReviewableRefund(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required"})
+		return
+	}
+
+	refund, err := h.paymentService.RejectRefund(refund.ID, userID, strings.TrimSpace(request.Reason))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefundTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject refund"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refund": refund})
+}
+
+// getReviewableRefund loads the refund in the route and checks that the caller sells
+// every refunded item or is an admin. It writes the error response when it returns false.
+func (h *RefundHandler) getReviewableRefund(c *gin.Context) (string, *models.Refund, bool) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return "", nil, false
+	}
+
+	refundID := c.Param("id")
+	if refundID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund ID is required"})
+		return "", nil, false
+	}
+
+	refund, err := h.firestoreService.GetRefund(refundID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund not found"})
+		return "", nil, false
+	}
+
+	if !middleware.IsAdmin(c) {
+		for _, artisanID := range refund.ArtisanIDs {
+			if artisanID != userID {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Refunds covering other artisans' items must be reviewed by an admin"})
+				return "", nil, false
+			}
+		}
+		if len(refund.ArtisanIDs) == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only review refunds for your own products"})
+			return "", nil, false
+		}
+	}
+
+	return userID, refund, true
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/models"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxReviewImages = 5
+
+type ReviewHandler struct {
+	firestoreService *services.FirestoreService
+	storageService   *services.StorageService
+	uploadValidator  *services.UploadValidator
+}
+
+func NewReviewHandler(firestoreService *services.FirestoreService, storageService *services.StorageService, uploadValidator *services.UploadValidator) *ReviewHandler {
+	return &ReviewHandler{
+		firestoreService: firestoreService,
+		storageService:   storageService,
+		uploadValidator:  uploadValidator,
+	}
+}
+
+// GetProductReviews lists the reviews for a product
+func (h *ReviewHandler) GetProductReviews(c *gin.Context) {
+	productID := c.Param("id")
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product ID is required"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	sortBy := c.DefaultQuery("sort_by", "created_at")
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	reviews, total, err := h.firestoreService.GetProductReviews(productID, sortBy, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	totalPages := (total + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews": reviews,
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+			"has_next":    page < totalPages,
+			"has_prev":    page > 1,
+		},
+	})
+}
+
+// CreateReview posts a review for a product from one of the buyer's delivered orders.
+// Accepts JSON or a multipart form with up to five "images" files.
+func (h *ReviewHandler) CreateReview(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	productID := c.Param("id")
+	if productID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product ID is required"})
+		return
+	}
+
+	var request struct {
+		OrderID string `json:"order_id" form:"order_id" binding:"required"`
+		Rating  int    `json:"rating" form:"rating" binding:"required"`
+		Title   string `json:"title" form:"title"`
+		Comment string `json:"comment" form:"comment"`
+	}
+
+	if err := c.ShouldBind(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if request.Rating < 1 || request.Rating > 5 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rating must be between 1 and 5"})
+		return
+	}
+
+	product, err := h.firestoreService.GetProduct(productID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	review := models.Review{
+		ProductID: productID,
+		ArtisanID: product.ArtisanID,
+		BuyerID:   userID,
+		OrderID:   request.OrderID,
+		Rating:    request.Rating,
+		Title:     strings.TrimSpace(request.Title),
+		Comment:   strings.TrimSpace(request.Comment),
+	}
+
+	// Upload optional review photos
+	var uploadedFiles []string
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse multipart form"})
+			return
+		}
+
+		files := form.File["images"]
+		if len(files) > maxReviewImages {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A review can have at most 5 images"})
+			return
+		}
+
+		for _, fileHeader := range files {
+			photo, err := h.uploadValidator.ValidateImage(c.Request.Context(), fileHeader)
+			if err != nil {
+				h.deleteUploads(uploadedFiles)
+				uploadError(c, fileHeader.Filename, err)
+				return
+			}
+
+			result, err := h.storageService.UploadImage(photo, userID)
+			if err != nil {
+				h.deleteUploads(uploadedFiles)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image"})
+				return
+			}
+
+			uploadedFiles = append(uploadedFiles, result.FileName)
+			review.Images = append(review.Images, result.URL)
+		}
+	}
+
+	if err := h.firestoreService.CreateReview(&review); err != nil {
+		h.deleteUploads(uploadedFiles)
+		switch {
+		case errors.Is(err, services.ErrReviewNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrReviewExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create review"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"review": review})
+}
+
+// UpdateReview edits the authenticated buyer's own review
+func (h *ReviewHandler) UpdateReview(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	reviewID := c.Param("id")
+	if reviewID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Review ID is required"})
+		return
+	}
+
+	var request struct {
+		Rating  int    `json:"rating" binding:"required"`
+		Title   string `json:"title"`
+		Comment string `json:"comment"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if request.Rating < 1 || request.Rating > 5 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rating must be between 1 and 5"})
+		return
+	}
+
+	existing, err := h.firestoreService.GetReview(reviewID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+
+	if existing.BuyerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own reviews"})
+		return
+	}
+
+	review, err := h.firestoreService.UpdateReview(reviewID, request.Rating, strings.TrimSpace(request.Title), strings.TrimSpace(request.Comment))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"review": review})
+}
+
+// DeleteReview deletes a review (its author or an admin)
+func (h *ReviewHandler) DeleteReview(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	reviewID := c.Param("id")
+	if reviewID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Review ID is required"})
+		return
+	}
+
+	existing, err := h.firestoreService.GetReview(reviewID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+
+	if existing.BuyerID != userID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own reviews"})
+		return
+	}
+
+	review, err := h.firestoreService.DeleteReview(reviewID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete review"})
+		return
+	}
+
+	// Remove review photos from storage
+	for _, imageURL := range review.Images {
+		if fileName, err := h.storageService.ExtractFileNameFromURL(imageURL); err == nil {
+			h.deleteUploads([]string{fileName})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review deleted successfully"})
+}
+
+// MarkReviewHelpful records a helpful vote from the authenticated user
+func (h *ReviewHandler) MarkReviewHelpful(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	reviewID := c.Param("id")
+	if reviewID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Review ID is required"})
+		return
+	}
+
+	review, err := h.firestoreService.GetReview(reviewID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+
+	if review.BuyerID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot mark your own review as helpful"})
+		return
+	}
+
+	if err := h.firestoreService.MarkReviewHelpful(reviewID, userID); err != nil {
+		if errors.Is(err, services.ErrAlreadyVoted) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record vote"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review marked as helpful"})
+}
+
+// ReplyToReview adds or updates the artisan's reply to a review of their product
+func (h *ReviewHandler) ReplyToReview(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	reviewID := c.Param("id")
+	if reviewID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Review ID is required"})
+		return
+	}
+
+	var request struct {
+		Comment string `json:"comment" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reply comment is required"})
+		return
+	}
+
+	review, err := h.firestoreService.GetReview(reviewID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+
+	if review.ArtisanID != userID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only reply to reviews of your own products"})
+		return
+	}
+
+	if err := h.firestoreService.SetReviewReply(review, strings.TrimSpace(request.Comment)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reply"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"review": review})
+}
+
+// deleteUploads removes review photos that were uploaded but are no longer referenced
+func (h *ReviewHandler) deleteUploads(fileNames []string) {
+	for _, fileName := range fileNames {
+		_ = h.storageService.DeleteImage(fileName)
+	}
+}
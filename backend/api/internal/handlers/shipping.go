@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"voicecraft-market/internal/models"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ShippingHandler struct {
+	firestoreService   *services.FirestoreService
+	shippingCalculator *services.ShippingCalculator
+	currencyService    *services.CurrencyService
+}
+
+func NewShippingHandler(firestoreService *services.FirestoreService, shippingCalculator *services.ShippingCalculator, currencyService *services.CurrencyService) *ShippingHandler {
+	return &ShippingHandler{
+		firestoreService:   firestoreService,
+		shippingCalculator: shippingCalculator,
+		currencyService:    currencyService,
+	}
+}
+
+// QuoteShipping prices shipping for a cart to a PIN code, the same way checkout does
+func (h *ShippingHandler) QuoteShipping(c *gin.Context) {
+	var request struct {
+		Items []struct {
+			ProductID string `json:"product_id" binding:"required"`
+			VariantID string `json:"variant_id"`
+			Quantity  int    `json:"quantity" binding:"required,min=1"`
+		} `json:"items" binding:"required,min=1"`
+		PostalCode string `json:"postal_code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "items (product_id, quantity) and postal_code are required"})
+		return
+	}
+
+	rates, err := h.currencyService.Rates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load exchange rates"})
+		return
+	}
+	currency := h.currencyService.Base()
+
+	items := make([]models.OrderItem, 0, len(request.Items))
+	products := make(map[string]*models.Product)
+	artisans := make(map[string]*models.ArtisanProfile)
+	var subtotal float64
+
+	for _, requested := range request.Items {
+		product, ok := products[requested.ProductID]
+		if !ok {
+			var err error
+			product, err = h.firestoreService.GetProduct(requested.ProductID)
+			if err != nil || !product.Status.IsPublic() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Product not available: " + requested.ProductID})
+				return
+			}
+			products[requested.ProductID] = product
+		}
+
+		// Artisans without a profile are quoted from an unknown origin
+		if _, ok := artisans[product.ArtisanID]; !ok {
+			artisan, _ := h.firestoreService.GetArtisan(product.ArtisanID)
+			artisans[product.ArtisanID] = artisan
+		}
+
+		if requested.VariantID != "" && product.Variant(requested.VariantID) == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Variant not available: " + requested.VariantID})
+			return
+		}
+
+		price, err := rates.Convert(services.VariantPrice(product, requested.VariantID), currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item := models.OrderItem{
+			ProductID: product.ID,
+			VariantID: requested.VariantID,
+			ArtisanID: product.ArtisanID,
+			Quantity:  requested.Quantity,
+			Price:     services.FromMinorUnits(price.Amount, currency),
+		}
+		item.Total = item.Price * float64(requested.Quantity)
+		subtotal += item.Total
+		items = append(items, item)
+	}
+
+	lines, shippingTotal, err := h.shippingCalculator.Quote(items, products, artisans, request.PostalCode)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPostalCode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to quote shipping"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency":       currency,
+		"subtotal":       subtotal,
+		"shipping_lines": lines,
+		"shipping_total": shippingTotal,
+		"total":          subtotal + shippingTotal,
+	})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/models"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TrackingHandler struct {
+	firestoreService *services.FirestoreService
+	trackingService  *services.TrackingService
+}
+
+func NewTrackingHandler(firestoreService *services.FirestoreService, trackingService *services.TrackingService) *TrackingHandler {
+	return &TrackingHandler{
+		firestoreService: firestoreService,
+		trackingService:  trackingService,
+	}
+}
+
+// timelineEntry is one step on an order's tracking timeline
+type timelineEntry struct {
+	Status         string    `json:"status"`
+	Description    string    `json:"description"`
+	Location       string    `json:"location,omitempty"`
+	TrackingNumber string    `json:"tracking_number,omitempty"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// GetOrderTracking returns an order's shipments and a single timeline of its
+// order milestones and carrier checkpoints, oldest first
+func (h *TrackingHandler) GetOrderTracking(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	orderID := c.Param("id")
+	if orderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+		return
+	}
+
+	order, err := h.firestoreService.GetOrder(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	allowed := order.BuyerID == userID || middleware.IsAdmin(c)
+	for _, item := range order.Items {
+		if item.ArtisanID == userID {
+			allowed = true
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only track your own orders"})
+		return
+	}
+
+	shipments, err := h.firestoreService.GetOrderShipments(orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id":      orderID,
+		"status":        order.Status,
+		"tracking_info": order.TrackingInfo,
+		"delivered_at":  order.DeliveredAt,
+		"shipments":     shipments,
+		"timeline":      buildTimeline(order, shipments),
+	})
+}
+
+// buildTimeline merges order milestones with every shipment's carrier events
+func buildTimeline(order *models.Order, shipments []models.Shipment) []timelineEntry {
+	timeline := []timelineEntry{{
+		Status:      "placed",
+		Description: "Order placed",
+		OccurredAt:  order.CreatedAt,
+	}}
+
+	if order.PaidAt != nil {
+		timeline = append(timeline, timelineEntry{
+			Status:      string(models.OrderStatusConfirmed),
+			Description: "Payment received",
+			OccurredAt:  *order.PaidAt,
+		})
+	}
+
+	carrierDelivered := false
+	for _, shipment := range shipments {
+		for _, event := range shipment.Events {
+			timeline = append(timeline, timelineEntry{
+				Status:         string(event.Status),
+				Description:    event.Description,
+				Location:       event.Location,
+				TrackingNumber: shipment.TrackingNumber,
+				OccurredAt:     event.OccurredAt,
+			})
+		}
+		if shipment.Status == models.ShipmentStatusDelivered {
+			carrierDelivered = true
+		}
+	}
+
+	// Orders marked delivered by the seller have no carrier checkpoint for it
+	if order.DeliveredAt != nil && !carrierDelivered {
+		timeline = append(timeline, timelineEntry{
+			Status:      string(models.OrderStatusDelivered),
+			Description: "Order delivered",
+			OccurredAt:  *order.DeliveredAt,
+		})
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].OccurredAt.Before(timeline[j].OccurredAt)
+	})
+	return timeline
+}
+
+// HandleCarrierWebhook receives tracking updates from the carrier in the route
+func (h *TrackingHandler) HandleCarrierWebhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	if err := h.trackingService.HandleWebhook(c.Param("carrier"), c.Request.Header, body); err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownCarrier):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown carrier"})
+		case errors.Is(err, services.ErrInvalidSignature):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
+		default:
+			log.Printf("Failed to process %s tracking webhook: %v", c.Param("carrier"), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
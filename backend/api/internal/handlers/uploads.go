@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/models"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UploadHandler struct {
+	firestoreService     *services.FirestoreService
+	uploadSessionService *services.UploadSessionService
+}
+
+func NewUploadHandler(firestoreService *services.FirestoreService, uploadSessionService *services.UploadSessionService) *UploadHandler {
+	return &UploadHandler{
+		firestoreService:     firestoreService,
+		uploadSessionService: uploadSessionService,
+	}
+}
+
+// CreateUploadSession opens a direct upload to Cloud Storage and returns the signed
+// request the client sends the file with
+func (h *UploadHandler) CreateUploadSession(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var request struct {
+		Purpose     models.UploadPurpose `json:"purpose" binding:"required"`
+		ProductID   string               `json:"product_id"`
+		FileName    string               `json:"file_name"`
+		ContentType string               `json:"content_type" binding:"required"`
+		Size        int64                `json:"size" binding:"required"`
+		Resumable   bool                 `json:"resumable"`
+		Enhance     string               `json:"enhance"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	// Uploads can only be attached to the artisan's own products and profile
+	switch request.Purpose {
+	case models.UploadPurposeProductImage, models.UploadPurposeVoiceStory:
+		product, err := h.firestoreService.GetProduct(request.ProductID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		if product.ArtisanID != userID && !middleware.IsAdmin(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only upload files for your own products"})
+			return
+		}
+		if request.Purpose == models.UploadPurposeProductImage && len(product.Images) >= services.MaxProductImages {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrTooManyImages.Error()})
+			return
+		}
+	case models.UploadPurposeAvatar:
+		if _, err := h.firestoreService.GetArtisan(userID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Artisan profile not found"})
+			return
+		}
+	}
+
+	session := &models.UploadSession{
+		UserID:      userID,
+		Purpose:     request.Purpose,
+		ProductID:   request.ProductID,
+		FileName:    request.FileName,
+		ContentType: request.ContentType,
+		Size:        request.Size,
+		Resumable:   request.Resumable,
+		Enhance:     request.Enhance,
+	}
+
+	upload, err := h.uploadSessionService.CreateSession(session)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidUploadSession) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		uploadError(c, request.FileName, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"session": session,
+		"upload":  upload,
+	})
+}
+
+// GetUploadSession returns one of the caller's upload sessions
+func (h *UploadHandler) GetUploadSession(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	session, err := h.uploadSessionService.GetSession(c.Param("id"), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUploadSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch upload session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session": session})
+}
+
+// FinalizeUpload checks a directly uploaded file and attaches it to its product,
+// avatar or voice story
+func (h *UploadHandler) FinalizeUpload(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	session, err := h.uploadSessionService.Finalize(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUploadSessionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUploadSessionExpired), errors.Is(err, services.ErrUploadTargetGone):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUploadSessionClosed), errors.Is(err, services.ErrUploadIncomplete):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUploadMismatch), errors.Is(err, services.ErrTooManyImages):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			uploadError(c, "upload", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session": session})
+}
+
+// uploadError writes the response for an upload that failed validation: 413 when it
+// is too large, 400 when its content is refused and 500 when it could not be checked
+func uploadError(c *gin.Context, fileName string, err error) {
+	switch {
+	case errors.Is(err, services.ErrFileTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fileName + ": " + err.Error()})
+	case errors.Is(err, services.ErrFileTypeNotAllowed),
+		errors.Is(err, services.ErrImageTooLarge),
+		errors.Is(err, services.ErrUnsupportedImage),
+		errors.Is(err, services.ErrInvalidImage),
+		errors.Is(err, services.ErrFileRejected):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fileName + ": " + err.Error()})
+	default:
+		log.Printf("Failed to validate upload %s: %v", fileName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check uploaded file"})
+	}
+}
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -16,49 +19,44 @@ type VoiceHandler struct {
 	aiService        *services.VertexAIService
 	firestoreService *services.FirestoreService
 	storageService   *services.StorageService
+	uploadValidator  *services.UploadValidator
 }
 
-func NewVoiceHandler(speechService *services.SpeechToTextService, aiService *services.VertexAIService, firestoreService *services.FirestoreService, storageService *services.StorageService) *VoiceHandler {
+func NewVoiceHandler(speechService *services.SpeechToTextService, aiService *services.VertexAIService, firestoreService *services.FirestoreService, storageService *services.StorageService, uploadValidator *services.UploadValidator) *VoiceHandler {
 	return &VoiceHandler{
 		speechService:    speechService,
 		aiService:        aiService,
 		firestoreService: firestoreService,
 		storageService:   storageService,
+		uploadValidator:  uploadValidator,
 	}
 }
 
 // TranscribeAudio converts audio to text
 func (h *VoiceHandler) TranscribeAudio(c *gin.Context) {
 	// Handle multipart form upload
-	file, header, err := c.Request.FormFile("audio")
+	header, err := c.FormFile("audio")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Audio file is required"})
 		return
 	}
-	defer file.Close()
 
-	// Validate file type
-	allowedTypes := []string{"mp3", "wav", "m4a", "flac", "webm"}
-	if !h.storageService.ValidateFileType(header.Filename, allowedTypes) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid audio file type"})
-		return
-	}
-
-	// Convert to bytes
-	audioData := make([]byte, header.Size)
-	_, err = file.Read(audioData)
+	// Read the audio and check its type and size from the content
+	audio, err := h.uploadValidator.ValidateAudio(c.Request.Context(), header)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read audio file"})
+		uploadError(c, header.Filename, err)
 		return
 	}
 
 	// Transcribe audio
-	result, err := h.speechService.TranscribeAudio(audioData, "en-US")
+	result, err := h.speechService.TranscribeAudio(audio.Data, "en-US")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transcribe audio"})
 		return
 	}
 
+	go h.firestoreService.RecordVoiceTranscription(result.Duration)
+
 	c.JSON(http.StatusOK, gin.H{
 		"text":       result.Transcript,
 		"confidence": result.Confidence,
@@ -67,54 +65,142 @@ func (h *VoiceHandler) TranscribeAudio(c *gin.Context) {
 	})
 }
 
+// generationRequest is the body of the product generation endpoints
+type generationRequest struct {
+	Text      string   `json:"text,omitempty"`
+	AudioURL  string   `json:"audio_url,omitempty"`
+	ImageURLs []string `json:"image_urls,omitempty"` // photos the caller uploaded
+	ProductID string   `json:"product_id,omitempty"` // or use the photos of one of their products
+}
+
 // GenerateProduct generates product listing from voice/text description
 func (h *VoiceHandler) GenerateProduct(c *gin.Context) {
-	var request struct {
-		Text     string `json:"text,omitempty"`
-		AudioURL string `json:"audio_url,omitempty"`
+	request, generation, ok := h.prepareGeneration(c)
+	if !ok {
+		return
 	}
 
+	// Generate product details using AI
+	productInfo, err := h.aiService.GenerateProductContent(generation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate product listing"})
+		return
+	}
+
+	draftID := h.saveGeneration(c, request, generation.Transcript, productInfo)
+
+	c.JSON(http.StatusOK, gin.H{
+		"original_text": generation.Transcript,
+		"product":       productInfo,
+		"draft_id":      draftID,
+	})
+}
+
+// GenerateProductStream generates a product listing like GenerateProduct but answers
+// with server-sent events: "transcript" with the text the listing is written from,
+// "section" for each part of the listing as soon as it is written, then "result" with
+// the checked listing, or "error" if generation fails.
+func (h *VoiceHandler) GenerateProductStream(c *gin.Context) {
+	request, generation, ok := h.prepareGeneration(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // stop proxies such as nginx holding events back
+
+	send := func(event string, data interface{}) {
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+	send("transcript", gin.H{"text": generation.Transcript})
+
+	productInfo, err := h.aiService.GenerateProductContentStream(c.Request.Context(), generation, func(name string, value json.RawMessage) {
+		send("section", gin.H{"name": name, "value": value})
+	})
+	if err != nil {
+		if c.Request.Context().Err() == nil {
+			log.Printf("Streaming product generation failed: %v", err)
+			send("error", gin.H{"error": "Failed to generate product listing"})
+		}
+		return
+	}
+
+	draftID := h.saveGeneration(c, request, generation.Transcript, productInfo)
+
+	send("result", gin.H{
+		"original_text": generation.Transcript,
+		"product":       productInfo,
+		"draft_id":      draftID,
+	})
+}
+
+// prepareGeneration reads a generation request, resolving its photos and transcribing
+// its recording if it has one. On failure it writes the response and returns false.
+func (h *VoiceHandler) prepareGeneration(c *gin.Context) (*generationRequest, *services.ProductGenerationRequest, bool) {
+	var request generationRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		return
+		return nil, nil, false
+	}
+
+	// Photos let the model see the item and check the description against it
+	images, ok := h.generationImages(c, request.ImageURLs, request.ProductID)
+	if !ok {
+		return nil, nil, false
 	}
 
 	var description string
 
 	// If audio URL is provided, transcribe it first
 	if request.AudioURL != "" {
-		// Download audio file
-		audioData, err := h.storageService.DownloadFile(request.AudioURL, "")
+		// Recordings are private, so only the uploader's own can be used
+		userID, err := middleware.GetUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in to generate a listing from an uploaded recording"})
+			return nil, nil, false
+		}
+
+		audioData, err := h.storageService.DownloadUserFile(request.AudioURL, userID)
 		if err != nil {
+			if errors.Is(err, services.ErrFileAccessDenied) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return nil, nil, false
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to download audio file"})
-			return
+			return nil, nil, false
 		}
 
 		// Transcribe audio
 		result, err := h.speechService.TranscribeAudio(audioData, "en-US")
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transcribe audio"})
-			return
+			return nil, nil, false
 		}
 		description = result.Transcript
+
+		go h.firestoreService.RecordVoiceTranscription(result.Duration)
 	} else if request.Text != "" {
 		description = request.Text
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Either text or audio_url is required"})
-		return
+		return nil, nil, false
 	}
 
-	// Generate product details using AI
-	productInfo, err := h.aiService.GenerateProductContent(&services.ProductGenerationRequest{
+	return &request, &services.ProductGenerationRequest{
 		Transcript: description,
 		Language:   "english",
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate product listing"})
-		return
-	}
+		Images:     images,
+	}, true
+}
 
+// saveGeneration saves a generated listing as a draft for signed-in users and records
+// the generation in the analytics. It returns the draft's ID, or "" when none was saved.
+func (h *VoiceHandler) saveGeneration(c *gin.Context, request *generationRequest, description string, productInfo *services.ProductGenerationResponse) string {
 	// Save as draft if user is authenticated
+	draftID := ""
 	if middleware.IsAuthenticated(c) {
 		userID, _ := middleware.GetUserID(c)
 
@@ -123,19 +209,82 @@ func (h *VoiceHandler) GenerateProduct(c *gin.Context) {
 			"user_id":     userID,
 			"description": description,
 			"generated":   productInfo,
+			"images":      request.ImageURLs,
+			"product_id":  request.ProductID,
 			"status":      "draft",
 			"created_at":  time.Now(),
 		}
 
-		_, err = h.firestoreService.CreateDocument("product_drafts", draftData)
+		id, err := h.firestoreService.CreateDocument(services.DraftsCollection, draftData)
 		if err != nil {
 			// Log error but don't fail the request
 			log.Printf("Failed to save draft: %v", err)
+		} else {
+			draftID = id
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"original_text": description,
-		"product":       productInfo,
-	})
+	go h.firestoreService.RecordAIGeneration(productInfo.Confidence, draftID != "")
+	return draftID
+}
+
+// generationImages resolves the photos sent with a generation request: stored images
+// the caller uploaded, or the photos of one of their products. On failure it writes
+// the response and returns false.
+func (h *VoiceHandler) generationImages(c *gin.Context, imageURLs []string, productID string) ([]services.ImageReference, bool) {
+	if len(imageURLs) == 0 && productID == "" {
+		return nil, true
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in to generate a listing from photos"})
+		return nil, false
+	}
+
+	if productID != "" {
+		product, err := h.firestoreService.GetProduct(productID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return nil, false
+		}
+		if product.ArtisanID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only use photos of your own products"})
+			return nil, false
+		}
+		// The card rendition is plenty for the model and cheaper than full size
+		for _, record := range product.ImageRecords {
+			url := record.URL("card")
+			if url == "" {
+				url = record.URL("full")
+			}
+			imageURLs = append(imageURLs, url)
+		}
+		if len(product.ImageRecords) == 0 {
+			imageURLs = append(imageURLs, product.Images...)
+		}
+	}
+
+	if len(imageURLs) > services.MaxGenerationImages {
+		if productID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d photos can be sent", services.MaxGenerationImages)})
+			return nil, false
+		}
+		imageURLs = imageURLs[:services.MaxGenerationImages]
+	}
+
+	images := make([]services.ImageReference, 0, len(imageURLs))
+	for _, url := range imageURLs {
+		image, err := h.storageService.UserImageReference(url, userID)
+		if err != nil {
+			if errors.Is(err, services.ErrFileAccessDenied) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return nil, false
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		images = append(images, image)
+	}
+	return images, true
 }
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"voicecraft-market/internal/middleware"
+	"voicecraft-market/internal/models"
+	"voicecraft-market/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WishlistHandler struct {
+	firestoreService *services.FirestoreService
+	currencyService  *services.CurrencyService
+}
+
+func NewWishlistHandler(firestoreService *services.FirestoreService, currencyService *services.CurrencyService) *WishlistHandler {
+	return &WishlistHandler{
+		firestoreService: firestoreService,
+		currencyService:  currencyService,
+	}
+}
+
+// wishlistName validates a wishlist name, writing a 400 response when it is unusable
+func wishlistName(c *gin.Context) (string, bool) {
+	var request struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A name is required"})
+		return "", false
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > 60 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wishlist names must be 1-60 characters"})
+		return "", false
+	}
+	return name, true
+}
+
+// wishlistError writes the response for a failed wishlist operation
+func wishlistError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, services.ErrWishlistNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist not found"})
+	case errors.Is(err, services.ErrDefaultWishlist):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// GetWishlists lists the buyer's wishlists
+func (h *WishlistHandler) GetWishlists(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	wishlists, err := h.firestoreService.GetWishlists(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wishlists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"wishlists": wishlists})
+}
+
+// CreateWishlist creates a named wishlist
+func (h *WishlistHandler) CreateWishlist(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	name, ok := wishlistName(c)
+	if !ok {
+		return
+	}
+
+	wishlist, err := h.firestoreService.CreateWishlist(userID, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"wishlist": wishlist})
+}
+
+// GetWishlist returns a wishlist with its saved products. Products that are no longer
+// listed stay on the list but are returned as unavailable.
+func (h *WishlistHandler) GetWishlist(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	wishlist, err := h.firestoreService.GetWishlist(userID, c.Param("id"))
+	if err != nil {
+		wishlistError(c, err, "fetch wishlist")
+		return
+	}
+
+	items, err := h.firestoreService.GetWishlistItems(wishlist.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wishlist items"})
+		return
+	}
+
+	rates, currency, ok := catalogueRates(c, h.firestoreService, h.currencyService)
+	if !ok {
+		return
+	}
+
+	type wishlistEntry struct {
+		models.WishlistItem
+		Product   *models.Product `json:"product,omitempty"`
+		Available bool            `json:"available"`
+		PriceDrop bool            `json:"price_drop"` // cheaper than when it was saved
+	}
+
+	entries := make([]wishlistEntry, 0, len(items))
+	for _, item := range items {
+		entry := wishlistEntry{WishlistItem: item}
+		if product, err := h.firestoreService.GetProduct(item.ProductID); err == nil && product.Status.IsPublic() {
+			setDisplayPrices(rates, currency, product)
+			price := services.ProductPrice(product)
+			entry.Product = product
+			entry.Available = product.AvailableStock() > 0 || product.OrderableWithoutStock()
+			entry.PriceDrop = item.AddedPrice != nil && item.AddedPrice.Currency == price.Currency && price.Amount < item.AddedPrice.Amount
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"wishlist":         wishlist,
+		"items":            entries,
+		"display_currency": currency,
+	})
+}
+
+// RenameWishlist renames one of the buyer's wishlists
+func (h *WishlistHandler) RenameWishlist(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	name, ok := wishlistName(c)
+	if !ok {
+		return
+	}
+
+	wishlist, err := h.firestoreService.RenameWishlist(userID, c.Param("id"), name)
+	if err != nil {
+		wishlistError(c, err, "rename wishlist")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"wishlist": wishlist})
+}
+
+// DeleteWishlist deletes one of the buyer's wishlists
+func (h *WishlistHandler) DeleteWishlist(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if err := h.firestoreService.DeleteWishlist(userID, c.Param("id")); err != nil {
+		wishlistError(c, err, "delete wishlist")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Wishlist deleted"})
+}
+
+// AddWishlistItem saves a product to a wishlist; use "default" for the buyer's default list
+func (h *WishlistHandler) AddWishlistItem(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var request struct {
+		ProductID string `json:"product_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product_id is required"})
+		return
+	}
+
+	product, err := h.firestoreService.GetProduct(request.ProductID)
+	if err != nil || !product.Status.IsPublic() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	item, added, err := h.firestoreService.AddWishlistItem(userID, c.Param("id"), product)
+	if err != nil {
+		wishlistError(c, err, "save product")
+		return
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{"item": item})
+}
+
+// RemoveWishlistItem removes a product from a wishlist
+func (h *WishlistHandler) RemoveWishlistItem(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if err := h.firestoreService.RemoveWishlistItem(userID, c.Param("id"), c.Param("productId")); err != nil {
+		wishlistError(c, err, "remove product")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product removed from wishlist"})
+}
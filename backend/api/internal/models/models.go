@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 )
 
@@ -16,6 +17,10 @@ type User struct {
 	UpdatedAt  time.Time `firestore:"updated_at" json:"updated_at"`
 	ProfileURL string    `firestore:"profile_url,omitempty" json:"profile_url,omitempty"`
 	Language   string    `firestore:"language" json:"language"` // english, hindi, hinglish
+	FCMToken   string    `firestore:"fcm_token,omitempty" json:"fcm_token,omitempty"`
+
+	// PreferredCurrency is the currency catalogue prices are displayed in
+	PreferredCurrency string `firestore:"preferred_currency,omitempty" json:"preferred_currency,omitempty"`
 
 	// Artisan-specific fields
 	ArtisanProfile *ArtisanProfile `firestore:"artisan_profile,omitempty" json:"artisan_profile,omitempty"`
@@ -34,6 +39,9 @@ type ArtisanProfile struct {
 	ID              string            `firestore:"id,omitempty" json:"id,omitempty"`
 	Craft           string            `firestore:"craft" json:"craft"`
 	Location        string            `firestore:"location" json:"location"`
+	PostalCode      string            `firestore:"postal_code,omitempty" json:"postal_code,omitempty"` // PIN code orders ship from
+	State           string            `firestore:"state,omitempty" json:"state,omitempty"`             // state of supply for GST
+	GSTIN           string            `firestore:"gstin,omitempty" json:"gstin,omitempty"`
 	YearsExperience int               `firestore:"years_experience" json:"years_experience"`
 	Specialties     []string          `firestore:"specialties" json:"specialties"`
 	Bio             string            `firestore:"bio" json:"bio"`
@@ -44,38 +52,66 @@ type ArtisanProfile struct {
 	IsVerified      bool              `firestore:"is_verified" json:"is_verified"`
 	Rating          float64           `firestore:"rating" json:"rating"`
 	ReviewCount     int               `firestore:"review_count" json:"review_count"`
+	RatingSum       int               `firestore:"rating_sum" json:"-"`
 	FollowerCount   int               `firestore:"follower_count" json:"follower_count"`
 	TotalSales      int               `firestore:"total_sales" json:"total_sales"`
-	CreatedAt       time.Time         `firestore:"created_at" json:"created_at"`
-	UpdatedAt       time.Time         `firestore:"updated_at" json:"updated_at"`
+	// FreeShippingThreshold overrides the platform free-shipping threshold for this artisan's items
+	FreeShippingThreshold float64 `firestore:"free_shipping_threshold,omitempty" json:"free_shipping_threshold,omitempty"`
+	// MadeToOrderCapacity caps open orders with made-to-order items from this artisan; 0 means no limit
+	MadeToOrderCapacity int       `firestore:"made_to_order_capacity,omitempty" json:"made_to_order_capacity,omitempty"`
+	CreatedAt           time.Time `firestore:"created_at" json:"created_at"`
+	UpdatedAt           time.Time `firestore:"updated_at" json:"updated_at"`
 }
 
 // Product represents an artisan's product
 type Product struct {
-	ID           string            `firestore:"id" json:"id"`
-	ArtisanID    string            `firestore:"artisan_id" json:"artisan_id"`
-	Title        string            `firestore:"title" json:"title"`
-	Description  string            `firestore:"description" json:"description"`
-	Price        float64           `firestore:"price" json:"price"`
-	Currency     string            `firestore:"currency" json:"currency"`
-	Category     string            `firestore:"category" json:"category"`
-	Images       []string          `firestore:"images" json:"images"`
-	VideoURL     string            `firestore:"video_url,omitempty" json:"video_url,omitempty"`
-	Status       ProductStatus     `firestore:"status" json:"status"`
-	Stock        int               `firestore:"stock" json:"stock"`
-	SKU          string            `firestore:"sku,omitempty" json:"sku,omitempty"`
-	Weight       float64           `firestore:"weight,omitempty" json:"weight,omitempty"`
-	Dimensions   ProductDimensions `firestore:"dimensions,omitempty" json:"dimensions,omitempty"`
-	Materials    []string          `firestore:"materials,omitempty" json:"materials,omitempty"`
-	CraftingTime string            `firestore:"crafting_time,omitempty" json:"crafting_time,omitempty"`
-	CreatedAt    time.Time         `firestore:"created_at" json:"created_at"`
-	UpdatedAt    time.Time         `firestore:"updated_at" json:"updated_at"`
-	Tags         []string          `firestore:"tags,omitempty" json:"tags,omitempty"`
-	SEOKeywords  []string          `firestore:"seo_keywords,omitempty" json:"seo_keywords,omitempty"`
+	ID            string            `firestore:"id" json:"id"`
+	ArtisanID     string            `firestore:"artisan_id" json:"artisan_id"`
+	Title         string            `firestore:"title" json:"title"`
+	Description   string            `firestore:"description" json:"description"`
+	Price         float64           `firestore:"price" json:"price"`
+	PriceMinor    int64             `firestore:"price_minor" json:"price_minor"` // price in the currency's minor units
+	Currency      string            `firestore:"currency" json:"currency"`
+	Category      string            `firestore:"category" json:"category"`
+	Images        []string          `firestore:"images" json:"images"`                                   // full-size image URLs
+	ImageRecords  []ProductImage    `firestore:"image_records,omitempty" json:"image_records,omitempty"` // renditions of each image, in the same order
+	VideoURL      string            `firestore:"video_url,omitempty" json:"video_url,omitempty"`
+	Status        ProductStatus     `firestore:"status" json:"status"`
+	Stock         int               `firestore:"stock" json:"stock"`
+	ReservedStock int               `firestore:"reserved_stock" json:"reserved_stock"` // held by orders awaiting payment
+	SKU           string            `firestore:"sku,omitempty" json:"sku,omitempty"`
+	Options       []ProductOption   `firestore:"options,omitempty" json:"options,omitempty"`   // option dimensions such as size or colour
+	Variants      []ProductVariant  `firestore:"variants,omitempty" json:"variants,omitempty"` // one per option combination; stock is then tracked per variant
+	Weight        float64           `firestore:"weight,omitempty" json:"weight,omitempty"`     // kg
+	Dimensions    ProductDimensions `firestore:"dimensions,omitempty" json:"dimensions,omitempty"`
+	Materials     []string          `firestore:"materials,omitempty" json:"materials,omitempty"`
+	CraftingTime  string            `firestore:"crafting_time,omitempty" json:"crafting_time,omitempty"`
+	Fulfillment   FulfillmentMode   `firestore:"fulfillment,omitempty" json:"fulfillment,omitempty"`
+	LeadTime      *LeadTime         `firestore:"lead_time,omitempty" json:"lead_time,omitempty"`       // crafting time for items made after ordering
+	ReleaseDate   *time.Time        `firestore:"release_date,omitempty" json:"release_date,omitempty"` // when pre-orders go into production
+	CreatedAt     time.Time         `firestore:"created_at" json:"created_at"`
+	UpdatedAt     time.Time         `firestore:"updated_at" json:"updated_at"`
+	PublishedAt   *time.Time        `firestore:"published_at,omitempty" json:"published_at,omitempty"` // first approval
+	Tags          []string          `firestore:"tags,omitempty" json:"tags,omitempty"`
+	SEOKeywords   []string          `firestore:"seo_keywords,omitempty" json:"seo_keywords,omitempty"`
 
 	// Voice-to-Shop specific fields
 	VoiceStory         *VoiceStory         `firestore:"voice_story,omitempty" json:"voice_story,omitempty"`
 	AIGeneratedContent *AIGeneratedContent `firestore:"ai_generated_content,omitempty" json:"ai_generated_content,omitempty"`
+	// GeneratedImages are AI-generated images awaiting the artisan's approval; they
+	// are only listed to the artisan and join Images once approved
+	GeneratedImages []ProductImage `firestore:"generated_images,omitempty" json:"-"`
+
+	// Moderation
+	Moderation *ProductModeration `firestore:"moderation,omitempty" json:"moderation,omitempty"`
+
+	// DisplayPrice is the price converted to the buyer's currency; it is not stored
+	DisplayPrice *Money `firestore:"-" json:"display_price,omitempty"`
+
+	// Reviews
+	Rating      float64 `firestore:"rating" json:"rating"`
+	ReviewCount int     `firestore:"review_count" json:"review_count"`
+	RatingSum   int     `firestore:"rating_sum" json:"-"`
 
 	// Analytics
 	ViewCount  int `firestore:"view_count" json:"view_count"`
@@ -87,12 +123,217 @@ type Product struct {
 type ProductStatus string
 
 const (
-	ProductStatusDraft      ProductStatus = "draft"
-	ProductStatusActive     ProductStatus = "active"
-	ProductStatusOutOfStock ProductStatus = "out_of_stock"
-	ProductStatusArchived   ProductStatus = "archived"
+	ProductStatusDraft            ProductStatus = "draft"
+	ProductStatusPendingReview    ProductStatus = "pending_review"
+	ProductStatusActive           ProductStatus = "active"
+	ProductStatusOutOfStock       ProductStatus = "out_of_stock"
+	ProductStatusArchived         ProductStatus = "archived"
+	ProductStatusRejected         ProductStatus = "rejected"
+	ProductStatusChangesRequested ProductStatus = "changes_requested"
+)
+
+// AvailableStock is the stock that is not held by orders awaiting payment
+func (p *Product) AvailableStock() int {
+	return p.Stock - p.ReservedStock
+}
+
+// ProductImage is a processed product photo and its stored renditions
+type ProductImage struct {
+	ID         string           `firestore:"id" json:"id"`
+	Width      int              `firestore:"width" json:"width"` // upright size of the upload
+	Height     int              `firestore:"height" json:"height"`
+	Blurhash   string           `firestore:"blurhash" json:"blurhash"` // placeholder shown while loading
+	Renditions []ImageRendition `firestore:"renditions" json:"renditions"`
+	CreatedAt  time.Time        `firestore:"created_at" json:"created_at"`
+
+	// AIGenerated is set on images made by an image generator rather than photographed
+	AIGenerated *AIImageInfo `firestore:"ai_generated,omitempty" json:"ai_generated,omitempty"`
+	// Enhancement is set on photos that were enhanced; the photo as taken is kept as
+	// the "original" rendition
+	Enhancement *ImageEnhancement `firestore:"enhancement,omitempty" json:"enhancement,omitempty"`
+}
+
+// ImageEnhancement records how a product photo was enhanced
+type ImageEnhancement struct {
+	Enhancer           string `firestore:"enhancer" json:"enhancer"` // basic or imagen
+	BackgroundReplaced bool   `firestore:"background_replaced" json:"background_replaced"`
+}
+
+// AIImageInfo records how an AI-generated product image was made and when the
+// artisan approved it for the gallery
+type AIImageInfo struct {
+	Provider    string     `firestore:"provider" json:"provider"` // imagen or placeholder
+	Model       string     `firestore:"model,omitempty" json:"model,omitempty"`
+	Prompt      string     `firestore:"prompt" json:"prompt"`
+	Style       string     `firestore:"style,omitempty" json:"style,omitempty"` // lifestyle or marketing
+	GeneratedAt time.Time  `firestore:"generated_at" json:"generated_at"`
+	ApprovedAt  *time.Time `firestore:"approved_at,omitempty" json:"approved_at,omitempty"`
+}
+
+// ImageRendition is one stored size and format of a product image
+type ImageRendition struct {
+	Name   string `firestore:"name" json:"name"`     // thumbnail, card, full or original
+	Format string `firestore:"format" json:"format"` // jpeg, png or webp
+	URL    string `firestore:"url" json:"url"`
+	Width  int    `firestore:"width" json:"width"`
+	Height int    `firestore:"height" json:"height"`
+	Size   int64  `firestore:"size" json:"size"`
+}
+
+// URL returns the address of a rendition, preferring JPEG or PNG over WebP
+func (i *ProductImage) URL(name string) string {
+	url := ""
+	for _, rendition := range i.Renditions {
+		if rendition.Name != name {
+			continue
+		}
+		if rendition.Format != "webp" {
+			return rendition.URL
+		}
+		url = rendition.URL
+	}
+	return url
+}
+
+// FulfillmentMode is how a product is supplied to buyers
+type FulfillmentMode string
+
+const (
+	FulfillmentInStock     FulfillmentMode = "in_stock"      // sold from stock on hand
+	FulfillmentMadeToOrder FulfillmentMode = "made_to_order" // crafted after each order
+	FulfillmentPreOrder    FulfillmentMode = "pre_order"     // ordered ahead of a release date
 )
 
+// IsValid reports whether the mode is known; an empty mode means in stock
+func (m FulfillmentMode) IsValid() bool {
+	switch m {
+	case "", FulfillmentInStock, FulfillmentMadeToOrder, FulfillmentPreOrder:
+		return true
+	}
+	return false
+}
+
+// LeadTime is the number of days an item takes to make once production starts
+type LeadTime struct {
+	MinDays int `firestore:"min_days" json:"min_days"`
+	MaxDays int `firestore:"max_days" json:"max_days"`
+}
+
+// OrderableWithoutStock reports whether the product can be ordered with no stock on hand
+func (p *Product) OrderableWithoutStock() bool {
+	return p.Fulfillment == FulfillmentMadeToOrder || p.Fulfillment == FulfillmentPreOrder
+}
+
+// ProductOption is a dimension a product varies along, such as size or colour
+type ProductOption struct {
+	Name   string   `firestore:"name" json:"name"`
+	Values []string `firestore:"values" json:"values"`
+}
+
+// ProductVariant is one purchasable combination of a product's options
+type ProductVariant struct {
+	ID            string            `firestore:"id" json:"id"`
+	Options       map[string]string `firestore:"options" json:"options"` // option name -> value
+	SKU           string            `firestore:"sku,omitempty" json:"sku,omitempty"`
+	PriceMinor    int64             `firestore:"price_minor,omitempty" json:"price_minor,omitempty"` // overrides the product price when set
+	Price         float64           `firestore:"price,omitempty" json:"price,omitempty"`
+	Stock         int               `firestore:"stock" json:"stock"`
+	ReservedStock int               `firestore:"reserved_stock" json:"reserved_stock"`
+	Images        []string          `firestore:"images,omitempty" json:"images,omitempty"`
+
+	// DisplayPrice is the override price converted to the buyer's currency; it is not stored
+	DisplayPrice *Money `firestore:"-" json:"display_price,omitempty"`
+}
+
+// AvailableStock is the variant's stock that is not held by orders awaiting payment
+func (v *ProductVariant) AvailableStock() int {
+	return v.Stock - v.ReservedStock
+}
+
+// Label describes the variant's options in the product's option order, e.g. "M / Indigo"
+func (v *ProductVariant) Label(options []ProductOption) string {
+	values := make([]string, 0, len(options))
+	for _, option := range options {
+		if value := v.Options[option.Name]; value != "" {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, " / ")
+}
+
+// Variant returns the variant with the given ID, or nil
+func (p *Product) Variant(id string) *ProductVariant {
+	for i := range p.Variants {
+		if p.Variants[i].ID == id {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// SyncStock recomputes a variant product's stock totals from its variants and moves
+// the product between active and out of stock to match its availability. Products
+// made after ordering never run out of stock.
+func (p *Product) SyncStock() {
+	if len(p.Variants) > 0 {
+		p.Stock, p.ReservedStock = 0, 0
+		for _, variant := range p.Variants {
+			p.Stock += variant.Stock
+			p.ReservedStock += variant.ReservedStock
+		}
+	}
+
+	inStock := p.Stock > 0 || p.OrderableWithoutStock()
+	switch {
+	case p.Status == ProductStatusActive && !inStock:
+		p.Status = ProductStatusOutOfStock
+	case p.Status == ProductStatusOutOfStock && inStock:
+		p.Status = ProductStatusActive
+	}
+}
+
+// PublicProductStatuses are the statuses of approved products that may be shown to buyers
+var PublicProductStatuses = []ProductStatus{ProductStatusActive, ProductStatusOutOfStock}
+
+// IsPublic reports whether a product with this status has been approved for the marketplace
+func (s ProductStatus) IsPublic() bool {
+	for _, status := range PublicProductStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ProductModeration holds the latest moderation decision for a product
+type ProductModeration struct {
+	Decision   ModerationAction `firestore:"decision" json:"decision"`
+	Reason     string           `firestore:"reason,omitempty" json:"reason,omitempty"`
+	ReviewedBy string           `firestore:"reviewed_by" json:"reviewed_by"`
+	ReviewedAt time.Time        `firestore:"reviewed_at" json:"reviewed_at"`
+}
+
+type ModerationAction string
+
+const (
+	ModerationActionApprove        ModerationAction = "approved"
+	ModerationActionReject         ModerationAction = "rejected"
+	ModerationActionRequestChanges ModerationAction = "changes_requested"
+)
+
+// ModerationLog is an audit trail entry for a single moderation decision
+type ModerationLog struct {
+	ID         string           `firestore:"id" json:"id"`
+	ProductID  string           `firestore:"product_id" json:"product_id"`
+	ArtisanID  string           `firestore:"artisan_id" json:"artisan_id"`
+	AdminID    string           `firestore:"admin_id" json:"admin_id"`
+	Action     ModerationAction `firestore:"action" json:"action"`
+	FromStatus ProductStatus    `firestore:"from_status" json:"from_status"`
+	ToStatus   ProductStatus    `firestore:"to_status" json:"to_status"`
+	Reason     string           `firestore:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt  time.Time        `firestore:"created_at" json:"created_at"`
+}
+
 type ProductDimensions struct {
 	Length float64 `firestore:"length" json:"length"`
 	Width  float64 `firestore:"width" json:"width"`
@@ -123,7 +364,9 @@ type AIGeneratedContent struct {
 	WhatsAppCatalog WhatsAppCatalogEntry `firestore:"whatsapp_catalog" json:"whatsapp_catalog"`
 	FAQ             []FAQItem            `firestore:"faq,omitempty" json:"faq,omitempty"`
 	GeneratedAt     time.Time            `firestore:"generated_at" json:"generated_at"`
-	ModelVersion    string               `firestore:"model_version" json:"model_version"`
+	ModelVersion    string               `firestore:"model_version" json:"model_version"`                         // model the content was generated with
+	PromptTemplate  string               `firestore:"prompt_template,omitempty" json:"prompt_template,omitempty"` // prompt, category and language of the template
+	PromptVersion   int                  `firestore:"prompt_version" json:"prompt_version"`                       // template version; 0 for the built-in one
 	Confidence      float64              `firestore:"confidence" json:"confidence"`
 }
 
@@ -174,21 +417,48 @@ type FAQItem struct {
 
 // Order represents a purchase order
 type Order struct {
-	ID              string        `firestore:"id" json:"id"`
-	BuyerID         string        `firestore:"buyer_id" json:"buyer_id"`
-	ArtisanID       string        `firestore:"artisan_id" json:"artisan_id"`
-	Items           []OrderItem   `firestore:"items" json:"items"`
-	TotalAmount     float64       `firestore:"total_amount" json:"total_amount"`
-	Currency        string        `firestore:"currency" json:"currency"`
-	Status          OrderStatus   `firestore:"status" json:"status"`
-	PaymentStatus   string        `firestore:"payment_status" json:"payment_status"`
-	PaymentID       string        `firestore:"payment_id,omitempty" json:"payment_id,omitempty"`
-	ShippingAddress Address       `firestore:"shipping_address" json:"shipping_address"`
-	BillingAddress  Address       `firestore:"billing_address" json:"billing_address"`
-	CreatedAt       time.Time     `firestore:"created_at" json:"created_at"`
-	UpdatedAt       time.Time     `firestore:"updated_at" json:"updated_at"`
-	DeliveredAt     *time.Time    `firestore:"delivered_at,omitempty" json:"delivered_at,omitempty"`
-	TrackingInfo    *TrackingInfo `firestore:"tracking_info,omitempty" json:"tracking_info,omitempty"`
+	ID              string                `firestore:"id" json:"id"`
+	BuyerID         string                `firestore:"buyer_id" json:"buyer_id"`
+	ArtisanID       string                `firestore:"artisan_id" json:"artisan_id"`
+	Items           []OrderItem           `firestore:"items" json:"items"`
+	Subtotal        float64               `firestore:"subtotal" json:"subtotal"` // items before discounts and shipping
+	CouponCode      string                `firestore:"coupon_code,omitempty" json:"coupon_code,omitempty"`
+	CouponID        string                `firestore:"coupon_id,omitempty" json:"coupon_id,omitempty"`
+	DiscountTotal   float64               `firestore:"discount_total" json:"discount_total"` // coupon discount on items
+	ShippingLines   []ShippingLine        `firestore:"shipping_lines,omitempty" json:"shipping_lines,omitempty"`
+	ShippingTotal   float64               `firestore:"shipping_total" json:"shipping_total"`
+	TaxLines        []TaxLine             `firestore:"tax_lines,omitempty" json:"tax_lines,omitempty"`
+	TaxTotal        float64               `firestore:"tax_total" json:"tax_total"` // GST included in or added to the total
+	TotalAmount     float64               `firestore:"total_amount" json:"total_amount"`
+	Currency        string                `firestore:"currency" json:"currency"`
+	ExchangeRates   *ExchangeRateSnapshot `firestore:"exchange_rates,omitempty" json:"exchange_rates,omitempty"` // rates the order was priced with
+	DisplayCurrency string                `firestore:"display_currency,omitempty" json:"display_currency,omitempty"`
+	DisplayTotal    *Money                `firestore:"display_total,omitempty" json:"display_total,omitempty"`
+	Status          OrderStatus           `firestore:"status" json:"status"`
+	PaymentStatus   PaymentStatus         `firestore:"payment_status" json:"payment_status"`
+	PaymentID       string                `firestore:"payment_id,omitempty" json:"payment_id,omitempty"`
+	PaymentProvider string                `firestore:"payment_provider,omitempty" json:"payment_provider,omitempty"`
+	PaymentOrderID  string                `firestore:"payment_order_id,omitempty" json:"payment_order_id,omitempty"`
+	PaymentExpires  *time.Time            `firestore:"payment_expires_at,omitempty" json:"payment_expires_at,omitempty"`
+	PaidAt          *time.Time            `firestore:"paid_at,omitempty" json:"paid_at,omitempty"`
+	RefundStatus    RefundStatus          `firestore:"refund_status,omitempty" json:"refund_status,omitempty"` // status of the latest refund
+	RefundedAmount  float64               `firestore:"refunded_amount" json:"refunded_amount"`
+	ShippingAddress Address               `firestore:"shipping_address" json:"shipping_address"`
+	BillingAddress  Address               `firestore:"billing_address" json:"billing_address"`
+	CreatedAt       time.Time             `firestore:"created_at" json:"created_at"`
+	UpdatedAt       time.Time             `firestore:"updated_at" json:"updated_at"`
+	DeliveredAt     *time.Time            `firestore:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+	TrackingInfo    *TrackingInfo         `firestore:"tracking_info,omitempty" json:"tracking_info,omitempty"`
+
+	// Made-to-order items
+	EstimatedDispatch   *DispatchWindow `firestore:"estimated_dispatch,omitempty" json:"estimated_dispatch,omitempty"` // when the last made-to-order item should be ready
+	MadeToOrderArtisans []string        `firestore:"made_to_order_artisans,omitempty" json:"made_to_order_artisans,omitempty"`
+}
+
+// DispatchWindow is the range of dates an item is expected to be dispatched in
+type DispatchWindow struct {
+	Earliest time.Time `firestore:"earliest" json:"earliest"`
+	Latest   time.Time `firestore:"latest" json:"latest"`
 }
 
 type OrderStatus string
@@ -203,11 +473,222 @@ const (
 	OrderStatusRefunded   OrderStatus = "refunded"
 )
 
-type OrderItem struct {
+// ArtisanByProduct maps each ordered product ID to the artisan who sells it
+func (o *Order) ArtisanByProduct() map[string]string {
+	artisans := make(map[string]string, len(o.Items))
+	for _, item := range o.Items {
+		artisans[item.ProductID] = item.ArtisanID
+	}
+	return artisans
+}
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending           PaymentStatus = "pending"
+	PaymentStatusFailed            PaymentStatus = "failed" // last attempt failed; the buyer may retry until the payment expires
+	PaymentStatusCaptured          PaymentStatus = "captured"
+	PaymentStatusExpired           PaymentStatus = "expired"
+	PaymentStatusCancelled         PaymentStatus = "cancelled"
+	PaymentStatusPartiallyRefunded PaymentStatus = "partially_refunded"
+	PaymentStatusRefunded          PaymentStatus = "refunded"
+)
+
+// Coupon is a discount code offered by an artisan on their own products, or by the
+// platform when ArtisanID is empty
+type Coupon struct {
+	ID            string     `firestore:"id" json:"id"`
+	Code          string     `firestore:"code" json:"code"`
+	ArtisanID     string     `firestore:"artisan_id,omitempty" json:"artisan_id,omitempty"`
+	Description   string     `firestore:"description,omitempty" json:"description,omitempty"`
+	Type          CouponType `firestore:"type" json:"type"`
+	Value         float64    `firestore:"value" json:"value"`                                   // percent, or amount for flat coupons
+	MaxDiscount   float64    `firestore:"max_discount,omitempty" json:"max_discount,omitempty"` // cap on percentage discounts
+	BuyQuantity   int        `firestore:"buy_quantity,omitempty" json:"buy_quantity,omitempty"`
+	GetQuantity   int        `firestore:"get_quantity,omitempty" json:"get_quantity,omitempty"`
+	Currency      string     `firestore:"currency" json:"currency"`
+	MinOrderValue float64    `firestore:"min_order_value,omitempty" json:"min_order_value,omitempty"` // of the eligible items
+	ProductIDs    []string   `firestore:"product_ids,omitempty" json:"product_ids,omitempty"`
+	Categories    []string   `firestore:"categories,omitempty" json:"categories,omitempty"`
+	StartsAt      *time.Time `firestore:"starts_at,omitempty" json:"starts_at,omitempty"`
+	EndsAt        *time.Time `firestore:"ends_at,omitempty" json:"ends_at,omitempty"`
+	UsageLimit    int        `firestore:"usage_limit,omitempty" json:"usage_limit,omitempty"`       // total redemptions; 0 for unlimited
+	PerUserLimit  int        `firestore:"per_user_limit,omitempty" json:"per_user_limit,omitempty"` // redemptions per buyer; 0 for unlimited
+	UsedCount     int        `firestore:"used_count" json:"used_count"`
+	Active        bool       `firestore:"active" json:"active"`
+	CreatedBy     string     `firestore:"created_by" json:"created_by"`
+	CreatedAt     time.Time  `firestore:"created_at" json:"created_at"`
+	UpdatedAt     time.Time  `firestore:"updated_at" json:"updated_at"`
+}
+
+type CouponType string
+
+const (
+	CouponTypePercentage   CouponType = "percentage"
+	CouponTypeFlat         CouponType = "flat"
+	CouponTypeBuyXGetY     CouponType = "buy_x_get_y"
+	CouponTypeFreeShipping CouponType = "free_shipping"
+)
+
+// IsValid checks if the coupon type is one of the known values
+func (t CouponType) IsValid() bool {
+	switch t {
+	case CouponTypePercentage, CouponTypeFlat, CouponTypeBuyXGetY, CouponTypeFreeShipping:
+		return true
+	}
+	return false
+}
+
+// Refund is a buyer's request to get money back for some or all of an order's items
+type Refund struct {
+	ID               string       `firestore:"id" json:"id"`
+	OrderID          string       `firestore:"order_id" json:"order_id"`
+	BuyerID          string       `firestore:"buyer_id" json:"buyer_id"`
+	ArtisanIDs       []string     `firestore:"artisan_ids" json:"artisan_ids"` // artisans whose items are refunded
+	Items            []RefundItem `firestore:"items" json:"items"`
+	Amount           float64      `firestore:"amount" json:"amount"`
+	Full             bool         `firestore:"full" json:"full"` // covers everything left on the order
+	Reason           string       `firestore:"reason" json:"reason"`
+	Status           RefundStatus `firestore:"status" json:"status"`
+	ProviderRefundID string       `firestore:"provider_refund_id,omitempty" json:"provider_refund_id,omitempty"`
+	PaymentID        string       `firestore:"payment_id,omitempty" json:"payment_id,omitempty"` // payment to refund when it is not the order's
+	ReviewedBy       string       `firestore:"reviewed_by,omitempty" json:"reviewed_by,omitempty"`
+	DecisionReason   string       `firestore:"decision_reason,omitempty" json:"decision_reason,omitempty"`
+	FailureReason    string       `firestore:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	Restocked        bool         `firestore:"restocked,omitempty" json:"restocked,omitempty"` // the refunded units went back into stock
+	ReturnReceivedAt *time.Time   `firestore:"return_received_at,omitempty" json:"return_received_at,omitempty"`
+	CreatedAt        time.Time    `firestore:"created_at" json:"created_at"`
+	UpdatedAt        time.Time    `firestore:"updated_at" json:"updated_at"`
+	ReviewedAt       *time.Time   `firestore:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+	CompletedAt      *time.Time   `firestore:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+type RefundItem struct {
 	ProductID string  `firestore:"product_id" json:"product_id"`
+	VariantID string  `firestore:"variant_id,omitempty" json:"variant_id,omitempty"`
+	ArtisanID string  `firestore:"artisan_id" json:"artisan_id"`
 	Quantity  int     `firestore:"quantity" json:"quantity"`
-	Price     float64 `firestore:"price" json:"price"`
-	Total     float64 `firestore:"total" json:"total"`
+	Amount    float64 `firestore:"amount" json:"amount"`
+}
+
+type RefundStatus string
+
+const (
+	RefundStatusRequested  RefundStatus = "requested"
+	RefundStatusRejected   RefundStatus = "rejected"
+	RefundStatusProcessing RefundStatus = "processing" // approved and sent to the payment provider
+	RefundStatusCompleted  RefundStatus = "completed"
+	RefundStatusFailed     RefundStatus = "failed"
+)
+
+// IsOpen reports whether a refund in this status still needs action
+func (s RefundStatus) IsOpen() bool {
+	return s == RefundStatusRequested || s == RefundStatusProcessing || s == RefundStatusFailed
+}
+
+// PaymentEvent records a processed payment provider webhook so redeliveries are ignored
+type PaymentEvent struct {
+	ID             string    `firestore:"id" json:"id"`
+	Provider       string    `firestore:"provider" json:"provider"`
+	Type           string    `firestore:"type" json:"type"`
+	PaymentOrderID string    `firestore:"payment_order_id" json:"payment_order_id"`
+	PaymentID      string    `firestore:"payment_id,omitempty" json:"payment_id,omitempty"`
+	OrderID        string    `firestore:"order_id,omitempty" json:"order_id,omitempty"`
+	ProcessedAt    time.Time `firestore:"processed_at" json:"processed_at"`
+}
+
+type OrderItem struct {
+	ProductID           string          `firestore:"product_id" json:"product_id"`
+	VariantID           string          `firestore:"variant_id,omitempty" json:"variant_id,omitempty"`
+	VariantLabel        string          `firestore:"variant_label,omitempty" json:"variant_label,omitempty"` // e.g. "M / Indigo"
+	SKU                 string          `firestore:"sku,omitempty" json:"sku,omitempty"`
+	MadeToOrder         bool            `firestore:"made_to_order,omitempty" json:"made_to_order,omitempty"` // made or released after ordering; holds no stock
+	Dispatch            *DispatchWindow `firestore:"dispatch,omitempty" json:"dispatch,omitempty"`           // estimated dispatch for made-to-order items
+	ProductionStartedAt *time.Time      `firestore:"production_started_at,omitempty" json:"production_started_at,omitempty"`
+	ArtisanID           string          `firestore:"artisan_id" json:"artisan_id"`
+	Quantity            int             `firestore:"quantity" json:"quantity"`
+	RefundedQuantity    int             `firestore:"refunded_quantity" json:"refunded_quantity"` // units covered by approved refunds
+	Price               float64         `firestore:"price" json:"price"`                         // unit price in the order currency
+	Total               float64         `firestore:"total" json:"total"`
+	Discount            float64         `firestore:"discount" json:"discount"`                         // coupon discount on this line's total
+	ListPrice           *Money          `firestore:"list_price,omitempty" json:"list_price,omitempty"` // unit price in the product's own currency
+}
+
+// LineKey identifies the product, or product variant, an order line is for
+func LineKey(productID, variantID string) string {
+	if variantID == "" {
+		return productID
+	}
+	return productID + "/" + variantID
+}
+
+// Money is an amount in a currency's minor units (paise, cents)
+type Money struct {
+	Amount   int64  `firestore:"amount" json:"amount"`
+	Currency string `firestore:"currency" json:"currency"`
+}
+
+// ExchangeRateSnapshot records the exchange rates an order was priced with, as units
+// of each currency per unit of Base
+type ExchangeRateSnapshot struct {
+	Base   string             `firestore:"base" json:"base"`
+	Rates  map[string]float64 `firestore:"rates" json:"rates"`
+	Source string             `firestore:"source" json:"source"`
+	AsOf   time.Time          `firestore:"as_of" json:"as_of"`
+}
+
+// ShippingLine is the shipping charge for one artisan's parcel on an order
+type ShippingLine struct {
+	ArtisanID        string  `firestore:"artisan_id" json:"artisan_id"`
+	Zone             string  `firestore:"zone" json:"zone"`
+	OriginPostalCode string  `firestore:"origin_postal_code,omitempty" json:"origin_postal_code,omitempty"`
+	ActualWeight     float64 `firestore:"actual_weight" json:"actual_weight"`         // kg
+	VolumetricWeight float64 `firestore:"volumetric_weight" json:"volumetric_weight"` // kg
+	ChargeableWeight float64 `firestore:"chargeable_weight" json:"chargeable_weight"` // kg, the greater of the two rounded up to the rate slab
+	Amount           float64 `firestore:"amount" json:"amount"`
+	FreeShipping     bool    `firestore:"free_shipping" json:"free_shipping"`
+}
+
+// TaxLine is the GST on one order line or one artisan's shipping charge
+type TaxLine struct {
+	ArtisanID    string  `firestore:"artisan_id" json:"artisan_id"`
+	ProductID    string  `firestore:"product_id,omitempty" json:"product_id,omitempty"` // empty for shipping
+	Description  string  `firestore:"description" json:"description"`
+	HSNCode      string  `firestore:"hsn_code" json:"hsn_code"` // SAC for shipping
+	Quantity     int     `firestore:"quantity" json:"quantity"`
+	Rate         float64 `firestore:"rate" json:"rate"` // percent
+	TaxableValue float64 `firestore:"taxable_value" json:"taxable_value"`
+	CGST         float64 `firestore:"cgst" json:"cgst"`
+	SGST         float64 `firestore:"sgst" json:"sgst"`
+	IGST         float64 `firestore:"igst" json:"igst"`
+	Total        float64 `firestore:"total" json:"total"`
+}
+
+// Invoice is an artisan's GST invoice for their items on an order
+type Invoice struct {
+	ID            string    `firestore:"id" json:"id"`
+	Number        string    `firestore:"number" json:"number"`
+	Sequence      int       `firestore:"sequence" json:"sequence"`
+	FinancialYear string    `firestore:"financial_year" json:"financial_year"` // e.g. 2026-27
+	OrderID       string    `firestore:"order_id" json:"order_id"`
+	ArtisanID     string    `firestore:"artisan_id" json:"artisan_id"`
+	BuyerID       string    `firestore:"buyer_id" json:"buyer_id"`
+	SellerName    string    `firestore:"seller_name" json:"seller_name"`
+	SellerAddress string    `firestore:"seller_address" json:"seller_address"`
+	SellerState   string    `firestore:"seller_state,omitempty" json:"seller_state,omitempty"`
+	SellerGSTIN   string    `firestore:"seller_gstin,omitempty" json:"seller_gstin,omitempty"`
+	BillTo        Address   `firestore:"bill_to" json:"bill_to"`
+	ShipTo        Address   `firestore:"ship_to" json:"ship_to"`
+	Interstate    bool      `firestore:"interstate" json:"interstate"`
+	Lines         []TaxLine `firestore:"lines" json:"lines"`
+	TaxableValue  float64   `firestore:"taxable_value" json:"taxable_value"`
+	CGST          float64   `firestore:"cgst" json:"cgst"`
+	SGST          float64   `firestore:"sgst" json:"sgst"`
+	IGST          float64   `firestore:"igst" json:"igst"`
+	Total         float64   `firestore:"total" json:"total"`
+	Currency      string    `firestore:"currency" json:"currency"`
+	FileName      string    `firestore:"file_name,omitempty" json:"-"` // archived PDF in storage
+	IssuedAt      time.Time `firestore:"issued_at" json:"issued_at"`
 }
 
 type Address struct {
@@ -227,23 +708,93 @@ type TrackingInfo struct {
 	EstimatedDelivery *time.Time `firestore:"estimated_delivery,omitempty" json:"estimated_delivery,omitempty"`
 }
 
+// Shipment is a parcel an artisan has handed to a carrier for (part of) an order
+type Shipment struct {
+	ID                string          `firestore:"id" json:"id"`
+	OrderID           string          `firestore:"order_id" json:"order_id"`
+	BuyerID           string          `firestore:"buyer_id" json:"buyer_id"`
+	ArtisanID         string          `firestore:"artisan_id" json:"artisan_id"`
+	ProductIDs        []string        `firestore:"product_ids" json:"product_ids"`
+	Items             []ShipmentItem  `firestore:"items,omitempty" json:"items,omitempty"` // the units shipped of each line
+	Carrier           string          `firestore:"carrier" json:"carrier"`
+	TrackingNumber    string          `firestore:"tracking_number" json:"tracking_number"`
+	Status            ShipmentStatus  `firestore:"status" json:"status"`
+	Tracked           bool            `firestore:"tracked" json:"tracked"` // the carrier sends tracking updates
+	EstimatedDelivery *time.Time      `firestore:"estimated_delivery,omitempty" json:"estimated_delivery,omitempty"`
+	Events            []TrackingEvent `firestore:"events" json:"events"`
+	CreatedAt         time.Time       `firestore:"created_at" json:"created_at"`
+	UpdatedAt         time.Time       `firestore:"updated_at" json:"updated_at"`
+	CheckedAt         time.Time       `firestore:"checked_at" json:"-"` // last carrier update or poll
+	DeliveredAt       *time.Time      `firestore:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+}
+
+// ShipmentItem is the quantity of one order line in a shipment
+type ShipmentItem struct {
+	ProductID string `firestore:"product_id" json:"product_id"`
+	VariantID string `firestore:"variant_id,omitempty" json:"variant_id,omitempty"`
+	Quantity  int    `firestore:"quantity" json:"quantity"`
+}
+
+// TrackingEvent is one checkpoint reported by a carrier
+type TrackingEvent struct {
+	Status      ShipmentStatus `firestore:"status" json:"status"`
+	Description string         `firestore:"description" json:"description"`
+	Location    string         `firestore:"location,omitempty" json:"location,omitempty"`
+	OccurredAt  time.Time      `firestore:"occurred_at" json:"occurred_at"`
+}
+
+type ShipmentStatus string
+
+const (
+	ShipmentStatusShipped        ShipmentStatus = "shipped"
+	ShipmentStatusInTransit      ShipmentStatus = "in_transit"
+	ShipmentStatusOutForDelivery ShipmentStatus = "out_for_delivery"
+	ShipmentStatusDelivered      ShipmentStatus = "delivered"
+	ShipmentStatusException      ShipmentStatus = "exception"
+)
+
+// IsValid reports whether s is a known shipment status
+func (s ShipmentStatus) IsValid() bool {
+	switch s {
+	case ShipmentStatusShipped, ShipmentStatusInTransit, ShipmentStatusOutForDelivery,
+		ShipmentStatusDelivered, ShipmentStatusException:
+		return true
+	}
+	return false
+}
+
 // Review represents product reviews
 type Review struct {
-	ID        string    `firestore:"id" json:"id"`
-	ProductID string    `firestore:"product_id" json:"product_id"`
-	ArtisanID string    `firestore:"artisan_id" json:"artisan_id"`
-	BuyerID   string    `firestore:"buyer_id" json:"buyer_id"`
-	OrderID   string    `firestore:"order_id" json:"order_id"`
-	Rating    int       `firestore:"rating" json:"rating"` // 1-5
-	Title     string    `firestore:"title,omitempty" json:"title,omitempty"`
-	Comment   string    `firestore:"comment,omitempty" json:"comment,omitempty"`
-	Images    []string  `firestore:"images,omitempty" json:"images,omitempty"`
-	Verified  bool      `firestore:"verified" json:"verified"`
-	Helpful   int       `firestore:"helpful" json:"helpful"`
+	ID        string       `firestore:"id" json:"id"`
+	ProductID string       `firestore:"product_id" json:"product_id"`
+	ArtisanID string       `firestore:"artisan_id" json:"artisan_id"`
+	BuyerID   string       `firestore:"buyer_id" json:"buyer_id"`
+	OrderID   string       `firestore:"order_id" json:"order_id"`
+	Rating    int          `firestore:"rating" json:"rating"` // 1-5
+	Title     string       `firestore:"title,omitempty" json:"title,omitempty"`
+	Comment   string       `firestore:"comment,omitempty" json:"comment,omitempty"`
+	Images    []string     `firestore:"images,omitempty" json:"images,omitempty"`
+	Verified  bool         `firestore:"verified" json:"verified"`
+	Helpful   int          `firestore:"helpful" json:"helpful"`
+	Reply     *ReviewReply `firestore:"reply,omitempty" json:"reply,omitempty"`
+	CreatedAt time.Time    `firestore:"created_at" json:"created_at"`
+	UpdatedAt time.Time    `firestore:"updated_at" json:"updated_at"`
+}
+
+// ReviewReply is the artisan's public response to a review
+type ReviewReply struct {
+	Comment   string    `firestore:"comment" json:"comment"`
 	CreatedAt time.Time `firestore:"created_at" json:"created_at"`
 	UpdatedAt time.Time `firestore:"updated_at" json:"updated_at"`
 }
 
+// ReviewVote records that a user marked a review as helpful
+type ReviewVote struct {
+	ReviewID  string    `firestore:"review_id" json:"review_id"`
+	UserID    string    `firestore:"user_id" json:"user_id"`
+	CreatedAt time.Time `firestore:"created_at" json:"created_at"`
+}
+
 // Cart represents shopping cart
 type Cart struct {
 	ID        string     `firestore:"id" json:"id"`
@@ -266,3 +817,188 @@ type Follow struct {
 	ArtisanID  string    `firestore:"artisan_id" json:"artisan_id"`
 	CreatedAt  time.Time `firestore:"created_at" json:"created_at"`
 }
+
+// Wishlist is a buyer's named list of saved products
+type Wishlist struct {
+	ID        string    `firestore:"id" json:"id"`
+	UserID    string    `firestore:"user_id" json:"user_id"`
+	Name      string    `firestore:"name" json:"name"`
+	ItemCount int       `firestore:"item_count" json:"item_count"`
+	CreatedAt time.Time `firestore:"created_at" json:"created_at"`
+	UpdatedAt time.Time `firestore:"updated_at" json:"updated_at"`
+}
+
+// WishlistItem is a product saved to a wishlist. Items are stored on their own so the
+// buyers watching a product can be found when its price drops or it is restocked.
+type WishlistItem struct {
+	ID         string    `firestore:"id" json:"id"`
+	WishlistID string    `firestore:"wishlist_id" json:"wishlist_id"`
+	UserID     string    `firestore:"user_id" json:"user_id"`
+	ProductID  string    `firestore:"product_id" json:"product_id"`
+	AddedPrice *Money    `firestore:"added_price,omitempty" json:"added_price,omitempty"` // price when saved
+	AddedAt    time.Time `firestore:"added_at" json:"added_at"`
+}
+
+// UploadPurpose is what a direct upload will be attached to once finalized
+type UploadPurpose string
+
+const (
+	UploadPurposeProductImage UploadPurpose = "product_image" // appended to a product's photos
+	UploadPurposeAvatar       UploadPurpose = "avatar"        // the artisan's profile picture
+	UploadPurposeVoiceStory   UploadPurpose = "voice_story"   // the recording on a product's voice story
+)
+
+// IsValid reports whether the purpose is known
+func (p UploadPurpose) IsValid() bool {
+	switch p {
+	case UploadPurposeProductImage, UploadPurposeAvatar, UploadPurposeVoiceStory:
+		return true
+	}
+	return false
+}
+
+// IsImage reports whether the upload is an image
+func (p UploadPurpose) IsImage() bool {
+	return p == UploadPurposeProductImage || p == UploadPurposeAvatar
+}
+
+type UploadSessionStatus string
+
+const (
+	UploadSessionPending    UploadSessionStatus = "pending"    // waiting for the client's upload
+	UploadSessionFinalizing UploadSessionStatus = "finalizing" // being verified and attached
+	UploadSessionCompleted  UploadSessionStatus = "completed"
+	UploadSessionFailed     UploadSessionStatus = "failed"
+)
+
+// UploadSession is a file the client uploads straight to Cloud Storage with a signed
+// URL. The object lands under a quarantine prefix and is only attached to its target
+// after the server has checked it.
+type UploadSession struct {
+	ID          string              `firestore:"id" json:"id"`
+	UserID      string              `firestore:"user_id" json:"user_id"`
+	Purpose     UploadPurpose       `firestore:"purpose" json:"purpose"`
+	ProductID   string              `firestore:"product_id,omitempty" json:"product_id,omitempty"` // for product images and voice stories
+	FileName    string              `firestore:"file_name,omitempty" json:"file_name,omitempty"`   // the client's name for the file
+	ContentType string              `firestore:"content_type" json:"content_type"`                 // declared by the client
+	Size        int64               `firestore:"size" json:"size"`                                 // declared by the client, in bytes
+	Resumable   bool                `firestore:"resumable" json:"resumable"`
+	Enhance     string              `firestore:"enhance,omitempty" json:"enhance,omitempty"` // product images: auto or studio enhancement
+	ObjectName  string              `firestore:"object_name" json:"-"`                       // quarantined object in the uploads bucket
+	Status      UploadSessionStatus `firestore:"status" json:"status"`
+	Error       string              `firestore:"error,omitempty" json:"error,omitempty"`
+	URL         string              `firestore:"url,omitempty" json:"url,omitempty"` // the stored file once completed
+	ExpiresAt   time.Time           `firestore:"expires_at" json:"expires_at"`
+	CreatedAt   time.Time           `firestore:"created_at" json:"created_at"`
+	CompletedAt *time.Time          `firestore:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// DailyMarketplaceStats is the incrementally maintained aggregate for a single day
+type DailyMarketplaceStats struct {
+	Date              string                `firestore:"date" json:"date"` // YYYY-MM-DD (UTC)
+	GMV               float64               `firestore:"gmv" json:"gmv"`
+	OrdersPlaced      int                   `firestore:"orders_placed" json:"orders_placed"`
+	OrdersByStatus    map[string]int        `firestore:"orders_by_status" json:"orders_by_status"` // orders that moved into each status that day
+	NewBuyers         int                   `firestore:"new_buyers" json:"new_buyers"`
+	NewArtisans       int                   `firestore:"new_artisans" json:"new_artisans"`
+	ProductSales      map[string]SalesTally `firestore:"product_sales" json:"-"`
+	ArtisanSales      map[string]SalesTally `firestore:"artisan_sales" json:"-"`
+	AIGenerations     int                   `firestore:"ai_generations" json:"ai_generations"`
+	AIConfidenceSum   float64               `firestore:"ai_confidence_sum" json:"-"`
+	VoiceSeconds      float64               `firestore:"voice_seconds" json:"voice_seconds"`
+	DraftsCreated     int                   `firestore:"drafts_created" json:"drafts_created"`
+	ProductsPublished int                   `firestore:"products_published" json:"products_published"`
+}
+
+type SalesTally struct {
+	Units   int     `firestore:"units" json:"units"`
+	Revenue float64 `firestore:"revenue" json:"revenue"`
+}
+
+// RankedSales is an entry in a top-sellers list
+type RankedSales struct {
+	ID      string  `json:"id"`
+	Units   int     `json:"units"`
+	Revenue float64 `json:"revenue"`
+}
+
+// MarketplaceStats summarises the daily aggregates over a date range
+type MarketplaceStats struct {
+	From                string                  `json:"from"`
+	To                  string                  `json:"to"`
+	GMV                 float64                 `json:"gmv"`
+	OrdersPlaced        int                     `json:"orders_placed"`
+	OrdersByStatus      map[string]int          `json:"orders_by_status"`
+	NewBuyers           int                     `json:"new_buyers"`
+	NewArtisans         int                     `json:"new_artisans"`
+	TopProducts         []RankedSales           `json:"top_products"`
+	TopArtisans         []RankedSales           `json:"top_artisans"`
+	AIGenerations       int                     `json:"ai_generations"`
+	AverageAIConfidence float64                 `json:"average_ai_confidence"`
+	VoiceMinutes        float64                 `json:"voice_minutes"`
+	DraftsCreated       int                     `json:"drafts_created"`
+	ProductsPublished   int                     `json:"products_published"`
+	DraftConversionRate float64                 `json:"draft_conversion_rate"`
+	Daily               []DailyMarketplaceStats `json:"daily"`
+}
+
+// ProductMetrics are the engagement and sales counters tracked for artisan analytics
+type ProductMetrics struct {
+	Views   int     `firestore:"views" json:"views"`
+	Likes   int     `firestore:"likes" json:"likes"`
+	Shares  int     `firestore:"shares" json:"shares"`
+	Orders  int     `firestore:"orders" json:"orders"`
+	Units   int     `firestore:"units" json:"units"`
+	Revenue float64 `firestore:"revenue" json:"revenue"`
+}
+
+// ConversionRate is the share of product views that turned into orders
+func (m ProductMetrics) ConversionRate() float64 {
+	if m.Views == 0 {
+		return 0
+	}
+	return float64(m.Orders) / float64(m.Views)
+}
+
+// ArtisanDailyRollup holds one artisan's counters for a single day, in total and per product
+type ArtisanDailyRollup struct {
+	ArtisanID string `firestore:"artisan_id" json:"artisan_id"`
+	Date      string `firestore:"date" json:"date"` // YYYY-MM-DD (UTC)
+	ProductMetrics
+	Products map[string]ProductMetrics `firestore:"products" json:"products,omitempty"`
+}
+
+// DailyMetrics is one point of an analytics time series
+type DailyMetrics struct {
+	Date string `json:"date"`
+	ProductMetrics
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// ProductAnalytics summarises a single product over a date range
+type ProductAnalytics struct {
+	ProductID string `json:"product_id"`
+	Title     string `json:"title,omitempty"`
+	ProductMetrics
+	ConversionRate float64        `json:"conversion_rate"`
+	Daily          []DailyMetrics `json:"daily,omitempty"`
+}
+
+// ArtisanAnalytics summarises an artisan's products over a date range
+type ArtisanAnalytics struct {
+	ArtisanID      string             `json:"artisan_id"`
+	From           string             `json:"from"`
+	To             string             `json:"to"`
+	Totals         ProductMetrics     `json:"totals"`
+	ConversionRate float64            `json:"conversion_rate"`
+	Daily          []DailyMetrics     `json:"daily"`
+	Products       []ProductAnalytics `json:"products"`
+}
+
+// ProductLike records that a user liked a product
+type ProductLike struct {
+	UserID    string    `firestore:"user_id" json:"user_id"`
+	ProductID string    `firestore:"product_id" json:"product_id"`
+	ArtisanID string    `firestore:"artisan_id" json:"artisan_id"`
+	CreatedAt time.Time `firestore:"created_at" json:"created_at"`
+}
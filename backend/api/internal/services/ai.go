@@ -3,8 +3,11 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
+	"voicecraft-market/internal/models"
 
 	"cloud.google.com/go/vertexai/genai"
 )
@@ -14,14 +17,25 @@ type VertexAIService struct {
 	ctx      context.Context
 	location string
 	model    string
+	prompts  *PromptLibrary
 }
 
+// MaxGenerationImages caps the product photos sent with one generation request
+const MaxGenerationImages = 4
+
 type ProductGenerationRequest struct {
-	Transcript   string `json:"transcript"`
-	Language     string `json:"language"`
-	ArtisanName  string `json:"artisan_name,omitempty"`
-	ArtisanCraft string `json:"artisan_craft,omitempty"`
-	Category     string `json:"category,omitempty"`
+	Transcript   string           `json:"transcript"`
+	Language     string           `json:"language"`
+	ArtisanName  string           `json:"artisan_name,omitempty"`
+	ArtisanCraft string           `json:"artisan_craft,omitempty"`
+	Category     string           `json:"category,omitempty"`
+	Images       []ImageReference `json:"images,omitempty"` // photos of the product for the model to look at
+}
+
+// ImageReference is a stored product photo the model reads straight from Cloud Storage
+type ImageReference struct {
+	URI      string `json:"uri"` // gs://bucket/object
+	MimeType string `json:"mime_type"`
 }
 
 type ProductGenerationResponse struct {
@@ -39,6 +53,56 @@ type ProductGenerationResponse struct {
 	CraftingTime    string                    `json:"crafting_time"`
 	Tags            []string                  `json:"tags"`
 	Confidence      float64                   `json:"confidence"`
+	Discrepancies   []DiscrepancyGeneration   `json:"discrepancies,omitempty"` // where the photos disagree with the transcript
+
+	// What the listing was generated with, named as in models.AIGeneratedContent
+	GeneratedAt    time.Time `json:"generated_at"`
+	ModelVersion   string    `json:"model_version"`
+	PromptTemplate string    `json:"prompt_template"` // PromptTemplate.Key
+	PromptVersion  int       `json:"prompt_version"`
+}
+
+// ErrDraftNotFound is returned when a user has no saved draft with an ID
+var ErrDraftNotFound = errors.New("draft not found")
+
+// GenerationDetails returns what the listing was generated with, as recorded on a
+// product's AI-generated content
+func (r *ProductGenerationResponse) GenerationDetails() *models.AIGeneratedContent {
+	return &models.AIGeneratedContent{
+		GeneratedAt:    r.GeneratedAt,
+		ModelVersion:   r.ModelVersion,
+		PromptTemplate: r.PromptTemplate,
+		PromptVersion:  r.PromptVersion,
+		Confidence:     r.Confidence,
+	}
+}
+
+// GetDraftGeneration returns the generated listing saved in one of the user's drafts
+func (fs *FirestoreService) GetDraftGeneration(draftID, userID string) (*ProductGenerationResponse, error) {
+	var draft struct {
+		UserID    string                     `firestore:"user_id"`
+		Generated *ProductGenerationResponse `firestore:"generated"`
+	}
+	if err := fs.GetDocument(DraftsCollection, draftID, &draft); err != nil {
+		if isNotFound(err) {
+			return nil, ErrDraftNotFound
+		}
+		return nil, err
+	}
+	if draft.UserID != userID || draft.Generated == nil {
+		return nil, ErrDraftNotFound
+	}
+	return draft.Generated, nil
+}
+
+// DiscrepancyGeneration is a detail the artisan described differently from how the
+// product looks in the photos
+type DiscrepancyGeneration struct {
+	Field      string `json:"field"`      // colour, material, size, quantity or other
+	Voice      string `json:"voice"`      // what the transcript says
+	Photo      string `json:"photo"`      // what the photos show
+	Severity   string `json:"severity"`   // high when a buyer would be misled, otherwise low
+	Suggestion string `json:"suggestion"` // what the artisan could check or correct
 }
 
 type SocialMediaGeneration struct {
@@ -84,7 +148,7 @@ type FAQGeneration struct {
 	Answer   string `json:"answer"`
 }
 
-func NewVertexAIService(ctx context.Context, projectID, location, model string) (*VertexAIService, error) {
+func NewVertexAIService(ctx context.Context, projectID, location, model string, prompts *PromptLibrary) (*VertexAIService, error) {
 	client, err := genai.NewClient(ctx, projectID, location)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Vertex AI client: %v", err)
@@ -95,6 +159,7 @@ func NewVertexAIService(ctx context.Context, projectID, location, model string)
 		ctx:      ctx,
 		location: location,
 		model:    model,
+		prompts:  prompts,
 	}, nil
 }
 
@@ -102,135 +167,122 @@ func (v *VertexAIService) Close() error {
 	return v.client.Close()
 }
 
+// Model returns the name of the model content is generated with
+func (v *VertexAIService) Model() string {
+	return v.model
+}
+
+// Prompts returns the prompt templates the service writes its prompts from
+func (v *VertexAIService) Prompts() *PromptLibrary {
+	return v.prompts
+}
+
 func (v *VertexAIService) GenerateProductContent(req *ProductGenerationRequest) (*ProductGenerationResponse, error) {
-	prompt := v.buildPrompt(req)
+	parts, template, err := v.productParts(v.ctx, req)
+	if err != nil {
+		return nil, err
+	}
 
+	resp, err := v.productModel().GenerateContent(v.ctx, parts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %v", err)
+	}
+
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("no content generated")
+	}
+
+	responseText := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	return v.parseProductContent(string(responseText), template)
+}
+
+// productModel is the model configured for writing listings
+func (v *VertexAIService) productModel() *genai.GenerativeModel {
 	model := v.client.GenerativeModel(v.model)
 	model.SetTemperature(0.7)
 	model.SetTopK(40)
 	model.SetTopP(0.8)
 	model.SetMaxOutputTokens(4000)
+	return model
+}
 
-	resp, err := model.GenerateContent(v.ctx, genai.Text(prompt))
+// productParts is the prompt for a listing followed by the product photos, which the
+// model reads from storage, and the template the prompt was written from
+func (v *VertexAIService) productParts(ctx context.Context, req *ProductGenerationRequest) ([]genai.Part, *PromptTemplate, error) {
+	prompt, template, err := v.buildPrompt(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate content: %v", err)
+		return nil, nil, err
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no content generated")
+	parts := []genai.Part{genai.Text(prompt)}
+	for _, image := range req.Images {
+		parts = append(parts, genai.FileData{MIMEType: image.MimeType, FileURI: image.URI})
 	}
+	return parts, template, nil
+}
 
-	responseText := resp.Candidates[0].Content.Parts[0].(genai.Text)
+// parseProductContent decodes and checks the JSON listing the model wrote from template
+func (v *VertexAIService) parseProductContent(text string, template *PromptTemplate) (*ProductGenerationResponse, error) {
+	// Models sometimes wrap the JSON in a Markdown code block
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "```"), "```")
 
 	// Parse the JSON response
 	var result ProductGenerationResponse
-	if err := json.Unmarshal([]byte(responseText), &result); err != nil {
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
 		return nil, fmt.Errorf("failed to parse generated content: %v", err)
 	}
+	if strings.TrimSpace(result.ProductTitle) == "" || strings.TrimSpace(result.Description) == "" {
+		return nil, fmt.Errorf("generated content has no title or description")
+	}
 
 	// Set confidence based on response quality
 	result.Confidence = v.calculateConfidence(&result)
 
+	result.GeneratedAt = time.Now()
+	result.ModelVersion = v.model
+	result.PromptTemplate = template.Key()
+	result.PromptVersion = template.Version
+
 	return &result, nil
 }
 
-func (v *VertexAIService) buildPrompt(req *ProductGenerationRequest) string {
-	languages := map[string]string{
-		"english":  "English",
-		"hindi":    "Hindi",
-		"hinglish": "Hinglish (mix of Hindi and English)",
-	}
-
-	languageName := languages[req.Language]
-	if languageName == "" {
-		languageName = "English"
-	}
-
-	prompt := fmt.Sprintf(`You are an AI assistant helping Indian artisans create compelling product listings and social media content. 
-
-Based on the following voice transcript from an artisan describing their handcrafted product, generate comprehensive content in JSON format:
-
-**Voice Transcript:** "%s"
-**Language:** %s
-**Artisan Name:** %s
-**Artisan Craft:** %s
-**Category:** %s
-
-Generate a JSON response with the following structure:
-
-{
-  "product_title": "Catchy, SEO-friendly product title",
-  "description": "Detailed product description (200-300 words) highlighting craftsmanship, materials, and cultural significance",
-  "suggested_price": 1500.0,
-  "currency": "INR",
-  "artisan_story": {
-    "english": "Artisan's story in English (100-150 words)",
-    "hindi": "Artisan's story in Hindi (100-150 words)",
-    "hinglish": "Artisan's story in Hinglish (100-150 words)"
-  },
-  "seo_keywords": ["relevant", "SEO", "keywords"],
-  "hashtags": ["#handmade", "#indian", "#artisan", "#traditional"],
-  "social_media": {
-    "instagram_reels": [
-      {
-        "script": "30-second reel script showing the crafting process",
-        "captions": ["Caption option 1", "Caption option 2"],
-        "hashtags": ["#reelspecific", "#hashtags"],
-        "duration": 30,
-        "music_suggestion": "Traditional Indian music or trending audio"
-      }
-    ],
-    "instagram_posts": [
-      {
-        "caption": "Engaging Instagram post caption",
-        "hashtags": ["#post", "#hashtags"],
-        "image_prompt": "Description for AI image generation"
-      }
-    ],
-    "facebook_posts": [
-      {
-        "content": "Facebook post content",
-        "hashtags": ["#facebook", "#hashtags"]
-      }
-    ],
-    "twitter_posts": [
-      {
-        "content": "Concise Twitter post under 280 characters",
-        "hashtags": ["#twitter", "#hashtags"]
-      }
-    ]
-  },
-  "whatsapp_catalog": {
-    "title": "WhatsApp catalog title",
-    "description": "Brief catalog description",
-    "price": "₹1,500",
-    "currency": "INR"
-  },
-  "faq": [
-    {
-      "question": "Common customer question",
-      "answer": "Detailed answer"
-    }
-  ],
-  "materials": ["clay", "natural pigments", "traditional tools"],
-  "crafting_time": "2-3 days",
-  "tags": ["handcrafted", "eco-friendly", "traditional"]
-}
-
-**Important Guidelines:**
-1. Maintain cultural authenticity and respect for traditional crafts
-2. Price suggestions should be reasonable for Indian market (₹100-₹50,000 range)
-3. Include emotional storytelling that connects with customers
-4. Use trending and relevant hashtags for better reach
-5. Ensure all content is family-friendly and professional
-6. Include multilingual content to reach diverse audiences
-7. Focus on the uniqueness and handcrafted nature of the product
-8. Consider seasonal relevance and gifting potential
-
-Generate only valid JSON without any additional text or explanations.`,
-		req.Transcript, languageName, req.ArtisanName, req.ArtisanCraft, req.Category)
-
-	return prompt
+// languageNames are the names prompts use for the listing languages
+var languageNames = map[string]string{
+	"english":  "English",
+	"hindi":    "Hindi",
+	"hinglish": "Hinglish (mix of Hindi and English)",
+}
+
+// LanguageName returns the name prompts use for a language code, English by default
+func LanguageName(language string) string {
+	if name := languageNames[language]; name != "" {
+		return name
+	}
+	return "English"
+}
+
+// buildPrompt writes the listing prompt from the template for the request's category
+// and language
+func (v *VertexAIService) buildPrompt(ctx context.Context, req *ProductGenerationRequest) (string, *PromptTemplate, error) {
+	template, err := v.prompts.Select(ctx, PromptProductListing, req.Category, req.Language)
+	if err != nil {
+		return "", nil, err
+	}
+
+	prompt, err := template.Render(PromptData{
+		Transcript:   req.Transcript,
+		Language:     LanguageName(req.Language),
+		ArtisanName:  req.ArtisanName,
+		ArtisanCraft: req.ArtisanCraft,
+		Category:     req.Category,
+		PhotoCount:   len(req.Images),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return prompt, template, nil
 }
 
 func (v *VertexAIService) calculateConfidence(resp *ProductGenerationResponse) float64 {
@@ -272,53 +324,108 @@ func (v *VertexAIService) calculateConfidence(resp *ProductGenerationResponse) f
 
 // TranslateContent translates content to different languages
 func (v *VertexAIService) TranslateContent(content, fromLang, toLang string) (string, error) {
-	prompt := fmt.Sprintf(`Translate the following text from %s to %s while maintaining the tone and cultural context:
-
-"%s"
-
-Provide only the translation without any additional text or explanations.`, fromLang, toLang, content)
-
-	model := v.client.GenerativeModel(v.model)
-	model.SetTemperature(0.3)
-	model.SetMaxOutputTokens(1000)
+	template, err := v.prompts.Select(v.ctx, PromptTranslation, "", toLang)
+	if err != nil {
+		return "", err
+	}
+	prompt, err := template.Render(PromptData{Content: content, FromLanguage: fromLang, ToLanguage: toLang})
+	if err != nil {
+		return "", err
+	}
 
-	resp, err := model.GenerateContent(v.ctx, genai.Text(prompt))
+	translation, err := v.generateText(v.ctx, PromptTranslation, prompt)
 	if err != nil {
 		return "", fmt.Errorf("failed to translate content: %v", err)
 	}
+	return translation, nil
+}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no translation generated")
+// GenerateImagePrompt generates AI image prompts for products
+func (v *VertexAIService) GenerateImagePrompt(productTitle, description, category string) (string, error) {
+	template, err := v.prompts.Select(v.ctx, PromptImage, category, "")
+	if err != nil {
+		return "", err
+	}
+	prompt, err := template.Render(PromptData{ProductTitle: productTitle, Description: description, Category: category})
+	if err != nil {
+		return "", err
 	}
 
-	translation := string(resp.Candidates[0].Content.Parts[0].(genai.Text))
-	return strings.TrimSpace(translation), nil
+	imagePrompt, err := v.generateText(v.ctx, PromptImage, prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate image prompt: %v", err)
+	}
+	return imagePrompt, nil
 }
 
-// GenerateImagePrompt generates AI image prompts for products
-func (v *VertexAIService) GenerateImagePrompt(productTitle, description string) (string, error) {
-	prompt := fmt.Sprintf(`Based on this handcrafted product, generate a detailed image prompt for AI image generation:
+// textModelSettings are the temperature and output limit for prompts answered in plain text
+var textModelSettings = map[string]struct {
+	temperature float32
+	maxTokens   int32
+}{
+	PromptTranslation: {0.3, 1000},
+	PromptImage:       {0.7, 500},
+}
+
+// generateText sends a prompt that is answered in plain text, with the model settings
+// for the named prompt
+func (v *VertexAIService) generateText(ctx context.Context, name, prompt string) (string, error) {
+	settings := textModelSettings[name]
+	model := v.client.GenerativeModel(v.model)
+	model.SetTemperature(settings.temperature)
+	model.SetMaxOutputTokens(settings.maxTokens)
 
-Product Title: %s
-Description: %s
+	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		return "", err
+	}
 
-Create a prompt that would generate a high-quality, professional product photo suitable for e-commerce. Include details about lighting, background, angles, and styling.
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("no content generated")
+	}
 
-Provide only the image prompt without any additional text.`, productTitle, description)
+	text := string(resp.Candidates[0].Content.Parts[0].(genai.Text))
+	return strings.TrimSpace(text), nil
+}
 
-	model := v.client.GenerativeModel(v.model)
-	model.SetTemperature(0.7)
-	model.SetMaxOutputTokens(500)
+// PromptPreview is a template rendered against sample data, and optionally what the
+// model wrote from it
+type PromptPreview struct {
+	Template *PromptTemplate            `json:"template"`
+	Prompt   string                     `json:"prompt"`
+	Product  *ProductGenerationResponse `json:"product,omitempty"` // product_listing output
+	Text     string                     `json:"text,omitempty"`    // translation and image_prompt output
+}
 
-	resp, err := model.GenerateContent(v.ctx, genai.Text(prompt))
+// PreviewPrompt renders a template against sample data and, if generate is set, sends
+// the prompt to the model. Product listing previews are sent without photos.
+func (v *VertexAIService) PreviewPrompt(ctx context.Context, template *PromptTemplate, sample PromptData, generate bool) (*PromptPreview, error) {
+	prompt, err := template.Render(sample)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate image prompt: %v", err)
+		return nil, err
+	}
+	preview := &PromptPreview{Template: template, Prompt: prompt}
+	if !generate {
+		return preview, nil
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no image prompt generated")
+	if template.Name == PromptProductListing {
+		resp, err := v.productModel().GenerateContent(ctx, genai.Text(prompt))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate content: %v", err)
+		}
+		if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+			return nil, fmt.Errorf("no content generated")
+		}
+		text, _ := resp.Candidates[0].Content.Parts[0].(genai.Text)
+		if preview.Product, err = v.parseProductContent(string(text), template); err != nil {
+			return nil, err
+		}
+		return preview, nil
 	}
 
-	imagePrompt := string(resp.Candidates[0].Content.Parts[0].(genai.Text))
-	return strings.TrimSpace(imagePrompt), nil
+	if preview.Text, err = v.generateText(ctx, template.Name, prompt); err != nil {
+		return nil, err
+	}
+	return preview, nil
 }
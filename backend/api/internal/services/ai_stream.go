@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/vertexai/genai"
+	"google.golang.org/api/iterator"
+)
+
+// A listing takes Gemini many seconds to write in full, which is a long wait on a slow
+// connection. The streaming variant reads the JSON as it arrives and hands over each
+// top-level field (product_title, description, artisan_story, social_media, faq and
+// so on) as soon as its value is complete, then parses and checks the whole response
+// like GenerateProductContent.
+
+// GenerateProductContentStream generates a listing like GenerateProductContent,
+// calling onField with each top-level field of the listing as soon as the model has
+// finished writing it. Cancelling ctx stops the generation.
+func (v *VertexAIService) GenerateProductContentStream(ctx context.Context, req *ProductGenerationRequest, onField func(name string, value json.RawMessage)) (*ProductGenerationResponse, error) {
+	parts, template, err := v.productParts(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	model := v.productModel()
+	model.ResponseMIMEType = "application/json"
+	iter := model.GenerateContentStream(ctx, parts...)
+
+	var text strings.Builder
+	scanner := &jsonFieldScanner{onField: onField}
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate content: %v", err)
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if chunk, ok := part.(genai.Text); ok {
+				text.WriteString(string(chunk))
+				scanner.Write(string(chunk))
+			}
+		}
+	}
+
+	if text.Len() == 0 {
+		return nil, fmt.Errorf("no content generated")
+	}
+	return v.parseProductContent(text.String(), template)
+}
+
+// jsonFieldScanner reads a JSON object as it arrives in pieces and reports each
+// top-level field once its value has been read to the end. Text before the opening
+// brace, such as a code fence, is skipped.
+type jsonFieldScanner struct {
+	onField func(name string, value json.RawMessage)
+
+	buf        []byte
+	pos        int  // next byte to scan
+	depth      int  // nesting depth; 1 is inside the top-level object
+	done       bool // the top-level object has been closed
+	inString   bool
+	escaped    bool
+	stringFrom int    // where the current string starts
+	inValue    bool   // between a top-level key's colon and the comma that ends its value
+	key        string // the top-level key being read
+	valueFrom  int    // where the current top-level value starts
+}
+
+// Write adds the next piece of the JSON text
+func (s *jsonFieldScanner) Write(chunk string) {
+	s.buf = append(s.buf, chunk...)
+	for ; s.pos < len(s.buf) && !s.done; s.pos++ {
+		c := s.buf[s.pos]
+
+		if s.inString {
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\':
+				s.escaped = true
+			case c == '"':
+				s.inString = false
+				if s.depth == 1 && !s.inValue {
+					// A top-level key has been read; decode it to undo any escapes
+					var key string
+					if json.Unmarshal(s.buf[s.stringFrom:s.pos+1], &key) == nil {
+						s.key = key
+					}
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			s.inString = true
+			s.stringFrom = s.pos
+		case '{', '[':
+			s.depth++
+		case '}', ']':
+			if s.depth == 1 {
+				s.endValue()
+				s.done = true
+			}
+			if s.depth > 0 {
+				s.depth--
+			}
+		case ':':
+			if s.depth == 1 && !s.inValue {
+				s.inValue = true
+				s.valueFrom = s.pos + 1
+			}
+		case ',':
+			if s.depth == 1 {
+				s.endValue()
+			}
+		}
+	}
+}
+
+// endValue reports the top-level value that has just ended
+func (s *jsonFieldScanner) endValue() {
+	if !s.inValue {
+		return
+	}
+	s.inValue = false
+
+	value := json.RawMessage(strings.TrimSpace(string(s.buf[s.valueFrom:s.pos])))
+	if s.key != "" && json.Valid(value) {
+		s.onField(s.key, value)
+	}
+	s.key = ""
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Marketplace analytics are kept as one document per UTC day in the analytics
+// collection. Every event increments counters on the current day's document so
+// the admin dashboard only ever reads one document per day in the requested range.
+
+const (
+	statsDateLayout   = "2006-01-02"
+	maxStatsRangeDays = 366
+)
+
+// dailyStatsRef returns the aggregate document for the day containing t
+func (fs *FirestoreService) dailyStatsRef(t time.Time) *firestore.DocumentRef {
+	return fs.client.Collection(AnalyticsCollection).Doc(t.UTC().Format(statsDateLayout))
+}
+
+// incrementDailyStats merges counter increments into today's aggregate document.
+// Failures are logged rather than returned so analytics never break user requests.
+func (fs *FirestoreService) incrementDailyStats(fields map[string]interface{}) {
+	now := time.Now()
+	fields["date"] = now.UTC().Format(statsDateLayout)
+
+	if _, err := fs.dailyStatsRef(now).Set(fs.ctx, fields, firestore.MergeAll); err != nil {
+		log.Printf("Failed to update marketplace stats: %v", err)
+	}
+}
+
+// RecordOrderPlaced adds a new order to GMV, order counts and the top-seller tallies.
+// artisanByProduct maps each ordered product ID to the artisan who sells it.
+func (fs *FirestoreService) RecordOrderPlaced(order *models.Order, artisanByProduct map[string]string) {
+	productSales := make(map[string]interface{})
+	artisanSales := make(map[string]interface{})
+
+	for _, item := range order.Items {
+		revenue := item.Price*float64(item.Quantity) - item.Discount
+		productSales[item.ProductID] = map[string]interface{}{
+			"units":   firestore.Increment(item.Quantity),
+			"revenue": firestore.Increment(revenue),
+		}
+
+		if artisanID := artisanByProduct[item.ProductID]; artisanID != "" {
+			artisanSales[artisanID] = map[string]interface{}{
+				"units":   firestore.Increment(item.Quantity),
+				"revenue": firestore.Increment(revenue),
+			}
+		}
+	}
+
+	fs.incrementDailyStats(map[string]interface{}{
+		"gmv":           firestore.Increment(order.TotalAmount),
+		"orders_placed": firestore.Increment(1),
+		"orders_by_status": map[string]interface{}{
+			string(order.Status): firestore.Increment(1),
+		},
+		"product_sales": productSales,
+		"artisan_sales": artisanSales,
+	})
+}
+
+// RecordOrderStatusChange counts an order moving into a new status
+func (fs *FirestoreService) RecordOrderStatusChange(status string) {
+	fs.incrementDailyStats(map[string]interface{}{
+		"orders_by_status": map[string]interface{}{
+			status: firestore.Increment(1),
+		},
+	})
+}
+
+// RecordUserSignup counts a newly registered buyer or artisan
+func (fs *FirestoreService) RecordUserSignup(role models.UserRole) {
+	field := "new_buyers"
+	if role == models.RoleArtisan {
+		field = "new_artisans"
+	}
+
+	fs.incrementDailyStats(map[string]interface{}{
+		field: firestore.Increment(1),
+	})
+}
+
+// RecordAIGeneration counts a product generation and whether it was saved as a draft
+func (fs *FirestoreService) RecordAIGeneration(confidence float64, draftSaved bool) {
+	fields := map[string]interface{}{
+		"ai_generations":    firestore.Increment(1),
+		"ai_confidence_sum": firestore.Increment(confidence),
+	}
+	if draftSaved {
+		fields["drafts_created"] = firestore.Increment(1)
+	}
+
+	fs.incrementDailyStats(fields)
+}
+
+// RecordVoiceTranscription adds transcribed audio to the voice usage total
+func (fs *FirestoreService) RecordVoiceTranscription(durationSeconds float64) {
+	fs.incrementDailyStats(map[string]interface{}{
+		"voice_seconds": firestore.Increment(durationSeconds),
+	})
+}
+
+// RecordProductPublished counts a product going live after moderation
+func (fs *FirestoreService) RecordProductPublished() {
+	fs.incrementDailyStats(map[string]interface{}{
+		"products_published": firestore.Increment(1),
+	})
+}
+
+// GetMarketplaceStats combines the daily aggregates between from and to (inclusive)
+func (fs *FirestoreService) GetMarketplaceStats(from, to time.Time, topN int) (*models.MarketplaceStats, error) {
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24 * time.Hour)
+	if to.Before(from) {
+		return nil, fmt.Errorf("end date is before start date")
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxStatsRangeDays {
+		return nil, fmt.Errorf("date range cannot exceed %d days", maxStatsRangeDays)
+	}
+
+	var refs []*firestore.DocumentRef
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		refs = append(refs, fs.dailyStatsRef(day))
+	}
+
+	docs, err := fs.client.GetAll(fs.ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read marketplace stats: %v", err)
+	}
+
+	stats := &models.MarketplaceStats{
+		From:           from.Format(statsDateLayout),
+		To:             to.Format(statsDateLayout),
+		OrdersByStatus: make(map[string]int),
+		Daily:          make([]models.DailyMarketplaceStats, 0, len(docs)),
+	}
+
+	productTotals := make(map[string]models.SalesTally)
+	artisanTotals := make(map[string]models.SalesTally)
+	var confidenceSum, voiceSeconds float64
+
+	for i, doc := range docs {
+		day := models.DailyMarketplaceStats{Date: refs[i].ID}
+		if doc.Exists() {
+			if err := doc.DataTo(&day); err != nil {
+				return nil, fmt.Errorf("failed to decode stats for %s: %v", refs[i].ID, err)
+			}
+		}
+
+		stats.GMV += day.GMV
+		stats.OrdersPlaced += day.OrdersPlaced
+		for status, count := range day.OrdersByStatus {
+			stats.OrdersByStatus[status] += count
+		}
+		stats.NewBuyers += day.NewBuyers
+		stats.NewArtisans += day.NewArtisans
+		stats.AIGenerations += day.AIGenerations
+		stats.DraftsCreated += day.DraftsCreated
+		stats.ProductsPublished += day.ProductsPublished
+		confidenceSum += day.AIConfidenceSum
+		voiceSeconds += day.VoiceSeconds
+
+		mergeSalesTallies(productTotals, day.ProductSales)
+		mergeSalesTallies(artisanTotals, day.ArtisanSales)
+
+		stats.Daily = append(stats.Daily, day)
+	}
+
+	if stats.AIGenerations > 0 {
+		stats.AverageAIConfidence = confidenceSum / float64(stats.AIGenerations)
+	}
+	if stats.DraftsCreated > 0 {
+		stats.DraftConversionRate = float64(stats.ProductsPublished) / float64(stats.DraftsCreated)
+	}
+	stats.VoiceMinutes = voiceSeconds / 60
+	stats.TopProducts = topSales(productTotals, topN)
+	stats.TopArtisans = topSales(artisanTotals, topN)
+
+	return stats, nil
+}
+
+func mergeSalesTallies(dst, src map[string]models.SalesTally) {
+	for id, tally := range src {
+		total := dst[id]
+		total.Units += tally.Units
+		total.Revenue += tally.Revenue
+		dst[id] = total
+	}
+}
+
+// topSales ranks tallies by revenue, then units, and keeps the first n
+func topSales(tallies map[string]models.SalesTally, n int) []models.RankedSales {
+	ranked := make([]models.RankedSales, 0, len(tallies))
+	for id, tally := range tallies {
+		ranked = append(ranked, models.RankedSales{ID: id, Units: tally.Units, Revenue: tally.Revenue})
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Revenue != ranked[j].Revenue {
+			return ranked[i].Revenue > ranked[j].Revenue
+		}
+		if ranked[i].Units != ranked[j].Units {
+			return ranked[i].Units > ranked[j].Units
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+
+	if n > 0 && len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
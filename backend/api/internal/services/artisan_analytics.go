@@ -0,0 +1,300 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Artisan analytics are kept as one rollup document per artisan per UTC day,
+// holding the artisan's totals and a per-product breakdown. Each view, like,
+// share and order increments the rollup for the day it happened.
+
+// artisanRollupRef returns the rollup document for an artisan on the day containing t
+func (fs *FirestoreService) artisanRollupRef(artisanID string, t time.Time) *firestore.DocumentRef {
+	return fs.client.Collection(ArtisanAnalyticsCollection).Doc(artisanID + "_" + t.UTC().Format(statsDateLayout))
+}
+
+// incrementArtisanRollup adds the given counter increments to both the artisan's
+// daily totals and the product's entry in today's rollup. Failures are logged.
+func (fs *FirestoreService) incrementArtisanRollup(artisanID, productID string, counters map[string]interface{}) {
+	if artisanID == "" {
+		return
+	}
+
+	now := time.Now()
+	fields := map[string]interface{}{
+		"artisan_id": artisanID,
+		"date":       now.UTC().Format(statsDateLayout),
+	}
+	productCounters := make(map[string]interface{}, len(counters))
+	for key, value := range counters {
+		fields[key] = value
+		productCounters[key] = value
+	}
+	if productID != "" {
+		fields["products"] = map[string]interface{}{productID: productCounters}
+	}
+
+	if _, err := fs.artisanRollupRef(artisanID, now).Set(fs.ctx, fields, firestore.MergeAll); err != nil {
+		log.Printf("Failed to update analytics for artisan %s: %v", artisanID, err)
+	}
+}
+
+// RecordArtisanOrders updates sales counters for every artisan with products in the order:
+// product sales counts, the artisan's total sales and the daily rollups.
+func (fs *FirestoreService) RecordArtisanOrders(order *models.Order, artisanByProduct map[string]string) {
+	now := time.Now()
+	totals := make(map[string]*models.ProductMetrics)
+	products := make(map[string]map[string]interface{})
+
+	for _, item := range order.Items {
+		artisanID := artisanByProduct[item.ProductID]
+		if artisanID == "" {
+			continue
+		}
+
+		revenue := item.Price*float64(item.Quantity) - item.Discount
+
+		if _, err := fs.client.Collection(ProductsCollection).Doc(item.ProductID).Update(fs.ctx, []firestore.Update{
+			{Path: "sales_count", Value: firestore.Increment(item.Quantity)},
+		}); err != nil {
+			log.Printf("Failed to update sales count for product %s: %v", item.ProductID, err)
+		}
+
+		if totals[artisanID] == nil {
+			totals[artisanID] = &models.ProductMetrics{Orders: 1}
+			products[artisanID] = make(map[string]interface{})
+		}
+		totals[artisanID].Units += item.Quantity
+		totals[artisanID].Revenue += revenue
+		products[artisanID][item.ProductID] = map[string]interface{}{
+			"orders":  firestore.Increment(1),
+			"units":   firestore.Increment(item.Quantity),
+			"revenue": firestore.Increment(revenue),
+		}
+	}
+
+	for artisanID, total := range totals {
+		if _, err := fs.client.Collection(ArtisansCollection).Doc(artisanID).Update(fs.ctx, []firestore.Update{
+			{Path: "total_sales", Value: firestore.Increment(total.Units)},
+		}); err != nil {
+			log.Printf("Failed to update total sales for artisan %s: %v", artisanID, err)
+		}
+
+		fields := map[string]interface{}{
+			"artisan_id": artisanID,
+			"date":       now.UTC().Format(statsDateLayout),
+			"orders":     firestore.Increment(total.Orders),
+			"units":      firestore.Increment(total.Units),
+			"revenue":    firestore.Increment(total.Revenue),
+			"products":   products[artisanID],
+		}
+		if _, err := fs.artisanRollupRef(artisanID, now).Set(fs.ctx, fields, firestore.MergeAll); err != nil {
+			log.Printf("Failed to update analytics for artisan %s: %v", artisanID, err)
+		}
+	}
+}
+
+// RecordProductShare counts a product being shared
+func (fs *FirestoreService) RecordProductShare(productID, artisanID string) error {
+	fs.incrementArtisanRollup(artisanID, productID, map[string]interface{}{
+		"shares": firestore.Increment(1),
+	})
+
+	_, err := fs.client.Collection(ProductsCollection).Doc(productID).Update(fs.ctx, []firestore.Update{
+		{Path: "share_count", Value: firestore.Increment(1)},
+	})
+	return err
+}
+
+// SetProductLike likes or unlikes a product for a user. The like document and the
+// product's like count change together; repeated likes or unlikes are no-ops.
+// It reports whether anything changed.
+func (fs *FirestoreService) SetProductLike(userID string, product *models.Product, liked bool) (bool, error) {
+	likeRef := fs.client.Collection(ProductLikesCollection).Doc(userID + "_" + product.ID)
+	productRef := fs.client.Collection(ProductsCollection).Doc(product.ID)
+
+	changed := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = false
+
+		doc, err := tx.Get(likeRef)
+		exists := err == nil && doc.Exists()
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		if exists == liked {
+			return nil
+		}
+
+		delta := 1
+		if liked {
+			if err := tx.Create(likeRef, models.ProductLike{
+				UserID:    userID,
+				ProductID: product.ID,
+				ArtisanID: product.ArtisanID,
+				CreatedAt: time.Now(),
+			}); err != nil {
+				return err
+			}
+		} else {
+			delta = -1
+			if err := tx.Delete(likeRef); err != nil {
+				return err
+			}
+		}
+
+		changed = true
+		return tx.Update(productRef, []firestore.Update{
+			{Path: "like_count", Value: firestore.Increment(delta)},
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if changed {
+		delta := 1
+		if !liked {
+			delta = -1
+		}
+		fs.incrementArtisanRollup(product.ArtisanID, product.ID, map[string]interface{}{
+			"likes": firestore.Increment(delta),
+		})
+	}
+
+	return changed, nil
+}
+
+// getArtisanRollups reads an artisan's rollups for every day between from and to (inclusive)
+func (fs *FirestoreService) getArtisanRollups(artisanID string, from, to time.Time) ([]models.ArtisanDailyRollup, error) {
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24 * time.Hour)
+	if to.Before(from) {
+		return nil, fmt.Errorf("end date is before start date")
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxStatsRangeDays {
+		return nil, fmt.Errorf("date range cannot exceed %d days", maxStatsRangeDays)
+	}
+
+	var refs []*firestore.DocumentRef
+	var dates []string
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		refs = append(refs, fs.artisanRollupRef(artisanID, day))
+		dates = append(dates, day.Format(statsDateLayout))
+	}
+
+	docs, err := fs.client.GetAll(fs.ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artisan analytics: %v", err)
+	}
+
+	rollups := make([]models.ArtisanDailyRollup, 0, len(docs))
+	for i, doc := range docs {
+		rollup := models.ArtisanDailyRollup{ArtisanID: artisanID, Date: dates[i]}
+		if doc.Exists() {
+			if err := doc.DataTo(&rollup); err != nil {
+				return nil, fmt.Errorf("failed to decode analytics for %s: %v", dates[i], err)
+			}
+		}
+		rollups = append(rollups, rollup)
+	}
+
+	return rollups, nil
+}
+
+// GetArtisanAnalytics summarises an artisan's rollups over a date range with a per-product breakdown
+func (fs *FirestoreService) GetArtisanAnalytics(artisanID string, from, to time.Time) (*models.ArtisanAnalytics, error) {
+	rollups, err := fs.getArtisanRollups(artisanID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics := &models.ArtisanAnalytics{
+		ArtisanID: artisanID,
+		From:      rollups[0].Date,
+		To:        rollups[len(rollups)-1].Date,
+		Daily:     make([]models.DailyMetrics, 0, len(rollups)),
+		Products:  []models.ProductAnalytics{},
+	}
+
+	productTotals := make(map[string]models.ProductMetrics)
+	for _, rollup := range rollups {
+		addMetrics(&analytics.Totals, rollup.ProductMetrics)
+		analytics.Daily = append(analytics.Daily, models.DailyMetrics{
+			Date:           rollup.Date,
+			ProductMetrics: rollup.ProductMetrics,
+			ConversionRate: rollup.ProductMetrics.ConversionRate(),
+		})
+
+		for productID, metrics := range rollup.Products {
+			total := productTotals[productID]
+			addMetrics(&total, metrics)
+			productTotals[productID] = total
+		}
+	}
+	analytics.ConversionRate = analytics.Totals.ConversionRate()
+
+	for productID, metrics := range productTotals {
+		entry := models.ProductAnalytics{
+			ProductID:      productID,
+			ProductMetrics: metrics,
+			ConversionRate: metrics.ConversionRate(),
+		}
+		if product, err := fs.GetProduct(productID); err == nil {
+			entry.Title = product.Title
+		}
+		analytics.Products = append(analytics.Products, entry)
+	}
+
+	sort.Slice(analytics.Products, func(i, j int) bool {
+		if analytics.Products[i].Revenue != analytics.Products[j].Revenue {
+			return analytics.Products[i].Revenue > analytics.Products[j].Revenue
+		}
+		return analytics.Products[i].Views > analytics.Products[j].Views
+	})
+
+	return analytics, nil
+}
+
+// GetProductAnalytics returns the daily time series for one of an artisan's products
+func (fs *FirestoreService) GetProductAnalytics(product *models.Product, from, to time.Time) (*models.ProductAnalytics, error) {
+	rollups, err := fs.getArtisanRollups(product.ArtisanID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics := &models.ProductAnalytics{
+		ProductID: product.ID,
+		Title:     product.Title,
+		Daily:     make([]models.DailyMetrics, 0, len(rollups)),
+	}
+
+	for _, rollup := range rollups {
+		metrics := rollup.Products[product.ID]
+		addMetrics(&analytics.ProductMetrics, metrics)
+		analytics.Daily = append(analytics.Daily, models.DailyMetrics{
+			Date:           rollup.Date,
+			ProductMetrics: metrics,
+			ConversionRate: metrics.ConversionRate(),
+		})
+	}
+	analytics.ConversionRate = analytics.ProductMetrics.ConversionRate()
+
+	return analytics, nil
+}
+
+func addMetrics(dst *models.ProductMetrics, src models.ProductMetrics) {
+	dst.Views += src.Views
+	dst.Likes += src.Likes
+	dst.Shares += src.Shares
+	dst.Orders += src.Orders
+	dst.Units += src.Units
+	dst.Revenue += src.Revenue
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// Blurhash is a short string the frontend decodes into a blurred placeholder while the
+// real image loads (https://blurha.sh). Only the encoder is needed here.
+
+const blurhashCharacters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurhash encodes an image with xComponents by yComponents (1-9 each) cosine
+// components. Callers pass a small image; the cost grows with its pixel count.
+func blurhash(img *image.NRGBA, xComponents, yComponents int) string {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width == 0 || height == 0 {
+		return ""
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var r, g, b float64
+			for y := 0; y < height; y++ {
+				basisY := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := basisY * math.Cos(math.Pi*float64(i)*float64(x)/float64(width))
+					offset := img.PixOffset(x+img.Rect.Min.X, y+img.Rect.Min.Y)
+					r += basis * srgbToLinear(img.Pix[offset])
+					g += basis * srgbToLinear(img.Pix[offset+1])
+					b += basis * srgbToLinear(img.Pix[offset+2])
+				}
+			}
+
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, factor := range ac {
+			for _, component := range factor {
+				actualMax = math.Max(actualMax, math.Abs(component))
+			}
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, factor := range ac {
+		quantise := func(value float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(value/maxValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encode83(quantise(factor[0])*19*19+quantise(factor[1])*19+quantise(factor[2]), 2))
+	}
+	return hash.String()
+}
+
+func encode83(value, length int) string {
+	result := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		result[i] = blurhashCharacters[value%83]
+		value /= 83
+	}
+	return string(result)
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
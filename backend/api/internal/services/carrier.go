@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"voicecraft-market/internal/models"
+)
+
+var (
+	// ErrTrackingNotSupported is returned by carriers that only push updates through webhooks
+	ErrTrackingNotSupported = errors.New("carrier does not support tracking lookups")
+	// ErrUnknownShipment is returned when a carrier has no record of a tracking number
+	ErrUnknownShipment = errors.New("carrier has no record of this shipment")
+)
+
+// CarrierAdapter connects a shipping carrier's tracking feed to the marketplace.
+// Carriers report progress by webhook, by polling Track, or both.
+type CarrierAdapter interface {
+	// Name identifies the carrier on shipments and in the webhook route
+	Name() string
+	// Track fetches the current state of a shipment from the carrier
+	Track(ctx context.Context, trackingNumber string) (*CarrierTracking, error)
+	// ParseWebhook authenticates a webhook delivery and extracts the tracking updates it carries
+	ParseWebhook(header http.Header, body []byte) ([]CarrierTracking, error)
+}
+
+// CarrierTracking is a carrier's view of a shipment, normalised to marketplace statuses
+type CarrierTracking struct {
+	TrackingNumber    string
+	Status            models.ShipmentStatus
+	EstimatedDelivery *time.Time
+	Events            []models.TrackingEvent
+}
+
+// normalizeTrackingNumber strips the spacing and case differences carriers and artisans introduce
+func normalizeTrackingNumber(trackingNumber string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(trackingNumber), ""))
+}
+
+// fakeCarrierWebhook is the payload accepted by FakeCarrier.ParseWebhook
+type fakeCarrierWebhook struct {
+	TrackingNumber    string     `json:"tracking_number"`
+	Status            string     `json:"status"`
+	Description       string     `json:"description"`
+	Location          string     `json:"location"`
+	OccurredAt        time.Time  `json:"occurred_at"`
+	EstimatedDelivery *time.Time `json:"estimated_delivery"`
+}
+
+// FakeCarrier is an in-process carrier for local development and tests. Track
+// simulates a parcel moving from in transit to out for delivery to delivered
+// over transitTime from the first lookup, unless a status has been pushed with
+// SetStatus or a webhook. Webhooks are JSON bodies signed with HMAC-SHA256 in the
+// X-Carrier-Signature header, which SignWebhook produces.
+type FakeCarrier struct {
+	secret      string
+	transitTime time.Duration
+	mu          sync.Mutex
+	firstSeen   map[string]time.Time
+	pushed      map[string]*CarrierTracking
+}
+
+// NewFakeCarrier creates a fake carrier signing with secret
+func NewFakeCarrier(secret string, transitTime time.Duration) *FakeCarrier {
+	return &FakeCarrier{
+		secret:      secret,
+		transitTime: transitTime,
+		firstSeen:   make(map[string]time.Time),
+		pushed:      make(map[string]*CarrierTracking),
+	}
+}
+
+func (f *FakeCarrier) Name() string {
+	return "fake"
+}
+
+// Track returns the pushed status of a shipment, or its simulated progress
+func (f *FakeCarrier) Track(ctx context.Context, trackingNumber string) (*CarrierTracking, error) {
+	trackingNumber = normalizeTrackingNumber(trackingNumber)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if tracking, ok := f.pushed[trackingNumber]; ok {
+		copied := *tracking
+		return &copied, nil
+	}
+
+	start, ok := f.firstSeen[trackingNumber]
+	if !ok {
+		start = time.Now()
+		f.firstSeen[trackingNumber] = start
+	}
+
+	estimated := start.Add(f.transitTime)
+	tracking := &CarrierTracking{
+		TrackingNumber:    trackingNumber,
+		Status:            models.ShipmentStatusInTransit,
+		EstimatedDelivery: &estimated,
+		Events: []models.TrackingEvent{
+			{Status: models.ShipmentStatusInTransit, Description: "Picked up by carrier", Location: "Origin hub", OccurredAt: start},
+		},
+	}
+
+	elapsed := time.Since(start)
+	if elapsed >= f.transitTime/2 {
+		tracking.Status = models.ShipmentStatusOutForDelivery
+		tracking.Events = append(tracking.Events, models.TrackingEvent{
+			Status: models.ShipmentStatusOutForDelivery, Description: "Out for delivery", Location: "Destination hub", OccurredAt: start.Add(f.transitTime / 2),
+		})
+	}
+	if elapsed >= f.transitTime {
+		tracking.Status = models.ShipmentStatusDelivered
+		tracking.Events = append(tracking.Events, models.TrackingEvent{
+			Status: models.ShipmentStatusDelivered, Description: "Delivered", OccurredAt: estimated,
+		})
+	}
+
+	return tracking, nil
+}
+
+// ParseWebhook verifies the X-Carrier-Signature header and decodes a single tracking update
+func (f *FakeCarrier) ParseWebhook(header http.Header, body []byte) ([]CarrierTracking, error) {
+	if !verifyHMAC(f.secret, body, header.Get("X-Carrier-Signature")) {
+		return nil, ErrInvalidSignature
+	}
+
+	var webhook fakeCarrierWebhook
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook: %v", err)
+	}
+
+	status := models.ShipmentStatus(webhook.Status)
+	if webhook.TrackingNumber == "" || !status.IsValid() {
+		return nil, fmt.Errorf("webhook needs a tracking_number and a valid status")
+	}
+	if webhook.OccurredAt.IsZero() {
+		webhook.OccurredAt = time.Now()
+	}
+
+	tracking := CarrierTracking{
+		TrackingNumber:    normalizeTrackingNumber(webhook.TrackingNumber),
+		Status:            status,
+		EstimatedDelivery: webhook.EstimatedDelivery,
+		Events: []models.TrackingEvent{{
+			Status:      status,
+			Description: webhook.Description,
+			Location:    webhook.Location,
+			OccurredAt:  webhook.OccurredAt,
+		}},
+	}
+
+	f.SetStatus(tracking)
+	return []CarrierTracking{tracking}, nil
+}
+
+// SetStatus overrides the simulated progress of a shipment with a pushed update
+func (f *FakeCarrier) SetStatus(tracking CarrierTracking) {
+	trackingNumber := normalizeTrackingNumber(tracking.TrackingNumber)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if previous, ok := f.pushed[trackingNumber]; ok {
+		tracking.Events = append(append([]models.TrackingEvent{}, previous.Events...), tracking.Events...)
+		if tracking.EstimatedDelivery == nil {
+			tracking.EstimatedDelivery = previous.EstimatedDelivery
+		}
+	}
+	tracking.TrackingNumber = trackingNumber
+	f.pushed[trackingNumber] = &tracking
+}
+
+// SignWebhook returns the X-Carrier-Signature value the fake carrier accepts for a webhook body
+func (f *FakeCarrier) SignWebhook(body []byte) string {
+	return signHMAC(f.secret, body)
+}
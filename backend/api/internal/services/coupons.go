@@ -0,0 +1,395 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Coupons are stored under their code, so codes are unique across artisans and the
+// platform. A coupon is applied at checkout inside the order transaction: its usage
+// counters are checked and incremented together with the stock reservation, and
+// released again if the order is cancelled before it is paid.
+
+var (
+	// ErrCouponRejected is the parent of every reason a coupon cannot be applied to an order
+	ErrCouponRejected = errors.New("coupon cannot be applied")
+
+	ErrCouponNotFound      = fmt.Errorf("%w: unknown coupon code", ErrCouponRejected)
+	ErrCouponNotActive     = fmt.Errorf("%w: coupon is not active", ErrCouponRejected)
+	ErrCouponUsageLimit    = fmt.Errorf("%w: coupon usage limit reached", ErrCouponRejected)
+	ErrCouponMinimumOrder  = fmt.Errorf("%w: order does not meet the coupon's minimum value", ErrCouponRejected)
+	ErrCouponNotApplicable = fmt.Errorf("%w: coupon does not apply to these items", ErrCouponRejected)
+
+	// ErrInvalidCoupon is returned when a coupon definition is incomplete or inconsistent
+	ErrInvalidCoupon = errors.New("invalid coupon")
+	// ErrCouponExists is returned when a coupon code is already taken
+	ErrCouponExists = errors.New("a coupon with this code already exists")
+)
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// NormalizeCouponCode upper-cases a coupon code as buyers may type it in any case
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidateCoupon checks a coupon definition before it is stored
+func ValidateCoupon(coupon *models.Coupon) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %s", ErrInvalidCoupon, reason)
+	}
+
+	if !couponCodePattern.MatchString(coupon.Code) {
+		return invalid("code must be 3-32 letters, digits, '-' or '_'")
+	}
+	if !coupon.Type.IsValid() {
+		return invalid("type must be percentage, flat, buy_x_get_y or free_shipping")
+	}
+
+	switch coupon.Type {
+	case models.CouponTypePercentage:
+		if coupon.Value <= 0 || coupon.Value > 100 {
+			return invalid("percentage value must be between 0 and 100")
+		}
+	case models.CouponTypeFlat:
+		if coupon.Value <= 0 {
+			return invalid("flat value must be positive")
+		}
+	case models.CouponTypeBuyXGetY:
+		if coupon.BuyQuantity < 1 || coupon.GetQuantity < 1 {
+			return invalid("buy_quantity and get_quantity must be at least 1")
+		}
+	}
+
+	if coupon.MaxDiscount < 0 || coupon.MinOrderValue < 0 || coupon.UsageLimit < 0 || coupon.PerUserLimit < 0 {
+		return invalid("limits cannot be negative")
+	}
+	if coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.EndsAt.After(*coupon.StartsAt) {
+		return invalid("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// couponAvailable checks a coupon's status, validity window and usage limits
+func couponAvailable(coupon *models.Coupon, buyerUses int, now time.Time) error {
+	if !coupon.Active {
+		return ErrCouponNotActive
+	}
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return fmt.Errorf("%w: coupon is not valid yet", ErrCouponRejected)
+	}
+	if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+		return fmt.Errorf("%w: coupon has expired", ErrCouponRejected)
+	}
+	if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+		return ErrCouponUsageLimit
+	}
+	if coupon.PerUserLimit > 0 && buyerUses >= coupon.PerUserLimit {
+		return fmt.Errorf("%w: you have already used this coupon", ErrCouponRejected)
+	}
+	return nil
+}
+
+// couponCovers reports whether an order line is within a coupon's artisan, product and category scope
+func couponCovers(coupon *models.Coupon, item models.OrderItem, product *models.Product) bool {
+	if coupon.ArtisanID != "" && item.ArtisanID != coupon.ArtisanID {
+		return false
+	}
+	if len(coupon.ProductIDs) > 0 && !containsString(coupon.ProductIDs, item.ProductID) {
+		return false
+	}
+	if len(coupon.Categories) > 0 && (product == nil || !containsString(coupon.Categories, product.Category)) {
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyCoupon applies a coupon to priced order lines, recording each line's discount on
+// the item. Free-shipping coupons discount no items; WaiveCouponShipping applies them
+// once shipping is quoted. It returns the total item discount.
+func ApplyCoupon(coupon *models.Coupon, buyerUses int, currency string, items []models.OrderItem, products map[string]*models.Product, now time.Time) (float64, error) {
+	if err := couponAvailable(coupon, buyerUses, now); err != nil {
+		return 0, err
+	}
+	if coupon.Currency != "" && coupon.Currency != currency {
+		return 0, ErrCouponNotApplicable
+	}
+
+	var eligible []int
+	var eligibleTotal float64
+	for i, item := range items {
+		items[i].Discount = 0
+		if couponCovers(coupon, item, products[item.ProductID]) {
+			eligible = append(eligible, i)
+			eligibleTotal += item.Total
+		}
+	}
+	if len(eligible) == 0 {
+		return 0, ErrCouponNotApplicable
+	}
+	if eligibleTotal < coupon.MinOrderValue {
+		return 0, ErrCouponMinimumOrder
+	}
+
+	var discount float64
+	switch coupon.Type {
+	case models.CouponTypePercentage:
+		discount = eligibleTotal * coupon.Value / 100
+		if coupon.MaxDiscount > 0 && discount > coupon.MaxDiscount {
+			discount = coupon.MaxDiscount
+		}
+		spreadDiscount(items, eligible, eligibleTotal, roundAmount(discount))
+
+	case models.CouponTypeFlat:
+		discount = coupon.Value
+		if discount > eligibleTotal {
+			discount = eligibleTotal
+		}
+		spreadDiscount(items, eligible, eligibleTotal, roundAmount(discount))
+
+	case models.CouponTypeBuyXGetY:
+		// Every group of buy+get units of a product gets the last get units free
+		group := coupon.BuyQuantity + coupon.GetQuantity
+		for _, i := range eligible {
+			free := items[i].Quantity / group * coupon.GetQuantity
+			items[i].Discount = roundAmount(float64(free) * items[i].Price)
+		}
+
+	case models.CouponTypeFreeShipping:
+		return 0, nil
+	}
+
+	var total float64
+	for _, i := range eligible {
+		total += items[i].Discount
+	}
+	if total <= 0 {
+		return 0, ErrCouponNotApplicable
+	}
+	return roundAmount(total), nil
+}
+
+// WaiveCouponShipping waives the shipping on parcels containing items a free-shipping
+// coupon covers; other coupons leave shipping alone. The coupon must already have been
+// accepted by ApplyCoupon.
+func WaiveCouponShipping(coupon *models.Coupon, items []models.OrderItem, products map[string]*models.Product, shipping []models.ShippingLine) {
+	if coupon.Type != models.CouponTypeFreeShipping {
+		return
+	}
+	artisans := make(map[string]bool)
+	for _, item := range items {
+		if couponCovers(coupon, item, products[item.ProductID]) {
+			artisans[item.ArtisanID] = true
+		}
+	}
+	for i := range shipping {
+		if artisans[shipping[i].ArtisanID] {
+			shipping[i].Amount = 0
+			shipping[i].FreeShipping = true
+		}
+	}
+}
+
+// spreadDiscount shares a discount across eligible lines in proportion to their totals;
+// the last line takes the rounding remainder
+func spreadDiscount(items []models.OrderItem, eligible []int, eligibleTotal, discount float64) {
+	remaining := discount
+	for n, i := range eligible {
+		share := roundAmount(discount * items[i].Total / eligibleTotal)
+		if n == len(eligible)-1 || share > remaining {
+			share = remaining
+		}
+		items[i].Discount = share
+		remaining = roundAmount(remaining - share)
+	}
+}
+
+// couponUsageRef is the per-buyer redemption counter for a coupon
+func (fs *FirestoreService) couponUsageRef(couponID, buyerID string) *firestore.DocumentRef {
+	return fs.client.Collection(CouponUsageCollection).Doc(couponID + "_" + buyerID)
+}
+
+// getCouponForRedemption reads a coupon and how often the buyer has used it inside a transaction
+func (fs *FirestoreService) getCouponForRedemption(tx *firestore.Transaction, code, buyerID string) (*models.Coupon, int, error) {
+	doc, err := tx.Get(fs.client.Collection(CouponsCollection).Doc(NormalizeCouponCode(code)))
+	if err != nil {
+		if isNotFound(err) {
+			return nil, 0, ErrCouponNotFound
+		}
+		return nil, 0, err
+	}
+	var coupon models.Coupon
+	if err := doc.DataTo(&coupon); err != nil {
+		return nil, 0, err
+	}
+
+	usage, err := tx.Get(fs.couponUsageRef(coupon.ID, buyerID))
+	if err != nil {
+		if isNotFound(err) {
+			return &coupon, 0, nil
+		}
+		return nil, 0, err
+	}
+	uses, _ := usage.Data()["count"].(int64)
+	return &coupon, int(uses), nil
+}
+
+// redeemCoupon counts a redemption against the coupon's total and per-buyer limits
+func (fs *FirestoreService) redeemCoupon(tx *firestore.Transaction, couponID, buyerID string, delta int) error {
+	if err := tx.Update(fs.client.Collection(CouponsCollection).Doc(couponID), []firestore.Update{
+		{Path: "used_count", Value: firestore.Increment(delta)},
+	}); err != nil {
+		return err
+	}
+	return tx.Set(fs.couponUsageRef(couponID, buyerID), map[string]interface{}{
+		"coupon_id":  couponID,
+		"buyer_id":   buyerID,
+		"count":      firestore.Increment(delta),
+		"updated_at": time.Now(),
+	}, firestore.MergeAll)
+}
+
+// CreateCoupon stores a new coupon under its code
+func (fs *FirestoreService) CreateCoupon(coupon *models.Coupon) error {
+	now := time.Now()
+	coupon.ID = coupon.Code
+	coupon.UsedCount = 0
+	coupon.CreatedAt = now
+	coupon.UpdatedAt = now
+
+	_, err := fs.client.Collection(CouponsCollection).Doc(coupon.ID).Create(fs.ctx, coupon)
+	if err != nil && isAlreadyExists(err) {
+		return ErrCouponExists
+	}
+	return err
+}
+
+// GetCoupon retrieves a coupon by its ID (code)
+func (fs *FirestoreService) GetCoupon(couponID string) (*models.Coupon, error) {
+	doc, err := fs.client.Collection(CouponsCollection).Doc(NormalizeCouponCode(couponID)).Get(fs.ctx)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+
+	var coupon models.Coupon
+	if err := doc.DataTo(&coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// GetCoupons lists coupons, newest first. An artisanID of "platform" lists platform
+// coupons; an empty one lists every coupon.
+func (fs *FirestoreService) GetCoupons(artisanID string) ([]models.Coupon, error) {
+	query := fs.client.Collection(CouponsCollection).Query
+	switch artisanID {
+	case "":
+	case "platform":
+		query = query.Where("artisan_id", "==", "")
+	default:
+		query = query.Where("artisan_id", "==", artisanID)
+	}
+
+	iter := query.OrderBy("created_at", firestore.Desc).Documents(fs.ctx)
+	defer iter.Stop()
+
+	coupons := []models.Coupon{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var coupon models.Coupon
+		if err := doc.DataTo(&coupon); err != nil {
+			continue
+		}
+		coupons = append(coupons, coupon)
+	}
+	return coupons, nil
+}
+
+// UpdateCoupon saves a coupon's editable terms, leaving its usage counter untouched
+func (fs *FirestoreService) UpdateCoupon(coupon *models.Coupon) error {
+	coupon.UpdatedAt = time.Now()
+	_, err := fs.client.Collection(CouponsCollection).Doc(coupon.ID).Update(fs.ctx, []firestore.Update{
+		{Path: "description", Value: coupon.Description},
+		{Path: "type", Value: coupon.Type},
+		{Path: "value", Value: coupon.Value},
+		{Path: "max_discount", Value: coupon.MaxDiscount},
+		{Path: "buy_quantity", Value: coupon.BuyQuantity},
+		{Path: "get_quantity", Value: coupon.GetQuantity},
+		{Path: "min_order_value", Value: coupon.MinOrderValue},
+		{Path: "product_ids", Value: coupon.ProductIDs},
+		{Path: "categories", Value: coupon.Categories},
+		{Path: "starts_at", Value: coupon.StartsAt},
+		{Path: "ends_at", Value: coupon.EndsAt},
+		{Path: "usage_limit", Value: coupon.UsageLimit},
+		{Path: "per_user_limit", Value: coupon.PerUserLimit},
+		{Path: "active", Value: coupon.Active},
+		{Path: "updated_at", Value: coupon.UpdatedAt},
+	})
+	return err
+}
+
+// PreviewCoupon prices items the way checkout does and applies a coupon to them without
+// redeeming it. The items are returned with their prices and discounts.
+func (fs *FirestoreService) PreviewCoupon(code, buyerID string, items []models.OrderItem, pricing *OrderPricing) (*models.Coupon, []models.OrderItem, float64, error) {
+	rates, err := pricing.Currency.Rates(fs.ctx)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to load exchange rates: %v", err)
+	}
+
+	productIDs, _ := orderQuantities(items)
+	products := make(map[string]*models.Product, len(productIDs))
+	for _, productID := range productIDs {
+		product, err := fs.GetProduct(productID)
+		if err != nil || !product.Status.IsPublic() {
+			return nil, nil, 0, fmt.Errorf("%w: %s", ErrProductUnavailable, productID)
+		}
+		products[productID] = product
+	}
+
+	if _, _, err := priceOrderItems(items, products, rates, pricing.Currency.Base()); err != nil {
+		return nil, nil, 0, err
+	}
+
+	coupon, err := fs.GetCoupon(code)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	var uses int
+	if usage, err := fs.couponUsageRef(coupon.ID, buyerID).Get(fs.ctx); err == nil {
+		if count, ok := usage.Data()["count"].(int64); ok {
+			uses = int(count)
+		}
+	}
+
+	discount, err := ApplyCoupon(coupon, uses, pricing.Currency.Base(), items, products, time.Now())
+	if err != nil {
+		return coupon, nil, 0, err
+	}
+	return coupon, items, discount, nil
+}
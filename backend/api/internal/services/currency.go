@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"voicecraft-market/internal/models"
+)
+
+// Amounts are stored in a currency's minor units (paise, cents) together with the
+// currency code. Conversions use a table of rates against the base currency from a
+// pluggable ExchangeRateSource; orders keep the rates they were priced with.
+
+var (
+	// ErrUnsupportedCurrency is returned for currency codes the marketplace does not handle
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	// ErrNoExchangeRate is returned when the rate table has no rate for a currency
+	ErrNoExchangeRate = errors.New("no exchange rate for currency")
+	// ErrReadOnlyRates is returned when rates are edited on a source that cannot store them
+	ErrReadOnlyRates = errors.New("exchange rates come from a read-only source")
+	// ErrRatesBaseMismatch is returned for rate tables quoted against another base currency
+	ErrRatesBaseMismatch = errors.New("exchange rates must be quoted against the base currency")
+)
+
+// currencyExponents lists the supported currencies and their number of minor-unit digits
+var currencyExponents = map[string]int{
+	"INR": 2, "USD": 2, "EUR": 2, "GBP": 2, "AED": 2, "SGD": 2, "AUD": 2, "CAD": 2,
+	"JPY": 0, "NPR": 2, "LKR": 2, "BDT": 2,
+}
+
+// NormalizeCurrency upper-cases a currency code and checks that it is supported
+func NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if _, ok := currencyExponents[currency]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+	return currency, nil
+}
+
+// SupportedCurrencies returns the supported currency codes
+func SupportedCurrencies() []string {
+	currencies := make([]string, 0, len(currencyExponents))
+	for currency := range currencyExponents {
+		currencies = append(currencies, currency)
+	}
+	return currencies
+}
+
+// ToMinorUnits converts a major-unit amount to the currency's minor units
+func ToMinorUnits(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(currencyExponents[strings.ToUpper(currency)])))
+}
+
+// FromMinorUnits converts minor units to a major-unit amount
+func FromMinorUnits(amount int64, currency string) float64 {
+	return float64(amount) / math.Pow10(currencyExponents[strings.ToUpper(currency)])
+}
+
+// ProductPrice returns a product's price in minor units, deriving it from the
+// major-unit price for products stored before minor units were recorded
+func ProductPrice(product *models.Product) models.Money {
+	currency := strings.ToUpper(product.Currency)
+	if currency == "" {
+		currency = "INR"
+	}
+	if product.PriceMinor > 0 {
+		return models.Money{Amount: product.PriceMinor, Currency: currency}
+	}
+	return models.Money{Amount: ToMinorUnits(product.Price, currency), Currency: currency}
+}
+
+// ExchangeRates is a table of how many units of each currency one unit of Base buys
+type ExchangeRates struct {
+	Base   string             `json:"base"`
+	Rates  map[string]float64 `json:"rates"`
+	Source string             `json:"source"`
+	AsOf   time.Time          `json:"as_of"`
+}
+
+// Rate returns the multiplier converting major units of from into major units of to
+func (r *ExchangeRates) Rate(from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	lookup := func(currency string) (float64, error) {
+		if currency == r.Base {
+			return 1, nil
+		}
+		rate, ok := r.Rates[currency]
+		if !ok || rate <= 0 {
+			return 0, fmt.Errorf("%w: %s", ErrNoExchangeRate, currency)
+		}
+		return rate, nil
+	}
+
+	fromRate, err := lookup(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := lookup(to)
+	if err != nil {
+		return 0, err
+	}
+	return toRate / fromRate, nil
+}
+
+// Convert converts an amount to another currency, rounding to the nearest minor unit
+func (r *ExchangeRates) Convert(amount models.Money, to string) (models.Money, error) {
+	rate, err := r.Rate(amount.Currency, to)
+	if err != nil {
+		return models.Money{}, err
+	}
+	major := FromMinorUnits(amount.Amount, amount.Currency) * rate
+	return models.Money{Amount: ToMinorUnits(major, to), Currency: to}, nil
+}
+
+// Snapshot records the rates for the given currencies, for storing on an order
+func (r *ExchangeRates) Snapshot(currencies ...string) *models.ExchangeRateSnapshot {
+	snapshot := &models.ExchangeRateSnapshot{
+		Base:   r.Base,
+		Rates:  map[string]float64{},
+		Source: r.Source,
+		AsOf:   r.AsOf,
+	}
+	for _, currency := range currencies {
+		if rate, err := r.Rate(r.Base, currency); err == nil && currency != r.Base {
+			snapshot.Rates[currency] = rate
+		}
+	}
+	return snapshot
+}
+
+// validate checks a rate table before it is used or stored
+func (r *ExchangeRates) validate() error {
+	base, err := NormalizeCurrency(r.Base)
+	if err != nil {
+		return err
+	}
+	r.Base = base
+
+	rates := make(map[string]float64, len(r.Rates))
+	for currency, rate := range r.Rates {
+		code, err := NormalizeCurrency(currency)
+		if err != nil {
+			return err
+		}
+		if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return fmt.Errorf("exchange rate for %s must be positive", code)
+		}
+		rates[code] = rate
+	}
+	r.Rates = rates
+	return nil
+}
+
+// ExchangeRateSource supplies the current exchange rates
+type ExchangeRateSource interface {
+	// Name identifies the source on rate snapshots
+	Name() string
+	// LoadRates returns the current rate table
+	LoadRates(ctx context.Context) (*ExchangeRates, error)
+	// SaveRates replaces the rate table, or returns ErrReadOnlyRates
+	SaveRates(ctx context.Context, rates *ExchangeRates) error
+}
+
+// FileRateSource reads rates from a JSON file in the shape of ExchangeRates, for
+// deployments that update rates by shipping a file (or never)
+type FileRateSource struct {
+	path string
+}
+
+func NewFileRateSource(path string) *FileRateSource {
+	return &FileRateSource{path: path}
+}
+
+func (f *FileRateSource) Name() string {
+	return "file"
+}
+
+func (f *FileRateSource) LoadRates(ctx context.Context) (*ExchangeRates, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %v", err)
+	}
+
+	var rates ExchangeRates
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("failed to parse exchange rates: %v", err)
+	}
+	if err := rates.validate(); err != nil {
+		return nil, err
+	}
+	if rates.AsOf.IsZero() {
+		if info, err := os.Stat(f.path); err == nil {
+			rates.AsOf = info.ModTime()
+		}
+	}
+	rates.Source = f.Name()
+	return &rates, nil
+}
+
+func (f *FileRateSource) SaveRates(ctx context.Context, rates *ExchangeRates) error {
+	return ErrReadOnlyRates
+}
+
+// FirestoreRateSource keeps admin-entered rates in a Firestore document
+type FirestoreRateSource struct {
+	firestoreService *FirestoreService
+}
+
+func NewFirestoreRateSource(firestoreService *FirestoreService) *FirestoreRateSource {
+	return &FirestoreRateSource{firestoreService: firestoreService}
+}
+
+func (f *FirestoreRateSource) Name() string {
+	return "admin"
+}
+
+func (f *FirestoreRateSource) LoadRates(ctx context.Context) (*ExchangeRates, error) {
+	rates, err := f.firestoreService.GetExchangeRates()
+	if err != nil {
+		return nil, err
+	}
+	rates.Source = f.Name()
+	return rates, nil
+}
+
+func (f *FirestoreRateSource) SaveRates(ctx context.Context, rates *ExchangeRates) error {
+	return f.firestoreService.SaveExchangeRates(rates)
+}
+
+// exchangeRatesDoc is the single document holding admin-entered rates
+const exchangeRatesDoc = "current"
+
+// GetExchangeRates loads the admin-entered exchange rates
+func (fs *FirestoreService) GetExchangeRates() (*ExchangeRates, error) {
+	doc, err := fs.client.Collection(ExchangeRatesCollection).Doc(exchangeRatesDoc).Get(fs.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored struct {
+		Base  string             `firestore:"base"`
+		Rates map[string]float64 `firestore:"rates"`
+		AsOf  time.Time          `firestore:"as_of"`
+	}
+	if err := doc.DataTo(&stored); err != nil {
+		return nil, err
+	}
+	return &ExchangeRates{Base: stored.Base, Rates: stored.Rates, AsOf: stored.AsOf}, nil
+}
+
+// SaveExchangeRates replaces the admin-entered exchange rates
+func (fs *FirestoreService) SaveExchangeRates(rates *ExchangeRates) error {
+	_, err := fs.client.Collection(ExchangeRatesCollection).Doc(exchangeRatesDoc).Set(fs.ctx, map[string]interface{}{
+		"base":  rates.Base,
+		"rates": rates.Rates,
+		"as_of": rates.AsOf,
+	})
+	return err
+}
+
+// CurrencyService converts between currencies with rates from an ExchangeRateSource,
+// caching them for a short time
+type CurrencyService struct {
+	source   ExchangeRateSource
+	base     string
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	cached   *ExchangeRates
+	cachedAt time.Time
+}
+
+// NewCurrencyService creates a converter whose orders settle in base
+func NewCurrencyService(source ExchangeRateSource, base string, cacheTTL time.Duration) (*CurrencyService, error) {
+	base, err := NormalizeCurrency(base)
+	if err != nil {
+		return nil, err
+	}
+	return &CurrencyService{source: source, base: base, cacheTTL: cacheTTL}, nil
+}
+
+// Base returns the settlement currency orders are charged in
+func (s *CurrencyService) Base() string {
+	return s.base
+}
+
+// Source returns the configured rate source
+func (s *CurrencyService) Source() ExchangeRateSource {
+	return s.source
+}
+
+// Rates returns the current rate table. When the source has no rates yet, only
+// the base currency can be used.
+func (s *CurrencyService) Rates(ctx context.Context) (*ExchangeRates, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && time.Since(s.cachedAt) < s.cacheTTL {
+		return s.cached, nil
+	}
+
+	rates, err := s.source.LoadRates(ctx)
+	if err != nil {
+		if !isNotFound(err) {
+			return nil, err
+		}
+		rates = &ExchangeRates{Base: s.base, Rates: map[string]float64{}, Source: s.source.Name()}
+	}
+
+	s.cached = rates
+	s.cachedAt = time.Now()
+	return rates, nil
+}
+
+// SetRates validates and stores new rates with the source. The table must be quoted
+// against the marketplace base currency, which prices and rate lookups assume.
+func (s *CurrencyService) SetRates(ctx context.Context, rates *ExchangeRates) (*ExchangeRates, error) {
+	if err := rates.validate(); err != nil {
+		return nil, err
+	}
+	if rates.Base != s.base {
+		return nil, fmt.Errorf("%w %s, not %s", ErrRatesBaseMismatch, s.base, rates.Base)
+	}
+	rates.AsOf = time.Now()
+
+	if err := s.source.SaveRates(ctx, rates); err != nil {
+		return nil, err
+	}
+	rates.Source = s.source.Name()
+
+	s.mu.Lock()
+	s.cached = rates
+	s.cachedAt = time.Now()
+	s.mu.Unlock()
+
+	return rates, nil
+}
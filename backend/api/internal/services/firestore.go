@@ -3,11 +3,14 @@ package services
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"time"
 	"voicecraft-market/internal/models"
 
 	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type FirestoreService struct {
@@ -40,6 +43,27 @@ const (
 	ReviewsCollection  = "reviews"
 	CartsCollection    = "carts"
 	DraftsCollection   = "product_drafts"
+
+	ModerationLogsCollection = "moderation_logs"
+	AnalyticsCollection      = "analytics"
+
+	ArtisanAnalyticsCollection = "artisan_analytics"
+	ProductLikesCollection     = "product_likes"
+	ReviewVotesCollection      = "review_votes"
+	FollowsCollection          = "follows"
+	PaymentEventsCollection    = "payment_events"
+	RefundsCollection          = "refunds"
+	ShipmentsCollection        = "shipments"
+	InvoicesCollection         = "invoices"
+	InvoiceCountersCollection  = "invoice_counters"
+	ExchangeRatesCollection    = "exchange_rates"
+	CouponsCollection          = "coupons"
+	CouponUsageCollection      = "coupon_usage"
+	WishlistsCollection        = "wishlists"
+	WishlistItemsCollection    = "wishlist_items"
+	WishlistAlertsCollection   = "wishlist_alerts"
+	UploadSessionsCollection   = "upload_sessions"
+	PromptTemplatesCollection  = "prompt_templates"
 )
 
 // Generic CRUD operations
@@ -187,7 +211,7 @@ func (fs *FirestoreService) GetProductsWithFilters(filters map[string]interface{
 			// This is a simplified version
 			continue
 		}
-		query = query.Where(key, "==", value)
+		query = query.Where(key, filterOperator(value), value)
 	}
 
 	// Apply sorting
@@ -229,7 +253,7 @@ func (fs *FirestoreService) GetProductsWithFilters(filters map[string]interface{
 	totalQuery := fs.client.Collection(ProductsCollection).Query
 	for key, value := range filters {
 		if key != "search" {
-			totalQuery = totalQuery.Where(key, "==", value)
+			totalQuery = totalQuery.Where(key, filterOperator(value), value)
 		}
 	}
 	totalDocs, err := totalQuery.Documents(fs.ctx).GetAll()
@@ -241,23 +265,62 @@ func (fs *FirestoreService) GetProductsWithFilters(filters map[string]interface{
 	return products, total, nil
 }
 
-func (fs *FirestoreService) IncrementProductViews(productID string) error {
-	return fs.UpdateDocument(ProductsCollection, productID, map[string]interface{}{
+// IncrementProductViews counts a product page view on the product and in the artisan's daily rollup
+func (fs *FirestoreService) IncrementProductViews(productID, artisanID string) error {
+	fs.incrementArtisanRollup(artisanID, productID, map[string]interface{}{
 		"views": firestore.Increment(1),
 	})
+
+	_, err := fs.client.Collection(ProductsCollection).Doc(productID).Update(fs.ctx, []firestore.Update{
+		{Path: "view_count", Value: firestore.Increment(1)},
+	})
+	return err
 }
 
-func (fs *FirestoreService) UpdateProductStock(productID string, stockChange int) error {
-	return fs.UpdateDocument(ProductsCollection, productID, map[string]interface{}{
-		"stock": firestore.Increment(stockChange),
+// UpdateProductStock adjusts the stock of a product, or of one of its variants, and returns
+// the product's total stock before the change. Live products move between active and
+// out_of_stock as their stock runs out or is replenished.
+func (fs *FirestoreService) UpdateProductStock(productID, variantID string, stockChange int) (int, error) {
+	productRef := fs.client.Collection(ProductsCollection).Doc(productID)
+
+	previous := 0
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(productRef)
+		if err != nil {
+			return err
+		}
+
+		var product models.Product
+		if err := doc.DataTo(&product); err != nil {
+			return err
+		}
+		previous = product.Stock
+
+		if _, err := itemVariant(&product, models.OrderItem{VariantID: variantID}); err != nil {
+			return err
+		}
+		adjustStock(&product, variantID, stockChange, 0)
+
+		return tx.Update(productRef, stockUpdates(&product, time.Now()))
 	})
+
+	return previous, err
 }
 
 // Artisan operations
 
+// CreateArtisan stores an artisan profile. Profiles with an ID are keyed by it
+// (the owning user's ID) so they can be looked up with GetArtisan.
 func (fs *FirestoreService) CreateArtisan(artisan *models.ArtisanProfile) (string, error) {
 	artisan.CreatedAt = time.Now()
 	artisan.UpdatedAt = time.Now()
+	if artisan.ID != "" {
+		_, err := fs.client.Collection(ArtisansCollection).Doc(artisan.ID).Set(fs.ctx, artisan)
+		if err != nil {
+			return "", err
+		}
+		return artisan.ID, nil
+	}
 	return fs.CreateDocument(ArtisansCollection, artisan)
 }
 
@@ -475,6 +538,24 @@ func (fs *FirestoreService) GetOrdersByArtisan(artisanID, status string, limit,
 
 // Utility methods
 
+// isNotFound reports whether a Firestore error means the document does not exist
+func isNotFound(err error) bool {
+	return status.Code(err) == codes.NotFound
+}
+
+// isAlreadyExists reports whether a Firestore error means a created document already exists
+func isAlreadyExists(err error) bool {
+	return status.Code(err) == codes.AlreadyExists
+}
+
+// filterOperator matches multi-valued filters with "in" and everything else with "=="
+func filterOperator(value interface{}) string {
+	if reflect.ValueOf(value).Kind() == reflect.Slice {
+		return "in"
+	}
+	return "=="
+}
+
 func (fs *FirestoreService) BatchWrite(operations []func(*firestore.WriteBatch)) error {
 	batch := fs.client.Batch()
 
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Firestore limits "in" filters to 30 values, so feeds over many artisans are queried in chunks
+const maxInFilterValues = 30
+
+var (
+	// ErrCannotFollowSelf is returned when an artisan tries to follow themselves
+	ErrCannotFollowSelf = errors.New("you cannot follow yourself")
+	// ErrInvalidCursor is returned when a feed cursor cannot be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+func followDocID(followerID, artisanID string) string {
+	return followerID + "_" + artisanID
+}
+
+// SetFollow follows or unfollows an artisan. The follow document and the artisan's
+// follower count change in one transaction; repeated calls are no-ops.
+// It reports whether anything changed.
+func (fs *FirestoreService) SetFollow(followerID, artisanID string, follow bool) (bool, error) {
+	if followerID == artisanID {
+		return false, ErrCannotFollowSelf
+	}
+
+	followRef := fs.client.Collection(FollowsCollection).Doc(followDocID(followerID, artisanID))
+	artisanRef := fs.client.Collection(ArtisansCollection).Doc(artisanID)
+
+	changed := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = false
+
+		if _, err := tx.Get(artisanRef); err != nil {
+			return err
+		}
+
+		_, err := tx.Get(followRef)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		exists := err == nil
+		if exists == follow {
+			return nil
+		}
+
+		delta := 1
+		if follow {
+			if err := tx.Create(followRef, models.Follow{
+				ID:         followRef.ID,
+				FollowerID: followerID,
+				ArtisanID:  artisanID,
+				CreatedAt:  time.Now(),
+			}); err != nil {
+				return err
+			}
+		} else {
+			delta = -1
+			if err := tx.Delete(followRef); err != nil {
+				return err
+			}
+		}
+
+		changed = true
+		return tx.Update(artisanRef, []firestore.Update{
+			{Path: "follower_count", Value: firestore.Increment(delta)},
+		})
+	})
+
+	return changed, err
+}
+
+// getFollows runs a follows query and decodes the results
+func (fs *FirestoreService) getFollows(query firestore.Query) ([]models.Follow, error) {
+	iter := query.Documents(fs.ctx)
+	defer iter.Stop()
+
+	follows := []models.Follow{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var follow models.Follow
+		if err := doc.DataTo(&follow); err != nil {
+			continue
+		}
+		follow.ID = doc.Ref.ID
+		follows = append(follows, follow)
+	}
+
+	return follows, nil
+}
+
+// GetFollowing lists the artisans a user follows, most recent first
+func (fs *FirestoreService) GetFollowing(followerID string) ([]models.Follow, error) {
+	return fs.getFollows(fs.client.Collection(FollowsCollection).
+		Where("follower_id", "==", followerID).
+		OrderBy("created_at", firestore.Desc))
+}
+
+// GetFollowerIDs lists the IDs of every user following an artisan
+func (fs *FirestoreService) GetFollowerIDs(artisanID string) ([]string, error) {
+	follows, err := fs.getFollows(fs.client.Collection(FollowsCollection).Where("artisan_id", "==", artisanID))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(follows))
+	for _, follow := range follows {
+		ids = append(ids, follow.FollowerID)
+	}
+	return ids, nil
+}
+
+// GetUserTokens returns the registered device tokens for the given users
+func (fs *FirestoreService) GetUserTokens(userIDs []string) ([]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, 0, len(userIDs))
+	for _, id := range userIDs {
+		refs = append(refs, fs.client.Collection(UsersCollection).Doc(id))
+	}
+
+	docs, err := fs.client.GetAll(fs.ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []string
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		var user models.User
+		if err := doc.DataTo(&user); err != nil || user.FCMToken == "" {
+			continue
+		}
+		tokens = append(tokens, user.FCMToken)
+	}
+	return tokens, nil
+}
+
+// feedCursor marks the last product returned on a feed page
+type feedCursor struct {
+	CreatedAt time.Time
+	ProductID string
+}
+
+func encodeFeedCursor(product models.Product) string {
+	raw := product.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + product.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeFeedCursor(cursor string) (*feedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &feedCursor{CreatedAt: createdAt, ProductID: parts[1]}, nil
+}
+
+// GetFollowingFeed lists the newest live products from the artisans a user follows.
+// Pages are ordered by creation time; pass the returned cursor to fetch the next page.
+// An empty next cursor means there are no more products.
+func (fs *FirestoreService) GetFollowingFeed(followerID, cursor string, limit int) ([]models.Product, string, error) {
+	var after *feedCursor
+	if cursor != "" {
+		var err error
+		if after, err = decodeFeedCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	follows, err := fs.GetFollowing(followerID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load followed artisans: %v", err)
+	}
+
+	products := []models.Product{}
+	for start := 0; start < len(follows); start += maxInFilterValues {
+		end := start + maxInFilterValues
+		if end > len(follows) {
+			end = len(follows)
+		}
+
+		artisanIDs := make([]string, 0, end-start)
+		for _, follow := range follows[start:end] {
+			artisanIDs = append(artisanIDs, follow.ArtisanID)
+		}
+
+		query := fs.client.Collection(ProductsCollection).
+			Where("artisan_id", "in", artisanIDs).
+			Where("status", "==", models.ProductStatusActive).
+			OrderBy("created_at", firestore.Desc).
+			OrderBy(firestore.DocumentID, firestore.Desc)
+		if after != nil {
+			query = query.StartAfter(after.CreatedAt, after.ProductID)
+		}
+		query = query.Limit(limit + 1)
+
+		iter := query.Documents(fs.ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return nil, "", err
+			}
+
+			var product models.Product
+			if err := doc.DataTo(&product); err != nil {
+				continue
+			}
+			product.ID = doc.Ref.ID
+			products = append(products, product)
+		}
+		iter.Stop()
+	}
+
+	// Merge the chunks into a single page in feed order
+	sort.Slice(products, func(i, j int) bool {
+		if !products[i].CreatedAt.Equal(products[j].CreatedAt) {
+			return products[i].CreatedAt.After(products[j].CreatedAt)
+		}
+		return products[i].ID > products[j].ID
+	})
+
+	nextCursor := ""
+	if len(products) > limit {
+		products = products[:limit]
+		nextCursor = encodeFeedCursor(products[len(products)-1])
+	}
+
+	return products, nextCursor, nil
+}
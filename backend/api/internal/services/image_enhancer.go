@@ -0,0 +1,418 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"sort"
+
+	aiplatform "cloud.google.com/go/aiplatform/apiv1"
+)
+
+// Product shots taken on a phone are often dim, colour-cast and surrounded by floor.
+// Enhancement crops to the subject, corrects white balance and exposure and can put
+// the subject on a plain studio backdrop. The subject is found by flood-filling from
+// the image edges over pixels close to the edge colour, which works for products shot
+// against a fairly even surface; the Imagen enhancer uses a segmentation model for
+// the backdrop instead.
+
+// studioBackdrop is the light grey a replaced background is filled with
+var studioBackdrop = color.NRGBA{R: 244, G: 244, B: 242, A: 255}
+
+const (
+	// enhanceMaxSize is the longest edge images are reduced to before enhancing;
+	// renditions are never larger than this
+	enhanceMaxSize = 2048
+	// backgroundTolerance is how far, in RGB distance, a pixel can be from the edge
+	// colour and still count as background
+	backgroundTolerance = 48
+	// subjectMargin is the space left around the subject when cropping, as a
+	// fraction of the subject's size
+	subjectMargin = 0.08
+	// maxLevelsGain caps how much auto-levels can stretch the tonal range
+	maxLevelsGain = 1.6
+)
+
+// ErrInvalidEnhancement is returned for an unknown enhancement mode
+var ErrInvalidEnhancement = errors.New("enhance must be auto or studio")
+
+// EnhanceOptions chooses the optional enhancement steps
+type EnhanceOptions struct {
+	ReplaceBackground bool // put the subject on a studio backdrop, padded to a square
+}
+
+// ParseEnhanceMode reads the enhance setting clients send with product photos: empty
+// for none, "auto" to crop and colour-correct, or "studio" to also replace the background
+func ParseEnhanceMode(mode string) (*EnhanceOptions, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case "auto":
+		return &EnhanceOptions{}, nil
+	case "studio":
+		return &EnhanceOptions{ReplaceBackground: true}, nil
+	}
+	return nil, ErrInvalidEnhancement
+}
+
+// ImageEnhancer improves product photos before their renditions are made
+type ImageEnhancer interface {
+	// Name identifies the enhancer on the images it processed
+	Name() string
+	// Enhance returns an improved copy of img
+	Enhance(ctx context.Context, img *image.NRGBA, options EnhanceOptions) (*image.NRGBA, error)
+}
+
+// BasicEnhancer enhances photos in pure Go: crop to the subject, gray-world white
+// balance, auto-levels and, optionally, a flood-filled backdrop padded to a square
+type BasicEnhancer struct{}
+
+func NewBasicEnhancer() *BasicEnhancer {
+	return &BasicEnhancer{}
+}
+
+func (e *BasicEnhancer) Name() string {
+	return "basic"
+}
+
+// Enhance crops, colour-corrects and optionally replaces the background of img
+func (e *BasicEnhancer) Enhance(ctx context.Context, img *image.NRGBA, options EnhanceOptions) (*image.NRGBA, error) {
+	img = limitSize(img, enhanceMaxSize)
+
+	background := edgeColor(img)
+	mask := backgroundMask(img, background)
+	if bounds, ok := subjectBounds(mask, img.Rect.Dx(), img.Rect.Dy()); ok {
+		mask = cropMask(mask, img.Rect.Dx(), bounds)
+		img = toNRGBA(img.SubImage(bounds.Add(img.Rect.Min)))
+	}
+
+	whiteBalance(img)
+	autoLevels(img)
+
+	if options.ReplaceBackground {
+		replaceBackground(img, mask, studioBackdrop)
+		img = padToSquare(img, studioBackdrop)
+	}
+	return img, nil
+}
+
+// ImagenEnhancer does the basic corrections in Go and swaps the background with an
+// Imagen editing model, falling back to the basic backdrop if the model fails
+type ImagenEnhancer struct {
+	basic    *BasicEnhancer
+	client   *aiplatform.PredictionClient
+	endpoint string
+}
+
+// NewImagenEnhancer connects to an Imagen editing model such as imagen-3.0-capability-001
+func NewImagenEnhancer(ctx context.Context, projectID, location, model string) (*ImagenEnhancer, error) {
+	client, endpoint, err := newImagenClient(ctx, projectID, location, model)
+	if err != nil {
+		return nil, err
+	}
+	return &ImagenEnhancer{basic: NewBasicEnhancer(), client: client, endpoint: endpoint}, nil
+}
+
+func (e *ImagenEnhancer) Close() error {
+	return e.client.Close()
+}
+
+func (e *ImagenEnhancer) Name() string {
+	return "imagen"
+}
+
+// Enhance corrects the photo and asks the model to replace everything but the product
+func (e *ImagenEnhancer) Enhance(ctx context.Context, img *image.NRGBA, options EnhanceOptions) (*image.NRGBA, error) {
+	corrected, err := e.basic.Enhance(ctx, img, EnhanceOptions{})
+	if err != nil || !options.ReplaceBackground {
+		return corrected, err
+	}
+
+	swapped, err := e.swapBackground(ctx, corrected)
+	if err != nil {
+		log.Printf("Imagen background swap failed, using the basic backdrop: %v", err)
+		return e.basic.Enhance(ctx, img, options)
+	}
+	return padToSquare(swapped, studioBackdrop), nil
+}
+
+func (e *ImagenEnhancer) swapBackground(ctx context.Context, img *image.NRGBA) (*image.NRGBA, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	images, err := imagenPredict(ctx, e.client, e.endpoint, map[string]interface{}{
+		"prompt": "The product on a seamless light grey studio backdrop with soft, even lighting and a gentle shadow",
+		"referenceImages": []interface{}{
+			map[string]interface{}{
+				"referenceType":  "REFERENCE_TYPE_RAW",
+				"referenceId":    1,
+				"referenceImage": map[string]interface{}{"bytesBase64Encoded": base64.StdEncoding.EncodeToString(buf.Bytes())},
+			},
+			map[string]interface{}{
+				"referenceType":   "REFERENCE_TYPE_MASK",
+				"referenceId":     2,
+				"maskImageConfig": map[string]interface{}{"maskMode": "MASK_MODE_BACKGROUND", "dilation": 0.0},
+			},
+		},
+	}, map[string]interface{}{
+		"editMode":         "EDIT_MODE_BGSWAP",
+		"sampleCount":      1,
+		"personGeneration": "dont_allow",
+		"outputOptions":    map[string]interface{}{"mimeType": "image/png"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, _, err := image.Decode(bytes.NewReader(images[0]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode edited image: %v", err)
+	}
+	return toNRGBA(result), nil
+}
+
+// limitSize scales an image down so its longest edge is at most size
+func limitSize(img *image.NRGBA, size int) *image.NRGBA {
+	w, h := fitWithin(img.Rect.Dx(), img.Rect.Dy(), size)
+	if w == img.Rect.Dx() && h == img.Rect.Dy() {
+		return img
+	}
+	return resizeNRGBA(img, w, h)
+}
+
+// edgeColor is the median colour of a thin strip around the image's edges
+func edgeColor(img *image.NRGBA) color.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	strip := max(1, min(w, h)/50)
+
+	var rs, gs, bs []int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x >= strip && x < w-strip && y >= strip && y < h-strip {
+				x = w - strip - 1 // skip the interior of the row
+				continue
+			}
+			c := img.NRGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			rs, gs, bs = append(rs, int(c.R)), append(gs, int(c.G)), append(bs, int(c.B))
+		}
+	}
+	median := func(values []int) uint8 {
+		sort.Ints(values)
+		return uint8(values[len(values)/2])
+	}
+	return color.NRGBA{R: median(rs), G: median(gs), B: median(bs), A: 255}
+}
+
+// backgroundMask flood-fills from the image's edges over pixels close to the
+// background colour; true marks background, row by row
+func backgroundMask(img *image.NRGBA, background color.NRGBA) []bool {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	mask := make([]bool, w*h)
+	near := func(x, y int) bool {
+		c := img.NRGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+		dr, dg, db := int(c.R)-int(background.R), int(c.G)-int(background.G), int(c.B)-int(background.B)
+		return dr*dr+dg*dg+db*db <= backgroundTolerance*backgroundTolerance
+	}
+
+	var stack []int
+	push := func(x, y int) {
+		if i := y*w + x; !mask[i] && near(x, y) {
+			mask[i] = true
+			stack = append(stack, i)
+		}
+	}
+	for x := 0; x < w; x++ {
+		push(x, 0)
+		push(x, h-1)
+	}
+	for y := 0; y < h; y++ {
+		push(0, y)
+		push(w-1, y)
+	}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := i%w, i/w
+		if x > 0 {
+			push(x-1, y)
+		}
+		if x < w-1 {
+			push(x+1, y)
+		}
+		if y > 0 {
+			push(x, y-1)
+		}
+		if y < h-1 {
+			push(x, y+1)
+		}
+	}
+	return mask
+}
+
+// subjectBounds is the box around everything that is not background, with a margin.
+// It reports false when the subject is too small or too large for cropping to help.
+func subjectBounds(mask []bool, w, h int) (image.Rectangle, bool) {
+	minX, minY, maxX, maxY := w, h, -1, -1
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !mask[y*w+x] {
+				minX, maxX = min(minX, x), max(maxX, x)
+				minY, maxY = min(minY, y), max(maxY, y)
+			}
+		}
+	}
+	if maxX < 0 {
+		return image.Rectangle{}, false
+	}
+
+	box := image.Rect(minX, minY, maxX+1, maxY+1)
+	area := float64(box.Dx()*box.Dy()) / float64(w*h)
+	if area < 0.02 || area > 0.9 {
+		// Either noise or a subject that already fills the frame
+		return image.Rectangle{}, false
+	}
+
+	mx := int(float64(box.Dx()) * subjectMargin)
+	my := int(float64(box.Dy()) * subjectMargin)
+	return image.Rect(box.Min.X-mx, box.Min.Y-my, box.Max.X+mx, box.Max.Y+my).Intersect(image.Rect(0, 0, w, h)), true
+}
+
+// cropMask cuts the part of a mask of width w inside bounds
+func cropMask(mask []bool, w int, bounds image.Rectangle) []bool {
+	cropped := make([]bool, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cropped = append(cropped, mask[y*w+bounds.Min.X:y*w+bounds.Max.X]...)
+	}
+	return cropped
+}
+
+// whiteBalance scales the channels so their averages match (the gray-world
+// assumption), limited so strongly coloured products are not washed out
+func whiteBalance(img *image.NRGBA) {
+	var sum [3]float64
+	forEachPixel(img, func(p []uint8) {
+		sum[0] += float64(p[0])
+		sum[1] += float64(p[1])
+		sum[2] += float64(p[2])
+	})
+	gray := (sum[0] + sum[1] + sum[2]) / 3
+	if gray == 0 {
+		return
+	}
+
+	var lut [3][256]uint8
+	for ch := 0; ch < 3; ch++ {
+		gain := 1.0
+		if sum[ch] > 0 {
+			gain = math.Max(0.8, math.Min(1.25, gray/sum[ch]))
+		}
+		for v := 0; v < 256; v++ {
+			lut[ch][v] = clampByte(float32(float64(v) * gain))
+		}
+	}
+	applyLUT(img, lut)
+}
+
+// autoLevels stretches the tones so the darkest 0.5% become black and the brightest
+// 0.5% white, using one range for all channels so the colour balance is kept. The
+// contrast is raised by at most maxLevelsGain so flat shots are not blown out.
+func autoLevels(img *image.NRGBA) {
+	var histogram [256]int
+	forEachPixel(img, func(p []uint8) {
+		histogram[p[0]]++
+		histogram[p[1]]++
+		histogram[p[2]]++
+	})
+
+	total := 0
+	for _, count := range histogram {
+		total += count
+	}
+	clip := total / 200
+	low, high := 0, 255
+	for seen := 0; low < 255 && seen+histogram[low] <= clip; low++ {
+		seen += histogram[low]
+	}
+	for seen := 0; high > 0 && seen+histogram[high] <= clip; high-- {
+		seen += histogram[high]
+	}
+	if high-low < 32 || (low == 0 && high == 255) {
+		// Nearly flat, or already using the full range
+		return
+	}
+
+	gain := min(255/float32(high-low), maxLevelsGain)
+	offset := (255 - float32(high-low)*gain) / 2 // centre what is left of the range
+
+	var lut [3][256]uint8
+	for v := 0; v < 256; v++ {
+		level := clampByte(float32(v-low)*gain + offset)
+		lut[0][v], lut[1][v], lut[2][v] = level, level, level
+	}
+	applyLUT(img, lut)
+}
+
+// replaceBackground fills the masked background with backdrop, blending the pixels
+// along the subject's edge so it does not look cut out
+func replaceBackground(img *image.NRGBA, mask []bool, backdrop color.NRGBA) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			px, py := img.Rect.Min.X+x, img.Rect.Min.Y+y
+			if mask[y*w+x] {
+				img.SetNRGBA(px, py, backdrop)
+				continue
+			}
+			if (x > 0 && mask[y*w+x-1]) || (x < w-1 && mask[y*w+x+1]) ||
+				(y > 0 && mask[(y-1)*w+x]) || (y < h-1 && mask[(y+1)*w+x]) {
+				img.SetNRGBA(px, py, mixColor(img.NRGBAAt(px, py), backdrop, 0.5))
+			}
+		}
+	}
+}
+
+// padToSquare centres an image on a square of the given colour
+func padToSquare(img *image.NRGBA, fill color.NRGBA) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if w == h {
+		return img
+	}
+
+	side := max(w, h)
+	square := image.NewNRGBA(image.Rect(0, 0, side, side))
+	for i := 0; i < len(square.Pix); i += 4 {
+		square.Pix[i], square.Pix[i+1], square.Pix[i+2], square.Pix[i+3] = fill.R, fill.G, fill.B, fill.A
+	}
+	offset := image.Pt((side-w)/2, (side-h)/2)
+	for y := 0; y < h; y++ {
+		src := img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):][:w*4]
+		copy(square.Pix[square.PixOffset(offset.X, offset.Y+y):], src)
+	}
+	return square
+}
+
+// forEachPixel calls fn with the RGBA bytes of every pixel
+func forEachPixel(img *image.NRGBA, fn func(p []uint8)) {
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, y):][:img.Rect.Dx()*4]
+		for i := 0; i < len(row); i += 4 {
+			fn(row[i : i+4])
+		}
+	}
+}
+
+// applyLUT maps each colour channel through its lookup table
+func applyLUT(img *image.NRGBA, lut [3][256]uint8) {
+	forEachPixel(img, func(p []uint8) {
+		p[0], p[1], p[2] = lut[0][p[0]], lut[1][p[1]], lut[2][p[2]]
+	})
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+)
+
+// AI-generated product images are made from a text prompt, processed into renditions
+// like uploaded photos and kept on the product in generated_images until the artisan
+// reviews them. Approving one moves it into the gallery, where it keeps its
+// ai_generated details so buyers can tell it apart from photos; rejecting one deletes
+// its files.
+
+const (
+	// MaxGeneratedImages caps the generated images awaiting approval on one product
+	MaxGeneratedImages = 8
+	// MaxImagesPerGeneration caps the images made from one request
+	MaxImagesPerGeneration = 4
+)
+
+// imageStyles are the kinds of image that can be generated, with the direction added to the prompt
+var imageStyles = map[string]string{
+	"lifestyle": "Show the product in everyday use in a warm, lived-in home with soft natural light. No people's faces, no text.",
+	"marketing": "A styled marketing shot of the product on a clean, uncluttered backdrop with studio lighting and space around it for a caption. No text.",
+}
+
+var (
+	// ErrInvalidImageGeneration is returned for generation requests with bad parameters
+	ErrInvalidImageGeneration = errors.New("invalid image generation request")
+	// ErrTooManyGeneratedImages is returned when a product already has too many images awaiting approval
+	ErrTooManyGeneratedImages = fmt.Errorf("a product can have at most %d generated images awaiting approval", MaxGeneratedImages)
+	// ErrGeneratedImageNotFound is returned when an image is not awaiting approval on the product
+	ErrGeneratedImageNotFound = errors.New("generated image not found on this product")
+	// ErrImageGenerationDisabled is returned when no image generator is configured
+	ErrImageGenerationDisabled = errors.New("image generation is not enabled")
+)
+
+// ProductImageGeneration asks for images of a product
+type ProductImageGeneration struct {
+	Prompt      string
+	Style       string // lifestyle or marketing; lifestyle when empty
+	AspectRatio string
+	Count       int
+}
+
+// ImageGenerationService generates product images and stores them for approval. Without
+// a generator, generation is disabled but images already generated can be reviewed.
+type ImageGenerationService struct {
+	firestoreService *FirestoreService
+	pipeline         *ImagePipeline
+	generator        ImageGenerator
+}
+
+func NewImageGenerationService(firestoreService *FirestoreService, pipeline *ImagePipeline, generator ImageGenerator) *ImageGenerationService {
+	return &ImageGenerationService{
+		firestoreService: firestoreService,
+		pipeline:         pipeline,
+		generator:        generator,
+	}
+}
+
+// GenerateProductImages generates images for a product and adds them to the images
+// awaiting the artisan's approval
+func (s *ImageGenerationService) GenerateProductImages(ctx context.Context, productID, userID string, request ProductImageGeneration) ([]models.ProductImage, error) {
+	if s.generator == nil {
+		return nil, ErrImageGenerationDisabled
+	}
+	request.Prompt = strings.TrimSpace(request.Prompt)
+	if request.Prompt == "" {
+		return nil, fmt.Errorf("%w: a prompt is required", ErrInvalidImageGeneration)
+	}
+	if request.Style == "" {
+		request.Style = "lifestyle"
+	}
+	direction, ok := imageStyles[request.Style]
+	if !ok {
+		return nil, fmt.Errorf("%w: style must be lifestyle or marketing", ErrInvalidImageGeneration)
+	}
+	if request.AspectRatio == "" {
+		request.AspectRatio = "1:1"
+	}
+	if _, ok := aspectRatios[request.AspectRatio]; !ok {
+		return nil, fmt.Errorf("%w: unsupported aspect ratio %s", ErrInvalidImageGeneration, request.AspectRatio)
+	}
+	if request.Count == 0 {
+		request.Count = 1
+	}
+	if request.Count < 0 || request.Count > MaxImagesPerGeneration {
+		return nil, fmt.Errorf("%w: count must be between 1 and %d", ErrInvalidImageGeneration, MaxImagesPerGeneration)
+	}
+
+	generated, err := s.generator.GenerateImages(ctx, ImageGenerationRequest{
+		Prompt:      request.Prompt + "\n\n" + direction,
+		Count:       request.Count,
+		AspectRatio: request.AspectRatio,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := models.AIImageInfo{
+		Provider:    s.generator.Name(),
+		Model:       s.generator.Model(),
+		Prompt:      request.Prompt,
+		Style:       request.Style,
+		GeneratedAt: time.Now(),
+	}
+
+	var records []models.ProductImage
+	discard := func() {
+		for _, record := range records {
+			s.pipeline.DeleteProductImage(record)
+		}
+	}
+	for _, data := range generated {
+		record, err := s.pipeline.StoreGeneratedImage(data, userID, info)
+		if err != nil {
+			discard()
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+
+	if err := s.firestoreService.addGeneratedImages(productID, records); err != nil {
+		discard()
+		return nil, err
+	}
+	return records, nil
+}
+
+// ApproveGeneratedImage moves a generated image into the product's gallery; with review
+// set a live product goes back for review
+func (s *ImageGenerationService) ApproveGeneratedImage(productID, imageID string, review bool) (*models.Product, error) {
+	return s.firestoreService.approveGeneratedImage(productID, imageID, review)
+}
+
+// RejectGeneratedImage discards a generated image and deletes its files
+func (s *ImageGenerationService) RejectGeneratedImage(productID, imageID string) error {
+	record, err := s.firestoreService.removeGeneratedImage(productID, imageID)
+	if err != nil {
+		return err
+	}
+	s.pipeline.DeleteProductImage(*record)
+	return nil
+}
+
+// updateGeneratedImages edits a product's generated images in a transaction; change
+// returns the updates to write, after editing product.GeneratedImages
+func (fs *FirestoreService) updateGeneratedImages(productID string, change func(product *models.Product) ([]firestore.Update, error)) (*models.Product, error) {
+	ref := fs.client.Collection(ProductsCollection).Doc(productID)
+
+	var product models.Product
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		product = models.Product{}
+		if err := doc.DataTo(&product); err != nil {
+			return err
+		}
+		product.ID = productID
+
+		updates, err := change(&product)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, firestore.Update{Path: "generated_images", Value: product.GeneratedImages})
+		return tx.Update(ref, updates)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (fs *FirestoreService) addGeneratedImages(productID string, added []models.ProductImage) error {
+	_, err := fs.updateGeneratedImages(productID, func(product *models.Product) ([]firestore.Update, error) {
+		if len(product.GeneratedImages)+len(added) > MaxGeneratedImages {
+			return nil, ErrTooManyGeneratedImages
+		}
+		product.GeneratedImages = append(product.GeneratedImages, added...)
+		return nil, nil
+	})
+	return err
+}
+
+func (fs *FirestoreService) approveGeneratedImage(productID, imageID string, review bool) (*models.Product, error) {
+	return fs.updateGeneratedImages(productID, func(product *models.Product) ([]firestore.Update, error) {
+		i := generatedImageIndex(product, imageID)
+		if i < 0 {
+			return nil, ErrGeneratedImageNotFound
+		}
+
+		images := productImages(product)
+		if len(images) >= MaxProductImages {
+			return nil, ErrTooManyImages
+		}
+		approved := product.GeneratedImages[i]
+		approvedAt := time.Now()
+		info := *approved.AIGenerated
+		info.ApprovedAt = &approvedAt
+		approved.AIGenerated = &info
+
+		product.GeneratedImages = append(product.GeneratedImages[:i], product.GeneratedImages[i+1:]...)
+		updates := setProductImages(product, append(images, approved), nil)
+		if review {
+			updates = append(updates, resubmitForReview(product)...)
+		}
+		return updates, nil
+	})
+}
+
+func (fs *FirestoreService) removeGeneratedImage(productID, imageID string) (*models.ProductImage, error) {
+	var removed models.ProductImage
+	_, err := fs.updateGeneratedImages(productID, func(product *models.Product) ([]firestore.Update, error) {
+		i := generatedImageIndex(product, imageID)
+		if i < 0 {
+			return nil, ErrGeneratedImageNotFound
+		}
+		removed = product.GeneratedImages[i]
+		product.GeneratedImages = append(product.GeneratedImages[:i], product.GeneratedImages[i+1:]...)
+		return []firestore.Update{{Path: "updated_at", Value: time.Now()}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &removed, nil
+}
+
+// generatedImageIndex finds an image awaiting approval by its ID
+func generatedImageIndex(product *models.Product, imageID string) int {
+	for i, image := range product.GeneratedImages {
+		if image.ID == imageID && image.AIGenerated != nil {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	aiplatform "cloud.google.com/go/aiplatform/apiv1"
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrNoImagesGenerated is returned when a generator returns no images, usually
+// because its safety filters removed them all
+var ErrNoImagesGenerated = errors.New("no images were generated for this prompt")
+
+// aspectRatios are the image shapes generators are asked for, as width and height
+var aspectRatios = map[string][2]int{
+	"1:1":  {1, 1},
+	"3:4":  {3, 4},
+	"4:3":  {4, 3},
+	"9:16": {9, 16},
+	"16:9": {16, 9},
+}
+
+// ImageGenerationRequest describes the images to generate from a prompt
+type ImageGenerationRequest struct {
+	Prompt      string
+	Count       int    // 1 to 4
+	AspectRatio string // one of the keys of aspectRatios; 1:1 when empty
+}
+
+// ImageGenerator turns text prompts into images
+type ImageGenerator interface {
+	// Name identifies the generator on the images it makes
+	Name() string
+	// Model is the model version images are generated with, if any
+	Model() string
+	// GenerateImages returns encoded images (PNG or JPEG) for the prompt
+	GenerateImages(ctx context.Context, request ImageGenerationRequest) ([][]byte, error)
+}
+
+// ImagenGenerator generates images with an Imagen model on Vertex AI
+type ImagenGenerator struct {
+	client   *aiplatform.PredictionClient
+	endpoint string
+	model    string
+}
+
+// NewImagenGenerator connects to the regional Vertex AI prediction endpoint
+func NewImagenGenerator(ctx context.Context, projectID, location, model string) (*ImagenGenerator, error) {
+	client, endpoint, err := newImagenClient(ctx, projectID, location, model)
+	if err != nil {
+		return nil, err
+	}
+	return &ImagenGenerator{client: client, endpoint: endpoint, model: model}, nil
+}
+
+// newImagenClient connects to the regional prediction endpoint and names the model's endpoint
+func newImagenClient(ctx context.Context, projectID, location, model string) (*aiplatform.PredictionClient, string, error) {
+	client, err := aiplatform.NewPredictionClient(ctx, option.WithEndpoint(fmt.Sprintf("%s-aiplatform.googleapis.com:443", location)))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create Vertex AI prediction client: %v", err)
+	}
+	return client, fmt.Sprintf("projects/%s/locations/%s/publishers/google/models/%s", projectID, location, model), nil
+}
+
+func (g *ImagenGenerator) Close() error {
+	return g.client.Close()
+}
+
+func (g *ImagenGenerator) Name() string {
+	return "imagen"
+}
+
+func (g *ImagenGenerator) Model() string {
+	return g.model
+}
+
+// GenerateImages asks Imagen for the requested number of images. People are kept out
+// of the pictures, and images the model's filters remove are simply not returned.
+func (g *ImagenGenerator) GenerateImages(ctx context.Context, request ImageGenerationRequest) ([][]byte, error) {
+	aspectRatio := request.AspectRatio
+	if aspectRatio == "" {
+		aspectRatio = "1:1"
+	}
+
+	return imagenPredict(ctx, g.client, g.endpoint, map[string]interface{}{
+		"prompt": request.Prompt,
+	}, map[string]interface{}{
+		"sampleCount":      request.Count,
+		"aspectRatio":      aspectRatio,
+		"personGeneration": "dont_allow",
+		"outputOptions":    map[string]interface{}{"mimeType": "image/png"},
+	})
+}
+
+// imagenPredict sends one instance to an Imagen endpoint and decodes the images it returns
+func imagenPredict(ctx context.Context, client *aiplatform.PredictionClient, endpoint string, instance, parameters map[string]interface{}) ([][]byte, error) {
+	instanceValue, err := structpb.NewValue(instance)
+	if err != nil {
+		return nil, err
+	}
+	parametersValue, err := structpb.NewValue(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Predict(ctx, &aiplatformpb.PredictRequest{
+		Endpoint:   endpoint,
+		Instances:  []*structpb.Value{instanceValue},
+		Parameters: parametersValue,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("imagen request failed: %v", err)
+	}
+
+	var images [][]byte
+	for _, prediction := range resp.GetPredictions() {
+		encoded := prediction.GetStructValue().GetFields()["bytesBase64Encoded"].GetStringValue()
+		if encoded == "" {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode generated image: %v", err)
+		}
+		images = append(images, data)
+	}
+	if len(images) == 0 {
+		return nil, ErrNoImagesGenerated
+	}
+	return images, nil
+}
+
+// PlaceholderImageGenerator renders simple still lifes locally, for development and
+// tests without Vertex AI. The colours are derived from the prompt, so the same
+// prompt always gives the same images.
+type PlaceholderImageGenerator struct {
+	size int // longest edge in pixels
+}
+
+func NewPlaceholderImageGenerator() *PlaceholderImageGenerator {
+	return &PlaceholderImageGenerator{size: 1024}
+}
+
+func (g *PlaceholderImageGenerator) Name() string {
+	return "placeholder"
+}
+
+func (g *PlaceholderImageGenerator) Model() string {
+	return ""
+}
+
+// GenerateImages renders one PNG per requested image
+func (g *PlaceholderImageGenerator) GenerateImages(ctx context.Context, request ImageGenerationRequest) ([][]byte, error) {
+	ratio, ok := aspectRatios[request.AspectRatio]
+	if !ok {
+		ratio = aspectRatios["1:1"]
+	}
+	w, h := g.size, g.size
+	if ratio[0] > ratio[1] {
+		h = g.size * ratio[1] / ratio[0]
+	} else {
+		w = g.size * ratio[0] / ratio[1]
+	}
+
+	images := make([][]byte, 0, request.Count)
+	for i := 0; i < request.Count; i++ {
+		seed := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", i, request.Prompt)))
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, renderPlaceholder(w, h, seed)); err != nil {
+			return nil, err
+		}
+		images = append(images, buf.Bytes())
+	}
+	return images, nil
+}
+
+// renderPlaceholder draws a round object with a soft shadow on a tabletop, over a
+// vertical gradient, with colours taken from seed
+func renderPlaceholder(w, h int, seed [32]byte) *image.NRGBA {
+	top := color.NRGBA{seed[0]/2 + 128, seed[1]/2 + 128, seed[2]/2 + 128, 255}
+	bottom := color.NRGBA{seed[3] / 2, seed[4] / 2, seed[5] / 2, 255}
+	object := color.NRGBA{seed[6], seed[7], seed[8], 255}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	horizon := h * 2 / 3
+	cx := float64(w) * (0.35 + float64(seed[9])/255*0.3)
+	radius := float64(min(w, h)) * (0.18 + float64(seed[10])/255*0.1)
+	cy := float64(horizon) - radius*0.6
+
+	for y := 0; y < h; y++ {
+		t := float64(y) / float64(h-1)
+		row := mixColor(top, bottom, t)
+		if y >= horizon {
+			// The tabletop is a darker band below the horizon
+			row = mixColor(row, bottom, 0.5)
+		}
+		for x := 0; x < w; x++ {
+			c := row
+
+			// Shadow: an ellipse under the object that fades towards its edge
+			sx, sy := (float64(x)-cx)/(radius*1.2), (float64(y)-float64(horizon))/(radius*0.25)
+			if d := sx*sx + sy*sy; d < 1 {
+				c = mixColor(c, color.NRGBA{0, 0, 0, 255}, 0.35*(1-d))
+			}
+
+			// Object: a sphere lit from the top left
+			dx, dy := (float64(x)-cx)/radius, (float64(y)-cy)/radius
+			if d := dx*dx + dy*dy; d <= 1 {
+				light := 0.55 + 0.45*(-dx*0.5-dy*0.7+math.Sqrt(1-d)*0.5)
+				c = scaleColor(object, light)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// mixColor blends from a towards b by t between 0 and 1
+func mixColor(a, b color.NRGBA, t float64) color.NRGBA {
+	blend := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*t))
+	}
+	return color.NRGBA{blend(a.R, b.R), blend(a.G, b.G), blend(a.B, b.B), 255}
+}
+
+// scaleColor brightens or darkens a colour, clamping each channel
+func scaleColor(c color.NRGBA, factor float64) color.NRGBA {
+	scale := func(x uint8) uint8 {
+		return uint8(math.Max(0, math.Min(255, math.Round(float64(x)*factor))))
+	}
+	return color.NRGBA{scale(c.R), scale(c.G), scale(c.B), 255}
+}
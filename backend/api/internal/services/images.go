@@ -0,0 +1,426 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"math"
+	"time"
+	"voicecraft-market/internal/models"
+
+	_ "image/gif" // register the GIF decoder
+
+	"github.com/google/uuid"
+)
+
+// Uploaded product photos are decoded, turned upright, re-encoded without their
+// metadata and stored as a set of renditions, each as JPEG (PNG for images with
+// transparency) and, when a WebP codec is configured, WebP. The original upload is
+// not kept; photos that are enhanced keep the unenhanced photo, cleaned the same way,
+// as an extra "original" rendition.
+
+var (
+	// ErrUnsupportedImage is returned for image formats the pipeline cannot decode
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	// ErrInvalidImage is returned when an upload cannot be decoded as an image
+	ErrInvalidImage = errors.New("file is not a readable image")
+	// ErrEnhancementDisabled is returned when enhancement is asked for but no enhancer is configured
+	ErrEnhancementDisabled = errors.New("photo enhancement is not enabled")
+)
+
+// imageRendition is one stored size of a product image
+type imageRendition struct {
+	name    string
+	size    int  // longest edge, or the side of a square crop
+	square  bool // center-crop to a square first
+	quality int
+}
+
+var productRenditions = []imageRendition{
+	{name: "thumbnail", size: 240, square: true, quality: 78},
+	{name: "card", size: 640, quality: 80},
+	{name: "full", size: 1600, quality: 85},
+}
+
+// originalRendition keeps an enhanced photo as it was taken
+var originalRendition = imageRendition{name: "original", size: 1600, quality: 85}
+
+// blurhashSize is the edge of the small image the blurhash is computed from
+const blurhashSize = 32
+
+// encodedRendition is a rendition ready to upload
+type encodedRendition struct {
+	models.ImageRendition
+	contentType string
+	data        []byte
+}
+
+// ImagePipeline processes product photos and stores their renditions
+type ImagePipeline struct {
+	storage  *StorageService
+	webp     WebPCodec
+	enhancer ImageEnhancer
+}
+
+// NewImagePipeline creates a pipeline; webp may be nil to skip WebP and enhancer nil
+// to turn enhancement off
+func NewImagePipeline(storage *StorageService, webp WebPCodec, enhancer ImageEnhancer) *ImagePipeline {
+	return &ImagePipeline{storage: storage, webp: webp, enhancer: enhancer}
+}
+
+// StoreProductImage processes an uploaded photo and stores its renditions under the
+// uploader's folder in the image bucket
+func (p *ImagePipeline) StoreProductImage(data []byte, userID string) (*models.ProductImage, error) {
+	record, renditions, err := p.Process(data)
+	if err != nil {
+		return nil, err
+	}
+	return p.store(record, renditions, userID, nil)
+}
+
+// CanEnhance reports whether an enhancer is configured
+func (p *ImagePipeline) CanEnhance() bool {
+	return p.enhancer != nil
+}
+
+// StoreEnhancedProductImage enhances an uploaded photo before making its renditions
+// and stores the unenhanced photo alongside them as the "original" rendition
+func (p *ImagePipeline) StoreEnhancedProductImage(ctx context.Context, data []byte, userID string, options EnhanceOptions) (*models.ProductImage, error) {
+	if p.enhancer == nil {
+		return nil, ErrEnhancementDisabled
+	}
+
+	img, err := p.decode(data)
+	if err != nil {
+		return nil, err
+	}
+	enhanced, err := p.enhancer.Enhance(ctx, img, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enhance image: %v", err)
+	}
+
+	record, renditions, err := p.render(enhanced)
+	if err != nil {
+		return nil, err
+	}
+	original, err := p.encode(renditionImage(img, originalRendition), originalRendition)
+	if err != nil {
+		return nil, err
+	}
+	renditions = append(renditions, original...)
+
+	record.Enhancement = &models.ImageEnhancement{
+		Enhancer:           p.enhancer.Name(),
+		BackgroundReplaced: options.ReplaceBackground,
+	}
+	return p.store(record, renditions, userID, map[string]string{"enhanced-by": p.enhancer.Name()})
+}
+
+// StoreGeneratedImage processes and stores an AI-generated image like an upload,
+// marking the record and the stored files as generated
+func (p *ImagePipeline) StoreGeneratedImage(data []byte, userID string, info models.AIImageInfo) (*models.ProductImage, error) {
+	record, renditions, err := p.Process(data)
+	if err != nil {
+		return nil, err
+	}
+	record.AIGenerated = &info
+	return p.store(record, renditions, userID, map[string]string{
+		"ai-generated": info.Provider,
+		"ai-model":     info.Model,
+	})
+}
+
+// store uploads encoded renditions and adds them to the record
+func (p *ImagePipeline) store(record *models.ProductImage, renditions []encodedRendition, userID string, metadata map[string]string) (*models.ProductImage, error) {
+	record.ID = uuid.New().String()
+	record.CreatedAt = time.Now()
+	var stored []string
+	for i, rendition := range renditions {
+		fileName := fmt.Sprintf("images/%s/%s/%s.%s", userID, record.ID, rendition.Name, rendition.Format)
+		fileMetadata := map[string]string{
+			"uploaded-by": userID,
+			"rendition":   rendition.Name,
+		}
+		for key, value := range metadata {
+			fileMetadata[key] = value
+		}
+		result, err := p.storage.UploadImageData(rendition.data, fileName, rendition.contentType, fileMetadata)
+		if err != nil {
+			// Don't leave a partial set of renditions behind
+			for _, name := range stored {
+				p.storage.DeleteImage(name)
+			}
+			return nil, err
+		}
+		stored = append(stored, fileName)
+		renditions[i].URL = result.URL
+		renditions[i].Size = result.Size
+		record.Renditions = append(record.Renditions, renditions[i].ImageRendition)
+	}
+	return record, nil
+}
+
+// DeleteProductImage deletes the stored renditions of a processed image. Images
+// from before renditions existed are left to the StorageSweeper, which checks that
+// nothing else still uses them.
+func (p *ImagePipeline) DeleteProductImage(record models.ProductImage) {
+	for _, rendition := range record.Renditions {
+		if rendition.Format == "" {
+			continue
+		}
+		if err := p.storage.DeleteFileByURL(rendition.URL); err != nil {
+			log.Printf("Failed to delete image rendition %s: %v", rendition.URL, err)
+		}
+	}
+}
+
+// Process decodes an image and encodes its renditions without storing them
+func (p *ImagePipeline) Process(data []byte) (*models.ProductImage, []encodedRendition, error) {
+	img, err := p.decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.render(img)
+}
+
+// render encodes the renditions of a decoded image
+func (p *ImagePipeline) render(img *image.NRGBA) (*models.ProductImage, []encodedRendition, error) {
+	record := &models.ProductImage{
+		Width:    img.Rect.Dx(),
+		Height:   img.Rect.Dy(),
+		Blurhash: imageBlurhash(img),
+	}
+
+	var renditions []encodedRendition
+	for _, spec := range productRenditions {
+		resized := renditionImage(img, spec)
+		encoded, err := p.encode(resized, spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		renditions = append(renditions, encoded...)
+	}
+	return record, renditions, nil
+}
+
+// decode reads JPEG, PNG, GIF and (with a codec) WebP images into upright NRGBA pixels
+func (p *ImagePipeline) decode(data []byte) (*image.NRGBA, error) {
+	var src image.Image
+	if isWebP(data) {
+		if p.webp == nil {
+			return nil, fmt.Errorf("%w: WebP uploads are not enabled", ErrUnsupportedImage)
+		}
+		var err error
+		if src, err = p.webp.DecodeWebP(data); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+	} else {
+		var format string
+		var err error
+		src, format, err = image.Decode(bytes.NewReader(data))
+		if err != nil {
+			if errors.Is(err, image.ErrFormat) {
+				return nil, ErrUnsupportedImage
+			}
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		if format == "jpeg" {
+			return applyOrientation(toNRGBA(src), jpegOrientation(data)), nil
+		}
+	}
+	return toNRGBA(src), nil
+}
+
+// encode writes a rendition as JPEG or PNG, plus WebP when a codec is configured
+func (p *ImagePipeline) encode(img *image.NRGBA, spec imageRendition) ([]encodedRendition, error) {
+	base := models.ImageRendition{Name: spec.name, Width: img.Rect.Dx(), Height: img.Rect.Dy()}
+
+	var buf bytes.Buffer
+	primary := encodedRendition{ImageRendition: base}
+	if img.Opaque() {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: spec.quality}); err != nil {
+			return nil, err
+		}
+		primary.Format, primary.contentType = "jpeg", "image/jpeg"
+	} else {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		primary.Format, primary.contentType = "png", "image/png"
+	}
+	primary.data = buf.Bytes()
+	renditions := []encodedRendition{primary}
+
+	if p.webp != nil {
+		data, err := p.webp.EncodeWebP(img, spec.quality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode WebP: %v", err)
+		}
+		webp := encodedRendition{ImageRendition: base, contentType: "image/webp", data: data}
+		webp.Format = "webp"
+		renditions = append(renditions, webp)
+	}
+	return renditions, nil
+}
+
+// isWebP checks for the RIFF/WEBP container header
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// toNRGBA copies any image into non-premultiplied RGBA pixels starting at the origin
+func toNRGBA(src image.Image) *image.NRGBA {
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Rect, src, bounds.Min, draw.Src)
+	return dst
+}
+
+// renditionImage crops and scales an image for a rendition, never enlarging it
+func renditionImage(img *image.NRGBA, spec imageRendition) *image.NRGBA {
+	src := img
+	if spec.square {
+		w, h := img.Rect.Dx(), img.Rect.Dy()
+		side := min(w, h)
+		x0, y0 := (w-side)/2, (h-side)/2
+		src = img.SubImage(image.Rect(x0, y0, x0+side, y0+side)).(*image.NRGBA)
+	}
+
+	w, h := fitWithin(src.Rect.Dx(), src.Rect.Dy(), spec.size)
+	if w == src.Rect.Dx() && h == src.Rect.Dy() {
+		return src
+	}
+	return resizeNRGBA(src, w, h)
+}
+
+// fitWithin scales dimensions down so the longest edge is at most size
+func fitWithin(w, h, size int) (int, int) {
+	longest := max(w, h)
+	if longest <= size {
+		return w, h
+	}
+	scale := float64(size) / float64(longest)
+	return max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale)))
+}
+
+// imageBlurhash computes a blurhash placeholder, with more components along the longer edge
+func imageBlurhash(img *image.NRGBA) string {
+	w, h := fitWithin(img.Rect.Dx(), img.Rect.Dy(), blurhashSize)
+	small := img
+	if w != img.Rect.Dx() || h != img.Rect.Dy() {
+		small = resizeNRGBA(img, w, h)
+	}
+	if w >= h {
+		return blurhash(small, 4, 3)
+	}
+	return blurhash(small, 3, 4)
+}
+
+// filterTap is the run of source pixels, and their weights, that make up one output pixel
+type filterTap struct {
+	start   int
+	weights []float32
+}
+
+// filterTaps computes tent-filter weights for scaling srcLen pixels to dstLen. When
+// shrinking, the filter widens with the scale so every source pixel contributes.
+func filterTaps(dstLen, srcLen int) []filterTap {
+	scale := float64(srcLen) / float64(dstLen)
+	support := math.Max(1, scale)
+
+	taps := make([]filterTap, dstLen)
+	for i := range taps {
+		center := (float64(i)+0.5)*scale - 0.5
+		lo := int(math.Ceil(center - support))
+		hi := int(math.Floor(center + support))
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > srcLen-1 {
+			hi = srcLen - 1
+		}
+
+		weights := make([]float32, 0, hi-lo+1)
+		var total float64
+		for x := lo; x <= hi; x++ {
+			weight := math.Max(0, 1-math.Abs(float64(x)-center)/support)
+			weights = append(weights, float32(weight))
+			total += weight
+		}
+		if total == 0 {
+			weights = []float32{1}
+			lo = int(math.Min(math.Max(math.Round(center), 0), float64(srcLen-1)))
+			total = 1
+		}
+		for k := range weights {
+			weights[k] /= float32(total)
+		}
+		taps[i] = filterTap{start: lo, weights: weights}
+	}
+	return taps
+}
+
+// resizeNRGBA scales an image in two separable passes, weighting colours by alpha so
+// transparent pixels do not darken their neighbours
+func resizeNRGBA(src *image.NRGBA, w, h int) *image.NRGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	xTaps, yTaps := filterTaps(w, sw), filterTaps(h, sh)
+
+	// Horizontal pass into premultiplied floats
+	tmp := make([]float32, w*sh*4)
+	for y := 0; y < sh; y++ {
+		row := src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y)
+		for x, tap := range xTaps {
+			var r, g, b, a float32
+			for k, weight := range tap.weights {
+				o := row + (tap.start+k)*4
+				alpha := float32(src.Pix[o+3]) * weight
+				r += float32(src.Pix[o]) * alpha
+				g += float32(src.Pix[o+1]) * alpha
+				b += float32(src.Pix[o+2]) * alpha
+				a += alpha
+			}
+			t := (y*w + x) * 4
+			tmp[t], tmp[t+1], tmp[t+2], tmp[t+3] = r, g, b, a
+		}
+	}
+
+	// Vertical pass back to straight alpha
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y, tap := range yTaps {
+		for x := 0; x < w; x++ {
+			var r, g, b, a float32
+			for k, weight := range tap.weights {
+				t := ((tap.start+k)*w + x) * 4
+				r += tmp[t] * weight
+				g += tmp[t+1] * weight
+				b += tmp[t+2] * weight
+				a += tmp[t+3] * weight
+			}
+			d := dst.PixOffset(x, y)
+			if a > 0 {
+				dst.Pix[d] = clampByte(r / a)
+				dst.Pix[d+1] = clampByte(g / a)
+				dst.Pix[d+2] = clampByte(b / a)
+			}
+			dst.Pix[d+3] = clampByte(a)
+		}
+	}
+	return dst
+}
+
+func clampByte(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
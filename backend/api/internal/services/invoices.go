@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Each artisan on a paid order issues their own GST invoice for their items and
+// shipping. Invoice numbers run sequentially per artisan within each Indian
+// financial year (April to March), as GST requires.
+
+// financialYear returns the Indian financial year containing t, such as "2026-27"
+func financialYear(t time.Time) string {
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// invoiceNumber formats an invoice number within GST's 16-character limit, such as "AB12CD/2627/0042"
+func invoiceNumber(artisanID, fy string, sequence int) string {
+	prefix := strings.ToUpper(artisanID)
+	if len(prefix) > 6 {
+		prefix = prefix[:6]
+	}
+	return fmt.Sprintf("%s/%s%s/%04d", prefix, fy[2:4], fy[5:7], sequence)
+}
+
+// IssueInvoice stores an artisan's invoice for an order under the next number in
+// their series. An invoice already issued for the order and artisan is returned
+// unchanged with created false.
+func (fs *FirestoreService) IssueInvoice(invoice *models.Invoice) (*models.Invoice, bool, error) {
+	invoiceRef := fs.client.Collection(InvoicesCollection).Doc(invoice.OrderID + "_" + invoice.ArtisanID)
+	fy := financialYear(invoice.IssuedAt)
+	counterRef := fs.client.Collection(InvoiceCountersCollection).Doc(invoice.ArtisanID + "_" + fy)
+
+	var result *models.Invoice
+	created := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		created = false
+
+		doc, err := tx.Get(invoiceRef)
+		if err == nil {
+			var existing models.Invoice
+			if err := doc.DataTo(&existing); err != nil {
+				return err
+			}
+			existing.ID = invoiceRef.ID
+			result = &existing
+			return nil
+		}
+		if !isNotFound(err) {
+			return err
+		}
+
+		last := 0
+		counter, err := tx.Get(counterRef)
+		if err == nil {
+			if value, err := counter.DataAt("last_sequence"); err == nil {
+				if n, ok := value.(int64); ok {
+					last = int(n)
+				}
+			}
+		} else if !isNotFound(err) {
+			return err
+		}
+
+		issued := *invoice
+		issued.ID = invoiceRef.ID
+		issued.FinancialYear = fy
+		issued.Sequence = last + 1
+		issued.Number = invoiceNumber(invoice.ArtisanID, fy, issued.Sequence)
+
+		if err := tx.Set(counterRef, map[string]interface{}{
+			"artisan_id":     invoice.ArtisanID,
+			"financial_year": fy,
+			"last_sequence":  issued.Sequence,
+			"updated_at":     time.Now(),
+		}); err != nil {
+			return err
+		}
+		if err := tx.Create(invoiceRef, &issued); err != nil {
+			return err
+		}
+
+		result = &issued
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return result, created, nil
+}
+
+// GetInvoice loads an invoice by ID
+func (fs *FirestoreService) GetInvoice(invoiceID string) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := fs.GetDocument(InvoicesCollection, invoiceID, &invoice); err != nil {
+		return nil, err
+	}
+	invoice.ID = invoiceID
+	return &invoice, nil
+}
+
+// GetOrderInvoices lists the invoices issued for an order
+func (fs *FirestoreService) GetOrderInvoices(orderID string) ([]models.Invoice, error) {
+	docs, err := fs.client.Collection(InvoicesCollection).Where("order_id", "==", orderID).Documents(fs.ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	invoices := make([]models.Invoice, 0, len(docs))
+	for _, doc := range docs {
+		var invoice models.Invoice
+		if err := doc.DataTo(&invoice); err != nil {
+			continue
+		}
+		invoice.ID = doc.Ref.ID
+		invoices = append(invoices, invoice)
+	}
+	return invoices, nil
+}
+
+// UpdateInvoice updates fields on an invoice
+func (fs *FirestoreService) UpdateInvoice(invoiceID string, updates map[string]interface{}) error {
+	return fs.UpdateDocument(InvoicesCollection, invoiceID, updates)
+}
+
+// InvoiceService issues GST invoices for paid orders and renders them as PDFs
+type InvoiceService struct {
+	firestoreService *FirestoreService
+	storageService   *StorageService
+}
+
+func NewInvoiceService(firestoreService *FirestoreService, storageService *StorageService) *InvoiceService {
+	return &InvoiceService{
+		firestoreService: firestoreService,
+		storageService:   storageService,
+	}
+}
+
+// IssueInvoices issues an invoice for each artisan on a paid order, skipping those
+// already issued, and archives each new invoice's PDF
+func (s *InvoiceService) IssueInvoices(order *models.Order) ([]models.Invoice, error) {
+	if order.PaidAt == nil {
+		return nil, fmt.Errorf("order %s has not been paid", order.ID)
+	}
+
+	var artisanIDs []string
+	seen := make(map[string]bool)
+	for _, item := range order.Items {
+		if !seen[item.ArtisanID] {
+			seen[item.ArtisanID] = true
+			artisanIDs = append(artisanIDs, item.ArtisanID)
+		}
+	}
+
+	invoices := make([]models.Invoice, 0, len(artisanIDs))
+	for _, artisanID := range artisanIDs {
+		invoice, created, err := s.firestoreService.IssueInvoice(s.buildInvoice(order, artisanID))
+		if err != nil {
+			return invoices, fmt.Errorf("failed to issue invoice for artisan %s: %v", artisanID, err)
+		}
+
+		if created {
+			s.archive(invoice)
+		}
+		invoices = append(invoices, *invoice)
+	}
+
+	return invoices, nil
+}
+
+// GetOrderInvoices returns an order's invoices, issuing any that are missing once the order is paid
+func (s *InvoiceService) GetOrderInvoices(order *models.Order) ([]models.Invoice, error) {
+	if order.PaidAt == nil {
+		return []models.Invoice{}, nil
+	}
+
+	invoices, err := s.firestoreService.GetOrderInvoices(order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := make(map[string]bool, len(invoices))
+	for _, invoice := range invoices {
+		issued[invoice.ArtisanID] = true
+	}
+	for _, item := range order.Items {
+		if !issued[item.ArtisanID] {
+			return s.IssueInvoices(order)
+		}
+	}
+
+	return invoices, nil
+}
+
+// PDF returns an invoice's archived PDF, rendering it again if the archive is unavailable
+func (s *InvoiceService) PDF(invoice *models.Invoice) []byte {
+	if invoice.FileName != "" && s.storageService != nil {
+		if data, err := s.storageService.DownloadFile(invoice.FileName, ""); err == nil {
+			return data
+		}
+	}
+	return renderInvoicePDF(invoice)
+}
+
+// buildInvoice collects an artisan's tax lines and the parties for an unnumbered invoice
+func (s *InvoiceService) buildInvoice(order *models.Order, artisanID string) *models.Invoice {
+	invoice := &models.Invoice{
+		OrderID:    order.ID,
+		ArtisanID:  artisanID,
+		BuyerID:    order.BuyerID,
+		SellerName: "Artisan",
+		BillTo:     order.BillingAddress,
+		ShipTo:     order.ShippingAddress,
+		Currency:   order.Currency,
+		IssuedAt:   time.Now(),
+	}
+	if invoice.BillTo.Name == "" {
+		invoice.BillTo = order.ShippingAddress
+	}
+
+	if user, err := s.firestoreService.GetUser(artisanID); err == nil && user.Name != "" {
+		invoice.SellerName = user.Name
+	}
+	if artisan, err := s.firestoreService.GetArtisan(artisanID); err == nil {
+		invoice.SellerState = artisan.State
+		invoice.SellerGSTIN = artisan.GSTIN
+		invoice.SellerAddress = strings.TrimSpace(strings.Join([]string{artisan.Location, artisan.PostalCode}, " "))
+	}
+	invoice.Interstate = IsInterstateSupply(invoice.SellerState, order.ShippingAddress.State)
+
+	for _, line := range order.TaxLines {
+		if line.ArtisanID != artisanID {
+			continue
+		}
+		invoice.Lines = append(invoice.Lines, line)
+		invoice.TaxableValue += line.TaxableValue
+		invoice.CGST += line.CGST
+		invoice.SGST += line.SGST
+		invoice.IGST += line.IGST
+		invoice.Total += line.Total
+	}
+	invoice.TaxableValue = roundAmount(invoice.TaxableValue)
+	invoice.CGST = roundAmount(invoice.CGST)
+	invoice.SGST = roundAmount(invoice.SGST)
+	invoice.IGST = roundAmount(invoice.IGST)
+	invoice.Total = roundAmount(invoice.Total)
+
+	return invoice
+}
+
+// archive stores a newly issued invoice's PDF. Failures are logged; the PDF can always be rendered again.
+func (s *InvoiceService) archive(invoice *models.Invoice) {
+	if s.storageService == nil {
+		return
+	}
+
+	fileName := fmt.Sprintf("invoices/%s/%s.pdf", invoice.ArtisanID, invoice.ID)
+	_, err := s.storageService.UploadData(renderInvoicePDF(invoice), fileName, "application/pdf", map[string]string{
+		"invoice-number": invoice.Number,
+		"order-id":       invoice.OrderID,
+	})
+	if err != nil {
+		log.Printf("Failed to archive invoice %s: %v", invoice.Number, err)
+		return
+	}
+
+	if err := s.firestoreService.UpdateInvoice(invoice.ID, map[string]interface{}{"file_name": fileName}); err != nil {
+		log.Printf("Failed to record archived invoice %s: %v", invoice.Number, err)
+		return
+	}
+	invoice.FileName = fileName
+}
+
+// formatAddress joins the non-empty parts of an address on one line
+func formatAddress(address models.Address) string {
+	var parts []string
+	for _, part := range []string{address.Line1, address.Line2, address.City, address.State, address.PostalCode} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// truncate shortens text to at most n characters
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// renderInvoicePDF lays out a GST tax invoice on A4 pages
+func renderInvoicePDF(invoice *models.Invoice) []byte {
+	const left, right = 40.0, 555.0
+	doc := newPDFDocument()
+	amount := func(value float64) string { return fmt.Sprintf("%.2f", value) }
+
+	doc.Text(left, 60, 18, true, "TAX INVOICE")
+	doc.TextRight(right, 50, 10, false, "Invoice No: "+invoice.Number)
+	doc.TextRight(right, 64, 10, false, "Date: "+invoice.IssuedAt.Format("02 Jan 2006"))
+	doc.TextRight(right, 78, 10, false, "Order: "+invoice.OrderID)
+
+	y := 110.0
+	doc.Text(left, y, 10, true, "Sold by")
+	doc.Text(left, y+14, 10, false, invoice.SellerName)
+	doc.Text(left, y+28, 9, false, truncate(invoice.SellerAddress, 60))
+	if invoice.SellerGSTIN != "" {
+		doc.Text(left, y+42, 9, false, "GSTIN: "+invoice.SellerGSTIN)
+	} else {
+		doc.Text(left, y+42, 9, false, "GSTIN: Unregistered")
+	}
+
+	doc.Text(300, y, 10, true, "Bill to")
+	doc.Text(300, y+14, 10, false, invoice.BillTo.Name)
+	doc.Text(300, y+28, 9, false, truncate(formatAddress(invoice.BillTo), 55))
+	doc.Text(300, y+42, 9, false, "Ship to: "+truncate(formatAddress(invoice.ShipTo), 46))
+	doc.Text(300, y+56, 9, false, "Place of supply: "+invoice.ShipTo.State)
+
+	header := func(y float64) {
+		doc.Line(left, y-12, right, y-12)
+		doc.Text(left, y, 8, true, "#")
+		doc.Text(56, y, 8, true, "Description")
+		doc.Text(230, y, 8, true, "HSN/SAC")
+		doc.TextRight(290, y, 8, true, "Qty")
+		doc.TextRight(345, y, 8, true, "Taxable")
+		doc.TextRight(378, y, 8, true, "Rate")
+		doc.TextRight(425, y, 8, true, "CGST")
+		doc.TextRight(470, y, 8, true, "SGST")
+		doc.TextRight(515, y, 8, true, "IGST")
+		doc.TextRight(right, y, 8, true, "Total")
+		doc.Line(left, y+5, right, y+5)
+	}
+
+	y = 210
+	header(y)
+	y += 20
+	for i, line := range invoice.Lines {
+		if y > pdfPageHeight-100 {
+			doc.AddPage()
+			y = 60
+			header(y)
+			y += 20
+		}
+
+		doc.Text(left, y, 8, false, fmt.Sprintf("%d", i+1))
+		doc.Text(56, y, 8, false, truncate(line.Description, 34))
+		doc.Text(230, y, 8, false, line.HSNCode)
+		doc.TextRight(290, y, 8, false, fmt.Sprintf("%d", line.Quantity))
+		doc.TextRight(345, y, 8, false, amount(line.TaxableValue))
+		doc.TextRight(378, y, 8, false, fmt.Sprintf("%g%%", line.Rate))
+		doc.TextRight(425, y, 8, false, amount(line.CGST))
+		doc.TextRight(470, y, 8, false, amount(line.SGST))
+		doc.TextRight(515, y, 8, false, amount(line.IGST))
+		doc.TextRight(right, y, 8, false, amount(line.Total))
+		y += 16
+	}
+
+	doc.Line(left, y-8, right, y-8)
+	y += 8
+	totals := [][2]string{
+		{"Taxable value", amount(invoice.TaxableValue)},
+		{"CGST", amount(invoice.CGST)},
+		{"SGST", amount(invoice.SGST)},
+		{"IGST", amount(invoice.IGST)},
+		{"Invoice total (" + invoice.Currency + ")", amount(invoice.Total)},
+	}
+	for i, total := range totals {
+		bold := i == len(totals)-1
+		doc.TextRight(470, y, 9, bold, total[0])
+		doc.TextRight(right, y, 9, bold, total[1])
+		y += 14
+	}
+
+	doc.Text(left, pdfPageHeight-40, 8, false, "This is a computer-generated invoice and does not require a signature.")
+
+	return doc.Bytes()
+}
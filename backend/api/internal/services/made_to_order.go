@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Made-to-order and pre-order products can be ordered with no stock on hand. Their
+// order lines hold no stock; instead each line gets a dispatch window from the
+// product's lead time, and artisans can cap how many such orders they have open.
+// Artisans mark the items as in production once they start work.
+
+var (
+	// ErrInvalidFulfillment is returned when a product's fulfillment settings do not fit together
+	ErrInvalidFulfillment = errors.New("invalid fulfillment settings")
+	// ErrMadeToOrderCapacity is returned when an artisan has no room for more made-to-order work
+	ErrMadeToOrderCapacity = errors.New("artisan is not taking more made-to-order work right now")
+	// ErrNothingToProduce is returned when an order has no paid made-to-order items awaiting production
+	ErrNothingToProduce = errors.New("order has no made-to-order items awaiting production")
+)
+
+// maxLeadTimeDays bounds lead times so dispatch estimates stay meaningful
+const maxLeadTimeDays = 365
+
+// openMadeToOrderStatuses are the order statuses that count against an artisan's capacity
+var openMadeToOrderStatuses = []models.OrderStatus{
+	models.OrderStatusPending,
+	models.OrderStatusConfirmed,
+	models.OrderStatusProcessing,
+}
+
+var craftingTimePattern = regexp.MustCompile(`(?i)(\d+)\s*(?:(?:-|–|to)\s*(\d+)\s*)?(day|week|month)`)
+
+// ParseLeadTime reads a lead time from free text such as "3-5 days" or "2 weeks"
+func ParseLeadTime(text string) *models.LeadTime {
+	match := craftingTimePattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil
+	}
+
+	min, _ := strconv.Atoi(match[1])
+	max := min
+	if match[2] != "" {
+		max, _ = strconv.Atoi(match[2])
+	}
+
+	unit := 1
+	switch strings.ToLower(match[3]) {
+	case "week":
+		unit = 7
+	case "month":
+		unit = 30
+	}
+	return &models.LeadTime{MinDays: min * unit, MaxDays: max * unit}
+}
+
+// NormalizeFulfillment validates a product's fulfillment mode and lead time. Products
+// made after ordering need a lead time, which is read from crafting_time when missing.
+func NormalizeFulfillment(product *models.Product) error {
+	if !product.Fulfillment.IsValid() {
+		return fmt.Errorf("%w: fulfillment must be in_stock, made_to_order or pre_order", ErrInvalidFulfillment)
+	}
+	if product.Fulfillment == "" {
+		product.Fulfillment = models.FulfillmentInStock
+	}
+	if product.Fulfillment != models.FulfillmentPreOrder {
+		product.ReleaseDate = nil
+	}
+	if !product.OrderableWithoutStock() {
+		return nil
+	}
+
+	if product.LeadTime == nil {
+		product.LeadTime = ParseLeadTime(product.CraftingTime)
+	}
+	if product.LeadTime == nil {
+		return fmt.Errorf("%w: %s products need a lead_time", ErrInvalidFulfillment, product.Fulfillment)
+	}
+	if product.LeadTime.MinDays < 0 || product.LeadTime.MaxDays < 1 ||
+		product.LeadTime.MinDays > product.LeadTime.MaxDays || product.LeadTime.MaxDays > maxLeadTimeDays {
+		return fmt.Errorf("%w: lead_time must be between 0 and %d days with min_days <= max_days", ErrInvalidFulfillment, maxLeadTimeDays)
+	}
+	return nil
+}
+
+// DispatchEstimate returns when an item ordered at orderedAt should be dispatched, or nil
+// for products sold from stock
+func DispatchEstimate(product *models.Product, orderedAt time.Time) *models.DispatchWindow {
+	if !product.OrderableWithoutStock() || product.LeadTime == nil {
+		return nil
+	}
+
+	start := orderedAt
+	if product.Fulfillment == models.FulfillmentPreOrder && product.ReleaseDate != nil && product.ReleaseDate.After(start) {
+		start = *product.ReleaseDate
+	}
+	return &models.DispatchWindow{
+		Earliest: start.AddDate(0, 0, product.LeadTime.MinDays),
+		Latest:   start.AddDate(0, 0, product.LeadTime.MaxDays),
+	}
+}
+
+// scheduleMadeToOrder marks the order's made-to-order lines, sets their dispatch windows
+// and the order's overall estimate, and records which artisans make items for it
+func scheduleMadeToOrder(order *models.Order, products map[string]*models.Product, now time.Time) {
+	order.EstimatedDispatch = nil
+	order.MadeToOrderArtisans = nil
+
+	for i, item := range order.Items {
+		product := products[item.ProductID]
+		order.Items[i].MadeToOrder = product.OrderableWithoutStock()
+		order.Items[i].Dispatch = nil
+		order.Items[i].ProductionStartedAt = nil
+		if !order.Items[i].MadeToOrder {
+			continue
+		}
+
+		if !containsString(order.MadeToOrderArtisans, product.ArtisanID) {
+			order.MadeToOrderArtisans = append(order.MadeToOrderArtisans, product.ArtisanID)
+		}
+
+		window := DispatchEstimate(product, now)
+		if window == nil {
+			continue
+		}
+		order.Items[i].Dispatch = window
+		if order.EstimatedDispatch == nil {
+			order.EstimatedDispatch = &models.DispatchWindow{Earliest: window.Earliest, Latest: window.Latest}
+			continue
+		}
+		if window.Earliest.After(order.EstimatedDispatch.Earliest) {
+			order.EstimatedDispatch.Earliest = window.Earliest
+		}
+		if window.Latest.After(order.EstimatedDispatch.Latest) {
+			order.EstimatedDispatch.Latest = window.Latest
+		}
+	}
+}
+
+// checkMadeToOrderCapacity counts the open made-to-order orders of each artisan on the
+// order that has a capacity limit, inside the checkout transaction
+func (fs *FirestoreService) checkMadeToOrderCapacity(tx *firestore.Transaction, order *models.Order, artisans map[string]*models.ArtisanProfile) error {
+	for _, artisanID := range order.MadeToOrderArtisans {
+		artisan := artisans[artisanID]
+		if artisan == nil || artisan.MadeToOrderCapacity <= 0 {
+			continue
+		}
+
+		docs, err := tx.Documents(fs.client.Collection(OrdersCollection).
+			Where("made_to_order_artisans", "array-contains", artisanID).
+			Where("status", "in", openMadeToOrderStatuses)).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(docs) >= artisan.MadeToOrderCapacity {
+			return ErrMadeToOrderCapacity
+		}
+	}
+	return nil
+}
+
+// StartProduction marks an artisan's made-to-order items on a paid order as in production,
+// moving a confirmed order to processing. An empty artisanID starts every item.
+func (fs *FirestoreService) StartProduction(orderID, artisanID string) (*models.Order, error) {
+	orderRef := fs.client.Collection(OrdersCollection).Doc(orderID)
+
+	var order *models.Order
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		if order, err = fs.getOrderForUpdate(tx, orderRef); err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusConfirmed && order.Status != models.OrderStatusProcessing {
+			return ErrNothingToProduce
+		}
+
+		now := time.Now()
+		started := 0
+		for i, item := range order.Items {
+			if !item.MadeToOrder || item.ProductionStartedAt != nil || (artisanID != "" && item.ArtisanID != artisanID) {
+				continue
+			}
+			order.Items[i].ProductionStartedAt = &now
+			started++
+		}
+		if started == 0 {
+			return ErrNothingToProduce
+		}
+
+		order.Status = models.OrderStatusProcessing
+		order.UpdatedAt = now
+		return tx.Update(orderRef, []firestore.Update{
+			{Path: "items", Value: order.Items},
+			{Path: "status", Value: order.Status},
+			{Path: "updated_at", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// MalwareScanner checks an upload before it is stored. Scan returns an error wrapping
+// ErrFileRejected when the file is infected, and any other error when it could not be
+// scanned; either way the upload is refused.
+type MalwareScanner interface {
+	Scan(ctx context.Context, data []byte, fileName string) error
+}
+
+const (
+	// clamdTimeout bounds a single scan, including the connection
+	clamdTimeout = 60 * time.Second
+	// clamdChunkSize is the size of each INSTREAM chunk
+	clamdChunkSize = 64 << 10
+)
+
+// ClamdScanner streams files to a ClamAV daemon
+type ClamdScanner struct {
+	network string
+	address string
+}
+
+// NewClamdScanner connects to clamd at host:port, or at a unix socket path
+func NewClamdScanner(address string) *ClamdScanner {
+	if strings.HasPrefix(address, "/") {
+		return &ClamdScanner{network: "unix", address: address}
+	}
+	return &ClamdScanner{network: "tcp", address: address}
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, data []byte, fileName string) error {
+	ctx, cancel := context.WithTimeout(ctx, clamdTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to clamd: %v", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// INSTREAM sends the file as length-prefixed chunks ending with an empty one
+	writer := bufio.NewWriter(conn)
+	writer.WriteString("zINSTREAM\x00")
+	var size [4]byte
+	for offset := 0; offset < len(data); offset += clamdChunkSize {
+		chunk := data[offset:min(offset+clamdChunkSize, len(data))]
+		binary.BigEndian.PutUint32(size[:], uint32(len(chunk)))
+		writer.Write(size[:])
+		writer.Write(chunk)
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	writer.Write(size[:])
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to send file to clamd: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return fmt.Errorf("failed to read clamd reply: %v", err)
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+
+	// Replies look like "stream: OK" or "stream: Eicar-Signature FOUND"
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return fmt.Errorf("%w: %s", ErrFileRejected, strings.TrimSuffix(result, " FOUND"))
+	}
+	return fmt.Errorf("clamd could not scan %s: %s", fileName, reply)
+}
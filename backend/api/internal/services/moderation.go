@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// ErrInvalidModerationTransition is returned when a decision does not apply to the product's current status
+var ErrInvalidModerationTransition = errors.New("product is not in a state that allows this moderation decision")
+
+// moderationSources lists the statuses each moderation decision may be applied to
+var moderationSources = map[models.ModerationAction][]models.ProductStatus{
+	models.ModerationActionApprove: {
+		models.ProductStatusPendingReview,
+	},
+	models.ModerationActionReject: {
+		models.ProductStatusPendingReview,
+		models.ProductStatusActive,
+		models.ProductStatusOutOfStock,
+	},
+	models.ModerationActionRequestChanges: {
+		models.ProductStatusPendingReview,
+		models.ProductStatusActive,
+		models.ProductStatusOutOfStock,
+	},
+}
+
+// ModerateProduct applies an admin decision to a product and records it in the audit trail.
+// The status change and the audit entry are written in a single transaction. published
+// reports whether an approval published the product for the first time; approvals of
+// later edits are not.
+func (fs *FirestoreService) ModerateProduct(productID, adminID string, action models.ModerationAction, reason string) (*models.Product, *models.ModerationLog, bool, error) {
+	sources, ok := moderationSources[action]
+	if !ok {
+		return nil, nil, false, fmt.Errorf("unknown moderation action: %s", action)
+	}
+
+	productRef := fs.client.Collection(ProductsCollection).Doc(productID)
+	logRef := fs.client.Collection(ModerationLogsCollection).NewDoc()
+
+	var product models.Product
+	var entry models.ModerationLog
+	published := false
+
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		published = false
+
+		doc, err := tx.Get(productRef)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&product); err != nil {
+			return err
+		}
+		product.ID = productID
+
+		allowed := false
+		for _, status := range sources {
+			if product.Status == status {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return ErrInvalidModerationTransition
+		}
+
+		toStatus := models.ProductStatusRejected
+		switch action {
+		case models.ModerationActionApprove:
+			toStatus = models.ProductStatusActive
+			if product.Stock <= 0 && !product.OrderableWithoutStock() {
+				toStatus = models.ProductStatusOutOfStock
+			}
+		case models.ModerationActionRequestChanges:
+			toStatus = models.ProductStatusChangesRequested
+		}
+
+		now := time.Now()
+		moderation := &models.ProductModeration{
+			Decision:   action,
+			Reason:     reason,
+			ReviewedBy: adminID,
+			ReviewedAt: now,
+		}
+
+		entry = models.ModerationLog{
+			ID:         logRef.ID,
+			ProductID:  productID,
+			ArtisanID:  product.ArtisanID,
+			AdminID:    adminID,
+			Action:     action,
+			FromStatus: product.Status,
+			ToStatus:   toStatus,
+			Reason:     reason,
+			CreatedAt:  now,
+		}
+
+		updates := []firestore.Update{
+			{Path: "status", Value: toStatus},
+			{Path: "moderation", Value: moderation},
+			{Path: "updated_at", Value: now},
+		}
+		if action == models.ModerationActionApprove && product.PublishedAt == nil {
+			published = true
+			product.PublishedAt = &now
+			updates = append(updates, firestore.Update{Path: "published_at", Value: now})
+		}
+		if err := tx.Update(productRef, updates); err != nil {
+			return err
+		}
+
+		product.Status = toStatus
+		product.Moderation = moderation
+		product.UpdatedAt = now
+
+		return tx.Create(logRef, entry)
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return &product, &entry, published, nil
+}
+
+// GetModerationLogs returns the moderation audit trail for a product, newest first
+func (fs *FirestoreService) GetModerationLogs(productID string) ([]models.ModerationLog, error) {
+	query := fs.client.Collection(ModerationLogsCollection).
+		Where("product_id", "==", productID).
+		OrderBy("created_at", firestore.Desc)
+
+	iter := query.Documents(fs.ctx)
+	defer iter.Stop()
+
+	var logs []models.ModerationLog
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var entry models.ModerationLog
+		if err := doc.DataTo(&entry); err != nil {
+			continue
+		}
+		entry.ID = doc.Ref.ID
+		logs = append(logs, entry)
+	}
+
+	return logs, nil
+}
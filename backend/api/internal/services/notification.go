@@ -197,9 +197,18 @@ func (n *NotificationService) SendOrderNotification(userToken, orderID, status s
 	case "confirmed":
 		title = "Order Confirmed"
 		body = fmt.Sprintf("Your order #%s has been confirmed and is being prepared.", orderID)
+	case "in_production":
+		title = "Being Handmade"
+		body = fmt.Sprintf("The artisan has started making the items in your order #%s.", orderID)
 	case "shipped":
 		title = "Order Shipped"
 		body = fmt.Sprintf("Your order #%s has been shipped and is on its way!", orderID)
+	case "out_for_delivery":
+		title = "Out for Delivery"
+		body = fmt.Sprintf("Your order #%s is out for delivery and should arrive today.", orderID)
+	case "exception":
+		title = "Delivery Delayed"
+		body = fmt.Sprintf("The carrier reported a problem delivering your order #%s. Check the tracking page for details.", orderID)
 	case "delivered":
 		title = "Order Delivered"
 		body = fmt.Sprintf("Your order #%s has been delivered. Thank you for shopping with us!", orderID)
@@ -256,6 +265,77 @@ func (n *NotificationService) SendArtisanNotification(userToken, artisanName, ac
 	return n.SendToToken(userToken, payload)
 }
 
+// SendRefundNotification tells a buyer about progress on a refund
+func (n *NotificationService) SendRefundNotification(userToken, orderID, refundID, status string, amount float64) error {
+	var title, body string
+
+	switch status {
+	case "requested":
+		title = "Refund Requested"
+		body = fmt.Sprintf("We've received your refund request of ₹%.2f for order #%s.", amount, orderID)
+	case "processing":
+		title = "Refund Approved"
+		body = fmt.Sprintf("Your refund of ₹%.2f for order #%s has been approved and is on its way.", amount, orderID)
+	case "rejected":
+		title = "Refund Declined"
+		body = fmt.Sprintf("Your refund request for order #%s was declined.", orderID)
+	case "completed":
+		title = "Refund Completed"
+		body = fmt.Sprintf("₹%.2f for order #%s has been refunded to your original payment method.", amount, orderID)
+	case "failed":
+		title = "Refund Delayed"
+		body = fmt.Sprintf("We couldn't process the refund for order #%s yet. Our team is looking into it.", orderID)
+	default:
+		title = "Refund Update"
+		body = fmt.Sprintf("Your refund for order #%s has been updated to: %s", orderID, status)
+	}
+
+	payload := NotificationPayload{
+		Title: title,
+		Body:  body,
+		Data: map[string]string{
+			"type":      "refund",
+			"order_id":  orderID,
+			"refund_id": refundID,
+			"status":    status,
+		},
+	}
+
+	return n.SendToToken(userToken, payload)
+}
+
+// SendModerationNotification tells an artisan about a moderation decision on their product
+func (n *NotificationService) SendModerationNotification(userToken, productID, productTitle, decision, reason string) error {
+	var title, body string
+
+	switch decision {
+	case "approved":
+		title = "Product Approved"
+		body = fmt.Sprintf("%s is now live on the marketplace!", productTitle)
+	case "rejected":
+		title = "Product Not Approved"
+		body = fmt.Sprintf("%s was not approved: %s", productTitle, reason)
+	case "changes_requested":
+		title = "Changes Requested"
+		body = fmt.Sprintf("Please update %s before it can go live: %s", productTitle, reason)
+	default:
+		title = "Product Review Update"
+		body = fmt.Sprintf("The review status of %s has changed.", productTitle)
+	}
+
+	payload := NotificationPayload{
+		Title: title,
+		Body:  body,
+		Data: map[string]string{
+			"type":       "moderation",
+			"product_id": productID,
+			"decision":   decision,
+		},
+	}
+
+	return n.SendToToken(userToken, payload)
+}
+
 // SendWelcomeNotification sends a welcome notification to new users
 func (n *NotificationService) SendWelcomeNotification(userToken, userName string) error {
 	payload := NotificationPayload{
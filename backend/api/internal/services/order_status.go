@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Payment capture confirms orders, shipments move them to shipped and delivered, and
+// completed refunds move them to refunded. Sellers and admins change the status by hand
+// only along orderTransitions, checked inside the transaction that writes it, so a
+// change cannot overwrite a shipment or cancellation made at the same time.
+
+var (
+	// ErrInvalidOrderTransition is returned when an order cannot move to a status from its current one
+	ErrInvalidOrderTransition = errors.New("order cannot move to that status from its current status")
+	// ErrNothingToCancel is returned when a seller has no unrefunded items on the order
+	ErrNothingToCancel = errors.New("no items on this order to cancel")
+)
+
+// orderTransitions lists the statuses an order can be moved to by hand from each
+// status. Shipping goes through the shipment endpoints, which check the same rule.
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusConfirmed:  {models.OrderStatusProcessing, models.OrderStatusCancelled},
+	models.OrderStatusProcessing: {models.OrderStatusCancelled},
+	models.OrderStatusShipped:    {models.OrderStatusDelivered},
+}
+
+// CanChangeOrderStatus reports whether an order can be moved from one status to another by hand
+func CanChangeOrderStatus(from, to models.OrderStatus) bool {
+	for _, status := range orderTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SetOrderStatus moves an order to status along orderTransitions. Setting the current
+// status again is a no-op; it reports whether anything changed. Cancellations go
+// through CancelPaidOrder, which also refunds the order.
+func (fs *FirestoreService) SetOrderStatus(orderID string, status models.OrderStatus) (*models.Order, bool, error) {
+	orderRef := fs.client.Collection(OrdersCollection).Doc(orderID)
+
+	var order *models.Order
+	changed := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = false
+
+		var err error
+		if order, err = fs.getOrderForUpdate(tx, orderRef); err != nil {
+			return err
+		}
+		if order.Status == status {
+			return nil
+		}
+		if status == models.OrderStatusCancelled || !CanChangeOrderStatus(order.Status, status) {
+			return ErrInvalidOrderTransition
+		}
+
+		now := time.Now()
+		updates := []firestore.Update{
+			{Path: "status", Value: status},
+			{Path: "updated_at", Value: now},
+		}
+		if status == models.OrderStatusDelivered && order.DeliveredAt == nil {
+			order.DeliveredAt = &now
+			updates = append(updates, firestore.Update{Path: "delivered_at", Value: now})
+		}
+
+		order.Status = status
+		order.UpdatedAt = now
+		changed = true
+		return tx.Update(orderRef, updates)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return order, changed, nil
+}
+
+// OrderCancellation describes who cancels a paid order
+type OrderCancellation struct {
+	BuyerID   string // set when the buyer cancels; they can only cancel before processing starts
+	ArtisanID string // set when a seller cancels only their own items
+	Reason    string
+}
+
+// CancelPaidOrder cancels a paid order, or a seller's items on it, and records the
+// refund request for what is cancelled in the same transaction, so a cancellation is
+// never left without its refund. The order is only cancelled as a whole when nothing
+// else is left on it. It reports whether the whole order was cancelled.
+func (fs *FirestoreService) CancelPaidOrder(orderID string, cancellation OrderCancellation) (*models.Order, *models.Refund, bool, error) {
+	orderRef := fs.client.Collection(OrdersCollection).Doc(orderID)
+	refundRef := fs.client.Collection(RefundsCollection).NewDoc()
+
+	var order *models.Order
+	var refund *models.Refund
+	whole := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		whole = false
+
+		var err error
+		if order, err = fs.getOrderForUpdate(tx, orderRef); err != nil {
+			return err
+		}
+
+		if cancellation.BuyerID != "" {
+			if order.BuyerID != cancellation.BuyerID || order.Status != models.OrderStatusConfirmed {
+				return ErrInvalidOrderTransition
+			}
+		} else if !CanChangeOrderStatus(order.Status, models.OrderStatusCancelled) {
+			return ErrInvalidOrderTransition
+		}
+		if order.PaymentStatus != models.PaymentStatusCaptured && order.PaymentStatus != models.PaymentStatusPartiallyRefunded {
+			return ErrRefundNotAllowed
+		}
+
+		// A seller cancels their own items; the whole order only if nothing else is left
+		var quantities map[string]int
+		if cancellation.ArtisanID != "" {
+			quantities = make(map[string]int)
+			others := false
+			for _, item := range order.Items {
+				remaining := item.Quantity - item.RefundedQuantity
+				if remaining <= 0 {
+					continue
+				}
+				if item.ArtisanID != cancellation.ArtisanID {
+					others = true
+					continue
+				}
+				quantities[models.LineKey(item.ProductID, item.VariantID)] += remaining
+			}
+			if len(quantities) == 0 {
+				return ErrNothingToCancel
+			}
+			if !others {
+				quantities = nil
+			}
+		}
+
+		if refund, err = newRefund(order, refundRef.ID, quantities, cancellation.Reason); err != nil {
+			return err
+		}
+		whole = refund.Full
+
+		updates := []firestore.Update{
+			{Path: "refund_status", Value: refund.Status},
+			{Path: "updated_at", Value: refund.CreatedAt},
+		}
+		if whole {
+			order.Status = models.OrderStatusCancelled
+			updates = append(updates, firestore.Update{Path: "status", Value: order.Status})
+		}
+		order.RefundStatus = refund.Status
+		order.UpdatedAt = refund.CreatedAt
+
+		if err := tx.Create(refundRef, refund); err != nil {
+			return err
+		}
+		return tx.Update(orderRef, updates)
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return order, refund, whole, nil
+}
+
+// CancelPaidOrder cancels a paid order, or a seller's items on it, and refunds what was
+// cancelled straight away, since the cancellation is the approval. If the refund cannot
+// be approved now it stays requested for an admin to approve. It returns the IDs of
+// products that came back into stock.
+func (s *PaymentService) CancelPaidOrder(orderID string, cancellation OrderCancellation) (*models.Order, *models.Refund, []string, error) {
+	order, refund, whole, err := s.firestoreService.CancelPaidOrder(orderID, cancellation)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if whole {
+		go s.firestoreService.RecordOrderStatusChange(string(models.OrderStatusCancelled))
+	}
+
+	approved, restocked, err := s.ApproveRefund(refund.ID, "system", "")
+	if err != nil {
+		log.Printf("Failed to approve refund %s for cancelled order %s: %v", refund.ID, orderID, err)
+		go s.notifyRefund(refund)
+		return order, refund, nil, nil
+	}
+	return order, approved, restocked, nil
+}
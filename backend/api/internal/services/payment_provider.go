@@ -0,0 +1,361 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Normalised webhook event types
+const (
+	PaymentEventCaptured        = "payment.captured"
+	PaymentEventFailed          = "payment.failed"
+	PaymentEventRefundProcessed = "refund.processed"
+	PaymentEventRefundFailed    = "refund.failed"
+)
+
+// Provider refund states
+const (
+	ProviderRefundPending   = "pending"
+	ProviderRefundProcessed = "processed"
+	ProviderRefundFailed    = "failed"
+)
+
+// ErrInvalidSignature is returned when a checkout callback or webhook signature does not match
+var ErrInvalidSignature = errors.New("invalid payment signature")
+
+// PaymentProvider creates payment orders with a payment gateway and authenticates
+// the callbacks and webhooks it sends back
+type PaymentProvider interface {
+	// Name identifies the provider on orders and webhook events
+	Name() string
+	// CreatePaymentOrder registers an amount to collect with the gateway
+	CreatePaymentOrder(ctx context.Context, request PaymentOrderRequest) (*PaymentOrder, error)
+	// VerifyPaymentSignature checks the signature the checkout returns to the client after payment
+	VerifyPaymentSignature(paymentOrderID, paymentID, signature string) bool
+	// ParseWebhook authenticates a webhook delivery and extracts the payment event
+	ParseWebhook(header http.Header, body []byte) (*PaymentWebhookEvent, error)
+	// CreateRefund returns part or all of a captured payment to the buyer
+	CreateRefund(ctx context.Context, request RefundRequest) (*ProviderRefund, error)
+}
+
+// RefundRequest describes an amount to return from a captured payment
+type RefundRequest struct {
+	PaymentID string
+	Amount    int64 // in minor units (paise)
+	Receipt   string
+	Notes     map[string]string
+}
+
+// ProviderRefund is the gateway's record of a refund
+type ProviderRefund struct {
+	ID     string
+	Status string // ProviderRefundPending, ProviderRefundProcessed or ProviderRefundFailed
+}
+
+// PaymentOrderRequest describes an amount to collect for a marketplace order
+type PaymentOrderRequest struct {
+	Receipt  string // marketplace order ID
+	Amount   int64  // in minor units (paise)
+	Currency string
+	Notes    map[string]string
+}
+
+// PaymentOrder is the gateway's record of an amount to collect, returned to the client for checkout
+type PaymentOrder struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"`
+	KeyID     string    `json:"key_id,omitempty"`
+	Amount    int64     `json:"amount"`
+	Currency  string    `json:"currency"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PaymentWebhookEvent is a verified webhook delivery reduced to what order processing needs
+type PaymentWebhookEvent struct {
+	ID             string
+	Type           string // PaymentEventCaptured, PaymentEventFailed or the provider's own event name
+	PaymentOrderID string
+	PaymentID      string
+	RefundID       string // set for refund events
+	RefundReceipt  string // for refund events, the marketplace refund ID sent as the receipt
+}
+
+func signHMAC(secret string, message []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyHMAC(secret string, message []byte, signature string) bool {
+	return secret != "" && hmac.Equal([]byte(signHMAC(secret, message)), []byte(signature))
+}
+
+// razorpayWebhook is the subset of a Razorpay webhook payload used for payment events
+type razorpayWebhook struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity struct {
+				ID      string `json:"id"`
+				OrderID string `json:"order_id"`
+				Status  string `json:"status"`
+			} `json:"entity"`
+		} `json:"payment"`
+		Order struct {
+			Entity struct {
+				ID string `json:"id"`
+			} `json:"entity"`
+		} `json:"order"`
+		Refund struct {
+			Entity struct {
+				ID        string          `json:"id"`
+				PaymentID string          `json:"payment_id"`
+				Receipt   string          `json:"receipt"`
+				Notes     json.RawMessage `json:"notes"` // an object, or an empty array when there are none
+			} `json:"entity"`
+		} `json:"refund"`
+	} `json:"payload"`
+}
+
+// parseRazorpayWebhook verifies a Razorpay-format webhook signed with secret
+func parseRazorpayWebhook(header http.Header, body []byte, secret string) (*PaymentWebhookEvent, error) {
+	if !verifyHMAC(secret, body, header.Get("X-Razorpay-Signature")) {
+		return nil, ErrInvalidSignature
+	}
+
+	var webhook razorpayWebhook
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook: %v", err)
+	}
+
+	payment := webhook.Payload.Payment.Entity
+	event := &PaymentWebhookEvent{
+		ID:             header.Get("X-Razorpay-Event-Id"),
+		Type:           webhook.Event,
+		PaymentOrderID: payment.OrderID,
+		PaymentID:      payment.ID,
+	}
+
+	// order.paid carries the same payment as payment.captured
+	if webhook.Event == "order.paid" {
+		event.Type = PaymentEventCaptured
+		if event.PaymentOrderID == "" {
+			event.PaymentOrderID = webhook.Payload.Order.Entity.ID
+		}
+	}
+
+	if refund := webhook.Payload.Refund.Entity; refund.ID != "" {
+		event.RefundID = refund.ID
+		if event.PaymentID == "" {
+			event.PaymentID = refund.PaymentID
+		}
+		event.RefundReceipt = refund.Receipt
+		if event.RefundReceipt == "" {
+			var notes map[string]string
+			if json.Unmarshal(refund.Notes, &notes) == nil {
+				event.RefundReceipt = notes["refund_id"]
+			}
+		}
+	}
+
+	// Fall back to a key derived from the payload when the delivery has no event ID
+	if event.ID == "" {
+		event.ID = webhook.Event + "_" + payment.ID + event.RefundID
+	}
+
+	return event, nil
+}
+
+// RazorpayProvider implements PaymentProvider against the Razorpay Orders API
+type RazorpayProvider struct {
+	keyID         string
+	keySecret     string
+	webhookSecret string
+	baseURL       string
+	httpClient    *http.Client
+}
+
+func NewRazorpayProvider(keyID, keySecret, webhookSecret string) *RazorpayProvider {
+	return &RazorpayProvider{
+		keyID:         keyID,
+		keySecret:     keySecret,
+		webhookSecret: webhookSecret,
+		baseURL:       "https://api.razorpay.com/v1",
+		httpClient:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (r *RazorpayProvider) Name() string {
+	return "razorpay"
+}
+
+// CreatePaymentOrder creates a Razorpay order for the amount
+func (r *RazorpayProvider) CreatePaymentOrder(ctx context.Context, request PaymentOrderRequest) (*PaymentOrder, error) {
+	var created struct {
+		ID       string `json:"id"`
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}
+
+	err := r.post(ctx, "/orders", map[string]interface{}{
+		"amount":   request.Amount,
+		"currency": request.Currency,
+		"receipt":  request.Receipt,
+		"notes":    request.Notes,
+	}, &created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment order: %v", err)
+	}
+
+	return &PaymentOrder{
+		ID:       created.ID,
+		Provider: r.Name(),
+		KeyID:    r.keyID,
+		Amount:   created.Amount,
+		Currency: created.Currency,
+	}, nil
+}
+
+// VerifyPaymentSignature checks the razorpay_signature returned by Checkout
+func (r *RazorpayProvider) VerifyPaymentSignature(paymentOrderID, paymentID, signature string) bool {
+	return verifyHMAC(r.keySecret, []byte(paymentOrderID+"|"+paymentID), signature)
+}
+
+// ParseWebhook verifies the X-Razorpay-Signature header and decodes the event
+func (r *RazorpayProvider) ParseWebhook(header http.Header, body []byte) (*PaymentWebhookEvent, error) {
+	return parseRazorpayWebhook(header, body, r.webhookSecret)
+}
+
+// CreateRefund refunds a captured Razorpay payment
+func (r *RazorpayProvider) CreateRefund(ctx context.Context, request RefundRequest) (*ProviderRefund, error) {
+	var created struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+
+	err := r.post(ctx, "/payments/"+request.PaymentID+"/refund", map[string]interface{}{
+		"amount":  request.Amount,
+		"receipt": request.Receipt,
+		"notes":   request.Notes,
+	}, &created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund: %v", err)
+	}
+
+	return &ProviderRefund{ID: created.ID, Status: created.Status}, nil
+}
+
+// post sends an authenticated JSON request to the Razorpay API and decodes the response into out
+func (r *RazorpayProvider) post(ctx context.Context, path string, payload interface{}, out interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.keyID, r.keySecret)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiError struct {
+			Error struct {
+				Description string `json:"description"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(body, &apiError)
+		return fmt.Errorf("request rejected (%d): %s", resp.StatusCode, apiError.Error.Description)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
+
+// FakePaymentProvider is an in-process provider for local development and tests. It
+// issues sequential payment order IDs and processes refunds immediately. Callbacks use
+// Razorpay's signature and webhook formats with a configured secret, so they can be
+// produced with SignPayment and SignWebhook.
+type FakePaymentProvider struct {
+	secret  string
+	mu      sync.Mutex
+	orders  int
+	refunds int
+}
+
+// NewFakePaymentProvider creates a fake provider signing with secret
+func NewFakePaymentProvider(secret string) *FakePaymentProvider {
+	return &FakePaymentProvider{secret: secret}
+}
+
+func (f *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+// CreatePaymentOrder issues a payment order without contacting any gateway
+func (f *FakePaymentProvider) CreatePaymentOrder(ctx context.Context, request PaymentOrderRequest) (*PaymentOrder, error) {
+	f.mu.Lock()
+	f.orders++
+	id := fmt.Sprintf("order_fake_%d_%d", time.Now().Unix(), f.orders)
+	f.mu.Unlock()
+
+	return &PaymentOrder{
+		ID:       id,
+		Provider: f.Name(),
+		KeyID:    "fake",
+		Amount:   request.Amount,
+		Currency: request.Currency,
+	}, nil
+}
+
+func (f *FakePaymentProvider) VerifyPaymentSignature(paymentOrderID, paymentID, signature string) bool {
+	return verifyHMAC(f.secret, []byte(paymentOrderID+"|"+paymentID), signature)
+}
+
+func (f *FakePaymentProvider) ParseWebhook(header http.Header, body []byte) (*PaymentWebhookEvent, error) {
+	return parseRazorpayWebhook(header, body, f.secret)
+}
+
+// CreateRefund reports the refund as processed straight away
+func (f *FakePaymentProvider) CreateRefund(ctx context.Context, request RefundRequest) (*ProviderRefund, error) {
+	f.mu.Lock()
+	f.refunds++
+	id := fmt.Sprintf("rfnd_fake_%d_%d", time.Now().Unix(), f.refunds)
+	f.mu.Unlock()
+
+	return &ProviderRefund{ID: id, Status: ProviderRefundProcessed}, nil
+}
+
+// SignPayment returns the checkout signature the fake provider accepts for a payment
+func (f *FakePaymentProvider) SignPayment(paymentOrderID, paymentID string) string {
+	return signHMAC(f.secret, []byte(paymentOrderID+"|"+paymentID))
+}
+
+// SignWebhook returns the X-Razorpay-Signature value the fake provider accepts for a webhook body
+func (f *FakePaymentProvider) SignWebhook(body []byte) string {
+	return signHMAC(f.secret, body)
+}
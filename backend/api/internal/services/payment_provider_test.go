@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"voicecraft-market/internal/models"
+)
+
+func TestFakeProviderVerifiesPaymentSignature(t *testing.T) {
+	provider := NewFakePaymentProvider("test-secret")
+	signature := provider.SignPayment("order_1", "pay_1")
+
+	tests := []struct {
+		name           string
+		paymentOrderID string
+		paymentID      string
+		signature      string
+		want           bool
+	}{
+		{"valid", "order_1", "pay_1", signature, true},
+		{"other payment", "order_1", "pay_2", signature, false},
+		{"other order", "order_2", "pay_1", signature, false},
+		{"signed with another secret", "order_1", "pay_1", NewFakePaymentProvider("other-secret").SignPayment("order_1", "pay_1"), false},
+		{"empty signature", "order_1", "pay_1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := provider.VerifyPaymentSignature(tt.paymentOrderID, tt.paymentID, tt.signature); got != tt.want {
+				t.Errorf("VerifyPaymentSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyHMACRejectsEmptySecret(t *testing.T) {
+	message := []byte("order_1|pay_1")
+	if verifyHMAC("", message, signHMAC("", message)) {
+		t.Error("verifyHMAC accepted a signature made without a secret")
+	}
+}
+
+func TestConfirmCheckoutRejectsInvalidSignature(t *testing.T) {
+	provider := NewFakePaymentProvider("test-secret")
+	service := &PaymentService{provider: provider}
+	order := &models.Order{ID: "o1", PaymentOrderID: "order_1"}
+
+	tests := []struct {
+		name           string
+		paymentOrderID string
+		signature      string
+	}{
+		{"tampered signature", "order_1", provider.SignPayment("order_1", "pay_2")},
+		{"another order's payment", "order_2", provider.SignPayment("order_2", "pay_1")},
+		{"missing signature", "order_1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.ConfirmCheckout(order, tt.paymentOrderID, "pay_1", tt.signature)
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("ConfirmCheckout() error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestParseWebhookChecksSignature(t *testing.T) {
+	provider := NewFakePaymentProvider("test-secret")
+	body := []byte(`{"event":"payment.captured","payload":{"payment":{"entity":{"id":"pay_1","order_id":"order_1","status":"captured"}}}}`)
+
+	header := http.Header{}
+	header.Set("X-Razorpay-Signature", provider.SignWebhook(body))
+	header.Set("X-Razorpay-Event-Id", "evt_1")
+	event, err := provider.ParseWebhook(header, body)
+	if err != nil {
+		t.Fatalf("ParseWebhook() error = %v", err)
+	}
+	if event.ID != "evt_1" || event.Type != PaymentEventCaptured || event.PaymentOrderID != "order_1" || event.PaymentID != "pay_1" {
+		t.Errorf("ParseWebhook() = %+v", event)
+	}
+
+	tampered := []byte(`{"event":"payment.captured","payload":{"payment":{"entity":{"id":"pay_2","order_id":"order_1","status":"captured"}}}}`)
+	if _, err := provider.ParseWebhook(header, tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ParseWebhook() with a changed body error = %v, want ErrInvalidSignature", err)
+	}
+
+	unsigned := http.Header{}
+	unsigned.Set("X-Razorpay-Event-Id", "evt_1")
+	if _, err := provider.ParseWebhook(unsigned, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ParseWebhook() without a signature error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestParseWebhookGivesRedeliveriesTheSameID(t *testing.T) {
+	provider := NewFakePaymentProvider("test-secret")
+	body := []byte(`{"event":"order.paid","payload":{"payment":{"entity":{"id":"pay_1","status":"captured"}},"order":{"entity":{"id":"order_1"}}}}`)
+	header := http.Header{}
+	header.Set("X-Razorpay-Signature", provider.SignWebhook(body))
+
+	// Without an event ID the key comes from the payload, so a redelivery matches
+	first, err := provider.ParseWebhook(header, body)
+	if err != nil {
+		t.Fatalf("ParseWebhook() error = %v", err)
+	}
+	second, err := provider.ParseWebhook(header, body)
+	if err != nil {
+		t.Fatalf("ParseWebhook() error = %v", err)
+	}
+	if first.ID == "" || first.ID != second.ID {
+		t.Errorf("redelivered event IDs %q and %q differ", first.ID, second.ID)
+	}
+	if first.Type != PaymentEventCaptured || first.PaymentOrderID != "order_1" {
+		t.Errorf("order.paid parsed as %+v", first)
+	}
+}
+
+func TestParseWebhookRefundReceipt(t *testing.T) {
+	provider := NewFakePaymentProvider("test-secret")
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"receipt", `{"event":"refund.processed","payload":{"refund":{"entity":{"id":"rfnd_1","payment_id":"pay_1","receipt":"r1","notes":[]}}}}`, "r1"},
+		{"notes", `{"event":"refund.processed","payload":{"refund":{"entity":{"id":"rfnd_1","payment_id":"pay_1","notes":{"refund_id":"r2"}}}}}`, "r2"},
+		{"no notes", `{"event":"refund.processed","payload":{"refund":{"entity":{"id":"rfnd_1","payment_id":"pay_1","notes":[]}}}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Razorpay-Signature", provider.SignWebhook([]byte(tt.body)))
+			event, err := provider.ParseWebhook(header, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("ParseWebhook() error = %v", err)
+			}
+			if event.RefundID != "rfnd_1" || event.PaymentID != "pay_1" || event.RefundReceipt != tt.want {
+				t.Errorf("ParseWebhook() = %+v, want receipt %q", event, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,840 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Orders are placed in two steps. CreateOrderWithReservation stores the order as
+// pending and reserves its stock; once the payment provider reports the payment as
+// captured, CaptureOrderPayment confirms the order and commits the reserved stock.
+// Orders that are not paid before their payment window closes are cancelled and
+// their reservations released.
+
+var (
+	// ErrProductUnavailable is returned when an ordered product is not live on the marketplace
+	ErrProductUnavailable = errors.New("product is not available")
+	// ErrInsufficientStock is returned when an ordered product does not have enough unreserved stock
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrPaymentNotPending is returned when an order is no longer awaiting payment
+	ErrPaymentNotPending = errors.New("order is not awaiting payment")
+)
+
+// orderQuantities totals the ordered quantity per product, keeping first-seen order
+func orderQuantities(items []models.OrderItem) ([]string, map[string]int) {
+	var productIDs []string
+	quantities := make(map[string]int)
+	for _, item := range items {
+		if _, seen := quantities[item.ProductID]; !seen {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+	return productIDs, quantities
+}
+
+// priceOrderItems sets each item's artisan, variant details and its price converted into
+// the order currency, returning the subtotal and the currencies the products are listed in
+func priceOrderItems(items []models.OrderItem, products map[string]*models.Product, rates *ExchangeRates, currency string) (float64, []string, error) {
+	var subtotal float64
+	var currencies []string
+	for i, item := range items {
+		product := products[item.ProductID]
+		variant, err := itemVariant(product, item)
+		if err != nil {
+			return 0, nil, err
+		}
+		items[i].SKU = product.SKU
+		items[i].VariantLabel = ""
+		if variant != nil {
+			items[i].SKU = variant.SKU
+			items[i].VariantLabel = variant.Label(product.Options)
+		}
+
+		listPrice := VariantPrice(product, item.VariantID)
+		price, err := rates.Convert(listPrice, currency)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		items[i].Price = FromMinorUnits(price.Amount, currency)
+		items[i].ListPrice = &listPrice
+		items[i].ArtisanID = product.ArtisanID
+		items[i].Total = roundAmount(items[i].Price * float64(item.Quantity))
+		items[i].Discount = 0
+		subtotal += items[i].Total
+		currencies = append(currencies, listPrice.Currency)
+	}
+	return subtotal, currencies, nil
+}
+
+// getOrderProducts reads the products of an order's items inside a transaction,
+// skipping products that have since been deleted
+func (fs *FirestoreService) getOrderProducts(tx *firestore.Transaction, items []models.OrderItem) (map[string]*models.Product, error) {
+	productIDs, _ := orderQuantities(items)
+	products := make(map[string]*models.Product, len(productIDs))
+	for _, productID := range productIDs {
+		doc, err := tx.Get(fs.client.Collection(ProductsCollection).Doc(productID))
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		var product models.Product
+		if err := doc.DataTo(&product); err != nil {
+			return nil, err
+		}
+		products[productID] = &product
+	}
+	return products, nil
+}
+
+// updateItemStock changes the stock and reservations of each item's product or variant by
+// the item quantity times stockSign and reservedSign, writing each product once. Made-to-order
+// items hold no stock and are skipped.
+func (fs *FirestoreService) updateItemStock(tx *firestore.Transaction, items []models.OrderItem, products map[string]*models.Product, stockSign, reservedSign int, now time.Time) error {
+	var changed []string
+	for _, item := range items {
+		product, ok := products[item.ProductID]
+		if !ok || item.MadeToOrder {
+			continue
+		}
+		if !containsString(changed, item.ProductID) {
+			changed = append(changed, item.ProductID)
+		}
+		adjustStock(product, item.VariantID, stockSign*item.Quantity, reservedSign*item.Quantity)
+	}
+
+	for _, productID := range changed {
+		if err := tx.Update(fs.client.Collection(ProductsCollection).Doc(productID), stockUpdates(products[productID], now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getOrderForUpdate reads an order inside a transaction
+func (fs *FirestoreService) getOrderForUpdate(tx *firestore.Transaction, orderRef *firestore.DocumentRef) (*models.Order, error) {
+	doc, err := tx.Get(orderRef)
+	if err != nil {
+		return nil, err
+	}
+
+	var order models.Order
+	if err := doc.DataTo(&order); err != nil {
+		return nil, err
+	}
+	order.ID = orderRef.ID
+	return &order, nil
+}
+
+// OrderPricing holds the calculators orders are priced with at checkout
+type OrderPricing struct {
+	Currency *CurrencyService
+	Shipping *ShippingCalculator
+	Tax      *TaxCalculator
+}
+
+// CreateOrderWithReservation prices the order, its shipping and GST from the current product
+// and artisan documents, reserves stock for every item and stores the order, all in one transaction.
+// Item prices are converted into the base currency at the current rates, which are kept on the order.
+func (fs *FirestoreService) CreateOrderWithReservation(order *models.Order, pricing *OrderPricing) error {
+	productIDs, _ := orderQuantities(order.Items)
+	orderRef := fs.client.Collection(OrdersCollection).NewDoc()
+
+	rates, err := pricing.Currency.Rates(fs.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load exchange rates: %v", err)
+	}
+	currency := pricing.Currency.Base()
+
+	return fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		products := make(map[string]*models.Product, len(productIDs))
+		for _, productID := range productIDs {
+			doc, err := tx.Get(fs.client.Collection(ProductsCollection).Doc(productID))
+			if err != nil {
+				if isNotFound(err) {
+					return fmt.Errorf("%w: %s", ErrProductUnavailable, productID)
+				}
+				return err
+			}
+
+			var product models.Product
+			if err := doc.DataTo(&product); err != nil {
+				return err
+			}
+			if product.Status != models.ProductStatusActive {
+				return fmt.Errorf("%w: %s", ErrProductUnavailable, product.Title)
+			}
+			products[productID] = &product
+		}
+		if err := checkItemStock(order.Items, products); err != nil {
+			return err
+		}
+
+		artisans := make(map[string]*models.ArtisanProfile)
+		for _, product := range products {
+			if _, seen := artisans[product.ArtisanID]; seen {
+				continue
+			}
+			artisans[product.ArtisanID] = nil
+
+			doc, err := tx.Get(fs.client.Collection(ArtisansCollection).Doc(product.ArtisanID))
+			if err != nil {
+				if isNotFound(err) {
+					continue
+				}
+				return err
+			}
+			var artisan models.ArtisanProfile
+			if err := doc.DataTo(&artisan); err != nil {
+				return err
+			}
+			artisans[product.ArtisanID] = &artisan
+		}
+
+		now := time.Now()
+		scheduleMadeToOrder(order, products, now)
+		if err := fs.checkMadeToOrderCapacity(tx, order, artisans); err != nil {
+			return err
+		}
+
+		var coupon *models.Coupon
+		var couponUses int
+		if order.CouponCode != "" {
+			var err error
+			if coupon, couponUses, err = fs.getCouponForRedemption(tx, order.CouponCode, order.BuyerID); err != nil {
+				return err
+			}
+		}
+
+		subtotal, currencies, err := priceOrderItems(order.Items, products, rates, currency)
+		if err != nil {
+			return err
+		}
+
+		var discountTotal float64
+		order.CouponID = ""
+		if coupon != nil {
+			if discountTotal, err = ApplyCoupon(coupon, couponUses, currency, order.Items, products, time.Now()); err != nil {
+				return err
+			}
+			order.CouponID = coupon.ID
+			order.CouponCode = coupon.Code
+		}
+
+		// Quoted after the coupon so the free-shipping threshold sees discounted totals
+		lines, _, err := pricing.Shipping.Quote(order.Items, products, artisans, order.ShippingAddress.PostalCode)
+		if err != nil {
+			return err
+		}
+		if coupon != nil {
+			WaiveCouponShipping(coupon, order.Items, products, lines)
+		}
+
+		var shippingTotal float64
+		for _, line := range lines {
+			shippingTotal += line.Amount
+		}
+		shippingTotal = roundAmount(shippingTotal)
+
+		taxLines, addedTax := pricing.Tax.Compute(order.Items, products, artisans, lines, order.ShippingAddress.State)
+		var taxTotal float64
+		for _, line := range taxLines {
+			taxTotal += line.CGST + line.SGST + line.IGST
+		}
+
+		order.ID = orderRef.ID
+		order.Subtotal = roundAmount(subtotal)
+		order.DiscountTotal = discountTotal
+		order.ShippingLines = lines
+		order.ShippingTotal = shippingTotal
+		order.TaxLines = taxLines
+		order.TaxTotal = roundAmount(taxTotal)
+		order.TotalAmount = roundAmount(subtotal - discountTotal + shippingTotal + addedTax)
+		order.Currency = currency
+		order.ExchangeRates = rates.Snapshot(append(currencies, order.DisplayCurrency)...)
+		order.DisplayTotal = nil
+		if order.DisplayCurrency != "" && order.DisplayCurrency != currency {
+			displayTotal, err := rates.Convert(models.Money{Amount: ToMinorUnits(order.TotalAmount, currency), Currency: currency}, order.DisplayCurrency)
+			if err != nil {
+				return err
+			}
+			order.DisplayTotal = &displayTotal
+		} else {
+			order.DisplayCurrency = ""
+		}
+		order.Status = models.OrderStatusPending
+		order.PaymentStatus = models.PaymentStatusPending
+		order.CreatedAt = now
+		order.UpdatedAt = now
+
+		if err := fs.updateItemStock(tx, order.Items, products, 0, 1, now); err != nil {
+			return err
+		}
+
+		if coupon != nil {
+			if err := fs.redeemCoupon(tx, coupon.ID, order.BuyerID, 1); err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(orderRef, order)
+	})
+}
+
+// CaptureOrderPayment confirms a paid order and turns its reservations into stock
+// decrements. Capturing an already captured order is a no-op; it reports whether
+// anything changed.
+func (fs *FirestoreService) CaptureOrderPayment(orderID, paymentID string) (*models.Order, bool, error) {
+	orderRef := fs.client.Collection(OrdersCollection).Doc(orderID)
+
+	var order *models.Order
+	changed := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = false
+
+		var err error
+		if order, err = fs.getOrderForUpdate(tx, orderRef); err != nil {
+			return err
+		}
+		if order.PaymentStatus == models.PaymentStatusCaptured {
+			return nil
+		}
+		if order.Status != models.OrderStatusPending ||
+			order.PaymentStatus == models.PaymentStatusExpired ||
+			order.PaymentStatus == models.PaymentStatusCancelled {
+			return ErrPaymentNotPending
+		}
+
+		products, err := fs.getOrderProducts(tx, order.Items)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := fs.updateItemStock(tx, order.Items, products, -1, -1, now); err != nil {
+			return err
+		}
+
+		order.Status = models.OrderStatusConfirmed
+		order.PaymentStatus = models.PaymentStatusCaptured
+		order.PaymentID = paymentID
+		order.PaidAt = &now
+		order.UpdatedAt = now
+		changed = true
+
+		return tx.Update(orderRef, []firestore.Update{
+			{Path: "status", Value: order.Status},
+			{Path: "payment_status", Value: order.PaymentStatus},
+			{Path: "payment_id", Value: paymentID},
+			{Path: "paid_at", Value: now},
+			{Path: "updated_at", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return order, changed, nil
+}
+
+// latePaymentRefundID is the refund for a payment captured after its order was
+// cancelled; one per payment, so webhook and checkout callbacks cannot refund twice
+func latePaymentRefundID(paymentID string) string {
+	return "late_" + paymentID
+}
+
+// CreateLatePaymentRefund records a refund of the whole payment for a payment that was
+// captured after its order had been cancelled, ready to send to the provider. The
+// reserved stock was already released, so nothing is restocked. An existing refund for
+// the payment is returned unchanged; it reports whether the refund was created.
+// Payments on orders that are not cancelled return ErrPaymentNotPending.
+func (fs *FirestoreService) CreateLatePaymentRefund(orderID, paymentID string) (*models.Refund, bool, error) {
+	orderRef := fs.client.Collection(OrdersCollection).Doc(orderID)
+	refundRef := fs.client.Collection(RefundsCollection).Doc(latePaymentRefundID(paymentID))
+
+	var refund *models.Refund
+	created := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		created = false
+
+		existing, err := fs.getRefundForUpdate(tx, refundRef)
+		if err == nil {
+			refund = existing
+			return nil
+		}
+		if !isNotFound(err) {
+			return err
+		}
+
+		order, err := fs.getOrderForUpdate(tx, orderRef)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusCancelled || order.PaymentStatus == models.PaymentStatusCaptured ||
+			order.PaymentStatus == models.PaymentStatusPartiallyRefunded || order.PaymentStatus == models.PaymentStatusRefunded {
+			return ErrPaymentNotPending
+		}
+
+		now := time.Now()
+		refund = &models.Refund{
+			ID:         refundRef.ID,
+			OrderID:    orderID,
+			BuyerID:    order.BuyerID,
+			ArtisanIDs: []string{},
+			Items:      []models.RefundItem{},
+			Amount:     roundAmount(order.TotalAmount),
+			Full:       true,
+			Reason:     "Payment received after the order was cancelled",
+			Status:     models.RefundStatusProcessing,
+			PaymentID:  paymentID,
+			ReviewedBy: "system",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			ReviewedAt: &now,
+		}
+		created = true
+
+		if err := tx.Create(refundRef, refund); err != nil {
+			return err
+		}
+		// The money is held until the refund completes and moves the order to refunded
+		return tx.Update(orderRef, []firestore.Update{
+			{Path: "payment_status", Value: models.PaymentStatusCaptured},
+			{Path: "payment_id", Value: paymentID},
+			{Path: "paid_at", Value: now},
+			{Path: "refund_status", Value: refund.Status},
+			{Path: "updated_at", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return refund, created, nil
+}
+
+// ReleaseOrderReservation cancels an unpaid order and returns its reserved stock.
+// Orders that are already paid or no longer pending are left untouched; it reports
+// whether the order was cancelled.
+func (fs *FirestoreService) ReleaseOrderReservation(orderID string, paymentStatus models.PaymentStatus) (*models.Order, bool, error) {
+	orderRef := fs.client.Collection(OrdersCollection).Doc(orderID)
+
+	var order *models.Order
+	changed := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = false
+
+		var err error
+		if order, err = fs.getOrderForUpdate(tx, orderRef); err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusPending || order.PaymentStatus == models.PaymentStatusCaptured {
+			return nil
+		}
+
+		products, err := fs.getOrderProducts(tx, order.Items)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := fs.updateItemStock(tx, order.Items, products, 0, -1, now); err != nil {
+			return err
+		}
+
+		// An unpaid order gives its coupon redemption back
+		if order.CouponID != "" {
+			if err := fs.redeemCoupon(tx, order.CouponID, order.BuyerID, -1); err != nil {
+				return err
+			}
+		}
+
+		order.Status = models.OrderStatusCancelled
+		order.PaymentStatus = paymentStatus
+		order.UpdatedAt = now
+		changed = true
+
+		return tx.Update(orderRef, []firestore.Update{
+			{Path: "status", Value: order.Status},
+			{Path: "payment_status", Value: paymentStatus},
+			{Path: "updated_at", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return order, changed, nil
+}
+
+// MarkPaymentFailed records a failed payment attempt. The order stays pending so the
+// buyer can retry until the payment window closes.
+func (fs *FirestoreService) MarkPaymentFailed(orderID, paymentID string) error {
+	orderRef := fs.client.Collection(OrdersCollection).Doc(orderID)
+
+	return fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		order, err := fs.getOrderForUpdate(tx, orderRef)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusPending || order.PaymentStatus != models.PaymentStatusPending {
+			return nil
+		}
+
+		return tx.Update(orderRef, []firestore.Update{
+			{Path: "payment_status", Value: models.PaymentStatusFailed},
+			{Path: "payment_id", Value: paymentID},
+			{Path: "updated_at", Value: time.Now()},
+		})
+	})
+}
+
+// GetOrderByPaymentOrderID finds the order a provider payment order was created for
+func (fs *FirestoreService) GetOrderByPaymentOrderID(paymentOrderID string) (*models.Order, error) {
+	iter := fs.client.Collection(OrdersCollection).
+		Where("payment_order_id", "==", paymentOrderID).
+		Limit(1).
+		Documents(fs.ctx)
+	defer iter.Stop()
+
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, fmt.Errorf("no order for payment order %s", paymentOrderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var order models.Order
+	if err := doc.DataTo(&order); err != nil {
+		return nil, err
+	}
+	order.ID = doc.Ref.ID
+	return &order, nil
+}
+
+// GetExpiredPaymentOrders lists pending orders whose payment window closed before the given time
+func (fs *FirestoreService) GetExpiredPaymentOrders(before time.Time, limit int) ([]models.Order, error) {
+	iter := fs.client.Collection(OrdersCollection).
+		Where("status", "==", models.OrderStatusPending).
+		Where("payment_expires_at", "<", before).
+		Limit(limit).
+		Documents(fs.ctx)
+	defer iter.Stop()
+
+	var orders []models.Order
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var order models.Order
+		if err := doc.DataTo(&order); err != nil {
+			continue
+		}
+		order.ID = doc.Ref.ID
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+func (fs *FirestoreService) paymentEventRef(provider, eventID string) *firestore.DocumentRef {
+	return fs.client.Collection(PaymentEventsCollection).Doc(provider + "_" + eventID)
+}
+
+// IsPaymentEventProcessed reports whether a webhook event has already been handled
+func (fs *FirestoreService) IsPaymentEventProcessed(provider, eventID string) (bool, error) {
+	_, err := fs.paymentEventRef(provider, eventID).Get(fs.ctx)
+	if err == nil {
+		return true, nil
+	}
+	if isNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// RecordPaymentEvent marks a webhook event as handled
+func (fs *FirestoreService) RecordPaymentEvent(event *models.PaymentEvent) error {
+	event.ProcessedAt = time.Now()
+	_, err := fs.paymentEventRef(event.Provider, event.ID).Set(fs.ctx, event)
+	return err
+}
+
+// PaymentService runs the payment step of checkout against a PaymentProvider
+type PaymentService struct {
+	firestoreService    *FirestoreService
+	notificationService *NotificationService
+	invoiceService      *InvoiceService
+	provider            PaymentProvider
+	expiry              time.Duration
+}
+
+func NewPaymentService(firestoreService *FirestoreService, notificationService *NotificationService, invoiceService *InvoiceService, provider PaymentProvider, expiry time.Duration) *PaymentService {
+	return &PaymentService{
+		firestoreService:    firestoreService,
+		notificationService: notificationService,
+		invoiceService:      invoiceService,
+		provider:            provider,
+		expiry:              expiry,
+	}
+}
+
+// Provider returns the configured payment provider
+func (s *PaymentService) Provider() PaymentProvider {
+	return s.provider
+}
+
+// StartPayment creates the provider payment order for a newly placed order and
+// opens its payment window
+func (s *PaymentService) StartPayment(ctx context.Context, order *models.Order) (*PaymentOrder, error) {
+	if order.Currency == "" {
+		order.Currency = "INR"
+	}
+
+	paymentOrder, err := s.provider.CreatePaymentOrder(ctx, PaymentOrderRequest{
+		Receipt:  order.ID,
+		Amount:   ToMinorUnits(order.TotalAmount, order.Currency),
+		Currency: order.Currency,
+		Notes: map[string]string{
+			"order_id": order.ID,
+			"buyer_id": order.BuyerID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.expiry)
+	paymentOrder.ExpiresAt = expiresAt
+
+	err = s.firestoreService.UpdateOrder(order.ID, map[string]interface{}{
+		"currency":           order.Currency,
+		"payment_provider":   paymentOrder.Provider,
+		"payment_order_id":   paymentOrder.ID,
+		"payment_expires_at": expiresAt,
+		"updated_at":         time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save payment order: %v", err)
+	}
+
+	order.PaymentProvider = paymentOrder.Provider
+	order.PaymentOrderID = paymentOrder.ID
+	order.PaymentExpires = &expiresAt
+
+	return paymentOrder, nil
+}
+
+// ConfirmCheckout verifies the signature the checkout returned to the buyer and captures
+// the payment. When the order was cancelled before the payment arrived, the payment is
+// refunded and the refund is returned with the order.
+func (s *PaymentService) ConfirmCheckout(order *models.Order, paymentOrderID, paymentID, signature string) (*models.Order, *models.Refund, error) {
+	if order.PaymentOrderID == "" || order.PaymentOrderID != paymentOrderID {
+		return nil, nil, ErrInvalidSignature
+	}
+	if !s.provider.VerifyPaymentSignature(paymentOrderID, paymentID, signature) {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	return s.capture(order.ID, paymentID)
+}
+
+// HandleWebhook verifies and applies a provider webhook. Redelivered events are ignored.
+func (s *PaymentService) HandleWebhook(header http.Header, body []byte) error {
+	event, err := s.provider.ParseWebhook(header, body)
+	if err != nil {
+		return err
+	}
+
+	processed, err := s.firestoreService.IsPaymentEventProcessed(s.provider.Name(), event.ID)
+	if err != nil {
+		return err
+	}
+	if processed {
+		return nil
+	}
+
+	record := &models.PaymentEvent{
+		ID:             event.ID,
+		Provider:       s.provider.Name(),
+		Type:           event.Type,
+		PaymentOrderID: event.PaymentOrderID,
+		PaymentID:      event.PaymentID,
+	}
+
+	if event.Type == PaymentEventRefundProcessed || event.Type == PaymentEventRefundFailed {
+		if err := s.handleRefundEvent(event); err != nil {
+			return err
+		}
+		return s.firestoreService.RecordPaymentEvent(record)
+	}
+
+	order, err := s.firestoreService.GetOrderByPaymentOrderID(event.PaymentOrderID)
+	if err != nil {
+		// Payments for orders this marketplace did not create are acknowledged and ignored
+		log.Printf("Ignoring %s webhook %s: %v", s.provider.Name(), event.ID, err)
+		return s.firestoreService.RecordPaymentEvent(record)
+	}
+	record.OrderID = order.ID
+
+	switch event.Type {
+	case PaymentEventCaptured:
+		if _, _, err := s.capture(order.ID, event.PaymentID); err != nil {
+			if !errors.Is(err, ErrPaymentNotPending) {
+				return err
+			}
+			log.Printf("Payment %s captured for order %s which is no longer awaiting payment", event.PaymentID, order.ID)
+		}
+	case PaymentEventFailed:
+		if err := s.firestoreService.MarkPaymentFailed(order.ID, event.PaymentID); err != nil {
+			return err
+		}
+	}
+
+	return s.firestoreService.RecordPaymentEvent(record)
+}
+
+// CancelUnpaidOrder cancels a pending order at the buyer's request and releases its reserved stock
+func (s *PaymentService) CancelUnpaidOrder(orderID string) (*models.Order, error) {
+	order, changed, err := s.firestoreService.ReleaseOrderReservation(orderID, models.PaymentStatusCancelled)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return nil, ErrPaymentNotPending
+	}
+
+	go s.firestoreService.RecordOrderStatusChange(string(models.OrderStatusCancelled))
+	return order, nil
+}
+
+// ExpirePayments cancels orders whose payment window has closed and releases their reserved stock
+func (s *PaymentService) ExpirePayments() (int, error) {
+	orders, err := s.firestoreService.GetExpiredPaymentOrders(time.Now(), 100)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load expired payments: %v", err)
+	}
+
+	expired := 0
+	for _, pending := range orders {
+		order, changed, err := s.firestoreService.ReleaseOrderReservation(pending.ID, models.PaymentStatusExpired)
+		if err != nil {
+			log.Printf("Failed to expire payment for order %s: %v", pending.ID, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		expired++
+		s.firestoreService.RecordOrderStatusChange(string(models.OrderStatusCancelled))
+		s.notifyBuyer(order)
+	}
+
+	return expired, nil
+}
+
+// RunExpirySweeper expires unpaid orders every interval until ctx is cancelled
+func (s *PaymentService) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if expired, err := s.ExpirePayments(); err != nil {
+				log.Printf("Payment expiry sweep failed: %v", err)
+			} else if expired > 0 {
+				log.Printf("Expired %d unpaid orders", expired)
+			}
+		}
+	}
+}
+
+// capture confirms a paid order and records the sale once. A payment that arrives
+// after the order was cancelled is refunded instead, and the refund is returned.
+func (s *PaymentService) capture(orderID, paymentID string) (*models.Order, *models.Refund, error) {
+	order, changed, err := s.firestoreService.CaptureOrderPayment(orderID, paymentID)
+	if errors.Is(err, ErrPaymentNotPending) {
+		return s.refundLatePayment(orderID, paymentID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if changed {
+		artisanByProduct := order.ArtisanByProduct()
+		go s.firestoreService.RecordOrderPlaced(order, artisanByProduct)
+		go s.firestoreService.RecordArtisanOrders(order, artisanByProduct)
+		go s.notifyBuyer(order)
+		go s.issueInvoices(order)
+	}
+
+	return order, nil, nil
+}
+
+// refundLatePayment returns a payment captured after its order was cancelled, so the
+// buyer is not charged for an order they will not receive
+func (s *PaymentService) refundLatePayment(orderID, paymentID string) (*models.Order, *models.Refund, error) {
+	refund, created, err := s.firestoreService.CreateLatePaymentRefund(orderID, paymentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if created {
+		log.Printf("Payment %s captured for cancelled order %s; refunding it as %s", paymentID, orderID, refund.ID)
+		go s.notifyRefund(refund)
+		refund = s.processRefund(refund)
+	}
+
+	order, err := s.firestoreService.GetOrder(orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, refund, nil
+}
+
+// issueInvoices issues the GST invoices for a newly paid order. Failures are logged;
+// missing invoices are issued when they are next requested.
+func (s *PaymentService) issueInvoices(order *models.Order) {
+	if s.invoiceService == nil {
+		return
+	}
+	if _, err := s.invoiceService.IssueInvoices(order); err != nil {
+		log.Printf("Failed to issue invoices for order %s: %v", order.ID, err)
+	}
+}
+
+// notifyBuyer tells the buyer about their order's current status. Failures are logged.
+func (s *PaymentService) notifyBuyer(order *models.Order) {
+	if s.notificationService == nil {
+		return
+	}
+
+	user, err := s.firestoreService.GetUser(order.BuyerID)
+	if err != nil || user.FCMToken == "" {
+		return
+	}
+
+	if err := s.notificationService.SendOrderNotification(user.FCMToken, order.ID, string(order.Status)); err != nil {
+		log.Printf("Failed to notify buyer about order %s: %v", order.ID, err)
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+)
+
+// newEmulatorFirestore connects to the Firestore emulator, skipping the test when none is running
+func newEmulatorFirestore(t *testing.T) *FirestoreService {
+	t.Helper()
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("set FIRESTORE_EMULATOR_HOST to run against the Firestore emulator")
+	}
+
+	fs, err := NewFirestoreService(context.Background(), "voicecraft-test")
+	if err != nil {
+		t.Fatalf("NewFirestoreService() error = %v", err)
+	}
+	t.Cleanup(func() { fs.Close() })
+	return fs
+}
+
+func TestHandleWebhookIgnoresRedeliveredEvents(t *testing.T) {
+	fs := newEmulatorFirestore(t)
+	provider := NewFakePaymentProvider("test-secret")
+	service := &PaymentService{firestoreService: fs, provider: provider}
+
+	suffix := time.Now().UnixNano()
+	orderID := fmt.Sprintf("order_%d", suffix)
+	paymentOrderID := fmt.Sprintf("order_fake_%d", suffix)
+	orderRef := fs.client.Collection(OrdersCollection).Doc(orderID)
+	if _, err := orderRef.Set(fs.ctx, &models.Order{
+		ID:             orderID,
+		Status:         models.OrderStatusPending,
+		PaymentStatus:  models.PaymentStatusPending,
+		PaymentOrderID: paymentOrderID,
+	}); err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	body := []byte(fmt.Sprintf(`{"event":"payment.failed","payload":{"payment":{"entity":{"id":"pay_%d","order_id":"%s","status":"failed"}}}}`, suffix, paymentOrderID))
+	header := http.Header{}
+	header.Set("X-Razorpay-Signature", provider.SignWebhook(body))
+	header.Set("X-Razorpay-Event-Id", fmt.Sprintf("evt_%d", suffix))
+
+	paymentStatus := func() models.PaymentStatus {
+		t.Helper()
+		order, err := fs.GetOrder(orderID)
+		if err != nil {
+			t.Fatalf("GetOrder() error = %v", err)
+		}
+		return order.PaymentStatus
+	}
+
+	if err := service.HandleWebhook(header, body); err != nil {
+		t.Fatalf("HandleWebhook() error = %v", err)
+	}
+	if got := paymentStatus(); got != models.PaymentStatusFailed {
+		t.Fatalf("payment status after the first delivery = %s, want %s", got, models.PaymentStatusFailed)
+	}
+
+	// Put the order back so a second application would be visible
+	if _, err := orderRef.Update(fs.ctx, []firestore.Update{{Path: "payment_status", Value: models.PaymentStatusPending}}); err != nil {
+		t.Fatalf("failed to reset order: %v", err)
+	}
+
+	if err := service.HandleWebhook(header, body); err != nil {
+		t.Fatalf("HandleWebhook() on redelivery error = %v", err)
+	}
+	if got := paymentStatus(); got != models.PaymentStatusPending {
+		t.Errorf("payment status after redelivery = %s, want the event to be ignored", got)
+	}
+}
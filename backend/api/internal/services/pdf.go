@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+)
+
+// pdfDocument writes simple text-and-rule PDFs. It uses the standard Helvetica
+// fonts that every PDF reader provides, so no fonts are embedded; Indian-script
+// text is transliterated and anything else outside the WinAnsi character set is
+// replaced.
+type pdfDocument struct {
+	pages   []*bytes.Buffer
+	current *bytes.Buffer
+}
+
+func newPDFDocument() *pdfDocument {
+	d := &pdfDocument{}
+	d.AddPage()
+	return d
+}
+
+// AddPage starts a new page; later drawing goes to it
+func (d *pdfDocument) AddPage() {
+	d.current = &bytes.Buffer{}
+	d.pages = append(d.pages, d.current)
+}
+
+// Text draws text with its baseline at y points from the top of the page
+func (d *pdfDocument) Text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.current, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, pdfPageHeight-y, pdfEscape(text))
+}
+
+// TextRight draws text ending at x
+func (d *pdfDocument) TextRight(x, y, size float64, bold bool, text string) {
+	d.Text(x-pdfTextWidth(text, size), y, size, bold, text)
+}
+
+// Line draws a thin rule between two points measured from the top of the page
+func (d *pdfDocument) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.current, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, pdfPageHeight-y1, x2, pdfPageHeight-y2)
+}
+
+// Bytes assembles the document
+func (d *pdfDocument) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are the catalog, page tree and fonts; each page then takes a
+	// page object followed by its content stream
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// pdfEscape encodes text as a WinAnsi PDF string body
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range transliterateIndic(text) {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '₹':
+			b.WriteString("Rs.")
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 0xA0 && r <= 0xFF:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case r == '\t':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfTextWidth approximates the width of Helvetica text, exactly for the digits and
+// punctuation used in amounts
+func pdfTextWidth(text string, size float64) float64 {
+	var units float64
+	for _, r := range transliterateIndic(text) {
+		switch {
+		case r >= '0' && r <= '9':
+			units += 556
+		case r == '.' || r == ',' || r == ' ':
+			units += 278
+		case r == '-':
+			units += 333
+		case r == '%':
+			units += 889
+		case r >= 'A' && r <= 'Z':
+			units += 667
+		default:
+			units += 556
+		}
+	}
+	return units * size / 1000
+}
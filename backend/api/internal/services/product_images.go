@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+)
+
+// A product's photos are kept in two aligned lists: images holds each photo's
+// full-size URL and image_records its renditions, in the same order. The first image
+// is the cover. Photos added before renditions existed only have a URL; they get a
+// record holding just that URL the first time the product's images change. Images
+// are referred to by their record ID or by URL.
+
+// MaxProductImages caps the photos on one product
+const MaxProductImages = 10
+
+var (
+	// ErrImageNotFound is returned when an image is not on the product
+	ErrImageNotFound = errors.New("image not found on this product")
+	// ErrTooManyImages is returned when adding images would pass MaxProductImages
+	ErrTooManyImages = fmt.Errorf("a product can have at most %d images", MaxProductImages)
+	// ErrInvalidImageOrder is returned when a new order does not list every image once
+	ErrInvalidImageOrder = errors.New("the new order must list every image exactly once")
+)
+
+// productImages pairs each image URL with its record, creating records for old images
+func productImages(product *models.Product) []models.ProductImage {
+	records := make(map[string]models.ProductImage, len(product.ImageRecords))
+	for _, record := range product.ImageRecords {
+		records[record.URL("full")] = record
+	}
+
+	images := make([]models.ProductImage, 0, len(product.Images))
+	seen := make(map[string]bool, len(product.Images))
+	for _, url := range product.Images {
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+
+		record, ok := records[url]
+		if !ok {
+			record = models.ProductImage{
+				ID:         uuid.New().String(),
+				Renditions: []models.ImageRendition{{Name: "full", URL: url}},
+			}
+		}
+		images = append(images, record)
+	}
+	return images
+}
+
+// imageIndex finds an image by record ID or by the URL of any of its renditions
+func imageIndex(images []models.ProductImage, ref string) int {
+	for i, image := range images {
+		if image.ID == ref {
+			return i
+		}
+		for _, rendition := range image.Renditions {
+			if rendition.URL == ref {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// updateProductImages edits a product's images in a transaction. change returns the
+// new list and the images it removed; removed images are also taken off variants.
+// With review set, a live product goes back for review in the same write.
+func (fs *FirestoreService) updateProductImages(productID string, review bool, change func(images []models.ProductImage) ([]models.ProductImage, []models.ProductImage, error)) (*models.Product, []models.ProductImage, error) {
+	ref := fs.client.Collection(ProductsCollection).Doc(productID)
+
+	var product models.Product
+	var removed []models.ProductImage
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		product = models.Product{}
+		if err := doc.DataTo(&product); err != nil {
+			return err
+		}
+		product.ID = productID
+
+		var images []models.ProductImage
+		if images, removed, err = change(productImages(&product)); err != nil {
+			return err
+		}
+		updates := setProductImages(&product, images, removed)
+		if review {
+			updates = append(updates, resubmitForReview(&product)...)
+		}
+		return tx.Update(ref, updates)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &product, removed, nil
+}
+
+// setProductImages stores a new image list on the product and returns the matching updates
+func setProductImages(product *models.Product, images, removed []models.ProductImage) []firestore.Update {
+	product.ImageRecords = images
+	product.Images = make([]string, len(images))
+	for i := range images {
+		product.Images[i] = images[i].URL("full")
+	}
+	product.UpdatedAt = time.Now()
+	updates := []firestore.Update{
+		{Path: "images", Value: product.Images},
+		{Path: "image_records", Value: product.ImageRecords},
+		{Path: "updated_at", Value: product.UpdatedAt},
+	}
+
+	if removeVariantImages(product, removed) {
+		updates = append(updates, firestore.Update{Path: "variants", Value: product.Variants})
+	}
+	return updates
+}
+
+// resubmitForReview sends a live product back to pending_review, since its approval
+// did not cover content added since. It returns the updates to write.
+func resubmitForReview(product *models.Product) []firestore.Update {
+	if !product.Status.IsPublic() {
+		return nil
+	}
+	product.Status = models.ProductStatusPendingReview
+	return []firestore.Update{{Path: "status", Value: product.Status}}
+}
+
+// removeVariantImages drops removed images from the product's variants
+func removeVariantImages(product *models.Product, removed []models.ProductImage) bool {
+	if len(removed) == 0 {
+		return false
+	}
+
+	changed := false
+	for i := range product.Variants {
+		kept := product.Variants[i].Images[:0]
+		for _, url := range product.Variants[i].Images {
+			if imageIndex(removed, url) >= 0 {
+				changed = true
+				continue
+			}
+			kept = append(kept, url)
+		}
+		product.Variants[i].Images = kept
+	}
+	return changed
+}
+
+// AddProductImages appends processed images to a product. Images added by anyone but
+// an admin send a live product back for review.
+func (fs *FirestoreService) AddProductImages(productID string, added []models.ProductImage, review bool) (*models.Product, error) {
+	product, _, err := fs.updateProductImages(productID, review, func(images []models.ProductImage) ([]models.ProductImage, []models.ProductImage, error) {
+		if len(images)+len(added) > MaxProductImages {
+			return nil, nil, ErrTooManyImages
+		}
+		return append(images, added...), nil, nil
+	})
+	return product, err
+}
+
+// ReorderProductImages puts a product's images in the given order; the first becomes the cover
+func (fs *FirestoreService) ReorderProductImages(productID string, order []string) (*models.Product, error) {
+	product, _, err := fs.updateProductImages(productID, false, func(images []models.ProductImage) ([]models.ProductImage, []models.ProductImage, error) {
+		if len(order) != len(images) {
+			return nil, nil, ErrInvalidImageOrder
+		}
+
+		reordered := make([]models.ProductImage, 0, len(images))
+		used := make([]bool, len(images))
+		for _, ref := range order {
+			i := imageIndex(images, ref)
+			if i < 0 {
+				return nil, nil, fmt.Errorf("%w: %s", ErrImageNotFound, ref)
+			}
+			if used[i] {
+				return nil, nil, ErrInvalidImageOrder
+			}
+			used[i] = true
+			reordered = append(reordered, images[i])
+		}
+		return reordered, nil, nil
+	})
+	return product, err
+}
+
+// SetCoverImage moves an image to the front of a product's images
+func (fs *FirestoreService) SetCoverImage(productID, imageRef string) (*models.Product, error) {
+	product, _, err := fs.updateProductImages(productID, false, func(images []models.ProductImage) ([]models.ProductImage, []models.ProductImage, error) {
+		i := imageIndex(images, imageRef)
+		if i < 0 {
+			return nil, nil, ErrImageNotFound
+		}
+
+		cover := images[i]
+		copy(images[1:i+1], images[:i])
+		images[0] = cover
+		return images, nil, nil
+	})
+	return product, err
+}
+
+// RemoveProductImage takes an image off a product and returns it so its files can be deleted
+func (fs *FirestoreService) RemoveProductImage(productID, imageRef string) (*models.Product, *models.ProductImage, error) {
+	product, removed, err := fs.updateProductImages(productID, false, func(images []models.ProductImage) ([]models.ProductImage, []models.ProductImage, error) {
+		i := imageIndex(images, imageRef)
+		if i < 0 {
+			return nil, nil, ErrImageNotFound
+		}
+
+		removed := images[i]
+		return append(images[:i], images[i+1:]...), []models.ProductImage{removed}, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return product, &removed[0], nil
+}
@@ -0,0 +1,489 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Prompts are text/template templates kept in a pluggable PromptTemplateSource. A
+// prompt can have templates for a category, a language or both, and every save adds a
+// new version, so generated content can record exactly which text it came from. When
+// the source has no template for a prompt, the built-in one (version 0) is used.
+
+// Prompt names
+const (
+	PromptProductListing = "product_listing"
+	PromptTranslation    = "translation"
+	PromptImage          = "image_prompt"
+)
+
+var (
+	// ErrInvalidPromptTemplate is returned for templates that cannot be saved or rendered
+	ErrInvalidPromptTemplate = errors.New("invalid prompt template")
+	// ErrPromptTemplateNotFound is returned when no template matches a lookup
+	ErrPromptTemplateNotFound = errors.New("prompt template not found")
+	// ErrPromptVersionConflict is returned when another save took the same version first
+	ErrPromptVersionConflict = errors.New("prompt template was changed at the same time; try again")
+	// ErrReadOnlyPrompts is returned when templates are saved on a source that cannot store them
+	ErrReadOnlyPrompts = errors.New("prompt templates come from a read-only source")
+)
+
+// promptSelector matches the category and language a template is written for
+var promptSelector = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// PromptData holds the variables templates can use, as {{.Transcript}} and so on.
+// Each prompt fills in the ones listed for it in PromptVariables.
+type PromptData struct {
+	Transcript   string `json:"transcript,omitempty"`
+	Language     string `json:"language,omitempty"` // language name, such as "Hindi"
+	ArtisanName  string `json:"artisan_name,omitempty"`
+	ArtisanCraft string `json:"artisan_craft,omitempty"`
+	Category     string `json:"category,omitempty"`
+	PhotoCount   int    `json:"photo_count,omitempty"`
+	Content      string `json:"content,omitempty"`
+	FromLanguage string `json:"from_language,omitempty"`
+	ToLanguage   string `json:"to_language,omitempty"`
+	ProductTitle string `json:"product_title,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// PromptVariables lists the PromptData fields each prompt fills in
+var PromptVariables = map[string][]string{
+	PromptProductListing: {"Transcript", "Language", "ArtisanName", "ArtisanCraft", "Category", "PhotoCount"},
+	PromptTranslation:    {"Content", "FromLanguage", "ToLanguage"},
+	PromptImage:          {"ProductTitle", "Description", "Category"},
+}
+
+// PromptTemplate is one version of a prompt's text
+type PromptTemplate struct {
+	Name      string    `json:"name" firestore:"name"`
+	Category  string    `json:"category,omitempty" firestore:"category"` // empty for every category
+	Language  string    `json:"language,omitempty" firestore:"language"` // empty for every language
+	Version   int       `json:"version" firestore:"version"`             // 0 for the built-in template
+	Text      string    `json:"text" firestore:"text"`
+	CreatedBy string    `json:"created_by,omitempty" firestore:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty" firestore:"created_at"`
+}
+
+// Key identifies the prompt, category and language a template is for, such as
+// "product_listing/pottery/*"
+func (t *PromptTemplate) Key() string {
+	category, language := t.Category, t.Language
+	if category == "" {
+		category = "*"
+	}
+	if language == "" {
+		language = "*"
+	}
+	return t.Name + "/" + category + "/" + language
+}
+
+// ID identifies this version of the template, such as "product_listing/pottery/*@3"
+func (t *PromptTemplate) ID() string {
+	return fmt.Sprintf("%s@%d", t.Key(), t.Version)
+}
+
+// Render fills in the template
+func (t *PromptTemplate) Render(data PromptData) (string, error) {
+	parsed, err := template.New(t.Key()).Option("missingkey=error").Parse(t.Text)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPromptTemplate, err)
+	}
+	var out strings.Builder
+	if err := parsed.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPromptTemplate, err)
+	}
+	return out.String(), nil
+}
+
+// validate checks the template names a known prompt and only uses known variables
+func (t *PromptTemplate) validate() error {
+	t.Category = strings.ToLower(strings.TrimSpace(t.Category))
+	t.Language = strings.ToLower(strings.TrimSpace(t.Language))
+
+	if _, ok := PromptVariables[t.Name]; !ok {
+		return fmt.Errorf("%w: unknown prompt %q", ErrInvalidPromptTemplate, t.Name)
+	}
+	if t.Category != "" && !promptSelector.MatchString(t.Category) {
+		return fmt.Errorf("%w: invalid category %q", ErrInvalidPromptTemplate, t.Category)
+	}
+	if t.Language != "" && !promptSelector.MatchString(t.Language) {
+		return fmt.Errorf("%w: invalid language %q", ErrInvalidPromptTemplate, t.Language)
+	}
+	if strings.TrimSpace(t.Text) == "" {
+		return fmt.Errorf("%w: text is required", ErrInvalidPromptTemplate)
+	}
+	// Rendering empty data catches syntax errors and unknown variables
+	_, err := t.Render(PromptData{})
+	return err
+}
+
+// PromptTemplateSource stores prompt templates
+type PromptTemplateSource interface {
+	// Name identifies the source
+	Name() string
+	// LoadTemplates returns every version of every stored template
+	LoadTemplates(ctx context.Context) ([]PromptTemplate, error)
+	// SaveTemplate stores a new version, or returns ErrReadOnlyPrompts
+	SaveTemplate(ctx context.Context, t *PromptTemplate) error
+}
+
+// FilePromptSource reads templates from a JSON array of PromptTemplate, for
+// deployments that ship prompts with the code
+type FilePromptSource struct {
+	path string
+}
+
+func NewFilePromptSource(path string) *FilePromptSource {
+	return &FilePromptSource{path: path}
+}
+
+func (f *FilePromptSource) Name() string {
+	return "file"
+}
+
+func (f *FilePromptSource) LoadTemplates(ctx context.Context) ([]PromptTemplate, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt templates: %v", err)
+	}
+
+	var templates []PromptTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("failed to parse prompt templates: %v", err)
+	}
+	for i := range templates {
+		if err := templates[i].validate(); err != nil {
+			return nil, fmt.Errorf("prompt template %d: %w", i, err)
+		}
+		if templates[i].Version < 1 {
+			return nil, fmt.Errorf("prompt template %s: version must be 1 or more", templates[i].Key())
+		}
+	}
+	return templates, nil
+}
+
+func (f *FilePromptSource) SaveTemplate(ctx context.Context, t *PromptTemplate) error {
+	return ErrReadOnlyPrompts
+}
+
+// FirestorePromptSource keeps admin-edited templates in Firestore, one document per version
+type FirestorePromptSource struct {
+	firestoreService *FirestoreService
+}
+
+func NewFirestorePromptSource(firestoreService *FirestoreService) *FirestorePromptSource {
+	return &FirestorePromptSource{firestoreService: firestoreService}
+}
+
+func (f *FirestorePromptSource) Name() string {
+	return "firestore"
+}
+
+func (f *FirestorePromptSource) LoadTemplates(ctx context.Context) ([]PromptTemplate, error) {
+	return f.firestoreService.GetPromptTemplates(ctx)
+}
+
+func (f *FirestorePromptSource) SaveTemplate(ctx context.Context, t *PromptTemplate) error {
+	return f.firestoreService.CreatePromptTemplate(ctx, t)
+}
+
+// GetPromptTemplates loads every stored prompt template version
+func (fs *FirestoreService) GetPromptTemplates(ctx context.Context) ([]PromptTemplate, error) {
+	docs, err := fs.client.Collection(PromptTemplatesCollection).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]PromptTemplate, 0, len(docs))
+	for _, doc := range docs {
+		var t PromptTemplate
+		if err := doc.DataTo(&t); err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// CreatePromptTemplate stores a new template version. The document ID is the version's
+// ID, so two saves of the same version cannot both succeed.
+func (fs *FirestoreService) CreatePromptTemplate(ctx context.Context, t *PromptTemplate) error {
+	docID := strings.ReplaceAll(t.ID(), "/", ":")
+	_, err := fs.client.Collection(PromptTemplatesCollection).Doc(docID).Create(ctx, t)
+	if err != nil && isAlreadyExists(err) {
+		return ErrPromptVersionConflict
+	}
+	return err
+}
+
+// PromptLibrary picks and renders prompt templates from a PromptTemplateSource,
+// caching them for a short time
+type PromptLibrary struct {
+	source   PromptTemplateSource
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	cached   []PromptTemplate
+	cachedAt time.Time
+}
+
+func NewPromptLibrary(source PromptTemplateSource, cacheTTL time.Duration) *PromptLibrary {
+	return &PromptLibrary{source: source, cacheTTL: cacheTTL}
+}
+
+// Source returns the configured template source
+func (l *PromptLibrary) Source() PromptTemplateSource {
+	return l.source
+}
+
+// Templates returns the built-in templates and every stored version, sorted by key and
+// version
+func (l *PromptLibrary) Templates(ctx context.Context) ([]PromptTemplate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cached != nil && time.Since(l.cachedAt) < l.cacheTTL {
+		return l.cached, nil
+	}
+
+	stored, err := l.source.LoadTemplates(ctx)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	templates := append(builtinPromptTemplates(), stored...)
+	sort.SliceStable(templates, func(i, j int) bool {
+		if templates[i].Key() != templates[j].Key() {
+			return templates[i].Key() < templates[j].Key()
+		}
+		return templates[i].Version < templates[j].Version
+	})
+
+	l.cached = templates
+	l.cachedAt = time.Now()
+	return templates, nil
+}
+
+// Select returns the latest version of the most specific template for a prompt: one
+// for both the category and the language, then the category, then the language, then
+// the prompt's general template
+func (l *PromptLibrary) Select(ctx context.Context, name, category, language string) (*PromptTemplate, error) {
+	templates, err := l.Templates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	category = strings.ToLower(category)
+	language = strings.ToLower(language)
+
+	var best *PromptTemplate
+	bestScore := -1
+	for i := range templates {
+		t := &templates[i]
+		if t.Name != name || (t.Category != "" && t.Category != category) || (t.Language != "" && t.Language != language) {
+			continue
+		}
+		score := 0
+		if t.Category != "" {
+			score += 2
+		}
+		if t.Language != "" {
+			score++
+		}
+		if score > bestScore || (score == bestScore && t.Version > best.Version) {
+			best, bestScore = t, score
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPromptTemplateNotFound, name)
+	}
+	copied := *best
+	return &copied, nil
+}
+
+// Version returns one version of the template for a prompt, category and language
+func (l *PromptLibrary) Version(ctx context.Context, name, category, language string, version int) (*PromptTemplate, error) {
+	templates, err := l.Templates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := (&PromptTemplate{Name: name, Category: strings.ToLower(category), Language: strings.ToLower(language)}).Key()
+
+	for _, t := range templates {
+		if t.Key() == key && t.Version == version {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s@%d", ErrPromptTemplateNotFound, key, version)
+}
+
+// Save validates a template and stores it as the next version for its prompt,
+// category and language
+func (l *PromptLibrary) Save(ctx context.Context, t *PromptTemplate) (*PromptTemplate, error) {
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+
+	templates, err := l.Templates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.Version = 1
+	for _, existing := range templates {
+		if existing.Key() == t.Key() && existing.Version >= t.Version {
+			t.Version = existing.Version + 1
+		}
+	}
+	t.CreatedAt = time.Now()
+
+	// Reload on next use so the new version is picked up at once, or so a retry after a
+	// conflict numbers its version from what another save stored
+	err = l.source.SaveTemplate(ctx, t)
+	l.mu.Lock()
+	l.cached = nil
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// builtinPromptTemplates are the templates used until the source has its own
+func builtinPromptTemplates() []PromptTemplate {
+	return []PromptTemplate{
+		{Name: PromptProductListing, Text: builtinProductListingPrompt},
+		{Name: PromptTranslation, Text: builtinTranslationPrompt},
+		{Name: PromptImage, Text: builtinImagePrompt},
+	}
+}
+
+const builtinProductListingPrompt = `You are an AI assistant helping Indian artisans create compelling product listings and social media content.
+
+Based on the following voice transcript from an artisan describing their handcrafted product, generate comprehensive content in JSON format:
+
+**Voice Transcript:** "{{.Transcript}}"
+**Language:** {{.Language}}
+**Artisan Name:** {{.ArtisanName}}
+**Artisan Craft:** {{.ArtisanCraft}}
+**Category:** {{.Category}}
+
+Generate a JSON response with the following structure:
+
+{
+  "product_title": "Catchy, SEO-friendly product title",
+  "description": "Detailed product description (200-300 words) highlighting craftsmanship, materials, and cultural significance",
+  "suggested_price": 1500.0,
+  "currency": "INR",
+  "artisan_story": {
+    "english": "Artisan's story in English (100-150 words)",
+    "hindi": "Artisan's story in Hindi (100-150 words)",
+    "hinglish": "Artisan's story in Hinglish (100-150 words)"
+  },
+  "seo_keywords": ["relevant", "SEO", "keywords"],
+  "hashtags": ["#handmade", "#indian", "#artisan", "#traditional"],
+  "social_media": {
+    "instagram_reels": [
+      {
+        "script": "30-second reel script showing the crafting process",
+        "captions": ["Caption option 1", "Caption option 2"],
+        "hashtags": ["#reelspecific", "#hashtags"],
+        "duration": 30,
+        "music_suggestion": "Traditional Indian music or trending audio"
+      }
+    ],
+    "instagram_posts": [
+      {
+        "caption": "Engaging Instagram post caption",
+        "hashtags": ["#post", "#hashtags"],
+        "image_prompt": "Description for AI image generation"
+      }
+    ],
+    "facebook_posts": [
+      {
+        "content": "Facebook post content",
+        "hashtags": ["#facebook", "#hashtags"]
+      }
+    ],
+    "twitter_posts": [
+      {
+        "content": "Concise Twitter post under 280 characters",
+        "hashtags": ["#twitter", "#hashtags"]
+      }
+    ]
+  },
+  "whatsapp_catalog": {
+    "title": "WhatsApp catalog title",
+    "description": "Brief catalog description",
+    "price": "₹1,500",
+    "currency": "INR"
+  },
+  "faq": [
+    {
+      "question": "Common customer question",
+      "answer": "Detailed answer"
+    }
+  ],
+  "materials": ["clay", "natural pigments", "traditional tools"],
+  "crafting_time": "2-3 days",
+  "tags": ["handcrafted", "eco-friendly", "traditional"]
+}
+
+**Important Guidelines:**
+1. Maintain cultural authenticity and respect for traditional crafts
+2. Price suggestions should be reasonable for Indian market (₹100-₹50,000 range)
+3. Include emotional storytelling that connects with customers
+4. Use trending and relevant hashtags for better reach
+5. Ensure all content is family-friendly and professional
+6. Include multilingual content to reach diverse audiences
+7. Focus on the uniqueness and handcrafted nature of the product
+8. Consider seasonal relevance and gifting potential
+
+Generate only valid JSON without any additional text or explanations.
+{{- if .PhotoCount}}
+
+**Product Photos:** {{.PhotoCount}} photo(s) of the product are attached after these instructions.
+Look at them before writing: base the title, description, materials and tags on what
+is visible as well as on the transcript. Then cross-check the transcript against the
+photos for colour, material and finish, size or dimension hints (compare with objects
+of known size), and the number of pieces. Add a "discrepancies" array to the JSON with
+one entry per disagreement:
+
+"discrepancies": [
+  {
+    "field": "colour",
+    "voice": "What the artisan said",
+    "photo": "What the photos show",
+    "severity": "high",
+    "suggestion": "What the artisan should check or correct"
+  }
+]
+
+Use "field" values colour, material, size, quantity or other, and "severity" high when
+a buyer would be misled, otherwise low. Do not report details the photos cannot show,
+such as weight or the crafting technique. Use an empty array when the photos agree.
+{{- end}}`
+
+const builtinTranslationPrompt = `Translate the following text from {{.FromLanguage}} to {{.ToLanguage}} while maintaining the tone and cultural context:
+
+"{{.Content}}"
+
+Provide only the translation without any additional text or explanations.`
+
+const builtinImagePrompt = `Based on this handcrafted product, generate a detailed image prompt for AI image generation:
+
+Product Title: {{.ProductTitle}}
+Description: {{.Description}}
+
+Create a prompt that would generate a high-quality, professional product photo suitable for e-commerce. Include details about lighting, background, angles, and styling.
+
+Provide only the image prompt without any additional text.`
@@ -0,0 +1,770 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// A refund is requested by the buyer, approved or rejected by the artisan (or an
+// admin), then sent to the payment provider. Approval restores stock for refunded
+// items that were never dispatched; goods already shipped stay with the buyer until
+// they are returned. The money side completes when the provider reports the refund
+// as processed, which may happen immediately or through a webhook.
+
+var (
+	// ErrRefundNotAllowed is returned when an order cannot be refunded
+	ErrRefundNotAllowed = errors.New("this order cannot be refunded")
+	// ErrRefundInProgress is returned when the order already has an open refund
+	ErrRefundInProgress = errors.New("a refund for this order is already in progress")
+	// ErrInvalidRefundItems is returned when requested quantities exceed what is left to refund
+	ErrInvalidRefundItems = errors.New("refund quantities exceed the refundable quantities")
+	// ErrInvalidRefundTransition is returned when a refund is not in a state that allows the action
+	ErrInvalidRefundTransition = errors.New("refund cannot be changed in its current state")
+	// ErrReturnNotExpected is returned when a refund's items were never dispatched or are already back in stock
+	ErrReturnNotExpected = errors.New("no return is expected for this refund")
+)
+
+// refundableStatuses are the order statuses in which a captured payment may be refunded
+var refundableStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusConfirmed:  true,
+	models.OrderStatusProcessing: true,
+	models.OrderStatusShipped:    true,
+	models.OrderStatusDelivered:  true,
+	models.OrderStatusCancelled:  true,
+}
+
+// undispatchedStatuses are the order statuses whose items are still with the seller, so
+// refunding them puts the units back into stock. Cancelled orders are never dispatched.
+var undispatchedStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusConfirmed:  true,
+	models.OrderStatusProcessing: true,
+	models.OrderStatusCancelled:  true,
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// getRefundForUpdate reads a refund inside a transaction
+func (fs *FirestoreService) getRefundForUpdate(tx *firestore.Transaction, refundRef *firestore.DocumentRef) (*models.Refund, error) {
+	doc, err := tx.Get(refundRef)
+	if err != nil {
+		return nil, err
+	}
+
+	var refund models.Refund
+	if err := doc.DataTo(&refund); err != nil {
+		return nil, err
+	}
+	refund.ID = refundRef.ID
+	return &refund, nil
+}
+
+// CreateRefundRequest records a buyer's refund request. quantities maps line keys (see
+// models.LineKey) to the units to refund; an empty map requests everything not yet refunded.
+func (fs *FirestoreService) CreateRefundRequest(orderID, buyerID string, quantities map[string]int, reason string) (*models.Refund, error) {
+	orderRef := fs.client.Collection(OrdersCollection).Doc(orderID)
+	refundRef := fs.client.Collection(RefundsCollection).NewDoc()
+
+	var refund *models.Refund
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		order, err := fs.getOrderForUpdate(tx, orderRef)
+		if err != nil {
+			return err
+		}
+
+		if order.BuyerID != buyerID || !refundableStatuses[order.Status] ||
+			(order.PaymentStatus != models.PaymentStatusCaptured && order.PaymentStatus != models.PaymentStatusPartiallyRefunded) {
+			return ErrRefundNotAllowed
+		}
+		if refund, err = newRefund(order, refundRef.ID, quantities, reason); err != nil {
+			return err
+		}
+
+		if err := tx.Create(refundRef, refund); err != nil {
+			return err
+		}
+		return tx.Update(orderRef, []firestore.Update{
+			{Path: "refund_status", Value: models.RefundStatusRequested},
+			{Path: "updated_at", Value: refund.UpdatedAt},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// newRefund works out a requested refund of quantities (see CreateRefundRequest) from
+// an order, without storing it
+func newRefund(order *models.Order, refundID string, quantities map[string]int, reason string) (*models.Refund, error) {
+	if order.RefundStatus.IsOpen() {
+		return nil, ErrRefundInProgress
+	}
+
+	var items []models.RefundItem
+	var amount float64
+	artisans := make(map[string]bool)
+	remainingAfter := 0
+	matched := 0
+
+	for _, item := range order.Items {
+		remaining := item.Quantity - item.RefundedQuantity
+		quantity := remaining
+		if len(quantities) > 0 {
+			requested, ok := quantities[models.LineKey(item.ProductID, item.VariantID)]
+			if !ok {
+				remainingAfter += remaining
+				continue
+			}
+			matched++
+			if requested < 1 || requested > remaining {
+				return nil, ErrInvalidRefundItems
+			}
+			quantity = requested
+		}
+		remainingAfter += remaining - quantity
+		if quantity == 0 {
+			continue
+		}
+
+		// Refund what was paid for the units, after any coupon discount on the line
+		itemAmount := roundAmount((item.Total - item.Discount) * float64(quantity) / float64(item.Quantity))
+		items = append(items, models.RefundItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			ArtisanID: item.ArtisanID,
+			Quantity:  quantity,
+			Amount:    itemAmount,
+		})
+		amount += itemAmount
+		if item.ArtisanID != "" {
+			artisans[item.ArtisanID] = true
+		}
+	}
+
+	if matched != len(quantities) || len(items) == 0 {
+		return nil, ErrInvalidRefundItems
+	}
+
+	// The last refund returns whatever is left of the payment, including any charges beyond item prices
+	full := remainingAfter == 0
+	if full {
+		amount = order.TotalAmount - order.RefundedAmount
+	}
+
+	artisanIDs := make([]string, 0, len(artisans))
+	for artisanID := range artisans {
+		artisanIDs = append(artisanIDs, artisanID)
+	}
+
+	now := time.Now()
+	return &models.Refund{
+		ID:         refundID,
+		OrderID:    order.ID,
+		BuyerID:    order.BuyerID,
+		ArtisanIDs: artisanIDs,
+		Items:      items,
+		Amount:     roundAmount(amount),
+		Full:       full,
+		Reason:     reason,
+		Status:     models.RefundStatusRequested,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}, nil
+}
+
+// ApproveRefund moves a requested refund to processing and marks its units as refunded
+// on the order. Units on orders that were not dispatched go back into stock; dispatched
+// units are restocked by ReceiveReturn once they come back. Approving a failed refund
+// retries it without restocking again. It returns the IDs of products
+// that came back into stock.
+func (fs *FirestoreService) ApproveRefund(refundID, reviewerID, note string) (*models.Refund, []string, error) {
+	refundRef := fs.client.Collection(RefundsCollection).Doc(refundID)
+
+	var refund *models.Refund
+	var restocked []string
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		restocked = nil
+
+		var err error
+		if refund, err = fs.getRefundForUpdate(tx, refundRef); err != nil {
+			return err
+		}
+		if refund.Status != models.RefundStatusRequested && refund.Status != models.RefundStatusFailed {
+			return ErrInvalidRefundTransition
+		}
+
+		orderRef := fs.client.Collection(OrdersCollection).Doc(refund.OrderID)
+		order, err := fs.getOrderForUpdate(tx, orderRef)
+		if err != nil {
+			return err
+		}
+
+		retry := refund.Status == models.RefundStatusFailed
+		restock := !retry && !refund.Restocked && undispatchedStatuses[order.Status]
+		var products map[string]*models.Product
+		if restock {
+			if products, err = fs.getRefundProducts(tx, refund); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		if !retry {
+			refunded := make(map[string]int, len(refund.Items))
+			for _, item := range refund.Items {
+				refunded[models.LineKey(item.ProductID, item.VariantID)] = item.Quantity
+			}
+
+			if restock {
+				if restocked, err = fs.restockRefund(tx, order, refund, products, now); err != nil {
+					return err
+				}
+				refund.Restocked = true
+			}
+
+			for i, item := range order.Items {
+				order.Items[i].RefundedQuantity += refunded[models.LineKey(item.ProductID, item.VariantID)]
+			}
+		}
+
+		refund.Status = models.RefundStatusProcessing
+		refund.ReviewedBy = reviewerID
+		refund.DecisionReason = note
+		refund.FailureReason = ""
+		refund.ReviewedAt = &now
+		refund.UpdatedAt = now
+
+		if err := tx.Update(orderRef, []firestore.Update{
+			{Path: "items", Value: order.Items},
+			{Path: "refund_status", Value: refund.Status},
+			{Path: "updated_at", Value: now},
+		}); err != nil {
+			return err
+		}
+		return tx.Update(refundRef, []firestore.Update{
+			{Path: "status", Value: refund.Status},
+			{Path: "reviewed_by", Value: reviewerID},
+			{Path: "decision_reason", Value: note},
+			{Path: "failure_reason", Value: ""},
+			{Path: "restocked", Value: refund.Restocked},
+			{Path: "reviewed_at", Value: now},
+			{Path: "updated_at", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return refund, restocked, nil
+}
+
+// getRefundProducts reads the products on a refund inside a transaction, skipping
+// products that have since been deleted
+func (fs *FirestoreService) getRefundProducts(tx *firestore.Transaction, refund *models.Refund) (map[string]*models.Product, error) {
+	products := make(map[string]*models.Product)
+	for _, item := range refund.Items {
+		if _, seen := products[item.ProductID]; seen {
+			continue
+		}
+		doc, err := tx.Get(fs.client.Collection(ProductsCollection).Doc(item.ProductID))
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		var product models.Product
+		if err := doc.DataTo(&product); err != nil {
+			return nil, err
+		}
+		products[item.ProductID] = &product
+	}
+	return products, nil
+}
+
+// restockRefund puts a refund's units back into stock and returns the IDs of products
+// that came back into stock. Made-to-order lines have no stock to return to.
+func (fs *FirestoreService) restockRefund(tx *firestore.Transaction, order *models.Order, refund *models.Refund, products map[string]*models.Product, now time.Time) ([]string, error) {
+	madeToOrder := make(map[string]bool, len(order.Items))
+	for _, item := range order.Items {
+		madeToOrder[models.LineKey(item.ProductID, item.VariantID)] = item.MadeToOrder
+	}
+	returned := make([]models.OrderItem, 0, len(refund.Items))
+	previousStock := make(map[string]int, len(products))
+	for _, item := range refund.Items {
+		key := models.LineKey(item.ProductID, item.VariantID)
+		returned = append(returned, models.OrderItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity, MadeToOrder: madeToOrder[key]})
+		if product, ok := products[item.ProductID]; ok {
+			previousStock[item.ProductID] = product.Stock
+		}
+	}
+
+	if err := fs.updateItemStock(tx, returned, products, 1, 0, now); err != nil {
+		return nil, err
+	}
+	var restocked []string
+	for productID, previous := range previousStock {
+		if previous <= 0 && products[productID].Stock > 0 {
+			restocked = append(restocked, productID)
+		}
+	}
+	return restocked, nil
+}
+
+// ReceiveReturn records that the buyer has sent back the items of a refund on a
+// dispatched order and puts them back into stock. Each refund's items are restocked
+// once. It returns the IDs of products that came back into stock.
+func (fs *FirestoreService) ReceiveReturn(refundID string) (*models.Refund, []string, error) {
+	refundRef := fs.client.Collection(RefundsCollection).Doc(refundID)
+
+	var refund *models.Refund
+	var restocked []string
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		if refund, err = fs.getRefundForUpdate(tx, refundRef); err != nil {
+			return err
+		}
+		if refund.Status == models.RefundStatusRejected {
+			return ErrInvalidRefundTransition
+		}
+		if refund.Restocked || refund.ReturnReceivedAt != nil {
+			return ErrReturnNotExpected
+		}
+
+		order, err := fs.getOrderForUpdate(tx, fs.client.Collection(OrdersCollection).Doc(refund.OrderID))
+		if err != nil {
+			return err
+		}
+		if undispatchedStatuses[order.Status] {
+			return ErrReturnNotExpected
+		}
+		products, err := fs.getRefundProducts(tx, refund)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if restocked, err = fs.restockRefund(tx, order, refund, products, now); err != nil {
+			return err
+		}
+
+		refund.Restocked = true
+		refund.ReturnReceivedAt = &now
+		refund.UpdatedAt = now
+		return tx.Update(refundRef, []firestore.Update{
+			{Path: "restocked", Value: true},
+			{Path: "return_received_at", Value: now},
+			{Path: "updated_at", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return refund, restocked, nil
+}
+
+// RejectRefund declines a requested refund
+func (fs *FirestoreService) RejectRefund(refundID, reviewerID, reason string) (*models.Refund, error) {
+	refundRef := fs.client.Collection(RefundsCollection).Doc(refundID)
+
+	var refund *models.Refund
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		if refund, err = fs.getRefundForUpdate(tx, refundRef); err != nil {
+			return err
+		}
+		if refund.Status != models.RefundStatusRequested {
+			return ErrInvalidRefundTransition
+		}
+
+		now := time.Now()
+		refund.Status = models.RefundStatusRejected
+		refund.ReviewedBy = reviewerID
+		refund.DecisionReason = reason
+		refund.ReviewedAt = &now
+		refund.UpdatedAt = now
+
+		if err := tx.Update(fs.client.Collection(OrdersCollection).Doc(refund.OrderID), []firestore.Update{
+			{Path: "refund_status", Value: refund.Status},
+			{Path: "updated_at", Value: now},
+		}); err != nil {
+			return err
+		}
+		return tx.Update(refundRef, []firestore.Update{
+			{Path: "status", Value: refund.Status},
+			{Path: "reviewed_by", Value: reviewerID},
+			{Path: "decision_reason", Value: reason},
+			{Path: "reviewed_at", Value: now},
+			{Path: "updated_at", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// SetRefundProviderID stores the payment provider's ID for a refund
+func (fs *FirestoreService) SetRefundProviderID(refundID, providerRefundID string) error {
+	return fs.UpdateDocument(RefundsCollection, refundID, map[string]interface{}{
+		"provider_refund_id": providerRefundID,
+		"updated_at":         time.Now(),
+	})
+}
+
+// CompleteRefund records the money as returned. Fully refunded orders move to the
+// refunded status. Completing a completed refund is a no-op; it reports whether
+// anything changed.
+func (fs *FirestoreService) CompleteRefund(refundID string) (*models.Refund, bool, error) {
+	refundRef := fs.client.Collection(RefundsCollection).Doc(refundID)
+
+	var refund *models.Refund
+	changed := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = false
+
+		var err error
+		if refund, err = fs.getRefundForUpdate(tx, refundRef); err != nil {
+			return err
+		}
+		if refund.Status == models.RefundStatusCompleted {
+			return nil
+		}
+		if refund.Status != models.RefundStatusProcessing && refund.Status != models.RefundStatusFailed {
+			return ErrInvalidRefundTransition
+		}
+
+		orderRef := fs.client.Collection(OrdersCollection).Doc(refund.OrderID)
+		order, err := fs.getOrderForUpdate(tx, orderRef)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		refundedAmount := roundAmount(order.RefundedAmount + refund.Amount)
+		orderUpdates := []firestore.Update{
+			{Path: "refunded_amount", Value: refundedAmount},
+			{Path: "refund_status", Value: models.RefundStatusCompleted},
+			{Path: "updated_at", Value: now},
+		}
+		if refund.Full {
+			orderUpdates = append(orderUpdates,
+				firestore.Update{Path: "status", Value: models.OrderStatusRefunded},
+				firestore.Update{Path: "payment_status", Value: models.PaymentStatusRefunded},
+			)
+		} else {
+			orderUpdates = append(orderUpdates, firestore.Update{Path: "payment_status", Value: models.PaymentStatusPartiallyRefunded})
+		}
+
+		refund.Status = models.RefundStatusCompleted
+		refund.FailureReason = ""
+		refund.CompletedAt = &now
+		refund.UpdatedAt = now
+		changed = true
+
+		if err := tx.Update(orderRef, orderUpdates); err != nil {
+			return err
+		}
+		return tx.Update(refundRef, []firestore.Update{
+			{Path: "status", Value: refund.Status},
+			{Path: "failure_reason", Value: ""},
+			{Path: "completed_at", Value: now},
+			{Path: "updated_at", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return refund, changed, nil
+}
+
+// FailRefund records that the payment provider could not process a refund. An admin
+// can retry it by approving it again. It reports whether anything changed.
+func (fs *FirestoreService) FailRefund(refundID, reason string) (*models.Refund, bool, error) {
+	refundRef := fs.client.Collection(RefundsCollection).Doc(refundID)
+
+	var refund *models.Refund
+	changed := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = false
+
+		var err error
+		if refund, err = fs.getRefundForUpdate(tx, refundRef); err != nil {
+			return err
+		}
+		if refund.Status != models.RefundStatusProcessing {
+			return nil
+		}
+
+		now := time.Now()
+		refund.Status = models.RefundStatusFailed
+		refund.FailureReason = reason
+		refund.UpdatedAt = now
+		changed = true
+
+		if err := tx.Update(fs.client.Collection(OrdersCollection).Doc(refund.OrderID), []firestore.Update{
+			{Path: "refund_status", Value: refund.Status},
+			{Path: "updated_at", Value: now},
+		}); err != nil {
+			return err
+		}
+		return tx.Update(refundRef, []firestore.Update{
+			{Path: "status", Value: refund.Status},
+			{Path: "failure_reason", Value: reason},
+			{Path: "updated_at", Value: now},
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return refund, changed, nil
+}
+
+// GetRefund retrieves a single refund
+func (fs *FirestoreService) GetRefund(refundID string) (*models.Refund, error) {
+	var refund models.Refund
+	err := fs.GetDocument(RefundsCollection, refundID, &refund)
+	if err != nil {
+		return nil, err
+	}
+	refund.ID = refundID
+	return &refund, nil
+}
+
+// getRefunds runs a refunds query and decodes the results
+func (fs *FirestoreService) getRefunds(query firestore.Query) ([]models.Refund, error) {
+	iter := query.Documents(fs.ctx)
+	defer iter.Stop()
+
+	refunds := []models.Refund{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var refund models.Refund
+		if err := doc.DataTo(&refund); err != nil {
+			continue
+		}
+		refund.ID = doc.Ref.ID
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, nil
+}
+
+// GetOrderRefunds lists an order's refunds, newest first
+func (fs *FirestoreService) GetOrderRefunds(orderID string) ([]models.Refund, error) {
+	return fs.getRefunds(fs.client.Collection(RefundsCollection).
+		Where("order_id", "==", orderID).
+		OrderBy("created_at", firestore.Desc))
+}
+
+// GetRefundByProviderID finds a refund by the payment provider's refund ID
+func (fs *FirestoreService) GetRefundByProviderID(providerRefundID string) (*models.Refund, error) {
+	refunds, err := fs.getRefunds(fs.client.Collection(RefundsCollection).
+		Where("provider_refund_id", "==", providerRefundID).
+		Limit(1))
+	if err != nil {
+		return nil, err
+	}
+	if len(refunds) == 0 {
+		return nil, fmt.Errorf("no refund with provider ID %s", providerRefundID)
+	}
+	return &refunds[0], nil
+}
+
+// GetRefunds lists refunds, newest first, optionally limited to one artisan's items and a status
+func (fs *FirestoreService) GetRefunds(artisanID, status string, limit, offset int) ([]models.Refund, error) {
+	query := fs.client.Collection(RefundsCollection).Query
+	if artisanID != "" {
+		query = query.Where("artisan_ids", "array-contains", artisanID)
+	}
+	if status != "" {
+		query = query.Where("status", "==", status)
+	}
+	query = query.OrderBy("created_at", firestore.Desc)
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	return fs.getRefunds(query)
+}
+
+// RequestRefund records a buyer's refund request and notifies them
+func (s *PaymentService) RequestRefund(orderID, buyerID string, quantities map[string]int, reason string) (*models.Refund, error) {
+	refund, err := s.firestoreService.CreateRefundRequest(orderID, buyerID, quantities, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.notifyRefund(refund)
+	return refund, nil
+}
+
+// ApproveRefund approves a refund and sends it to the payment provider. It returns
+// the IDs of products that came back into stock.
+func (s *PaymentService) ApproveRefund(refundID, reviewerID, note string) (*models.Refund, []string, error) {
+	refund, restocked, err := s.firestoreService.ApproveRefund(refundID, reviewerID, note)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	go s.notifyRefund(refund)
+	return s.processRefund(refund), restocked, nil
+}
+
+// RejectRefund declines a refund and tells the buyer why
+func (s *PaymentService) RejectRefund(refundID, reviewerID, reason string) (*models.Refund, error) {
+	refund, err := s.firestoreService.RejectRefund(refundID, reviewerID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.notifyRefund(refund)
+	return refund, nil
+}
+
+// processRefund sends an approved refund to the payment provider and records the outcome
+func (s *PaymentService) processRefund(refund *models.Refund) *models.Refund {
+	order, err := s.firestoreService.GetOrder(refund.OrderID)
+	if err != nil {
+		return s.failRefund(refund, fmt.Sprintf("order lookup failed: %v", err))
+	}
+
+	paymentID := order.PaymentID
+	if refund.PaymentID != "" {
+		paymentID = refund.PaymentID
+	}
+
+	providerRefund, err := s.provider.CreateRefund(context.Background(), RefundRequest{
+		PaymentID: paymentID,
+		Amount:    ToMinorUnits(refund.Amount, order.Currency),
+		Receipt:   refund.ID,
+		Notes: map[string]string{
+			"order_id":  refund.OrderID,
+			"refund_id": refund.ID,
+		},
+	})
+	if err != nil {
+		return s.failRefund(refund, err.Error())
+	}
+
+	if err := s.firestoreService.SetRefundProviderID(refund.ID, providerRefund.ID); err != nil {
+		log.Printf("Failed to save provider ID for refund %s: %v", refund.ID, err)
+	}
+	refund.ProviderRefundID = providerRefund.ID
+
+	switch providerRefund.Status {
+	case ProviderRefundProcessed:
+		return s.completeRefund(refund)
+	case ProviderRefundFailed:
+		return s.failRefund(refund, "refund declined by payment provider")
+	}
+	return refund
+}
+
+// handleRefundEvent applies a refund webhook from the payment provider. Refunds are
+// matched on the marketplace refund ID sent as their receipt, which is known before the
+// provider is called, so a webhook that arrives before CreateRefund has returned still
+// finds its refund.
+func (s *PaymentService) handleRefundEvent(event *PaymentWebhookEvent) error {
+	var refund *models.Refund
+	var err error
+	if event.RefundReceipt != "" {
+		refund, err = s.firestoreService.GetRefund(event.RefundReceipt)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		if err == nil && refund.ProviderRefundID == "" {
+			if err := s.firestoreService.SetRefundProviderID(refund.ID, event.RefundID); err != nil {
+				return err
+			}
+			refund.ProviderRefundID = event.RefundID
+		}
+	}
+	if refund == nil {
+		if refund, err = s.firestoreService.GetRefundByProviderID(event.RefundID); err != nil {
+			// Every marketplace refund carries its receipt, so this one was made elsewhere
+			log.Printf("Ignoring %s for unknown refund %s: %v", event.Type, event.RefundID, err)
+			return nil
+		}
+	}
+
+	if event.Type == PaymentEventRefundProcessed {
+		s.completeRefund(refund)
+	} else {
+		s.failRefund(refund, "refund failed at payment provider")
+	}
+	return nil
+}
+
+func (s *PaymentService) completeRefund(refund *models.Refund) *models.Refund {
+	completed, changed, err := s.firestoreService.CompleteRefund(refund.ID)
+	if err != nil {
+		log.Printf("Failed to complete refund %s: %v", refund.ID, err)
+		return refund
+	}
+
+	if changed {
+		go s.notifyRefund(completed)
+		if completed.Full {
+			go s.firestoreService.RecordOrderStatusChange(string(models.OrderStatusRefunded))
+		}
+	}
+	return completed
+}
+
+func (s *PaymentService) failRefund(refund *models.Refund, reason string) *models.Refund {
+	log.Printf("Refund %s failed: %s", refund.ID, reason)
+
+	failed, changed, err := s.firestoreService.FailRefund(refund.ID, reason)
+	if err != nil {
+		log.Printf("Failed to record refund failure for %s: %v", refund.ID, err)
+		return refund
+	}
+
+	if changed {
+		go s.notifyRefund(failed)
+	}
+	return failed
+}
+
+// notifyRefund tells the buyer about their refund's current status. Failures are logged.
+func (s *PaymentService) notifyRefund(refund *models.Refund) {
+	if s.notificationService == nil {
+		return
+	}
+
+	user, err := s.firestoreService.GetUser(refund.BuyerID)
+	if err != nil || user.FCMToken == "" {
+		return
+	}
+
+	if err := s.notificationService.SendRefundNotification(user.FCMToken, refund.OrderID, refund.ID, string(refund.Status), refund.Amount); err != nil {
+		log.Printf("Failed to notify buyer about refund %s: %v", refund.ID, err)
+	}
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	// ErrReviewNotAllowed is returned when the buyer has no delivered order containing the product
+	ErrReviewNotAllowed = errors.New("only buyers with a delivered order for this product can review it")
+	// ErrReviewExists is returned when the order item has already been reviewed
+	ErrReviewExists = errors.New("this order item has already been reviewed")
+	// ErrAlreadyVoted is returned when a user marks the same review helpful twice
+	ErrAlreadyVoted = errors.New("review already marked as helpful")
+)
+
+// ratingAggregate is the subset of product and artisan fields that hold review aggregates
+type ratingAggregate struct {
+	RatingSum   int `firestore:"rating_sum"`
+	ReviewCount int `firestore:"review_count"`
+}
+
+// adjustRating applies a change in rating sum and review count to a product or artisan
+// document inside a transaction. Missing documents are skipped.
+func adjustRating(tx *firestore.Transaction, doc *firestore.DocumentSnapshot, sumDelta, countDelta int) error {
+	if doc == nil || !doc.Exists() {
+		return nil
+	}
+
+	var current ratingAggregate
+	if err := doc.DataTo(&current); err != nil {
+		return err
+	}
+
+	sum := current.RatingSum + sumDelta
+	count := current.ReviewCount + countDelta
+	if count < 0 {
+		count = 0
+	}
+
+	rating := 0.0
+	if count > 0 {
+		rating = float64(sum) / float64(count)
+	}
+
+	return tx.Update(doc.Ref, []firestore.Update{
+		{Path: "rating", Value: rating},
+		{Path: "review_count", Value: count},
+		{Path: "rating_sum", Value: sum},
+	})
+}
+
+// getRatingTargets reads the product and artisan documents whose aggregates a review affects
+func (fs *FirestoreService) getRatingTargets(tx *firestore.Transaction, productID, artisanID string) (*firestore.DocumentSnapshot, *firestore.DocumentSnapshot, error) {
+	productDoc, err := tx.Get(fs.client.Collection(ProductsCollection).Doc(productID))
+	if err != nil && !isNotFound(err) {
+		return nil, nil, err
+	}
+
+	artisanDoc, err := tx.Get(fs.client.Collection(ArtisansCollection).Doc(artisanID))
+	if err != nil && !isNotFound(err) {
+		return nil, nil, err
+	}
+
+	return productDoc, artisanDoc, nil
+}
+
+// CreateReview stores a verified-purchase review and updates the product and artisan
+// rating aggregates in the same transaction. One review is allowed per order item.
+func (fs *FirestoreService) CreateReview(review *models.Review) error {
+	orderRef := fs.client.Collection(OrdersCollection).Doc(review.OrderID)
+	reviewRef := fs.client.Collection(ReviewsCollection).Doc(review.OrderID + "_" + review.ProductID)
+
+	return fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		orderDoc, err := tx.Get(orderRef)
+		if err != nil {
+			if isNotFound(err) {
+				return ErrReviewNotAllowed
+			}
+			return err
+		}
+
+		var order models.Order
+		if err := orderDoc.DataTo(&order); err != nil {
+			return err
+		}
+
+		if order.BuyerID != review.BuyerID || order.Status != models.OrderStatusDelivered {
+			return ErrReviewNotAllowed
+		}
+
+		inOrder := false
+		for _, item := range order.Items {
+			if item.ProductID == review.ProductID {
+				inOrder = true
+				break
+			}
+		}
+		if !inOrder {
+			return ErrReviewNotAllowed
+		}
+
+		if _, err := tx.Get(reviewRef); err == nil {
+			return ErrReviewExists
+		} else if !isNotFound(err) {
+			return err
+		}
+
+		productDoc, artisanDoc, err := fs.getRatingTargets(tx, review.ProductID, review.ArtisanID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		review.ID = reviewRef.ID
+		review.Verified = true
+		review.Helpful = 0
+		review.CreatedAt = now
+		review.UpdatedAt = now
+
+		if err := tx.Create(reviewRef, review); err != nil {
+			return err
+		}
+		if err := adjustRating(tx, productDoc, review.Rating, 1); err != nil {
+			return err
+		}
+		return adjustRating(tx, artisanDoc, review.Rating, 1)
+	})
+}
+
+// GetReview retrieves a single review
+func (fs *FirestoreService) GetReview(reviewID string) (*models.Review, error) {
+	var review models.Review
+	err := fs.GetDocument(ReviewsCollection, reviewID, &review)
+	if err != nil {
+		return nil, err
+	}
+	review.ID = reviewID
+	return &review, nil
+}
+
+// UpdateReview changes a review's content and moves the rating aggregates by the
+// difference between the old and new rating
+func (fs *FirestoreService) UpdateReview(reviewID string, rating int, title, comment string) (*models.Review, error) {
+	reviewRef := fs.client.Collection(ReviewsCollection).Doc(reviewID)
+
+	var review models.Review
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(reviewRef)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&review); err != nil {
+			return err
+		}
+		review.ID = reviewID
+
+		productDoc, artisanDoc, err := fs.getRatingTargets(tx, review.ProductID, review.ArtisanID)
+		if err != nil {
+			return err
+		}
+
+		delta := rating - review.Rating
+		review.Rating = rating
+		review.Title = title
+		review.Comment = comment
+		review.UpdatedAt = time.Now()
+
+		if err := tx.Update(reviewRef, []firestore.Update{
+			{Path: "rating", Value: review.Rating},
+			{Path: "title", Value: review.Title},
+			{Path: "comment", Value: review.Comment},
+			{Path: "updated_at", Value: review.UpdatedAt},
+		}); err != nil {
+			return err
+		}
+		if delta == 0 {
+			return nil
+		}
+		if err := adjustRating(tx, productDoc, delta, 0); err != nil {
+			return err
+		}
+		return adjustRating(tx, artisanDoc, delta, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// DeleteReview removes a review and its contribution to the rating aggregates
+func (fs *FirestoreService) DeleteReview(reviewID string) (*models.Review, error) {
+	reviewRef := fs.client.Collection(ReviewsCollection).Doc(reviewID)
+
+	var review models.Review
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(reviewRef)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&review); err != nil {
+			return err
+		}
+		review.ID = reviewID
+
+		productDoc, artisanDoc, err := fs.getRatingTargets(tx, review.ProductID, review.ArtisanID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(reviewRef); err != nil {
+			return err
+		}
+		if err := adjustRating(tx, productDoc, -review.Rating, -1); err != nil {
+			return err
+		}
+		return adjustRating(tx, artisanDoc, -review.Rating, -1)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// MarkReviewHelpful counts a helpful vote, at most once per user
+func (fs *FirestoreService) MarkReviewHelpful(reviewID, userID string) error {
+	reviewRef := fs.client.Collection(ReviewsCollection).Doc(reviewID)
+	voteRef := fs.client.Collection(ReviewVotesCollection).Doc(reviewID + "_" + userID)
+
+	return fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(reviewRef); err != nil {
+			return err
+		}
+
+		if _, err := tx.Get(voteRef); err == nil {
+			return ErrAlreadyVoted
+		} else if !isNotFound(err) {
+			return err
+		}
+
+		if err := tx.Create(voteRef, models.ReviewVote{
+			ReviewID:  reviewID,
+			UserID:    userID,
+			CreatedAt: time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		return tx.Update(reviewRef, []firestore.Update{
+			{Path: "helpful", Value: firestore.Increment(1)},
+		})
+	})
+}
+
+// SetReviewReply adds or replaces the artisan's reply to a review
+func (fs *FirestoreService) SetReviewReply(review *models.Review, comment string) error {
+	now := time.Now()
+	reply := &models.ReviewReply{
+		Comment:   comment,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if review.Reply != nil {
+		reply.CreatedAt = review.Reply.CreatedAt
+	}
+
+	_, err := fs.client.Collection(ReviewsCollection).Doc(review.ID).Update(fs.ctx, []firestore.Update{
+		{Path: "reply", Value: reply},
+	})
+	if err != nil {
+		return err
+	}
+
+	review.Reply = reply
+	return nil
+}
+
+// GetProductReviews lists a product's reviews sorted by "helpful" or "created_at" (newest first)
+func (fs *FirestoreService) GetProductReviews(productID, sortBy string, limit, offset int) ([]models.Review, int, error) {
+	if sortBy != "helpful" {
+		sortBy = "created_at"
+	}
+
+	query := fs.client.Collection(ReviewsCollection).
+		Where("product_id", "==", productID).
+		OrderBy(sortBy, firestore.Desc)
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	iter := query.Documents(fs.ctx)
+	defer iter.Stop()
+
+	reviews := []models.Review{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var review models.Review
+		if err := doc.DataTo(&review); err != nil {
+			continue
+		}
+		review.ID = doc.Ref.ID
+		reviews = append(reviews, review)
+	}
+
+	// The product document keeps the review count, so no second query is needed
+	total := len(reviews)
+	if product, err := fs.GetProduct(productID); err == nil {
+		total = product.ReviewCount
+	}
+
+	return reviews, total, nil
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"voicecraft-market/internal/models"
+)
+
+// Shipping is charged per artisan, since each artisan sends their items as one
+// parcel. A parcel is billed on the greater of its actual and volumetric weight,
+// at the rate for the zone between the artisan's PIN code and the buyer's.
+
+// ErrInvalidPostalCode is returned when a shipping address does not have a valid Indian PIN code
+var ErrInvalidPostalCode = errors.New("shipping address needs a valid 6-digit PIN code")
+
+// Shipping zones, from nearest to farthest
+const (
+	ShippingZoneLocal    = "local"    // same sorting district (first three digits)
+	ShippingZoneRegional = "regional" // same postal circle (first two digits)
+	ShippingZoneZonal    = "zonal"    // same postal zone (first digit)
+	ShippingZoneNational = "national" // anywhere else
+	ShippingZoneSpecial  = "special"  // remote destinations such as the North East, J&K and the islands
+)
+
+var pincodePattern = regexp.MustCompile(`\b[1-9][0-9]{5}\b`)
+
+// ZoneRate prices a parcel as a base charge covering BaseWeight, plus
+// AdditionalCharge for each further AdditionalWeight slab or part of one
+type ZoneRate struct {
+	BaseWeight       float64 `json:"base_weight"` // kg
+	BaseCharge       float64 `json:"base_charge"`
+	AdditionalWeight float64 `json:"additional_weight"` // kg
+	AdditionalCharge float64 `json:"additional_charge"`
+}
+
+// ShippingRateCard holds the shipping configuration, usually loaded from SHIPPING_RATES_FILE
+type ShippingRateCard struct {
+	Currency string `json:"currency"`
+	// VolumetricDivisor converts cubic centimetres to volumetric kilograms
+	VolumetricDivisor float64 `json:"volumetric_divisor"`
+	// DefaultItemWeight is used for products without a weight, in kg
+	DefaultItemWeight float64 `json:"default_item_weight"`
+	// FreeShippingThreshold waives shipping on an artisan's parcel when its items total at least this much
+	// after coupon discounts; 0 disables it
+	FreeShippingThreshold float64 `json:"free_shipping_threshold"`
+	// SpecialPrefixes are destination PIN code prefixes billed at the special zone rate
+	SpecialPrefixes []string            `json:"special_prefixes"`
+	Zones           map[string]ZoneRate `json:"zones"`
+}
+
+// DefaultShippingRateCard returns the rate card used when no file is configured
+func DefaultShippingRateCard() *ShippingRateCard {
+	return &ShippingRateCard{
+		Currency:              "INR",
+		VolumetricDivisor:     5000,
+		DefaultItemWeight:     0.5,
+		FreeShippingThreshold: 999,
+		SpecialPrefixes:       []string{"18", "19", "737", "744", "6825", "78", "79"},
+		Zones: map[string]ZoneRate{
+			ShippingZoneLocal:    {BaseWeight: 0.5, BaseCharge: 40, AdditionalWeight: 0.5, AdditionalCharge: 20},
+			ShippingZoneRegional: {BaseWeight: 0.5, BaseCharge: 50, AdditionalWeight: 0.5, AdditionalCharge: 25},
+			ShippingZoneZonal:    {BaseWeight: 0.5, BaseCharge: 65, AdditionalWeight: 0.5, AdditionalCharge: 30},
+			ShippingZoneNational: {BaseWeight: 0.5, BaseCharge: 80, AdditionalWeight: 0.5, AdditionalCharge: 40},
+			ShippingZoneSpecial:  {BaseWeight: 0.5, BaseCharge: 110, AdditionalWeight: 0.5, AdditionalCharge: 55},
+		},
+	}
+}
+
+// LoadShippingRateCard reads a JSON rate card. Every zone must be priced.
+func LoadShippingRateCard(path string) (*ShippingRateCard, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shipping rates: %v", err)
+	}
+
+	rates := DefaultShippingRateCard()
+	rates.Zones = nil
+	if err := json.Unmarshal(data, rates); err != nil {
+		return nil, fmt.Errorf("failed to parse shipping rates: %v", err)
+	}
+
+	if rates.VolumetricDivisor <= 0 {
+		return nil, fmt.Errorf("shipping rates need a positive volumetric_divisor")
+	}
+	for _, zone := range []string{ShippingZoneLocal, ShippingZoneRegional, ShippingZoneZonal, ShippingZoneNational, ShippingZoneSpecial} {
+		rate, ok := rates.Zones[zone]
+		if !ok {
+			return nil, fmt.Errorf("shipping rates are missing the %s zone", zone)
+		}
+		if rate.BaseWeight <= 0 || rate.AdditionalWeight <= 0 {
+			return nil, fmt.Errorf("shipping rates for the %s zone need positive base_weight and additional_weight", zone)
+		}
+	}
+
+	return rates, nil
+}
+
+// ValidPostalCode reports whether code is a well-formed Indian PIN code
+func ValidPostalCode(code string) bool {
+	code = strings.TrimSpace(code)
+	return len(code) == 6 && pincodePattern.MatchString(code)
+}
+
+// ArtisanPostalCode returns the PIN code an artisan ships from: their postal code,
+// or one written into their location
+func ArtisanPostalCode(artisan *models.ArtisanProfile) string {
+	if artisan == nil {
+		return ""
+	}
+	if ValidPostalCode(artisan.PostalCode) {
+		return strings.TrimSpace(artisan.PostalCode)
+	}
+	return pincodePattern.FindString(artisan.Location)
+}
+
+// toCentimetres converts a product dimension to centimetres
+func toCentimetres(value float64, unit string) float64 {
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "mm":
+		return value / 10
+	case "m":
+		return value * 100
+	case "in", "inch", "inches":
+		return value * 2.54
+	default:
+		return value
+	}
+}
+
+// ShippingCalculator quotes shipping from a rate card
+type ShippingCalculator struct {
+	rates *ShippingRateCard
+}
+
+func NewShippingCalculator(rates *ShippingRateCard) *ShippingCalculator {
+	return &ShippingCalculator{rates: rates}
+}
+
+// Rates returns the rate card in use
+func (s *ShippingCalculator) Rates() *ShippingRateCard {
+	return s.rates
+}
+
+// zone returns the shipping zone between two PIN codes. Parcels from an unknown origin are billed nationally.
+func (s *ShippingCalculator) zone(origin, destination string) string {
+	switch {
+	case len(origin) == 6 && origin[:3] == destination[:3]:
+		return ShippingZoneLocal
+	case s.isSpecial(destination):
+		return ShippingZoneSpecial
+	case len(origin) == 6 && origin[:2] == destination[:2]:
+		return ShippingZoneRegional
+	case len(origin) == 6 && origin[0] == destination[0]:
+		return ShippingZoneZonal
+	default:
+		return ShippingZoneNational
+	}
+}
+
+func (s *ShippingCalculator) isSpecial(destination string) bool {
+	for _, prefix := range s.rates.SpecialPrefixes {
+		if strings.HasPrefix(destination, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Quote prices one parcel per artisan for items already priced from products. The
+// free-shipping threshold applies to each parcel's items after any coupon discount.
+// artisans may be missing entries; their parcels are billed from an unknown origin.
+// It returns the shipping lines in first-seen artisan order and their total.
+func (s *ShippingCalculator) Quote(items []models.OrderItem, products map[string]*models.Product, artisans map[string]*models.ArtisanProfile, destination string) ([]models.ShippingLine, float64, error) {
+	destination = strings.TrimSpace(destination)
+	if !ValidPostalCode(destination) {
+		return nil, 0, ErrInvalidPostalCode
+	}
+
+	type parcel struct {
+		actual, volumetric, subtotal float64
+	}
+
+	var artisanIDs []string
+	parcels := make(map[string]*parcel)
+	for _, item := range items {
+		product := products[item.ProductID]
+		if product == nil {
+			continue
+		}
+
+		p, ok := parcels[item.ArtisanID]
+		if !ok {
+			p = &parcel{}
+			parcels[item.ArtisanID] = p
+			artisanIDs = append(artisanIDs, item.ArtisanID)
+		}
+
+		weight := product.Weight
+		if weight <= 0 {
+			weight = s.rates.DefaultItemWeight
+		}
+		dims := product.Dimensions
+		volume := toCentimetres(dims.Length, dims.Unit) * toCentimetres(dims.Width, dims.Unit) * toCentimetres(dims.Height, dims.Unit)
+
+		quantity := float64(item.Quantity)
+		p.actual += weight * quantity
+		p.volumetric += volume / s.rates.VolumetricDivisor * quantity
+		p.subtotal += item.Total - item.Discount
+	}
+
+	lines := make([]models.ShippingLine, 0, len(artisanIDs))
+	var total float64
+	for _, artisanID := range artisanIDs {
+		p := parcels[artisanID]
+		artisan := artisans[artisanID]
+		origin := ArtisanPostalCode(artisan)
+		zone := s.zone(origin, destination)
+		rate := s.rates.Zones[zone]
+
+		line := models.ShippingLine{
+			ArtisanID:        artisanID,
+			Zone:             zone,
+			OriginPostalCode: origin,
+			ActualWeight:     roundWeight(p.actual),
+			VolumetricWeight: roundWeight(p.volumetric),
+		}
+
+		chargeable := math.Max(p.actual, p.volumetric)
+		amount := rate.BaseCharge
+		if chargeable > rate.BaseWeight {
+			slabs := math.Ceil(roundWeight(chargeable-rate.BaseWeight) / rate.AdditionalWeight)
+			amount += slabs * rate.AdditionalCharge
+			chargeable = rate.BaseWeight + slabs*rate.AdditionalWeight
+		} else {
+			chargeable = rate.BaseWeight
+		}
+		line.ChargeableWeight = roundWeight(chargeable)
+
+		threshold := s.rates.FreeShippingThreshold
+		if artisan != nil && artisan.FreeShippingThreshold > 0 {
+			threshold = artisan.FreeShippingThreshold
+		}
+		if threshold > 0 && p.subtotal >= threshold {
+			line.FreeShipping = true
+			amount = 0
+		}
+
+		line.Amount = roundAmount(amount)
+		total += line.Amount
+		lines = append(lines, line)
+	}
+
+	return lines, roundAmount(total), nil
+}
+
+// roundWeight rounds a weight to grams
+func roundWeight(kg float64) float64 {
+	return math.Round(kg*1000) / 1000
+}
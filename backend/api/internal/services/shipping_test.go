@@ -0,0 +1,32 @@
+package services
+
+import (
+	"testing"
+	"voicecraft-market/internal/models"
+)
+
+func TestQuoteFreeShippingThresholdUsesDiscountedTotal(t *testing.T) {
+	calculator := NewShippingCalculator(DefaultShippingRateCard())
+	products := map[string]*models.Product{"p1": {ID: "p1", ArtisanID: "a1", Weight: 0.5}}
+
+	tests := []struct {
+		name     string
+		discount float64
+		want     bool
+	}{
+		{"no discount", 0, true},
+		{"discounted below the threshold", 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := []models.OrderItem{{ProductID: "p1", ArtisanID: "a1", Quantity: 1, Price: 1000, Total: 1000, Discount: tt.discount}}
+			lines, _, err := calculator.Quote(items, products, nil, "302001")
+			if err != nil {
+				t.Fatalf("Quote() error = %v", err)
+			}
+			if lines[0].FreeShipping != tt.want {
+				t.Errorf("FreeShipping = %v, want %v", lines[0].FreeShipping, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"mime"
 	"net/url"
 	"path/filepath"
 	"strings"
@@ -12,35 +14,59 @@ import (
 
 	"cloud.google.com/go/storage"
 	"github.com/google/uuid"
+	"google.golang.org/api/iterator"
 )
 
+// Visibility says who can read a stored file. Product photos, avatars and review
+// photos are public. Voice recordings, invoices and anything else in the general
+// bucket are private: their URL is a gs:// reference, and readers get a short-lived
+// signed URL once the API has checked their access.
+type Visibility string
+
+const (
+	VisibilityPublic  Visibility = "public"
+	VisibilityPrivate Visibility = "private"
+)
+
+// ErrFileAccessDenied is returned when a user refers to a file that is not theirs
+var ErrFileAccessDenied = errors.New("you can only use your own files")
+
 type StorageService struct {
 	client      *storage.Client
 	ctx         context.Context
 	bucketName  string
 	audioBucket string
 	imageBucket string
+
+	// uniformAccess skips object ACLs for buckets using uniform bucket-level access,
+	// where the bucket's IAM policy decides who can read files
+	uniformAccess bool
+	// signedURLExpiry is how long signed URLs for private files stay valid
+	signedURLExpiry time.Duration
 }
 
 type UploadResult struct {
-	URL      string `json:"url"`
-	FileName string `json:"file_name"`
-	Size     int64  `json:"size"`
-	MimeType string `json:"mime_type"`
+	URL        string     `json:"url"` // public URL, or a gs:// reference for private files
+	FileName   string     `json:"file_name"`
+	Size       int64      `json:"size"`
+	MimeType   string     `json:"mime_type"`
+	Visibility Visibility `json:"visibility"`
 }
 
-func NewStorageService(ctx context.Context, bucketName, audioBucket, imageBucket string) (*StorageService, error) {
+func NewStorageService(ctx context.Context, bucketName, audioBucket, imageBucket string, uniformAccess bool, signedURLExpiry time.Duration) (*StorageService, error) {
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create storage client: %v", err)
 	}
 
 	return &StorageService{
-		client:      client,
-		ctx:         ctx,
-		bucketName:  bucketName,
-		audioBucket: audioBucket,
-		imageBucket: imageBucket,
+		client:          client,
+		ctx:             ctx,
+		bucketName:      bucketName,
+		audioBucket:     audioBucket,
+		imageBucket:     imageBucket,
+		uniformAccess:   uniformAccess,
+		signedURLExpiry: signedURLExpiry,
 	}, nil
 }
 
@@ -48,28 +74,44 @@ func (s *StorageService) Close() error {
 	return s.client.Close()
 }
 
-// UploadAudio uploads audio files to the audio bucket
-func (s *StorageService) UploadAudio(file multipart.File, header *multipart.FileHeader, userID string) (*UploadResult, error) {
-	return s.uploadFile(file, header, s.audioBucket, "audio", userID)
+// UploadAudio uploads validated audio files to the audio bucket as private files
+func (s *StorageService) UploadAudio(file *ValidatedFile, userID string) (*UploadResult, error) {
+	return s.uploadFile(file, s.audioBucket, "audio", userID, VisibilityPrivate)
+}
+
+// UploadImage uploads validated image files to the image bucket as public files
+func (s *StorageService) UploadImage(file *ValidatedFile, userID string) (*UploadResult, error) {
+	return s.uploadFile(file, s.imageBucket, "images", userID, VisibilityPublic)
 }
 
-// UploadImage uploads image files to the image bucket
-func (s *StorageService) UploadImage(file multipart.File, header *multipart.FileHeader, userID string) (*UploadResult, error) {
-	return s.uploadFile(file, header, s.imageBucket, "images", userID)
+// UploadFile uploads any validated file to the general bucket as a private file
+func (s *StorageService) UploadFile(file *ValidatedFile, userID string) (*UploadResult, error) {
+	return s.uploadFile(file, s.bucketName, "files", userID, VisibilityPrivate)
 }
 
-// UploadFile uploads any file to the general bucket
-func (s *StorageService) UploadFile(file multipart.File, header *multipart.FileHeader, userID string) (*UploadResult, error) {
-	return s.uploadFile(file, header, s.bucketName, "files", userID)
+func (s *StorageService) uploadFile(file *ValidatedFile, bucketName, folder, userID string, visibility Visibility) (*UploadResult, error) {
+	// Generate unique filename; the extension and content type come from the sniffed
+	// type, never from what the client sent
+	fileName := fmt.Sprintf("%s/%s/%s%s", folder, userID, uuid.New().String(), file.Extension)
+
+	return s.upload(bytes.NewReader(file.Data), bucketName, fileName, file.MimeType, map[string]string{
+		"original-name": file.Name,
+		"uploaded-by":   userID,
+		"uploaded-at":   time.Now().UTC().Format(time.RFC3339),
+	}, visibility)
 }
 
-func (s *StorageService) uploadFile(file multipart.File, header *multipart.FileHeader, bucketName, folder, userID string) (*UploadResult, error) {
-	defer file.Close()
+// UploadData stores generated content, such as invoices, privately under fileName in the general bucket
+func (s *StorageService) UploadData(data []byte, fileName, contentType string, metadata map[string]string) (*UploadResult, error) {
+	return s.upload(bytes.NewReader(data), s.bucketName, fileName, contentType, metadata, VisibilityPrivate)
+}
 
-	// Generate unique filename
-	ext := filepath.Ext(header.Filename)
-	fileName := fmt.Sprintf("%s/%s/%s%s", folder, userID, uuid.New().String(), ext)
+// UploadImageData stores processed images publicly under fileName in the image bucket
+func (s *StorageService) UploadImageData(data []byte, fileName, contentType string, metadata map[string]string) (*UploadResult, error) {
+	return s.upload(bytes.NewReader(data), s.imageBucket, fileName, contentType, metadata, VisibilityPublic)
+}
 
+func (s *StorageService) upload(content io.Reader, bucketName, fileName, contentType string, metadata map[string]string, visibility Visibility) (*UploadResult, error) {
 	// Get bucket handle
 	bucket := s.client.Bucket(bucketName)
 
@@ -78,15 +120,11 @@ func (s *StorageService) uploadFile(file multipart.File, header *multipart.FileH
 
 	// Create writer with metadata
 	writer := obj.NewWriter(s.ctx)
-	writer.ContentType = header.Header.Get("Content-Type")
-	writer.Metadata = map[string]string{
-		"original-name": header.Filename,
-		"uploaded-by":   userID,
-		"uploaded-at":   time.Now().UTC().Format(time.RFC3339),
-	}
+	writer.ContentType = contentType
+	writer.Metadata = metadata
 
 	// Copy file content
-	size, err := io.Copy(writer, file)
+	size, err := io.Copy(writer, content)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload file: %v", err)
 	}
@@ -96,22 +134,96 @@ func (s *StorageService) uploadFile(file multipart.File, header *multipart.FileH
 		return nil, fmt.Errorf("failed to close writer: %v", err)
 	}
 
-	// Make object public
-	if err := obj.ACL().Set(s.ctx, storage.AllUsers, storage.RoleReader); err != nil {
-		return nil, fmt.Errorf("failed to set ACL: %v", err)
+	if err := s.share(obj, visibility); err != nil {
+		return nil, err
 	}
 
-	// Generate public URL
-	publicURL := fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucketName, fileName)
-
 	return &UploadResult{
-		URL:      publicURL,
-		FileName: fileName,
-		Size:     size,
-		MimeType: header.Header.Get("Content-Type"),
+		URL:        fileURL(bucketName, fileName, visibility),
+		FileName:   fileName,
+		Size:       size,
+		MimeType:   contentType,
+		Visibility: visibility,
 	}, nil
 }
 
+// share makes a public file readable by everyone. Private files, and all files in
+// buckets with uniform access, are left to the bucket's permissions.
+func (s *StorageService) share(obj *storage.ObjectHandle, visibility Visibility) error {
+	if visibility != VisibilityPublic || s.uniformAccess {
+		return nil
+	}
+	if err := obj.ACL().Set(s.ctx, storage.AllUsers, storage.RoleReader); err != nil {
+		return fmt.Errorf("failed to set ACL: %v", err)
+	}
+	return nil
+}
+
+// fileURL is the public URL of a public file, or the gs:// reference of a private one
+func fileURL(bucketName, fileName string, visibility Visibility) string {
+	if visibility == VisibilityPrivate {
+		return fmt.Sprintf("gs://%s/%s", bucketName, fileName)
+	}
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucketName, fileName)
+}
+
+// IsPrivateURL reports whether a stored file URL refers to a private file
+func IsPrivateURL(fileURL string) bool {
+	return strings.HasPrefix(fileURL, "gs://")
+}
+
+// SignedFileURL returns a short-lived URL for reading a stored file, given its public
+// URL or gs:// reference. Callers check the reader's access first.
+func (s *StorageService) SignedFileURL(fileURL string) (string, time.Time, error) {
+	bucketName, fileName, ok := s.objectFromURL(fileURL)
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("not a file in this service's buckets: %s", fileURL)
+	}
+
+	expiresAt := time.Now().Add(s.signedURLExpiry)
+	url, err := s.GetFileURL(fileName, bucketName, s.signedURLExpiry)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return url, expiresAt, nil
+}
+
+// DownloadUserFile downloads a file the user uploaded, given its URL. Uploads are
+// stored under "<folder>/<user ID>/", which is how ownership is checked.
+func (s *StorageService) DownloadUserFile(fileURL, userID string) ([]byte, error) {
+	bucketName, fileName, err := s.userObject(fileURL, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.DownloadFile(fileName, bucketName)
+}
+
+// UserImageReference returns the gs:// reference the AI model reads one of the user's
+// stored images with, given its URL
+func (s *StorageService) UserImageReference(fileURL, userID string) (ImageReference, error) {
+	bucketName, fileName, err := s.userObject(fileURL, userID)
+	if err != nil {
+		return ImageReference{}, err
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(fileName))
+	if !strings.HasPrefix(mimeType, "image/") {
+		return ImageReference{}, fmt.Errorf("%w: %s is not an image", ErrFileTypeNotAllowed, fileURL)
+	}
+	return ImageReference{URI: fmt.Sprintf("gs://%s/%s", bucketName, fileName), MimeType: mimeType}, nil
+}
+
+// userObject finds a stored file by URL, checking it is in the user's own folder
+func (s *StorageService) userObject(fileURL, userID string) (string, string, error) {
+	bucketName, fileName, ok := s.objectFromURL(fileURL)
+	if !ok {
+		return "", "", ErrFileAccessDenied
+	}
+	if parts := strings.SplitN(fileName, "/", 3); len(parts) < 3 || parts[1] != userID {
+		return "", "", ErrFileAccessDenied
+	}
+	return bucketName, fileName, nil
+}
+
 // DeleteFile deletes a file from storage
 func (s *StorageService) DeleteFile(fileName, bucketName string) error {
 	if bucketName == "" {
@@ -128,6 +240,51 @@ func (s *StorageService) DeleteFile(fileName, bucketName string) error {
 	return nil
 }
 
+// DeleteFileByURL deletes a file from one of the service's buckets given its public URL
+func (s *StorageService) DeleteFileByURL(fileURL string) error {
+	bucketName, _, ok := s.objectFromURL(fileURL)
+	if !ok {
+		return fmt.Errorf("not a file in this service's buckets: %s", fileURL)
+	}
+	fileName, err := s.ExtractFileNameFromURL(fileURL)
+	if err != nil {
+		return err
+	}
+	return s.DeleteFile(fileName, bucketName)
+}
+
+// objectFromURL splits a public storage URL or gs:// reference into bucket and object
+// name, reporting whether it points into one of the service's buckets
+func (s *StorageService) objectFromURL(fileURL string) (string, string, bool) {
+	parsedURL, err := url.Parse(fileURL)
+	if err != nil {
+		return "", "", false
+	}
+
+	var bucketName, fileName string
+	switch {
+	case parsedURL.Scheme == "gs":
+		bucketName, fileName = parsedURL.Host, strings.TrimPrefix(parsedURL.Path, "/")
+	case parsedURL.Host == "storage.googleapis.com":
+		bucketName, fileName, _ = strings.Cut(strings.TrimPrefix(parsedURL.Path, "/"), "/")
+	default:
+		return "", "", false
+	}
+	if fileName == "" {
+		return "", "", false
+	}
+	switch bucketName {
+	case s.bucketName, s.audioBucket, s.imageBucket:
+		return bucketName, fileName, true
+	}
+	return "", "", false
+}
+
+// DeleteImage deletes a file from the image bucket
+func (s *StorageService) DeleteImage(fileName string) error {
+	return s.DeleteFile(fileName, s.imageBucket)
+}
+
 // GetFileURL generates a signed URL for private file access
 func (s *StorageService) GetFileURL(fileName, bucketName string, expiry time.Duration) (string, error) {
 	if bucketName == "" {
@@ -140,7 +297,9 @@ func (s *StorageService) GetFileURL(fileName, bucketName string, expiry time.Dur
 		Expires: time.Now().Add(expiry),
 	}
 
-	url, err := storage.SignedURL(bucketName, fileName, opts)
+	// The bucket handle signs with the client's credentials, or through IAM when
+	// running on Google Cloud without a key file
+	url, err := s.client.Bucket(bucketName).SignedURL(fileName, opts)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate signed URL: %v", err)
 	}
@@ -170,7 +329,7 @@ func (s *StorageService) ListFiles(bucketName, prefix string, maxResults int) ([
 			break
 		}
 		obj, err := it.Next()
-		if err == storage.ErrObjectNotExist {
+		if err == iterator.Done {
 			break
 		}
 		if err != nil {
@@ -183,6 +342,27 @@ func (s *StorageService) ListFiles(bucketName, prefix string, maxResults int) ([
 	return objects, nil
 }
 
+// WalkFiles calls fn for every object under prefix, including those in sub-folders
+func (s *StorageService) WalkFiles(ctx context.Context, bucketName, prefix string, fn func(*storage.ObjectAttrs) error) error {
+	if bucketName == "" {
+		bucketName = s.bucketName
+	}
+
+	it := s.client.Bucket(bucketName).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		obj, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %v", err)
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+}
+
 // GetFileMetadata returns metadata for a specific file
 func (s *StorageService) GetFileMetadata(fileName, bucketName string) (*storage.ObjectAttrs, error) {
 	if bucketName == "" {
@@ -223,12 +403,17 @@ func (s *StorageService) DownloadFile(fileName, bucketName string) ([]byte, erro
 	return data, nil
 }
 
-// ValidateFileType checks if the uploaded file type is allowed
+// ValidateFileType checks a file name's extension against allowed extensions or MIME
+// types. It only looks at the name; uploads are validated by UploadValidator.
 func (s *StorageService) ValidateFileType(fileName string, allowedTypes []string) bool {
-	ext := strings.ToLower(filepath.Ext(fileName))
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	if ext == "" {
+		return false
+	}
 
 	for _, allowedType := range allowedTypes {
-		if strings.Contains(allowedType, ext[1:]) { // Remove the dot from extension
+		allowedType = strings.ToLower(strings.TrimSpace(allowedType))
+		if allowedType == ext || strings.HasSuffix(allowedType, "/"+ext) {
 			return true
 		}
 	}
@@ -257,8 +442,9 @@ func (s *StorageService) GetFileExtensionFromMimeType(mimeType string) string {
 	return ".bin" // Default binary extension
 }
 
-// GenerateUploadURL generates a signed URL for direct client uploads
-func (s *StorageService) GenerateUploadURL(fileName, bucketName, contentType string, expiry time.Duration) (string, error) {
+// GenerateUploadURL generates a signed URL for direct client uploads. Headers such as
+// "x-goog-content-length-range:0,1024" are signed too, so the client must send them.
+func (s *StorageService) GenerateUploadURL(fileName, bucketName, contentType string, expiry time.Duration, headers ...string) (string, error) {
 	if bucketName == "" {
 		bucketName = s.bucketName
 	}
@@ -268,9 +454,34 @@ func (s *StorageService) GenerateUploadURL(fileName, bucketName, contentType str
 		Method:      "PUT",
 		Expires:     time.Now().Add(expiry),
 		ContentType: contentType,
+		Headers:     headers,
+	}
+
+	url, err := s.client.Bucket(bucketName).SignedURL(fileName, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate upload URL: %v", err)
+	}
+
+	return url, nil
+}
+
+// GenerateResumableUploadURL generates a signed URL that starts a resumable upload.
+// The client POSTs to it with "x-goog-resumable: start" and uploads to the session URI
+// in the Location header of the response.
+func (s *StorageService) GenerateResumableUploadURL(fileName, bucketName, contentType string, expiry time.Duration) (string, error) {
+	if bucketName == "" {
+		bucketName = s.bucketName
+	}
+
+	opts := &storage.SignedURLOptions{
+		Scheme:      storage.SigningSchemeV4,
+		Method:      "POST",
+		Expires:     time.Now().Add(expiry),
+		ContentType: contentType,
+		Headers:     []string{"x-goog-resumable:start"},
 	}
 
-	url, err := storage.SignedURL(bucketName, fileName, opts)
+	url, err := s.client.Bucket(bucketName).SignedURL(fileName, opts)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate upload URL: %v", err)
 	}
@@ -278,6 +489,67 @@ func (s *StorageService) GenerateUploadURL(fileName, bucketName, contentType str
 	return url, nil
 }
 
+// ReadObject downloads one generation of an object. Objects over maxSize bytes are not
+// read; only their attributes are returned. Missing objects return storage.ErrObjectNotExist.
+func (s *StorageService) ReadObject(fileName, bucketName string, maxSize int64) ([]byte, *storage.ObjectAttrs, error) {
+	if bucketName == "" {
+		bucketName = s.bucketName
+	}
+
+	obj := s.client.Bucket(bucketName).Object(fileName)
+	attrs, err := obj.Attrs(s.ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if attrs.Size > maxSize {
+		return nil, attrs, nil
+	}
+
+	// Read the generation that was checked, even if the client uploads again meanwhile
+	reader, err := obj.Generation(attrs.Generation).NewReader(s.ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create reader: %v", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return data, attrs, nil
+}
+
+// CopyObject copies one generation of an object to another bucket with a checked
+// content type and the given visibility
+func (s *StorageService) CopyObject(srcBucket, srcName string, generation int64, dstBucket, dstName, contentType string, metadata map[string]string, visibility Visibility) (*UploadResult, error) {
+	if srcBucket == "" {
+		srcBucket = s.bucketName
+	}
+
+	src := s.client.Bucket(srcBucket).Object(srcName).Generation(generation)
+	dst := s.client.Bucket(dstBucket).Object(dstName)
+
+	copier := dst.CopierFrom(src)
+	copier.ContentType = contentType
+	copier.Metadata = metadata
+	attrs, err := copier.Run(s.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy file: %v", err)
+	}
+
+	if err := s.share(dst, visibility); err != nil {
+		return nil, err
+	}
+
+	return &UploadResult{
+		URL:        fileURL(dstBucket, dstName, visibility),
+		FileName:   dstName,
+		Size:       attrs.Size,
+		MimeType:   contentType,
+		Visibility: visibility,
+	}, nil
+}
+
 // ExtractFileNameFromURL extracts the file name from a Google Cloud Storage URL
 func (s *StorageService) ExtractFileNameFromURL(fileURL string) (string, error) {
 	parsedURL, err := url.Parse(fileURL)
@@ -288,6 +560,11 @@ func (s *StorageService) ExtractFileNameFromURL(fileURL string) (string, error)
 	// Remove leading slash and decode
 	fileName := strings.TrimPrefix(parsedURL.Path, "/")
 
+	// gs:// references carry the bucket as their host
+	if parsedURL.Scheme == "gs" {
+		return fileName, nil
+	}
+
 	// For Google Cloud Storage URLs, remove the bucket name
 	parts := strings.SplitN(fileName, "/", 2)
 	if len(parts) > 1 {
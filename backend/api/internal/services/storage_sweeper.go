@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// Files in the image bucket are referenced by URL from many documents: product
+// photos and their renditions, variant photos, avatars, review photos and drafts. The
+// sweeper collects every storage URL or gs:// reference mentioned anywhere in those collections and
+// deletes images/ objects that none of them mention. Objects younger than the grace
+// period are skipped, so uploads whose document has not been written yet survive.
+
+// sweptCollections are the collections whose documents can refer to stored images
+var sweptCollections = []string{
+	ProductsCollection,
+	DraftsCollection,
+	ArtisansCollection,
+	UsersCollection,
+	ReviewsCollection,
+	OrdersCollection,
+}
+
+// StorageSweeper garbage-collects images nothing refers to
+type StorageSweeper struct {
+	firestoreService *FirestoreService
+	storageService   *StorageService
+	grace            time.Duration
+}
+
+func NewStorageSweeper(firestoreService *FirestoreService, storageService *StorageService, grace time.Duration) *StorageSweeper {
+	return &StorageSweeper{
+		firestoreService: firestoreService,
+		storageService:   storageService,
+		grace:            grace,
+	}
+}
+
+// RunSweeper deletes unreferenced images every interval until ctx is cancelled
+func (s *StorageSweeper) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if deleted, err := s.Sweep(ctx); err != nil {
+				log.Printf("Storage sweep failed: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Deleted %d unreferenced images", deleted)
+			}
+		}
+	}
+}
+
+// Sweep deletes images/ objects in the image bucket that no document refers to. If
+// any collection cannot be read, nothing is deleted.
+func (s *StorageSweeper) Sweep(ctx context.Context) (int, error) {
+	// Note the time first so objects uploaded during the scan are never candidates
+	cutoff := time.Now().Add(-s.grace)
+
+	referenced, err := s.referencedObjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	bucketName := s.storageService.imageBucket
+	err = s.storageService.WalkFiles(ctx, bucketName, "images/", func(obj *storage.ObjectAttrs) error {
+		if obj.Created.After(cutoff) || referenced[bucketName+"/"+obj.Name] {
+			return nil
+		}
+		if err := s.storageService.DeleteFile(obj.Name, bucketName); err != nil {
+			log.Printf("Failed to delete unreferenced image %s: %v", obj.Name, err)
+			return nil
+		}
+		deleted++
+		return nil
+	})
+	return deleted, err
+}
+
+// referencedObjects returns "bucket/name" for every storage URL found in the swept collections
+func (s *StorageSweeper) referencedObjects(ctx context.Context) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for _, collection := range sweptCollections {
+		iter := s.firestoreService.client.Collection(collection).Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return nil, fmt.Errorf("failed to read %s: %v", collection, err)
+			}
+			s.collectURLs(doc.Data(), referenced)
+		}
+		iter.Stop()
+	}
+	return referenced, nil
+}
+
+// collectURLs walks a document's fields for storage URLs
+func (s *StorageSweeper) collectURLs(value interface{}, referenced map[string]bool) {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "storage.googleapis.com/") && !IsPrivateURL(v) {
+			return
+		}
+		if bucketName, fileName, ok := s.storageService.objectFromURL(v); ok {
+			referenced[bucketName+"/"+fileName] = true
+		}
+	case map[string]interface{}:
+		for _, field := range v {
+			s.collectURLs(field, referenced)
+		}
+	case []interface{}:
+		for _, item := range v {
+			s.collectURLs(item, referenced)
+		}
+	}
+}
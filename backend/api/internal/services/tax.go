@@ -0,0 +1,208 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"voicecraft-market/internal/models"
+)
+
+// GST is charged per line at the rate for the product's category. Supplies within
+// the artisan's own state are split equally into CGST and SGST; supplies to another
+// state (or where either state is unknown) carry IGST. Shipping is part of the
+// supply of the goods, so it is taxed at the highest rate in the artisan's parcel.
+
+// CategoryTax is the HSN code and GST rate for a product category
+type CategoryTax struct {
+	HSNCode string  `json:"hsn_code"`
+	Rate    float64 `json:"rate"` // percent
+}
+
+// TaxRateCard holds the GST configuration, usually loaded from TAX_RATES_FILE
+type TaxRateCard struct {
+	// PricesIncludeTax treats product prices and shipping charges as GST-inclusive,
+	// as Indian retail prices are; otherwise GST is added on top
+	PricesIncludeTax bool                   `json:"prices_include_tax"`
+	ShippingSAC      string                 `json:"shipping_sac"`
+	Categories       map[string]CategoryTax `json:"categories"`
+	Default          CategoryTax            `json:"default"`
+}
+
+// DefaultTaxRateCard returns the rate card used when no file is configured
+func DefaultTaxRateCard() *TaxRateCard {
+	return &TaxRateCard{
+		PricesIncludeTax: true,
+		ShippingSAC:      "996812",
+		Categories: map[string]CategoryTax{
+			"pottery":   {HSNCode: "6912", Rate: 5},
+			"textiles":  {HSNCode: "6304", Rate: 5},
+			"jewelry":   {HSNCode: "7117", Rate: 3},
+			"woodwork":  {HSNCode: "4420", Rate: 5},
+			"metalwork": {HSNCode: "8306", Rate: 5},
+			"glass":     {HSNCode: "7013", Rate: 18},
+			"leather":   {HSNCode: "4202", Rate: 18},
+			"other":     {HSNCode: "9703", Rate: 5},
+		},
+		Default: CategoryTax{HSNCode: "9703", Rate: 5},
+	}
+}
+
+// LoadTaxRateCard reads a JSON tax rate card
+func LoadTaxRateCard(path string) (*TaxRateCard, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tax rates: %v", err)
+	}
+
+	// The file must give its own default; a rate of -1 marks one that is missing
+	rates := DefaultTaxRateCard()
+	rates.Categories = nil
+	rates.Default = CategoryTax{Rate: -1}
+	if err := json.Unmarshal(data, rates); err != nil {
+		return nil, fmt.Errorf("failed to parse tax rates: %v", err)
+	}
+
+	for category, tax := range rates.Categories {
+		if tax.Rate < 0 || tax.Rate > 28 {
+			return nil, fmt.Errorf("tax rate for %s must be between 0 and 28 percent", category)
+		}
+	}
+	if rates.Default.Rate < 0 || rates.Default.Rate > 28 {
+		return nil, fmt.Errorf("default tax rate is required and must be between 0 and 28 percent")
+	}
+
+	return rates, nil
+}
+
+// normalizeState compares states by their letters only, so "Tamil Nadu" matches "tamilnadu"
+func normalizeState(state string) string {
+	state = strings.ReplaceAll(strings.ToLower(state), "&", "and")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return r
+		}
+		return -1
+	}, state)
+}
+
+// IsInterstateSupply reports whether a supply from the artisan's state to the buyer's
+// crosses state lines. Unknown states are treated as interstate.
+func IsInterstateSupply(artisanState, buyerState string) bool {
+	from, to := normalizeState(artisanState), normalizeState(buyerState)
+	return from == "" || to == "" || from != to
+}
+
+// TaxCalculator computes GST from a rate card
+type TaxCalculator struct {
+	rates *TaxRateCard
+}
+
+func NewTaxCalculator(rates *TaxRateCard) *TaxCalculator {
+	return &TaxCalculator{rates: rates}
+}
+
+// Rates returns the rate card in use
+func (t *TaxCalculator) Rates() *TaxRateCard {
+	return t.rates
+}
+
+// CategoryTax returns the HSN code and rate for a product category
+func (t *TaxCalculator) CategoryTax(category string) CategoryTax {
+	if tax, ok := t.rates.Categories[category]; ok {
+		return tax
+	}
+	return t.rates.Default
+}
+
+// taxLine splits the GST on an amount into its components
+func (t *TaxCalculator) taxLine(line models.TaxLine, amount float64, interstate bool) models.TaxLine {
+	var tax float64
+	if t.rates.PricesIncludeTax {
+		line.TaxableValue = roundAmount(amount / (1 + line.Rate/100))
+		tax = roundAmount(amount - line.TaxableValue)
+	} else {
+		line.TaxableValue = roundAmount(amount)
+		tax = roundAmount(amount * line.Rate / 100)
+	}
+
+	if interstate {
+		line.IGST = tax
+	} else {
+		line.CGST = roundAmount(tax / 2)
+		line.SGST = roundAmount(tax - line.CGST)
+	}
+	line.Total = roundAmount(line.TaxableValue + tax)
+	return line
+}
+
+// Compute returns the tax lines for priced items (net of coupon discounts) and shipping
+// lines delivered to buyerState, and the tax to add to the order total (zero when prices
+// include tax)
+func (t *TaxCalculator) Compute(items []models.OrderItem, products map[string]*models.Product, artisans map[string]*models.ArtisanProfile, shipping []models.ShippingLine, buyerState string) ([]models.TaxLine, float64) {
+	var lines []models.TaxLine
+	var added float64
+	highestRate := make(map[string]float64)
+
+	for _, item := range items {
+		product := products[item.ProductID]
+		if product == nil {
+			continue
+		}
+
+		var artisanState string
+		if artisan := artisans[item.ArtisanID]; artisan != nil {
+			artisanState = artisan.State
+		}
+
+		description := product.Title
+		if item.VariantLabel != "" {
+			description += " (" + item.VariantLabel + ")"
+		}
+
+		category := t.CategoryTax(product.Category)
+		line := t.taxLine(models.TaxLine{
+			ArtisanID:   item.ArtisanID,
+			ProductID:   item.ProductID,
+			Description: description,
+			HSNCode:     category.HSNCode,
+			Quantity:    item.Quantity,
+			Rate:        category.Rate,
+		}, item.Total-item.Discount, IsInterstateSupply(artisanState, buyerState))
+
+		if category.Rate > highestRate[item.ArtisanID] {
+			highestRate[item.ArtisanID] = category.Rate
+		}
+		if !t.rates.PricesIncludeTax {
+			added += line.Total - line.TaxableValue
+		}
+		lines = append(lines, line)
+	}
+
+	for _, shippingLine := range shipping {
+		if shippingLine.Amount <= 0 {
+			continue
+		}
+
+		var artisanState string
+		if artisan := artisans[shippingLine.ArtisanID]; artisan != nil {
+			artisanState = artisan.State
+		}
+
+		line := t.taxLine(models.TaxLine{
+			ArtisanID:   shippingLine.ArtisanID,
+			Description: "Shipping",
+			HSNCode:     t.rates.ShippingSAC,
+			Quantity:    1,
+			Rate:        highestRate[shippingLine.ArtisanID],
+		}, shippingLine.Amount, IsInterstateSupply(artisanState, buyerState))
+
+		if !t.rates.PricesIncludeTax {
+			added += line.Total - line.TaxableValue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, roundAmount(added)
+}
@@ -0,0 +1,580 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Artisans ship an order by registering a shipment for their items with the
+// carrier's tracking number. Carriers with a CarrierAdapter then report progress
+// by webhook or polling, and once every item on the order is in a delivered
+// shipment the order moves to delivered.
+
+var (
+	// ErrOrderNotShippable is returned when an order is not in a state that can be shipped
+	ErrOrderNotShippable = errors.New("order cannot be shipped in its current status")
+	// ErrShipmentExists is returned when a tracking number is already registered with the carrier
+	ErrShipmentExists = errors.New("a shipment with this tracking number already exists")
+	// ErrInvalidTrackingNumber is returned for empty or malformed tracking numbers
+	ErrInvalidTrackingNumber = errors.New("invalid tracking number")
+	// ErrNothingToShip is returned when the shipping artisan has no items on the order
+	ErrNothingToShip = errors.New("no items on this order to ship")
+	// ErrUnknownCarrier is returned for webhooks from carriers without an adapter
+	ErrUnknownCarrier = errors.New("unknown carrier")
+)
+
+// activeShipmentStatuses are the statuses carriers are still expected to update
+var activeShipmentStatuses = []models.ShipmentStatus{
+	models.ShipmentStatusShipped,
+	models.ShipmentStatusInTransit,
+	models.ShipmentStatusOutForDelivery,
+	models.ShipmentStatusException,
+}
+
+// ShipmentUpdate is the outcome of applying a carrier update to a shipment
+type ShipmentUpdate struct {
+	Shipment       *models.Shipment
+	Order          *models.Order
+	StatusChanged  bool
+	OrderDelivered bool
+}
+
+// normalizeCarrier gives carrier names a single spelling for lookups and document IDs
+func normalizeCarrier(carrier string) string {
+	return strings.ToLower(strings.TrimSpace(carrier))
+}
+
+// shipmentRef returns the deterministic document for a carrier's tracking number,
+// so the same parcel cannot be registered twice
+func (fs *FirestoreService) shipmentRef(carrier, trackingNumber string) *firestore.DocumentRef {
+	return fs.client.Collection(ShipmentsCollection).Doc(normalizeCarrier(carrier) + "_" + normalizeTrackingNumber(trackingNumber))
+}
+
+// CreateShipment stores a shipment and marks its order as shipped. The returned
+// order reflects the update; changed reports whether the order status moved to shipped.
+func (fs *FirestoreService) CreateShipment(shipment *models.Shipment) (*models.Order, bool, error) {
+	shipment.Carrier = normalizeCarrier(shipment.Carrier)
+	shipment.TrackingNumber = normalizeTrackingNumber(shipment.TrackingNumber)
+	if shipment.TrackingNumber == "" || strings.Contains(shipment.TrackingNumber, "/") {
+		return nil, false, ErrInvalidTrackingNumber
+	}
+
+	shipmentRef := fs.shipmentRef(shipment.Carrier, shipment.TrackingNumber)
+	orderRef := fs.client.Collection(OrdersCollection).Doc(shipment.OrderID)
+
+	var result *models.Order
+	var changed bool
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		order, err := fs.getOrderForUpdate(tx, orderRef)
+		if err != nil {
+			return err
+		}
+
+		switch order.Status {
+		case models.OrderStatusConfirmed, models.OrderStatusProcessing, models.OrderStatusShipped:
+		default:
+			return ErrOrderNotShippable
+		}
+
+		// Lines refunded since the caller read the order are no longer shipped
+		remaining := make(map[string]int, len(order.Items))
+		for _, item := range order.Items {
+			remaining[models.LineKey(item.ProductID, item.VariantID)] += item.Quantity - item.RefundedQuantity
+		}
+		var items []models.ShipmentItem
+		var productIDs []string
+		for _, item := range shipment.Items {
+			if left := remaining[models.LineKey(item.ProductID, item.VariantID)]; left < item.Quantity {
+				item.Quantity = left
+			}
+			if item.Quantity <= 0 {
+				continue
+			}
+			items = append(items, item)
+			if !containsString(productIDs, item.ProductID) {
+				productIDs = append(productIDs, item.ProductID)
+			}
+		}
+		if len(items) == 0 {
+			return ErrNothingToShip
+		}
+		shipment.Items = items
+		shipment.ProductIDs = productIDs
+
+		if _, err := tx.Get(shipmentRef); err == nil {
+			return ErrShipmentExists
+		} else if !isNotFound(err) {
+			return err
+		}
+
+		now := time.Now()
+		shipment.ID = shipmentRef.ID
+		shipment.BuyerID = order.BuyerID
+		shipment.Status = models.ShipmentStatusShipped
+		shipment.Events = []models.TrackingEvent{{
+			Status:      models.ShipmentStatusShipped,
+			Description: "Shipment handed to " + shipment.Carrier,
+			OccurredAt:  now,
+		}}
+		shipment.CreatedAt = now
+		shipment.UpdatedAt = now
+		shipment.CheckedAt = now
+
+		updates := []firestore.Update{
+			{Path: "status", Value: models.OrderStatusShipped},
+			{Path: "updated_at", Value: now},
+		}
+		// The order summary shows the first shipment; every shipment is on the tracking timeline
+		if order.TrackingInfo == nil {
+			order.TrackingInfo = &models.TrackingInfo{
+				Carrier:           shipment.Carrier,
+				TrackingNumber:    shipment.TrackingNumber,
+				EstimatedDelivery: shipment.EstimatedDelivery,
+			}
+			updates = append(updates, firestore.Update{Path: "tracking_info", Value: order.TrackingInfo})
+		}
+
+		if err := tx.Create(shipmentRef, shipment); err != nil {
+			return err
+		}
+		if err := tx.Update(orderRef, updates); err != nil {
+			return err
+		}
+
+		changed = order.Status != models.OrderStatusShipped
+		order.Status = models.OrderStatusShipped
+		order.UpdatedAt = now
+		result = order
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return result, changed, nil
+}
+
+// GetShipment loads a shipment by carrier and tracking number
+func (fs *FirestoreService) GetShipment(carrier, trackingNumber string) (*models.Shipment, error) {
+	doc, err := fs.shipmentRef(carrier, trackingNumber).Get(fs.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var shipment models.Shipment
+	if err := doc.DataTo(&shipment); err != nil {
+		return nil, err
+	}
+	shipment.ID = doc.Ref.ID
+	return &shipment, nil
+}
+
+func (fs *FirestoreService) getShipments(query firestore.Query) ([]models.Shipment, error) {
+	iter := query.Documents(fs.ctx)
+	defer iter.Stop()
+
+	shipments := []models.Shipment{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var shipment models.Shipment
+		if err := doc.DataTo(&shipment); err != nil {
+			continue
+		}
+		shipment.ID = doc.Ref.ID
+		shipments = append(shipments, shipment)
+	}
+
+	return shipments, nil
+}
+
+// GetOrderShipments lists an order's shipments, oldest first
+func (fs *FirestoreService) GetOrderShipments(orderID string) ([]models.Shipment, error) {
+	shipments, err := fs.getShipments(fs.client.Collection(ShipmentsCollection).Where("order_id", "==", orderID))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(shipments, func(i, j int) bool {
+		return shipments[i].CreatedAt.Before(shipments[j].CreatedAt)
+	})
+	return shipments, nil
+}
+
+// GetShipmentsToPoll returns undelivered shipments on tracked carriers that have
+// not been checked since before, least recently checked first
+func (fs *FirestoreService) GetShipmentsToPoll(before time.Time, limit int) ([]models.Shipment, error) {
+	return fs.getShipments(fs.client.Collection(ShipmentsCollection).
+		Where("tracked", "==", true).
+		Where("status", "in", activeShipmentStatuses).
+		Where("checked_at", "<", before).
+		OrderBy("checked_at", firestore.Asc).
+		Limit(limit))
+}
+
+// MarkShipmentChecked records a poll that brought no update, so the shipment goes to the back of the queue
+func (fs *FirestoreService) MarkShipmentChecked(shipmentID string) error {
+	_, err := fs.client.Collection(ShipmentsCollection).Doc(shipmentID).Update(fs.ctx, []firestore.Update{
+		{Path: "checked_at", Value: time.Now()},
+	})
+	return err
+}
+
+// mergeTrackingEvents adds carrier events not already on the shipment and keeps them in time order
+func mergeTrackingEvents(existing, incoming []models.TrackingEvent) ([]models.TrackingEvent, bool) {
+	key := func(event models.TrackingEvent) string {
+		return fmt.Sprintf("%s|%d|%s", event.Status, event.OccurredAt.Unix(), event.Description)
+	}
+
+	seen := make(map[string]bool, len(existing))
+	for _, event := range existing {
+		seen[key(event)] = true
+	}
+
+	merged := append([]models.TrackingEvent{}, existing...)
+	added := false
+	for _, event := range incoming {
+		if event.OccurredAt.IsZero() {
+			event.OccurredAt = time.Now()
+		}
+		if seen[key(event)] {
+			continue
+		}
+		seen[key(event)] = true
+		merged = append(merged, event)
+		added = true
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].OccurredAt.Before(merged[j].OccurredAt)
+	})
+	return merged, added
+}
+
+// ApplyShipmentTracking merges a carrier update into a shipment and, when it
+// completes delivery of every item on the order, marks the order delivered
+func (fs *FirestoreService) ApplyShipmentTracking(carrier string, tracking CarrierTracking) (*ShipmentUpdate, error) {
+	shipmentRef := fs.shipmentRef(carrier, tracking.TrackingNumber)
+
+	var update *ShipmentUpdate
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(shipmentRef)
+		if err != nil {
+			return err
+		}
+
+		var shipment models.Shipment
+		if err := doc.DataTo(&shipment); err != nil {
+			return err
+		}
+		shipment.ID = shipmentRef.ID
+
+		orderRef := fs.client.Collection(OrdersCollection).Doc(shipment.OrderID)
+		order, err := fs.getOrderForUpdate(tx, orderRef)
+		if err != nil {
+			return err
+		}
+
+		siblings, err := tx.Documents(fs.client.Collection(ShipmentsCollection).Where("order_id", "==", shipment.OrderID)).GetAll()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		events, added := mergeTrackingEvents(shipment.Events, tracking.Events)
+		previous := shipment.Status
+
+		// Delivery is final; late or out-of-order carrier events do not undo it
+		if shipment.Status != models.ShipmentStatusDelivered && tracking.Status.IsValid() {
+			shipment.Status = tracking.Status
+		}
+		if tracking.EstimatedDelivery != nil {
+			shipment.EstimatedDelivery = tracking.EstimatedDelivery
+		}
+		if shipment.Status == models.ShipmentStatusDelivered && shipment.DeliveredAt == nil {
+			deliveredAt := now
+			for _, event := range events {
+				if event.Status == models.ShipmentStatusDelivered {
+					deliveredAt = event.OccurredAt
+				}
+			}
+			shipment.DeliveredAt = &deliveredAt
+		}
+
+		shipment.Events = events
+		shipment.CheckedAt = now
+		statusChanged := shipment.Status != previous
+		if statusChanged || added || tracking.EstimatedDelivery != nil {
+			shipment.UpdatedAt = now
+		}
+
+		if err := tx.Set(shipmentRef, &shipment); err != nil {
+			return err
+		}
+
+		update = &ShipmentUpdate{Shipment: &shipment, Order: order, StatusChanged: statusChanged}
+
+		var orderUpdates []firestore.Update
+		if order.TrackingInfo != nil && order.TrackingInfo.TrackingNumber == shipment.TrackingNumber &&
+			tracking.EstimatedDelivery != nil {
+			order.TrackingInfo.EstimatedDelivery = tracking.EstimatedDelivery
+			orderUpdates = append(orderUpdates, firestore.Update{Path: "tracking_info", Value: order.TrackingInfo})
+		}
+
+		if shipment.Status == models.ShipmentStatusDelivered && order.Status == models.OrderStatusShipped {
+			complete, err := orderFullyDelivered(order, &shipment, siblings)
+			if err != nil {
+				return err
+			}
+			if complete {
+				order.Status = models.OrderStatusDelivered
+				order.DeliveredAt = shipment.DeliveredAt
+				order.UpdatedAt = now
+				update.OrderDelivered = true
+				orderUpdates = append(orderUpdates,
+					firestore.Update{Path: "status", Value: models.OrderStatusDelivered},
+					firestore.Update{Path: "delivered_at", Value: *shipment.DeliveredAt},
+					firestore.Update{Path: "updated_at", Value: now},
+				)
+			}
+		}
+
+		if len(orderUpdates) == 0 {
+			return nil
+		}
+		return tx.Update(orderRef, orderUpdates)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return update, nil
+}
+
+// orderFullyDelivered reports whether every item still on the order is in a shipment
+// and every shipment is delivered, given the just-updated shipment and the order's
+// stored shipments. Lines refunded in full are not waited for.
+func orderFullyDelivered(order *models.Order, shipment *models.Shipment, stored []*firestore.DocumentSnapshot) (bool, error) {
+	delivered := map[string]bool{}
+	for _, productID := range shipment.ProductIDs {
+		delivered[productID] = true
+	}
+
+	for _, doc := range stored {
+		if doc.Ref.ID == shipment.ID {
+			continue
+		}
+		var other models.Shipment
+		if err := doc.DataTo(&other); err != nil {
+			return false, err
+		}
+		if other.Status != models.ShipmentStatusDelivered {
+			return false, nil
+		}
+		for _, productID := range other.ProductIDs {
+			delivered[productID] = true
+		}
+	}
+
+	for _, item := range order.Items {
+		if item.RefundedQuantity < item.Quantity && !delivered[item.ProductID] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// TrackingService registers shipments and keeps them in step with their carriers
+type TrackingService struct {
+	firestoreService    *FirestoreService
+	notificationService *NotificationService
+	carriers            map[string]CarrierAdapter
+}
+
+func NewTrackingService(firestoreService *FirestoreService, notificationService *NotificationService, carriers ...CarrierAdapter) *TrackingService {
+	registry := make(map[string]CarrierAdapter, len(carriers))
+	for _, carrier := range carriers {
+		registry[normalizeCarrier(carrier.Name())] = carrier
+	}
+
+	return &TrackingService{
+		firestoreService:    firestoreService,
+		notificationService: notificationService,
+		carriers:            registry,
+	}
+}
+
+// Carrier returns the adapter for a carrier name, if one is configured
+func (s *TrackingService) Carrier(name string) (CarrierAdapter, bool) {
+	carrier, ok := s.carriers[normalizeCarrier(name)]
+	return carrier, ok
+}
+
+// Ship registers a shipment of the artisan's items on an order and marks the order
+// shipped. An empty artisanID ships every item (admins shipping on a seller's behalf).
+// Only the units not refunded are shipped. changed reports whether the order status
+// moved to shipped.
+func (s *TrackingService) Ship(order *models.Order, artisanID, carrier, trackingNumber string, estimatedDelivery *time.Time) (*models.Shipment, *models.Order, bool, error) {
+	var items []models.ShipmentItem
+	for _, item := range order.Items {
+		remaining := item.Quantity - item.RefundedQuantity
+		if remaining > 0 && (artisanID == "" || item.ArtisanID == artisanID) {
+			items = append(items, models.ShipmentItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: remaining})
+		}
+	}
+	if len(items) == 0 {
+		return nil, nil, false, ErrNothingToShip
+	}
+
+	if artisanID == "" {
+		artisanID = order.ArtisanID
+	}
+
+	_, tracked := s.Carrier(carrier)
+	shipment := &models.Shipment{
+		OrderID:           order.ID,
+		ArtisanID:         artisanID,
+		Items:             items,
+		Carrier:           carrier,
+		TrackingNumber:    trackingNumber,
+		Tracked:           tracked,
+		EstimatedDelivery: estimatedDelivery,
+	}
+
+	updated, changed, err := s.firestoreService.CreateShipment(shipment)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return shipment, updated, changed, nil
+}
+
+// HandleWebhook verifies a carrier webhook and applies its tracking updates.
+// Updates for tracking numbers the marketplace does not know are ignored.
+func (s *TrackingService) HandleWebhook(carrierName string, header http.Header, body []byte) error {
+	carrier, ok := s.Carrier(carrierName)
+	if !ok {
+		return ErrUnknownCarrier
+	}
+
+	updates, err := carrier.ParseWebhook(header, body)
+	if err != nil {
+		return err
+	}
+
+	for _, tracking := range updates {
+		if err := s.apply(carrier.Name(), tracking); err != nil {
+			if isNotFound(err) {
+				log.Printf("Ignoring %s tracking update for unknown shipment %s", carrier.Name(), tracking.TrackingNumber)
+				continue
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PollShipments asks carriers for the status of shipments not checked within interval
+func (s *TrackingService) PollShipments(ctx context.Context, interval time.Duration) (int, error) {
+	shipments, err := s.firestoreService.GetShipmentsToPoll(time.Now().Add(-interval), 100)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load shipments to poll: %v", err)
+	}
+
+	polled := 0
+	for _, shipment := range shipments {
+		carrier, ok := s.Carrier(shipment.Carrier)
+		if !ok {
+			continue
+		}
+
+		tracking, err := carrier.Track(ctx, shipment.TrackingNumber)
+		if err != nil {
+			if !errors.Is(err, ErrTrackingNotSupported) {
+				log.Printf("Failed to track %s shipment %s: %v", shipment.Carrier, shipment.TrackingNumber, err)
+			}
+			if err := s.firestoreService.MarkShipmentChecked(shipment.ID); err != nil {
+				log.Printf("Failed to mark shipment %s checked: %v", shipment.ID, err)
+			}
+			continue
+		}
+
+		tracking.TrackingNumber = shipment.TrackingNumber
+		if err := s.apply(shipment.Carrier, *tracking); err != nil {
+			log.Printf("Failed to update shipment %s: %v", shipment.ID, err)
+			continue
+		}
+		polled++
+	}
+
+	return polled, nil
+}
+
+// RunTrackingPoller polls carriers every interval until ctx is cancelled
+func (s *TrackingService) RunTrackingPoller(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.PollShipments(ctx, interval); err != nil {
+				log.Printf("Shipment tracking poll failed: %v", err)
+			}
+		}
+	}
+}
+
+// apply stores a carrier update and tells the buyer about delivery milestones
+func (s *TrackingService) apply(carrier string, tracking CarrierTracking) error {
+	update, err := s.firestoreService.ApplyShipmentTracking(carrier, tracking)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case update.OrderDelivered:
+		go s.firestoreService.RecordOrderStatusChange(string(models.OrderStatusDelivered))
+		go s.notifyBuyer(update.Order.BuyerID, update.Order.ID, string(models.OrderStatusDelivered))
+	case update.StatusChanged && (update.Shipment.Status == models.ShipmentStatusOutForDelivery ||
+		update.Shipment.Status == models.ShipmentStatusException):
+		go s.notifyBuyer(update.Order.BuyerID, update.Order.ID, string(update.Shipment.Status))
+	}
+
+	return nil
+}
+
+// notifyBuyer sends an order notification for a delivery milestone. Failures are logged.
+func (s *TrackingService) notifyBuyer(buyerID, orderID, status string) {
+	if s.notificationService == nil {
+		return
+	}
+
+	user, err := s.firestoreService.GetUser(buyerID)
+	if err != nil || user.FCMToken == "" {
+		return
+	}
+
+	if err := s.notificationService.SendOrderNotification(user.FCMToken, orderID, status); err != nil {
+		log.Printf("Failed to notify buyer about order %s: %v", orderID, err)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Invoices are drawn with the standard PDF fonts, which only cover Latin text, so
+// names and addresses in Indian scripts are transliterated to ASCII first. The Indic
+// Unicode blocks share Devanagari's layout, so one table covers Devanagari, Bengali,
+// Gurmukhi, Gujarati, Odia, Tamil, Telugu, Kannada and Malayalam. The spelling is a
+// plain phonetic one ("शर्मा" -> "Sharma") rather than a scholarly scheme.
+
+// indicBlocks are the first code points of the Unicode blocks laid out like Devanagari
+var indicBlocks = []rune{0x0900, 0x0980, 0x0A00, 0x0A80, 0x0B00, 0x0B80, 0x0C00, 0x0C80, 0x0D00}
+
+// indicConsonants map Devanagari consonants to their sound without the inherent vowel
+var indicConsonants = map[rune]string{
+	'क': "k", 'ख': "kh", 'ग': "g", 'घ': "gh", 'ङ': "n",
+	'च': "ch", 'छ': "chh", 'ज': "j", 'झ': "jh", 'ञ': "n",
+	'ट': "t", 'ठ': "th", 'ड': "d", 'ढ': "dh", 'ण': "n",
+	'त': "t", 'थ': "th", 'द': "d", 'ध': "dh", 'न': "n", 'ऩ': "n",
+	'प': "p", 'फ': "ph", 'ब': "b", 'भ': "bh", 'म': "m",
+	'य': "y", 'र': "r", 'ऱ': "r", 'ल': "l", 'ळ': "l", 'ऴ': "zh", 'व': "v",
+	'श': "sh", 'ष': "sh", 'स': "s", 'ह': "h",
+	'क़': "q", 'ख़': "kh", 'ग़': "gh", 'ज़': "z", 'ड़': "r", 'ढ़': "rh", 'फ़': "f", 'य़': "y",
+}
+
+// indicNukta changes a consonant's sound when the nukta sign follows it
+var indicNukta = map[string]string{"k": "q", "j": "z", "ph": "f", "d": "r", "dh": "rh"}
+
+// indicVowels map independent vowels and vowel signs to their sound
+var indicVowels = map[rune]string{
+	'अ': "a", 'आ': "a", 'इ': "i", 'ई': "i", 'उ': "u", 'ऊ': "u", 'ऋ': "ri",
+	'ऍ': "e", 'ऎ': "e", 'ए': "e", 'ऐ': "ai", 'ऑ': "o", 'ऒ': "o", 'ओ': "o", 'औ': "au",
+	'ा': "a", 'ि': "i", 'ी': "i", 'ु': "u", 'ू': "u", 'ृ': "ri",
+	'ॅ': "e", 'ॆ': "e", 'े': "e", 'ै': "ai", 'ॉ': "o", 'ॊ': "o", 'ो': "o", 'ौ': "au",
+}
+
+// indicSigns map the remaining signs and punctuation
+var indicSigns = map[rune]string{
+	'ँ': "n", 'ं': "n", 'ः': "h", 'ऽ': "'", 'ॐ': "Om", '।': ".", '॥': ".",
+}
+
+const (
+	indicVirama    = '्'
+	indicNuktaSign = '़'
+)
+
+// latinMarks spell letters with diacritics, as used in romanised Indian names, without them
+var latinMarks = strings.NewReplacer(
+	"ā", "a", "ī", "i", "ū", "u", "ṛ", "ri", "ṝ", "ri", "ḷ", "l", "ē", "e", "ō", "o",
+	"ṅ", "n", "ṭ", "t", "ḍ", "d", "ṇ", "n", "ś", "sh", "ṣ", "sh", "ṃ", "m", "ḥ", "h",
+	"Ā", "A", "Ī", "I", "Ū", "U", "Ṛ", "Ri", "Ē", "E", "Ō", "O",
+	"Ṭ", "T", "Ḍ", "D", "Ṇ", "N", "Ś", "Sh", "Ṣ", "Sh", "Ṃ", "M", "Ḥ", "H",
+)
+
+// toDevanagari maps a character of any Indic block onto its Devanagari counterpart
+func toDevanagari(r rune) (rune, bool) {
+	for _, start := range indicBlocks {
+		if r >= start && r < start+0x80 {
+			return r - start + 0x0900, true
+		}
+	}
+	return r, false
+}
+
+// transliterateIndic spells Indian-script text in ASCII letters and leaves other
+// text as it is. Each transliterated word starts with a capital letter.
+func transliterateIndic(text string) string {
+	if !strings.ContainsFunc(text, func(r rune) bool { _, ok := toDevanagari(r); return ok }) {
+		return latinMarks.Replace(text)
+	}
+
+	runes := []rune(text)
+	var b strings.Builder
+	wordStart := true
+	write := func(s string) {
+		if wordStart && s != "" {
+			s = strings.ToUpper(s[:1]) + s[1:]
+			wordStart = false
+		}
+		b.WriteString(s)
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r, indic := toDevanagari(runes[i])
+		if !indic {
+			wordStart = !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i])
+			b.WriteRune(runes[i])
+			continue
+		}
+
+		switch {
+		case r >= '०' && r <= '९':
+			b.WriteRune('0' + r - '०')
+		case indicConsonants[r] != "":
+			sound := indicConsonants[r]
+			next := func() rune {
+				if i+1 < len(runes) {
+					n, _ := toDevanagari(runes[i+1])
+					return n
+				}
+				return 0
+			}
+			if next() == indicNuktaSign {
+				if changed, ok := indicNukta[sound]; ok {
+					sound = changed
+				}
+				i++
+			}
+			write(sound)
+
+			// The inherent vowel is silent before a virama or vowel sign and at the end of a word
+			n := next()
+			if n == indicVirama {
+				i++
+			} else if _, sign := indicVowels[n]; !sign && (indicConsonants[n] != "" || n == 'ँ' || n == 'ं' || n == 'ः') {
+				write("a")
+			}
+		case indicVowels[r] != "":
+			write(indicVowels[r])
+		case indicSigns[r] != "":
+			write(indicSigns[r])
+		}
+	}
+	return latinMarks.Replace(b.String())
+}
@@ -0,0 +1,30 @@
+package services
+
+import "testing"
+
+func TestTransliterateIndic(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"शर्मा", "Sharma"},
+		{"राम कुमार", "Ram Kumar"},
+		{"मोहम्मद ज़फ़र", "Mohammad Zafar"},
+		{"লক্ষ্মী দাস", "Lakshmi Das"},
+		{"சென்னை", "Chennai"},
+		{"पिन ३०२००१", "Pin 302001"},
+		{"Ravi (Jaipur)", "Ravi (Jaipur)"},
+		{"Śāntā", "Shanta"},
+	}
+	for _, tt := range tests {
+		if got := transliterateIndic(tt.text); got != tt.want {
+			t.Errorf("transliterateIndic(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPDFEscapeTransliterates(t *testing.T) {
+	if got := pdfEscape("सीता (दिल्ली) ₹500"); got != `Sita \(Dilli\) Rs.500` {
+		t.Errorf("pdfEscape() = %q", got)
+	}
+}
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+)
+
+// Large files are uploaded straight to Cloud Storage instead of through the API. The
+// client opens an upload session declaring the file's type and size and gets a signed
+// URL for an object under the quarantine/ prefix of the uploads bucket. Once uploaded,
+// finalizing the session checks the object's size and sniffed content against the
+// declaration and the upload limits, then stores it where it belongs and attaches it
+// to a product, the artisan's avatar or a product's voice story. Quarantined objects
+// are deleted once a session is finalized or fails; a lifecycle rule on the prefix
+// should remove the ones left by abandoned sessions.
+
+var (
+	// ErrInvalidUploadSession is returned when an upload session request is incomplete
+	ErrInvalidUploadSession = errors.New("invalid upload session")
+	// ErrUploadSessionNotFound is returned for sessions that do not exist or belong to someone else
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	// ErrUploadSessionExpired is returned when a session is finalized after its upload URL expired
+	ErrUploadSessionExpired = errors.New("upload session has expired")
+	// ErrUploadSessionClosed is returned when a session has already been finalized
+	ErrUploadSessionClosed = errors.New("upload session is already finalized")
+	// ErrUploadIncomplete is returned when finalizing before the file has been uploaded
+	ErrUploadIncomplete = errors.New("the file has not been uploaded yet")
+	// ErrUploadMismatch is returned when the uploaded file is not what the session declared
+	ErrUploadMismatch = errors.New("uploaded file does not match the upload session")
+	// ErrUploadTargetGone is returned when the product or profile for an upload no longer exists
+	ErrUploadTargetGone = errors.New("the product or profile for this upload no longer exists")
+)
+
+// quarantinePrefix is where direct uploads land before they are checked
+const quarantinePrefix = "quarantine/"
+
+// SignedUpload tells the client how to send a file to Cloud Storage
+type SignedUpload struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"` // must be sent with the request exactly as given
+}
+
+// UploadSessionService manages direct-to-bucket uploads
+type UploadSessionService struct {
+	firestoreService *FirestoreService
+	storageService   *StorageService
+	uploadValidator  *UploadValidator
+	imagePipeline    *ImagePipeline
+	expiry           time.Duration
+}
+
+func NewUploadSessionService(firestoreService *FirestoreService, storageService *StorageService, uploadValidator *UploadValidator, imagePipeline *ImagePipeline, expiry time.Duration) *UploadSessionService {
+	return &UploadSessionService{
+		firestoreService: firestoreService,
+		storageService:   storageService,
+		uploadValidator:  uploadValidator,
+		imagePipeline:    imagePipeline,
+		expiry:           expiry,
+	}
+}
+
+// CreateSession checks the declared file against the upload limits, saves the session
+// and signs the URL the client uploads to. The caller checks access to the target.
+func (s *UploadSessionService) CreateSession(session *models.UploadSession) (*SignedUpload, error) {
+	if !session.Purpose.IsValid() {
+		return nil, fmt.Errorf("%w: purpose must be product_image, avatar or voice_story", ErrInvalidUploadSession)
+	}
+	if session.Purpose != models.UploadPurposeAvatar && session.ProductID == "" {
+		return nil, fmt.Errorf("%w: product_id is required for %s uploads", ErrInvalidUploadSession, session.Purpose)
+	}
+	if session.Purpose == models.UploadPurposeAvatar {
+		session.ProductID = ""
+	}
+	if session.Size <= 0 {
+		return nil, fmt.Errorf("%w: size must be the file size in bytes", ErrInvalidUploadSession)
+	}
+	if session.Enhance != "" {
+		if session.Purpose != models.UploadPurposeProductImage {
+			return nil, fmt.Errorf("%w: only product images can be enhanced", ErrInvalidUploadSession)
+		}
+		if _, err := ParseEnhanceMode(session.Enhance); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidUploadSession, err)
+		}
+		if !s.imagePipeline.CanEnhance() {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidUploadSession, ErrEnhancementDisabled)
+		}
+	}
+
+	session.ContentType = strings.ToLower(strings.TrimSpace(session.ContentType))
+	var err error
+	if session.Purpose.IsImage() {
+		err = s.uploadValidator.AllowsImage(session.ContentType, session.Size)
+	} else {
+		err = s.uploadValidator.AllowsAudio(session.ContentType, session.Size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ref := s.firestoreService.client.Collection(UploadSessionsCollection).NewDoc()
+	now := time.Now()
+	session.ID = ref.ID
+	session.ObjectName = fmt.Sprintf("%s%s/%s", quarantinePrefix, session.UserID, ref.ID)
+	session.Status = models.UploadSessionPending
+	session.Error = ""
+	session.URL = ""
+	session.ExpiresAt = now.Add(s.expiry)
+	session.CreatedAt = now
+	session.CompletedAt = nil
+
+	upload, err := s.sign(session)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ref.Create(s.firestoreService.ctx, session); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// sign creates the upload URL for a session. Single-request uploads must be exactly
+// the declared size; resumable uploads are checked when finalized.
+func (s *UploadSessionService) sign(session *models.UploadSession) (*SignedUpload, error) {
+	if session.Resumable {
+		url, err := s.storageService.GenerateResumableUploadURL(session.ObjectName, "", session.ContentType, s.expiry)
+		if err != nil {
+			return nil, err
+		}
+		return &SignedUpload{URL: url, Method: "POST", Headers: map[string]string{
+			"Content-Type":     session.ContentType,
+			"x-goog-resumable": "start",
+		}}, nil
+	}
+
+	lengthRange := fmt.Sprintf("%d,%d", session.Size, session.Size)
+	url, err := s.storageService.GenerateUploadURL(session.ObjectName, "", session.ContentType, s.expiry, "x-goog-content-length-range:"+lengthRange)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedUpload{URL: url, Method: "PUT", Headers: map[string]string{
+		"Content-Type":                session.ContentType,
+		"x-goog-content-length-range": lengthRange,
+	}}, nil
+}
+
+// GetSession returns one of the user's upload sessions
+func (s *UploadSessionService) GetSession(sessionID, userID string) (*models.UploadSession, error) {
+	var session models.UploadSession
+	if err := s.firestoreService.GetDocument(UploadSessionsCollection, sessionID, &session); err != nil {
+		if isNotFound(err) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, ErrUploadSessionNotFound
+	}
+	return &session, nil
+}
+
+// Finalize checks an uploaded file and attaches it to the session's target. Sessions
+// whose file is refused are closed as failed; after other errors, including a file
+// that has not arrived yet, the session can be finalized again.
+func (s *UploadSessionService) Finalize(ctx context.Context, sessionID, userID string) (*models.UploadSession, error) {
+	session, err := s.claim(sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, generation, err := s.verify(ctx, session)
+	if err == nil {
+		session.URL, err = s.attach(ctx, session, file, generation)
+	}
+	if err != nil {
+		if isUploadRejection(err) {
+			s.fail(session, err)
+		} else {
+			s.reopen(session)
+		}
+		return nil, err
+	}
+
+	// The checked copy now lives elsewhere
+	if err := s.storageService.DeleteFile(session.ObjectName, ""); err != nil {
+		log.Printf("Failed to delete quarantined upload %s: %v", session.ObjectName, err)
+	}
+
+	now := time.Now()
+	session.Status = models.UploadSessionCompleted
+	session.CompletedAt = &now
+	_, err = s.firestoreService.client.Collection(UploadSessionsCollection).Doc(session.ID).Update(s.firestoreService.ctx, []firestore.Update{
+		{Path: "status", Value: session.Status},
+		{Path: "url", Value: session.URL},
+		{Path: "completed_at", Value: now},
+	})
+	if err != nil {
+		log.Printf("Failed to complete upload session %s: %v", session.ID, err)
+	}
+	return session, nil
+}
+
+// claim moves a pending session to finalizing so it is only attached once. Expired
+// sessions are closed and their upload deleted.
+func (s *UploadSessionService) claim(sessionID, userID string) (*models.UploadSession, error) {
+	ref := s.firestoreService.client.Collection(UploadSessionsCollection).Doc(sessionID)
+
+	var session models.UploadSession
+	var expired bool
+	err := s.firestoreService.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if isNotFound(err) {
+				return ErrUploadSessionNotFound
+			}
+			return err
+		}
+		if err := doc.DataTo(&session); err != nil {
+			return err
+		}
+		if session.UserID != userID {
+			return ErrUploadSessionNotFound
+		}
+		if session.Status != models.UploadSessionPending {
+			return ErrUploadSessionClosed
+		}
+
+		expired = time.Now().After(session.ExpiresAt)
+		if expired {
+			session.Status = models.UploadSessionFailed
+			session.Error = ErrUploadSessionExpired.Error()
+			return tx.Update(ref, []firestore.Update{
+				{Path: "status", Value: session.Status},
+				{Path: "error", Value: session.Error},
+			})
+		}
+		session.Status = models.UploadSessionFinalizing
+		return tx.Update(ref, []firestore.Update{{Path: "status", Value: session.Status}})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if expired {
+		s.storageService.DeleteFile(session.ObjectName, "")
+		return nil, ErrUploadSessionExpired
+	}
+	return &session, nil
+}
+
+// verify reads the quarantined object and checks it against the session and the
+// upload limits, returning the checked generation
+func (s *UploadSessionService) verify(ctx context.Context, session *models.UploadSession) (*ValidatedFile, int64, error) {
+	data, attrs, err := s.storageService.ReadObject(session.ObjectName, "", session.Size)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, 0, ErrUploadIncomplete
+		}
+		return nil, 0, err
+	}
+	if attrs.Size != session.Size {
+		return nil, 0, fmt.Errorf("%w: declared %d bytes but received %d", ErrUploadMismatch, session.Size, attrs.Size)
+	}
+
+	var file *ValidatedFile
+	if session.Purpose.IsImage() {
+		file, err = s.uploadValidator.CheckImage(ctx, data, session.FileName)
+	} else {
+		file, err = s.uploadValidator.CheckAudio(ctx, data, session.FileName)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if !sameMimeType(file.MimeType, session.ContentType) {
+		return nil, 0, fmt.Errorf("%w: declared %s but the file is %s", ErrUploadMismatch, session.ContentType, file.MimeType)
+	}
+	return file, attrs.Generation, nil
+}
+
+// attach stores a checked file for its target and returns its URL
+func (s *UploadSessionService) attach(ctx context.Context, session *models.UploadSession, file *ValidatedFile, generation int64) (string, error) {
+	metadata := map[string]string{
+		"original-name":  file.Name,
+		"uploaded-by":    session.UserID,
+		"uploaded-at":    time.Now().UTC().Format(time.RFC3339),
+		"upload-session": session.ID,
+	}
+
+	switch session.Purpose {
+	case models.UploadPurposeProductImage:
+		product, err := s.checkProduct(session.ProductID, session.Purpose)
+		if err != nil {
+			return "", err
+		}
+		var record *models.ProductImage
+		enhance, err := ParseEnhanceMode(session.Enhance)
+		if err == nil && enhance != nil {
+			record, err = s.imagePipeline.StoreEnhancedProductImage(ctx, file.Data, session.UserID, *enhance)
+		} else if err == nil {
+			record, err = s.imagePipeline.StoreProductImage(file.Data, session.UserID)
+		}
+		if err != nil {
+			return "", err
+		}
+		// Sessions for someone else's product are only opened by admins
+		review := product.ArtisanID == session.UserID
+		if _, err := s.firestoreService.AddProductImages(session.ProductID, []models.ProductImage{*record}, review); err != nil {
+			s.imagePipeline.DeleteProductImage(*record)
+			return "", err
+		}
+		return record.URL("full"), nil
+
+	case models.UploadPurposeAvatar:
+		artisan, err := s.firestoreService.GetArtisan(session.UserID)
+		if err != nil {
+			if isNotFound(err) {
+				return "", ErrUploadTargetGone
+			}
+			return "", err
+		}
+		fileName := fmt.Sprintf("images/%s/%s%s", session.UserID, uuid.New().String(), file.Extension)
+		result, err := s.storageService.CopyObject("", session.ObjectName, generation, s.storageService.imageBucket, fileName, file.MimeType, metadata, VisibilityPublic)
+		if err != nil {
+			return "", err
+		}
+		return result.URL, s.firestoreService.UpdateArtisan(artisan.ID, map[string]interface{}{"avatar_url": result.URL})
+
+	case models.UploadPurposeVoiceStory:
+		if _, err := s.checkProduct(session.ProductID, session.Purpose); err != nil {
+			return "", err
+		}
+		fileName := fmt.Sprintf("audio/%s/%s%s", session.UserID, uuid.New().String(), file.Extension)
+		result, err := s.storageService.CopyObject("", session.ObjectName, generation, s.storageService.audioBucket, fileName, file.MimeType, metadata, VisibilityPrivate)
+		if err != nil {
+			return "", err
+		}
+		return result.URL, s.firestoreService.UpdateProduct(session.ProductID, map[string]interface{}{"voice_story.audio_url": result.URL})
+	}
+	return "", ErrInvalidUploadSession
+}
+
+func (s *UploadSessionService) checkProduct(productID string, purpose models.UploadPurpose) (*models.Product, error) {
+	product, err := s.firestoreService.GetProduct(productID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrUploadTargetGone
+		}
+		return nil, err
+	}
+	if purpose == models.UploadPurposeProductImage && len(product.Images) >= MaxProductImages {
+		return nil, ErrTooManyImages
+	}
+	return product, nil
+}
+
+// fail closes a session whose file was refused and deletes the file
+func (s *UploadSessionService) fail(session *models.UploadSession, cause error) {
+	s.storageService.DeleteFile(session.ObjectName, "")
+
+	session.Status = models.UploadSessionFailed
+	session.Error = cause.Error()
+	_, err := s.firestoreService.client.Collection(UploadSessionsCollection).Doc(session.ID).Update(s.firestoreService.ctx, []firestore.Update{
+		{Path: "status", Value: session.Status},
+		{Path: "error", Value: session.Error},
+	})
+	if err != nil {
+		log.Printf("Failed to close upload session %s: %v", session.ID, err)
+	}
+}
+
+// reopen returns a session to pending so it can be finalized again
+func (s *UploadSessionService) reopen(session *models.UploadSession) {
+	session.Status = models.UploadSessionPending
+	_, err := s.firestoreService.client.Collection(UploadSessionsCollection).Doc(session.ID).Update(s.firestoreService.ctx, []firestore.Update{
+		{Path: "status", Value: session.Status},
+	})
+	if err != nil {
+		log.Printf("Failed to reopen upload session %s: %v", session.ID, err)
+	}
+}
+
+// isUploadRejection reports whether finalizing failed because of the file itself
+func isUploadRejection(err error) bool {
+	for _, target := range []error{
+		ErrUploadMismatch, ErrUploadTargetGone, ErrTooManyImages, ErrFileTooLarge, ErrFileTypeNotAllowed,
+		ErrImageTooLarge, ErrUnsupportedImage, ErrInvalidImage, ErrFileRejected,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
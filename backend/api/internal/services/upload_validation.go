@@ -0,0 +1,279 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"mime/multipart"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Uploads are judged by their content, not by the file name or Content-Type the
+// client sends. The type is sniffed from the file's magic bytes, the size limit is
+// enforced while reading, images have their dimensions read from the header before
+// anything decodes them, and files can be passed to a malware scanner before they are
+// stored.
+
+var (
+	// ErrFileTooLarge is returned when an upload exceeds its size limit
+	ErrFileTooLarge = errors.New("file is too large")
+	// ErrFileTypeNotAllowed is returned when an upload's content is not an allowed type
+	ErrFileTypeNotAllowed = errors.New("file type is not allowed")
+	// ErrImageTooLarge is returned when an image's dimensions exceed the limits
+	ErrImageTooLarge = errors.New("image dimensions are too large")
+	// ErrFileRejected is returned when the malware scanner flags an upload
+	ErrFileRejected = errors.New("file was rejected by the malware scan")
+)
+
+// mimeAliases lists detected types that satisfy an allowed type under another name
+var mimeAliases = map[string][]string{
+	"audio/m4a": {"audio/x-m4a", "audio/mp4"},
+}
+
+// UploadPolicy limits one kind of upload
+type UploadPolicy struct {
+	AllowedTypes []string
+	MaxSize      int64
+	MaxDimension int   // longest image edge in pixels; 0 for no limit
+	MaxPixels    int64 // image width times height; 0 for no limit
+}
+
+// ValidatedFile is an upload that passed validation, with its sniffed type
+type ValidatedFile struct {
+	Name      string // the client's file name, kept as metadata only
+	Data      []byte
+	MimeType  string
+	Extension string // includes the leading dot
+	Width     int    // images only
+	Height    int
+}
+
+// UploadValidator checks audio and image uploads against their policies
+type UploadValidator struct {
+	audio   UploadPolicy
+	image   UploadPolicy
+	scanner MalwareScanner
+}
+
+// NewUploadValidator creates a validator; scanner may be nil to skip malware scans
+func NewUploadValidator(audio, image UploadPolicy, scanner MalwareScanner) *UploadValidator {
+	return &UploadValidator{audio: audio, image: image, scanner: scanner}
+}
+
+// ValidateAudio reads and checks an uploaded audio file
+func (v *UploadValidator) ValidateAudio(ctx context.Context, header *multipart.FileHeader) (*ValidatedFile, error) {
+	data, err := readUpload(header, v.audio.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	return v.CheckAudio(ctx, data, header.Filename)
+}
+
+// ValidateImage reads and checks an uploaded image
+func (v *UploadValidator) ValidateImage(ctx context.Context, header *multipart.FileHeader) (*ValidatedFile, error) {
+	data, err := readUpload(header, v.image.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	return v.CheckImage(ctx, data, header.Filename)
+}
+
+// CheckAudio checks audio that has already been read
+func (v *UploadValidator) CheckAudio(ctx context.Context, data []byte, name string) (*ValidatedFile, error) {
+	file, err := checkContent(data, name, v.audio)
+	if err != nil {
+		return nil, err
+	}
+	return file, v.scan(ctx, file)
+}
+
+// CheckImage checks an image that has already been read. Its dimensions come from the
+// file header, so oversized images are refused without being decoded.
+func (v *UploadValidator) CheckImage(ctx context.Context, data []byte, name string) (*ValidatedFile, error) {
+	file, err := checkContent(data, name, v.image)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.Width, file.Height, err = imageDimensions(data, file.MimeType); err != nil {
+		return nil, err
+	}
+	if file.Width <= 0 || file.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+	if (v.image.MaxDimension > 0 && max(file.Width, file.Height) > v.image.MaxDimension) ||
+		(v.image.MaxPixels > 0 && int64(file.Width)*int64(file.Height) > v.image.MaxPixels) {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, file.Width, file.Height)
+	}
+
+	return file, v.scan(ctx, file)
+}
+
+// AllowsAudio checks the type and size a client declares before uploading audio
+func (v *UploadValidator) AllowsAudio(contentType string, size int64) error {
+	return v.audio.allows(contentType, size)
+}
+
+// AllowsImage checks the type and size a client declares before uploading an image
+func (v *UploadValidator) AllowsImage(contentType string, size int64) error {
+	return v.image.allows(contentType, size)
+}
+
+func (p UploadPolicy) allows(contentType string, size int64) error {
+	if p.MaxSize > 0 && size > p.MaxSize {
+		return fmt.Errorf("%w: the limit is %s", ErrFileTooLarge, FormatSize(p.MaxSize))
+	}
+	declared := mimetype.Lookup(strings.ToLower(strings.TrimSpace(contentType)))
+	if declared == nil || !typeAllowed(declared, p.AllowedTypes) {
+		return fmt.Errorf("%w: %s", ErrFileTypeNotAllowed, contentType)
+	}
+	return nil
+}
+
+func (v *UploadValidator) scan(ctx context.Context, file *ValidatedFile) error {
+	if v.scanner == nil {
+		return nil
+	}
+	return v.scanner.Scan(ctx, file.Data, file.Name)
+}
+
+// readUpload reads an uploaded file, refusing it once it passes maxSize bytes
+func readUpload(header *multipart.FileHeader, maxSize int64) ([]byte, error) {
+	if maxSize > 0 && header.Size > maxSize {
+		return nil, fmt.Errorf("%w: the limit is %s", ErrFileTooLarge, FormatSize(maxSize))
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if maxSize > 0 {
+		reader = io.LimitReader(file, maxSize+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: the limit is %s", ErrFileTooLarge, FormatSize(maxSize))
+	}
+	return data, nil
+}
+
+// checkContent enforces the size limit and sniffs the type from the magic bytes
+func checkContent(data []byte, name string, policy UploadPolicy) (*ValidatedFile, error) {
+	if policy.MaxSize > 0 && int64(len(data)) > policy.MaxSize {
+		return nil, fmt.Errorf("%w: the limit is %s", ErrFileTooLarge, FormatSize(policy.MaxSize))
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: the file is empty", ErrFileTypeNotAllowed)
+	}
+
+	detected := mimetype.Detect(data)
+	if !typeAllowed(detected, policy.AllowedTypes) {
+		return nil, fmt.Errorf("%w: %s", ErrFileTypeNotAllowed, detected.String())
+	}
+
+	mimeType, _, _ := strings.Cut(detected.String(), ";")
+	return &ValidatedFile{
+		Name:      name,
+		Data:      data,
+		MimeType:  mimeType,
+		Extension: detected.Extension(),
+	}, nil
+}
+
+// typeAllowed matches a detected type, or one of its aliases, against the allowed types
+func typeAllowed(detected *mimetype.MIME, allowedTypes []string) bool {
+	for _, allowed := range allowedTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "" {
+			continue
+		}
+		if detected.Is(allowed) {
+			return true
+		}
+		for _, alias := range mimeAliases[allowed] {
+			if detected.Is(alias) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameMimeType reports whether a sniffed type is the declared type or one of its aliases
+func sameMimeType(sniffed, declared string) bool {
+	detected := mimetype.Lookup(sniffed)
+	return detected != nil && typeAllowed(detected, []string{declared})
+}
+
+// imageDimensions reads an image's size from its header without decoding the pixels
+func imageDimensions(data []byte, mimeType string) (int, int, error) {
+	if mimeType == "image/webp" {
+		return webpDimensions(data)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return 0, 0, fmt.Errorf("%w: %s", ErrUnsupportedImage, mimeType)
+		}
+		return 0, 0, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	return config.Width, config.Height, nil
+}
+
+// webpDimensions reads the canvas size from the first chunk of a WebP file
+func webpDimensions(data []byte) (int, int, error) {
+	if !isWebP(data) || len(data) < 30 {
+		return 0, 0, ErrInvalidImage
+	}
+
+	chunk := data[20:]
+	switch string(data[12:16]) {
+	case "VP8X":
+		// Extended format: 24-bit canvas width and height minus one
+		width := int(chunk[4]) | int(chunk[5])<<8 | int(chunk[6])<<16
+		height := int(chunk[7]) | int(chunk[8])<<8 | int(chunk[9])<<16
+		return width + 1, height + 1, nil
+	case "VP8L":
+		// Lossless: signature byte, then 14-bit width and height minus one
+		if chunk[0] != 0x2f {
+			return 0, 0, ErrInvalidImage
+		}
+		bits := binary.LittleEndian.Uint32(chunk[1:])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, nil
+	case "VP8 ":
+		// Lossy: frame tag, start code, then 14-bit width and height
+		if chunk[3] != 0x9d || chunk[4] != 0x01 || chunk[5] != 0x2a {
+			return 0, 0, ErrInvalidImage
+		}
+		width := int(binary.LittleEndian.Uint16(chunk[6:]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(chunk[8:]) & 0x3fff)
+		return width, height, nil
+	}
+	return 0, 0, ErrInvalidImage
+}
+
+// FormatSize prints a byte count in the units sizes are configured in
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1<<30 && size%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", size>>30)
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", size>>10)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
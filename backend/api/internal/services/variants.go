@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Products can vary along option dimensions such as size or colour. Each variant is
+// one combination of option values with its own SKU, stock and optional price; the
+// product's stock and status then follow the totals across its variants.
+
+// ErrInvalidVariants is returned when a product's options and variants do not fit together
+var ErrInvalidVariants = errors.New("invalid variants")
+
+// VariantPrice returns the price of a product variant, which is the product's price
+// unless the variant overrides it
+func VariantPrice(product *models.Product, variantID string) models.Money {
+	price := ProductPrice(product)
+	if variant := product.Variant(variantID); variant != nil && variant.PriceMinor > 0 {
+		price.Amount = variant.PriceMinor
+	}
+	return price
+}
+
+// itemVariant returns the variant an order line is for, or nil for products without
+// variants. Lines for variant products must name one of its variants.
+func itemVariant(product *models.Product, item models.OrderItem) (*models.ProductVariant, error) {
+	if len(product.Variants) == 0 {
+		if item.VariantID != "" {
+			return nil, fmt.Errorf("%w: %s has no variant %q", ErrProductUnavailable, product.Title, item.VariantID)
+		}
+		return nil, nil
+	}
+	if item.VariantID == "" {
+		return nil, fmt.Errorf("%w: choose a variant of %s", ErrProductUnavailable, product.Title)
+	}
+	variant := product.Variant(item.VariantID)
+	if variant == nil {
+		return nil, fmt.Errorf("%w: %s has no variant %q", ErrProductUnavailable, product.Title, item.VariantID)
+	}
+	return variant, nil
+}
+
+// checkItemStock checks that every line can be reserved from its product or variant.
+// Products made after ordering need no stock.
+func checkItemStock(items []models.OrderItem, products map[string]*models.Product) error {
+	needed := make(map[string]int)
+	var stocked []models.OrderItem
+	for _, item := range items {
+		product := products[item.ProductID]
+		variant, err := itemVariant(product, item)
+		if err != nil {
+			return err
+		}
+		if product.OrderableWithoutStock() {
+			continue
+		}
+		stocked = append(stocked, item)
+
+		key := models.LineKey(item.ProductID, item.VariantID)
+		needed[key] += item.Quantity
+		if variant != nil {
+			if variant.AvailableStock() < needed[key] {
+				return fmt.Errorf("%w: %s (%s)", ErrInsufficientStock, product.Title, variant.Label(product.Options))
+			}
+		}
+	}
+
+	_, quantities := orderQuantities(stocked)
+	for productID, quantity := range quantities {
+		if product := products[productID]; product.AvailableStock() < quantity {
+			return fmt.Errorf("%w: %s", ErrInsufficientStock, product.Title)
+		}
+	}
+	return nil
+}
+
+// adjustStock changes a product's stock and reservations in memory, on the given
+// variant for variant products
+func adjustStock(product *models.Product, variantID string, stockChange, reservedChange int) {
+	if variant := product.Variant(variantID); variant != nil {
+		variant.Stock += stockChange
+		variant.ReservedStock += reservedChange
+	} else {
+		product.Stock += stockChange
+		product.ReservedStock += reservedChange
+	}
+	product.SyncStock()
+}
+
+// stockUpdates writes a product's stock after adjustStock, including its variants and
+// any status change that followed
+func stockUpdates(product *models.Product, now time.Time) []firestore.Update {
+	updates := []firestore.Update{
+		{Path: "stock", Value: product.Stock},
+		{Path: "reserved_stock", Value: product.ReservedStock},
+		{Path: "status", Value: product.Status},
+		{Path: "updated_at", Value: now},
+	}
+	if len(product.Variants) > 0 {
+		updates = append(updates, firestore.Update{Path: "variants", Value: product.Variants})
+	}
+	return updates
+}
+
+// NormalizeVariants validates a product's options and variants, fills in variant IDs
+// and prices, and recomputes the product's stock from its variants. Reservations are
+// carried over from the stored product, and variants held by unpaid orders cannot be
+// removed. Variant images must be among the product's own images.
+func NormalizeVariants(product *models.Product, existing *models.Product) error {
+	if len(product.Options) == 0 && len(product.Variants) == 0 {
+		if existing != nil && len(existing.Variants) > 0 && existing.ReservedStock > 0 {
+			return fmt.Errorf("%w: variants with reserved stock cannot be removed", ErrInvalidVariants)
+		}
+		return nil
+	}
+	if len(product.Options) == 0 || len(product.Variants) == 0 {
+		return fmt.Errorf("%w: products with options need at least one variant", ErrInvalidVariants)
+	}
+	if existing != nil && len(existing.Variants) == 0 && existing.ReservedStock > 0 {
+		return fmt.Errorf("%w: variants cannot be added while stock is reserved by unpaid orders", ErrInvalidVariants)
+	}
+	if len(product.Options) > 3 {
+		return fmt.Errorf("%w: at most 3 options are allowed", ErrInvalidVariants)
+	}
+
+	names := make(map[string]bool, len(product.Options))
+	for i, option := range product.Options {
+		option.Name = strings.TrimSpace(option.Name)
+		if option.Name == "" || names[strings.ToLower(option.Name)] {
+			return fmt.Errorf("%w: option names must be unique and not empty", ErrInvalidVariants)
+		}
+		names[strings.ToLower(option.Name)] = true
+
+		values := make(map[string]bool, len(option.Values))
+		for j, value := range option.Values {
+			value = strings.TrimSpace(value)
+			if value == "" || values[strings.ToLower(value)] {
+				return fmt.Errorf("%w: values of %s must be unique and not empty", ErrInvalidVariants, option.Name)
+			}
+			values[strings.ToLower(value)] = true
+			option.Values[j] = value
+		}
+		if len(option.Values) == 0 {
+			return fmt.Errorf("%w: %s needs at least one value", ErrInvalidVariants, option.Name)
+		}
+		product.Options[i] = option
+	}
+
+	ids := make(map[string]bool, len(product.Variants))
+	combinations := make(map[string]bool, len(product.Variants))
+	skus := make(map[string]bool, len(product.Variants))
+	for i := range product.Variants {
+		variant := &product.Variants[i]
+
+		options := make(map[string]string, len(product.Options))
+		for _, option := range product.Options {
+			value := strings.TrimSpace(variant.Options[option.Name])
+			if !containsString(option.Values, value) {
+				return fmt.Errorf("%w: each variant needs one of the %s values", ErrInvalidVariants, option.Name)
+			}
+			options[option.Name] = value
+		}
+		if len(variant.Options) != len(options) {
+			return fmt.Errorf("%w: variants may only use the product's options", ErrInvalidVariants)
+		}
+		variant.Options = options
+
+		label := variant.Label(product.Options)
+		if combinations[label] {
+			return fmt.Errorf("%w: %s is listed twice", ErrInvalidVariants, label)
+		}
+		combinations[label] = true
+
+		if variant.ID == "" {
+			variant.ID = variantSlug(label)
+		}
+		if ids[variant.ID] {
+			return fmt.Errorf("%w: variant ID %s is used twice", ErrInvalidVariants, variant.ID)
+		}
+		ids[variant.ID] = true
+
+		variant.SKU = strings.TrimSpace(variant.SKU)
+		if variant.SKU != "" {
+			if skus[variant.SKU] {
+				return fmt.Errorf("%w: SKU %s is used twice", ErrInvalidVariants, variant.SKU)
+			}
+			skus[variant.SKU] = true
+		}
+
+		if variant.Stock < 0 || variant.Price < 0 || variant.PriceMinor < 0 {
+			return fmt.Errorf("%w: variant stock and prices cannot be negative", ErrInvalidVariants)
+		}
+		for _, url := range variant.Images {
+			if !containsString(product.Images, url) {
+				return fmt.Errorf("%w: variant images must be among the product's images", ErrInvalidVariants)
+			}
+		}
+		if variant.PriceMinor == 0 && variant.Price > 0 {
+			variant.PriceMinor = ToMinorUnits(variant.Price, product.Currency)
+		}
+		variant.Price = FromMinorUnits(variant.PriceMinor, product.Currency)
+
+		variant.ReservedStock = 0
+		if existing != nil {
+			if previous := existing.Variant(variant.ID); previous != nil {
+				variant.ReservedStock = previous.ReservedStock
+			}
+		}
+	}
+
+	if existing != nil {
+		for _, previous := range existing.Variants {
+			if previous.ReservedStock > 0 && !ids[previous.ID] {
+				return fmt.Errorf("%w: variant %s has reserved stock and cannot be removed", ErrInvalidVariants, previous.ID)
+			}
+		}
+	}
+
+	product.SyncStock()
+	return nil
+}
+
+// UpdateProductVariants writes a product update that replaces its options or variants.
+// The variants are normalized again against the product as read in the transaction,
+// so reservations made by checkouts since the caller read it are kept, and the stock
+// and status follow from them. A status already in updates is kept.
+func (fs *FirestoreService) UpdateProductVariants(productID string, varied *models.Product, updates map[string]interface{}) error {
+	ref := fs.client.Collection(ProductsCollection).Doc(productID)
+
+	return fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var current models.Product
+		if err := doc.DataTo(&current); err != nil {
+			return err
+		}
+
+		product := *varied
+		product.Images = current.Images
+		product.Status = current.Status
+		product.Stock = current.Stock
+		product.Fulfillment = current.Fulfillment
+		product.Variants = append([]models.ProductVariant(nil), varied.Variants...)
+		if mode, ok := updates["fulfillment"].(models.FulfillmentMode); ok {
+			product.Fulfillment = mode
+		}
+		if err := NormalizeVariants(&product, &current); err != nil {
+			return err
+		}
+		if len(product.Variants) == 0 {
+			switch stock := updates["stock"].(type) {
+			case float64:
+				product.Stock = int(stock)
+			case int:
+				product.Stock = stock
+			}
+			product.SyncStock()
+		}
+
+		writes := []firestore.Update{
+			{Path: "options", Value: product.Options},
+			{Path: "variants", Value: product.Variants},
+			{Path: "updated_at", Value: time.Now()},
+		}
+		if len(product.Variants) > 0 {
+			writes = append(writes,
+				firestore.Update{Path: "stock", Value: product.Stock},
+				firestore.Update{Path: "reserved_stock", Value: product.ReservedStock},
+			)
+			delete(updates, "stock")
+		}
+		if _, ok := updates["status"]; !ok && product.Status != current.Status {
+			writes = append(writes, firestore.Update{Path: "status", Value: product.Status})
+		}
+		for key, value := range updates {
+			switch key {
+			case "options", "variants", "reserved_stock", "updated_at":
+				continue
+			}
+			writes = append(writes, firestore.Update{Path: key, Value: value})
+		}
+		return tx.Update(ref, writes)
+	})
+}
+
+// variantSlug builds a variant ID from its option values, e.g. "M / Indigo" -> "m-indigo"
+func variantSlug(label string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(label) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
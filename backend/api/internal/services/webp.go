@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// The standard library has no WebP support, so WebP renditions and WebP uploads go
+// through a pluggable codec. Without one, renditions are JPEG/PNG only and WebP
+// uploads are refused.
+
+// WebPCodec encodes and decodes WebP images
+type WebPCodec interface {
+	EncodeWebP(img image.Image, quality int) ([]byte, error)
+	DecodeWebP(data []byte) (image.Image, error)
+}
+
+// webpToolTimeout bounds a single cwebp/dwebp run
+const webpToolTimeout = 30 * time.Second
+
+// CLIWebPCodec runs the cwebp and dwebp tools from libwebp
+type CLIWebPCodec struct {
+	cwebp string
+	dwebp string
+}
+
+// NewCLIWebPCodec finds cwebp and dwebp on the PATH
+func NewCLIWebPCodec() (*CLIWebPCodec, error) {
+	cwebp, err := exec.LookPath("cwebp")
+	if err != nil {
+		return nil, fmt.Errorf("cwebp not found: %v", err)
+	}
+	dwebp, err := exec.LookPath("dwebp")
+	if err != nil {
+		return nil, fmt.Errorf("dwebp not found: %v", err)
+	}
+	return &CLIWebPCodec{cwebp: cwebp, dwebp: dwebp}, nil
+}
+
+func (c *CLIWebPCodec) EncodeWebP(img image.Image, quality int) ([]byte, error) {
+	var input bytes.Buffer
+	if err := png.Encode(&input, img); err != nil {
+		return nil, err
+	}
+	return c.run(input.Bytes(), "in.png", "out.webp", func(in, out string) []string {
+		return []string{c.cwebp, "-quiet", "-q", fmt.Sprint(quality), in, "-o", out}
+	})
+}
+
+func (c *CLIWebPCodec) DecodeWebP(data []byte) (image.Image, error) {
+	output, err := c.run(data, "in.webp", "out.png", func(in, out string) []string {
+		return []string{c.dwebp, "-quiet", in, "-o", out}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(output))
+}
+
+// run writes input to a scratch directory, runs the tool and returns its output file
+func (c *CLIWebPCodec) run(input []byte, inName, outName string, command func(in, out string) []string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "webp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, inName), filepath.Join(dir, outName)
+	if err := os.WriteFile(in, input, 0o600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webpToolTimeout)
+	defer cancel()
+
+	args := command(in, out)
+	if output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", filepath.Base(args[0]), err, bytes.TrimSpace(output))
+	}
+	return os.ReadFile(out)
+}
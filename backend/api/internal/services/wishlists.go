@@ -0,0 +1,429 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"voicecraft-market/internal/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Every buyer has a default "Saved" wishlist, created the first time something is
+// saved to it, and can add named lists of their own. Each saved product is a
+// wishlist_items document so the buyers watching a product can be queried.
+
+// DefaultWishlistID is the alias for a buyer's default wishlist
+const DefaultWishlistID = "default"
+
+var (
+	// ErrWishlistNotFound is returned for wishlists that do not exist or belong to someone else
+	ErrWishlistNotFound = errors.New("wishlist not found")
+	// ErrDefaultWishlist is returned when the default wishlist would be renamed or deleted
+	ErrDefaultWishlist = errors.New("the default wishlist cannot be renamed or deleted")
+)
+
+// wishlistDocID resolves the default alias to the buyer's own default wishlist
+func wishlistDocID(userID, wishlistID string) string {
+	if wishlistID == DefaultWishlistID || wishlistID == userID+"_saved" {
+		return userID + "_saved"
+	}
+	return wishlistID
+}
+
+func wishlistItemDocID(wishlistID, productID string) string {
+	return wishlistID + "_" + productID
+}
+
+// getWishlistForUpdate reads a buyer's wishlist inside a transaction. The default
+// wishlist is returned unsaved when it does not exist yet.
+func (fs *FirestoreService) getWishlistForUpdate(tx *firestore.Transaction, userID, wishlistID string) (*models.Wishlist, bool, error) {
+	wishlistID = wishlistDocID(userID, wishlistID)
+	doc, err := tx.Get(fs.client.Collection(WishlistsCollection).Doc(wishlistID))
+	if err != nil {
+		if isNotFound(err) && wishlistID == userID+"_saved" {
+			now := time.Now()
+			return &models.Wishlist{ID: wishlistID, UserID: userID, Name: "Saved", CreatedAt: now, UpdatedAt: now}, false, nil
+		}
+		if isNotFound(err) {
+			return nil, false, ErrWishlistNotFound
+		}
+		return nil, false, err
+	}
+
+	var wishlist models.Wishlist
+	if err := doc.DataTo(&wishlist); err != nil {
+		return nil, false, err
+	}
+	if wishlist.UserID != userID {
+		return nil, false, ErrWishlistNotFound
+	}
+	return &wishlist, true, nil
+}
+
+// CreateWishlist creates a named wishlist for a buyer
+func (fs *FirestoreService) CreateWishlist(userID, name string) (*models.Wishlist, error) {
+	ref := fs.client.Collection(WishlistsCollection).NewDoc()
+	now := time.Now()
+	wishlist := &models.Wishlist{
+		ID:        ref.ID,
+		UserID:    userID,
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if _, err := ref.Create(fs.ctx, wishlist); err != nil {
+		return nil, err
+	}
+	return wishlist, nil
+}
+
+// GetWishlist returns one of a buyer's wishlists
+func (fs *FirestoreService) GetWishlist(userID, wishlistID string) (*models.Wishlist, error) {
+	var wishlist *models.Wishlist
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		wishlist, _, err = fs.getWishlistForUpdate(tx, userID, wishlistID)
+		return err
+	})
+	return wishlist, err
+}
+
+// GetWishlists lists a buyer's wishlists, the default one first
+func (fs *FirestoreService) GetWishlists(userID string) ([]models.Wishlist, error) {
+	iter := fs.client.Collection(WishlistsCollection).
+		Where("user_id", "==", userID).
+		OrderBy("created_at", firestore.Asc).
+		Documents(fs.ctx)
+	defer iter.Stop()
+
+	wishlists := []models.Wishlist{}
+	hasDefault := false
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var wishlist models.Wishlist
+		if err := doc.DataTo(&wishlist); err != nil {
+			continue
+		}
+		if wishlist.ID == wishlistDocID(userID, DefaultWishlistID) {
+			hasDefault = true
+			wishlists = append([]models.Wishlist{wishlist}, wishlists...)
+			continue
+		}
+		wishlists = append(wishlists, wishlist)
+	}
+
+	if !hasDefault {
+		wishlists = append([]models.Wishlist{{ID: wishlistDocID(userID, DefaultWishlistID), UserID: userID, Name: "Saved"}}, wishlists...)
+	}
+	return wishlists, nil
+}
+
+// RenameWishlist changes the name of one of a buyer's wishlists
+func (fs *FirestoreService) RenameWishlist(userID, wishlistID, name string) (*models.Wishlist, error) {
+	if wishlistDocID(userID, wishlistID) == wishlistDocID(userID, DefaultWishlistID) {
+		return nil, ErrDefaultWishlist
+	}
+
+	var wishlist *models.Wishlist
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		var err error
+		if wishlist, _, err = fs.getWishlistForUpdate(tx, userID, wishlistID); err != nil {
+			return err
+		}
+		wishlist.Name = name
+		wishlist.UpdatedAt = time.Now()
+		return tx.Update(fs.client.Collection(WishlistsCollection).Doc(wishlist.ID), []firestore.Update{
+			{Path: "name", Value: name},
+			{Path: "updated_at", Value: wishlist.UpdatedAt},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wishlist, nil
+}
+
+// DeleteWishlist deletes one of a buyer's wishlists and everything saved to it
+func (fs *FirestoreService) DeleteWishlist(userID, wishlistID string) error {
+	if wishlistDocID(userID, wishlistID) == wishlistDocID(userID, DefaultWishlistID) {
+		return ErrDefaultWishlist
+	}
+
+	return fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		wishlist, _, err := fs.getWishlistForUpdate(tx, userID, wishlistID)
+		if err != nil {
+			return err
+		}
+
+		items, err := tx.Documents(fs.client.Collection(WishlistItemsCollection).
+			Where("wishlist_id", "==", wishlist.ID)).GetAll()
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if err := tx.Delete(item.Ref); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(fs.client.Collection(WishlistsCollection).Doc(wishlist.ID))
+	})
+}
+
+// AddWishlistItem saves a product to a buyer's wishlist. Saving a product twice is a
+// no-op; it reports whether anything changed.
+func (fs *FirestoreService) AddWishlistItem(userID, wishlistID string, product *models.Product) (*models.WishlistItem, bool, error) {
+	var item *models.WishlistItem
+	changed := false
+	err := fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = false
+
+		wishlist, exists, err := fs.getWishlistForUpdate(tx, userID, wishlistID)
+		if err != nil {
+			return err
+		}
+
+		itemRef := fs.client.Collection(WishlistItemsCollection).Doc(wishlistItemDocID(wishlist.ID, product.ID))
+		doc, err := tx.Get(itemRef)
+		if err == nil {
+			item = &models.WishlistItem{}
+			return doc.DataTo(item)
+		}
+		if !isNotFound(err) {
+			return err
+		}
+
+		price := ProductPrice(product)
+		now := time.Now()
+		item = &models.WishlistItem{
+			ID:         itemRef.ID,
+			WishlistID: wishlist.ID,
+			UserID:     userID,
+			ProductID:  product.ID,
+			AddedPrice: &price,
+			AddedAt:    now,
+		}
+
+		wishlistRef := fs.client.Collection(WishlistsCollection).Doc(wishlist.ID)
+		if !exists {
+			wishlist.ItemCount = 1
+			wishlist.UpdatedAt = now
+			if err := tx.Create(wishlistRef, wishlist); err != nil {
+				return err
+			}
+		} else if err := tx.Update(wishlistRef, []firestore.Update{
+			{Path: "item_count", Value: firestore.Increment(1)},
+			{Path: "updated_at", Value: now},
+		}); err != nil {
+			return err
+		}
+
+		changed = true
+		return tx.Create(itemRef, item)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return item, changed, nil
+}
+
+// RemoveWishlistItem removes a product from a buyer's wishlist; removing a product
+// that is not saved is a no-op
+func (fs *FirestoreService) RemoveWishlistItem(userID, wishlistID, productID string) error {
+	return fs.RunTransaction(func(ctx context.Context, tx *firestore.Transaction) error {
+		wishlist, exists, err := fs.getWishlistForUpdate(tx, userID, wishlistID)
+		if err != nil || !exists {
+			return err
+		}
+
+		itemRef := fs.client.Collection(WishlistItemsCollection).Doc(wishlistItemDocID(wishlist.ID, productID))
+		if _, err := tx.Get(itemRef); err != nil {
+			if isNotFound(err) {
+				return nil
+			}
+			return err
+		}
+
+		if err := tx.Delete(itemRef); err != nil {
+			return err
+		}
+		return tx.Update(fs.client.Collection(WishlistsCollection).Doc(wishlist.ID), []firestore.Update{
+			{Path: "item_count", Value: firestore.Increment(-1)},
+			{Path: "updated_at", Value: time.Now()},
+		})
+	})
+}
+
+// getWishlistItems runs a wishlist items query and decodes the results
+func (fs *FirestoreService) getWishlistItems(query firestore.Query) ([]models.WishlistItem, error) {
+	iter := query.Documents(fs.ctx)
+	defer iter.Stop()
+
+	items := []models.WishlistItem{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var item models.WishlistItem
+		if err := doc.DataTo(&item); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// GetWishlistItems lists the products saved to a wishlist, most recent first
+func (fs *FirestoreService) GetWishlistItems(wishlistID string) ([]models.WishlistItem, error) {
+	return fs.getWishlistItems(fs.client.Collection(WishlistItemsCollection).
+		Where("wishlist_id", "==", wishlistID).
+		OrderBy("added_at", firestore.Desc))
+}
+
+// GetProductWatcherIDs lists the buyers who saved a product to any of their wishlists
+func (fs *FirestoreService) GetProductWatcherIDs(productID string) ([]string, error) {
+	items, err := fs.getWishlistItems(fs.client.Collection(WishlistItemsCollection).Where("product_id", "==", productID))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var userIDs []string
+	for _, item := range items {
+		if !seen[item.UserID] {
+			seen[item.UserID] = true
+			userIDs = append(userIDs, item.UserID)
+		}
+	}
+	return userIDs, nil
+}
+
+// ClaimWishlistAlert records that a buyer is being alerted about a product today. It
+// returns false when they already had an alert for it today.
+func (fs *FirestoreService) ClaimWishlistAlert(userID, productID, kind string, now time.Time) (bool, error) {
+	day := now.UTC().Format("2006-01-02")
+	_, err := fs.client.Collection(WishlistAlertsCollection).Doc(fmt.Sprintf("%s_%s_%s", userID, productID, day)).Create(fs.ctx, map[string]interface{}{
+		"user_id":    userID,
+		"product_id": productID,
+		"kind":       kind,
+		"day":        day,
+		"created_at": now,
+	})
+	if err != nil {
+		if isAlreadyExists(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// WishlistWatcher alerts buyers when a product on their wishlist drops in price or
+// comes back in stock, at most once per product per buyer per day
+type WishlistWatcher struct {
+	firestoreService    *FirestoreService
+	notificationService *NotificationService
+}
+
+func NewWishlistWatcher(firestoreService *FirestoreService, notificationService *NotificationService) *WishlistWatcher {
+	return &WishlistWatcher{
+		firestoreService:    firestoreService,
+		notificationService: notificationService,
+	}
+}
+
+// ProductChanged compares a product before and after an update and sends any alerts
+func (w *WishlistWatcher) ProductChanged(before, after *models.Product) {
+	if !after.Status.IsPublic() {
+		return
+	}
+
+	oldPrice, newPrice := ProductPrice(before), ProductPrice(after)
+	if oldPrice.Currency == newPrice.Currency && newPrice.Amount < oldPrice.Amount {
+		w.alert(after, "price_drop", func(token string) error {
+			return w.notificationService.SendReminderNotification(token, "wishlist_sale", map[string]string{
+				"type":           "wishlist_sale",
+				"product_id":     after.ID,
+				"product_title":  after.Title,
+				"price":          fmt.Sprintf("%.2f", FromMinorUnits(newPrice.Amount, newPrice.Currency)),
+				"previous_price": fmt.Sprintf("%.2f", FromMinorUnits(oldPrice.Amount, oldPrice.Currency)),
+				"currency":       newPrice.Currency,
+			})
+		})
+		return
+	}
+
+	if before.Stock <= 0 && after.Stock > 0 {
+		w.backInStock(after)
+	}
+}
+
+// StockChanged sends back-in-stock alerts for a product whose stock was previousStock
+// before a change, as returned by UpdateProductStock
+func (w *WishlistWatcher) StockChanged(productID string, previousStock int) {
+	if previousStock > 0 {
+		return
+	}
+	product, err := w.firestoreService.GetProduct(productID)
+	if err != nil || product.Stock <= 0 || !product.Status.IsPublic() {
+		return
+	}
+	w.backInStock(product)
+}
+
+func (w *WishlistWatcher) backInStock(product *models.Product) {
+	artisanName := "An artisan"
+	if artisan, err := w.firestoreService.GetUser(product.ArtisanID); err == nil && artisan.Name != "" {
+		artisanName = artisan.Name
+	}
+
+	w.alert(product, "back_in_stock", func(token string) error {
+		return w.notificationService.SendArtisanNotification(token, artisanName, "back_in_stock")
+	})
+}
+
+// alert sends to every buyer watching the product who has not had an alert for it today
+func (w *WishlistWatcher) alert(product *models.Product, kind string, send func(token string) error) {
+	userIDs, err := w.firestoreService.GetProductWatcherIDs(product.ID)
+	if err != nil {
+		log.Printf("Failed to load wishlists for product %s: %v", product.ID, err)
+		return
+	}
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		claimed, err := w.firestoreService.ClaimWishlistAlert(userID, product.ID, kind, now)
+		if err != nil {
+			log.Printf("Failed to record %s alert for product %s: %v", kind, product.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		user, err := w.firestoreService.GetUser(userID)
+		if err != nil || user.FCMToken == "" {
+			continue
+		}
+		if err := send(user.FCMToken); err != nil {
+			log.Printf("Failed to send %s alert for product %s to user %s: %v", kind, product.ID, userID, err)
+		}
+	}
+}
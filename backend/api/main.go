@@ -54,7 +54,11 @@ func main() {
 	defer firestoreService.Close()
 
 	// Initialize services
-	storageService, err := services.NewStorageService(ctx, cfg.GCSBucketName, cfg.GCSBucketAudio, cfg.GCSBucketImages)
+	signedURLExpiry, err := time.ParseDuration(cfg.SignedURLExpiry)
+	if err != nil {
+		log.Fatalf("Invalid SIGNED_URL_EXPIRY: %v", err)
+	}
+	storageService, err := services.NewStorageService(ctx, cfg.GCSBucketName, cfg.GCSBucketAudio, cfg.GCSBucketImages, cfg.GCSUniformAccess, signedURLExpiry)
 	if err != nil {
 		log.Fatalf("Failed to initialize Storage service: %v", err)
 	}
@@ -66,7 +70,25 @@ func main() {
 	}
 	defer speechService.Close()
 
-	aiService, err := services.NewVertexAIService(ctx, cfg.GoogleProjectID, cfg.VertexAILocation, cfg.VertexAIModel)
+	// Initialize prompt templates
+	var promptSource services.PromptTemplateSource
+	switch cfg.PromptTemplateSource {
+	case "file":
+		if cfg.PromptTemplatesFile == "" {
+			log.Fatalf("PROMPT_TEMPLATES_FILE is required when PROMPT_TEMPLATE_SOURCE=file")
+		}
+		promptSource = services.NewFilePromptSource(cfg.PromptTemplatesFile)
+	case "firestore":
+		promptSource = services.NewFirestorePromptSource(firestoreService)
+	default:
+		log.Fatalf("Unknown prompt template source: %s", cfg.PromptTemplateSource)
+	}
+	prompts := services.NewPromptLibrary(promptSource, 5*time.Minute)
+	if _, err := prompts.Templates(ctx); err != nil {
+		log.Fatalf("Failed to load prompt templates: %v", err)
+	}
+
+	aiService, err := services.NewVertexAIService(ctx, cfg.GoogleProjectID, cfg.VertexAILocation, cfg.VertexAIModel, prompts)
 	if err != nil {
 		log.Fatalf("Failed to initialize AI service: %v", err)
 	}
@@ -74,12 +96,225 @@ func main() {
 
 	notificationService := services.NewNotificationService(ctx, authClient, messagingClient)
 
+	// Initialize payments
+	var paymentProvider services.PaymentProvider
+	switch cfg.PaymentProvider {
+	case "razorpay":
+		paymentProvider = services.NewRazorpayProvider(cfg.RazorpayKeyID, cfg.RazorpayKeySecret, cfg.RazorpayWebhookSecret)
+	case "fake":
+		// Anyone who knows the secret can confirm orders, so it must be chosen on purpose
+		if !cfg.AllowFakePayments {
+			log.Fatalf("PAYMENT_PROVIDER=fake confirms orders without collecting payment; set ALLOW_FAKE_PAYMENTS=true to use it")
+		}
+		if cfg.FakePaymentSecret == "" {
+			log.Fatalf("FAKE_PAYMENT_SECRET is required when PAYMENT_PROVIDER=fake")
+		}
+		log.Println("Using the fake payment provider; payments are not collected")
+		paymentProvider = services.NewFakePaymentProvider(cfg.FakePaymentSecret)
+	default:
+		log.Fatalf("Unknown payment provider: %s", cfg.PaymentProvider)
+	}
+
+	paymentExpiry, err := time.ParseDuration(cfg.PaymentExpiry)
+	if err != nil {
+		log.Fatalf("Invalid PAYMENT_EXPIRY: %v", err)
+	}
+	invoiceService := services.NewInvoiceService(firestoreService, storageService)
+	paymentService := services.NewPaymentService(firestoreService, notificationService, invoiceService, paymentProvider, paymentExpiry)
+
+	// Cancel orders that are not paid in time and release their stock
+	sweeperCtx, stopSweeper := context.WithCancel(ctx)
+	defer stopSweeper()
+	go paymentService.RunExpirySweeper(sweeperCtx, time.Minute)
+
+	// Initialize shipment tracking
+	var carriers []services.CarrierAdapter
+	if cfg.FakeCarrierEnabled {
+		// Anyone who knows the secret can mark orders delivered
+		if cfg.FakeCarrierSecret == "" {
+			log.Fatalf("FAKE_CARRIER_SECRET is required when FAKE_CARRIER_ENABLED=true")
+		}
+		log.Println("Using the fake carrier; its shipments are simulated")
+		carriers = append(carriers, services.NewFakeCarrier(cfg.FakeCarrierSecret, 48*time.Hour))
+	}
+
+	trackingPollInterval, err := time.ParseDuration(cfg.TrackingPollInterval)
+	if err != nil {
+		log.Fatalf("Invalid TRACKING_POLL_INTERVAL: %v", err)
+	}
+	trackingService := services.NewTrackingService(firestoreService, notificationService, carriers...)
+	go trackingService.RunTrackingPoller(sweeperCtx, trackingPollInterval)
+
+	// Initialize shipping rates
+	shippingRates := services.DefaultShippingRateCard()
+	if cfg.ShippingRatesFile != "" {
+		if shippingRates, err = services.LoadShippingRateCard(cfg.ShippingRatesFile); err != nil {
+			log.Fatalf("Failed to load shipping rates: %v", err)
+		}
+	}
+	shippingCalculator := services.NewShippingCalculator(shippingRates)
+
+	// Initialize GST rates
+	taxRates := services.DefaultTaxRateCard()
+	if cfg.TaxRatesFile != "" {
+		if taxRates, err = services.LoadTaxRateCard(cfg.TaxRatesFile); err != nil {
+			log.Fatalf("Failed to load tax rates: %v", err)
+		}
+	}
+
+	// Initialize currency conversion
+	var rateSource services.ExchangeRateSource
+	switch cfg.CurrencyRateSource {
+	case "file":
+		if cfg.ExchangeRatesFile == "" {
+			log.Fatalf("EXCHANGE_RATES_FILE is required when CURRENCY_RATE_SOURCE=file")
+		}
+		rateSource = services.NewFileRateSource(cfg.ExchangeRatesFile)
+	case "firestore":
+		rateSource = services.NewFirestoreRateSource(firestoreService)
+	default:
+		log.Fatalf("Unknown currency rate source: %s", cfg.CurrencyRateSource)
+	}
+	currencyService, err := services.NewCurrencyService(rateSource, cfg.BaseCurrency, 5*time.Minute)
+	if err != nil {
+		log.Fatalf("Invalid BASE_CURRENCY: %v", err)
+	}
+	if rates, err := currencyService.Rates(ctx); err != nil {
+		log.Fatalf("Failed to load exchange rates: %v", err)
+	} else if rates.Base != currencyService.Base() {
+		log.Fatalf("Exchange rates are quoted against %s but BASE_CURRENCY is %s", rates.Base, currencyService.Base())
+	}
+	if shippingRates.Currency != currencyService.Base() {
+		log.Fatalf("Shipping rates are in %s but BASE_CURRENCY is %s", shippingRates.Currency, currencyService.Base())
+	}
+
+	pricing := &services.OrderPricing{
+		Currency: currencyService,
+		Shipping: shippingCalculator,
+		Tax:      services.NewTaxCalculator(taxRates),
+	}
+
+	// Product photos are resized into renditions; WebP needs an external encoder
+	var webpCodec services.WebPCodec
+	switch cfg.ImageWebPEncoder {
+	case "":
+	case "cwebp":
+		codec, err := services.NewCLIWebPCodec()
+		if err != nil {
+			log.Printf("WebP renditions disabled: %v", err)
+		} else {
+			webpCodec = codec
+		}
+	default:
+		log.Fatalf("Unknown IMAGE_WEBP_ENCODER %q", cfg.ImageWebPEncoder)
+	}
+	var imageEnhancer services.ImageEnhancer
+	switch cfg.ImageEnhancer {
+	case "":
+	case "basic":
+		imageEnhancer = services.NewBasicEnhancer()
+	case "imagen":
+		enhancer, err := services.NewImagenEnhancer(ctx, cfg.GoogleProjectID, cfg.VertexAILocation, cfg.ImagenEditModel)
+		if err != nil {
+			log.Fatalf("Failed to initialize Imagen enhancer: %v", err)
+		}
+		defer enhancer.Close()
+		imageEnhancer = enhancer
+	default:
+		log.Fatalf("Unknown IMAGE_ENHANCER %q", cfg.ImageEnhancer)
+	}
+	imagePipeline := services.NewImagePipeline(storageService, webpCodec, imageEnhancer)
+
+	// Product images can be generated from prompts and are held for the artisan's approval
+	var imageGenerator services.ImageGenerator
+	switch cfg.ImageGenerator {
+	case "":
+	case "placeholder":
+		// Placeholder drawings would reach the gallery as AI-generated photos, so they must be chosen on purpose
+		if !cfg.AllowPlaceholderImages {
+			log.Fatalf("IMAGE_GENERATOR=placeholder draws stand-in images for development; set ALLOW_PLACEHOLDER_IMAGES=true to use it")
+		}
+		log.Println("Using the placeholder image generator; generated images are not real product images")
+		imageGenerator = services.NewPlaceholderImageGenerator()
+	case "imagen":
+		imagen, err := services.NewImagenGenerator(ctx, cfg.GoogleProjectID, cfg.VertexAILocation, cfg.ImagenModel)
+		if err != nil {
+			log.Fatalf("Failed to initialize Imagen: %v", err)
+		}
+		defer imagen.Close()
+		imageGenerator = imagen
+	default:
+		log.Fatalf("Unknown IMAGE_GENERATOR %q", cfg.ImageGenerator)
+	}
+	imageGenerationService := services.NewImageGenerationService(firestoreService, imagePipeline, imageGenerator)
+
+	// Delete images that nothing refers to any more, sparing a day of new uploads
+	imageGCInterval, err := time.ParseDuration(cfg.ImageGCInterval)
+	if err != nil {
+		log.Fatalf("Invalid IMAGE_GC_INTERVAL: %v", err)
+	}
+	if imageGCInterval > 0 {
+		storageSweeper := services.NewStorageSweeper(firestoreService, storageService, 24*time.Hour)
+		go storageSweeper.RunSweeper(sweeperCtx, imageGCInterval)
+	}
+
+	// Uploads are checked by content against the configured types and limits
+	maxAudioSize, err := config.ParseSize(cfg.MaxAudioSize)
+	if err != nil {
+		log.Fatalf("Invalid MAX_AUDIO_SIZE: %v", err)
+	}
+	maxImageSize, err := config.ParseSize(cfg.MaxImageSize)
+	if err != nil {
+		log.Fatalf("Invalid MAX_IMAGE_SIZE: %v", err)
+	}
+	var malwareScanner services.MalwareScanner
+	switch cfg.MalwareScanner {
+	case "":
+	case "clamd":
+		malwareScanner = services.NewClamdScanner(cfg.ClamdAddress)
+	default:
+		log.Fatalf("Unknown MALWARE_SCANNER %q", cfg.MalwareScanner)
+	}
+	uploadValidator := services.NewUploadValidator(
+		services.UploadPolicy{AllowedTypes: cfg.AllowedAudioTypes, MaxSize: maxAudioSize},
+		services.UploadPolicy{
+			AllowedTypes: cfg.AllowedImageTypes,
+			MaxSize:      maxImageSize,
+			MaxDimension: cfg.MaxImageDimension,
+			MaxPixels:    int64(cfg.MaxImagePixels),
+		},
+		malwareScanner,
+	)
+
+	// Large files go straight to Cloud Storage and are checked when finalized
+	uploadSessionExpiry, err := time.ParseDuration(cfg.UploadSessionExpiry)
+	if err != nil {
+		log.Fatalf("Invalid UPLOAD_SESSION_EXPIRY: %v", err)
+	}
+	uploadSessionService := services.NewUploadSessionService(firestoreService, storageService, uploadValidator, imagePipeline, uploadSessionExpiry)
+
+	// Alert buyers about price drops and restocks on their wishlists
+	wishlistWatcher := services.NewWishlistWatcher(firestoreService, notificationService)
+
 	// Initialize handlers
-	productHandler := handlers.NewProductHandler(firestoreService, storageService, aiService)
-	voiceHandler := handlers.NewVoiceHandler(speechService, aiService, firestoreService, storageService)
+	productHandler := handlers.NewProductHandler(firestoreService, storageService, aiService, notificationService, currencyService, wishlistWatcher, imagePipeline, uploadValidator, imageGenerationService)
+	voiceHandler := handlers.NewVoiceHandler(speechService, aiService, firestoreService, storageService, uploadValidator)
 	authHandler := handlers.NewAuthHandler(authClient, firestoreService)
-	artisanHandler := handlers.NewArtisanHandler(firestoreService, storageService)
-	orderHandler := handlers.NewOrderHandler(firestoreService, notificationService)
+	artisanHandler := handlers.NewArtisanHandler(firestoreService, storageService, uploadValidator)
+	orderHandler := handlers.NewOrderHandler(firestoreService, notificationService, paymentService, trackingService, pricing, wishlistWatcher)
+	shippingHandler := handlers.NewShippingHandler(firestoreService, shippingCalculator, currencyService)
+	currencyHandler := handlers.NewCurrencyHandler(currencyService)
+	promptHandler := handlers.NewPromptHandler(aiService)
+	wishlistHandler := handlers.NewWishlistHandler(firestoreService, currencyService)
+	couponHandler := handlers.NewCouponHandler(firestoreService, notificationService, pricing)
+	invoiceHandler := handlers.NewInvoiceHandler(firestoreService, invoiceService)
+	trackingHandler := handlers.NewTrackingHandler(firestoreService, trackingService)
+	paymentHandler := handlers.NewPaymentHandler(firestoreService, paymentService)
+	refundHandler := handlers.NewRefundHandler(firestoreService, notificationService, paymentService, wishlistWatcher)
+	adminHandler := handlers.NewAdminHandler(firestoreService, notificationService)
+	reviewHandler := handlers.NewReviewHandler(firestoreService, storageService, uploadValidator)
+	followHandler := handlers.NewFollowHandler(firestoreService)
+	uploadHandler := handlers.NewUploadHandler(firestoreService, uploadSessionService)
 
 	// Setup Gin router
 	if cfg.GinMode == "release" {
@@ -109,11 +344,14 @@ func main() {
 			})
 		})
 
-		// Public product routes
-		v1.GET("/products", productHandler.GetProducts)
-		v1.GET("/products/:id", productHandler.GetProduct)
-		v1.GET("/products/search", productHandler.SearchProducts)
-		v1.GET("/artisans/:id/products", productHandler.GetProductsByArtisan)
+		// Public product routes; signed-in buyers see prices in their preferred currency
+		optionalAuth := middleware.OptionalAuthMiddleware(authClient)
+		v1.GET("/products", optionalAuth, productHandler.GetProducts)
+		v1.GET("/products/:id", optionalAuth, productHandler.GetProduct)
+		v1.GET("/products/search", optionalAuth, productHandler.SearchProducts)
+		v1.POST("/products/:id/share", productHandler.ShareProduct)
+		v1.GET("/products/:id/reviews", reviewHandler.GetProductReviews)
+		v1.GET("/artisans/:id/products", optionalAuth, productHandler.GetProductsByArtisan)
 
 		// Public artisan routes
 		v1.GET("/artisans", artisanHandler.GetArtisans)
@@ -121,7 +359,20 @@ func main() {
 
 		// Voice processing (public)
 		v1.POST("/voice/transcribe", voiceHandler.TranscribeAudio)
-		v1.POST("/voice/generate", voiceHandler.GenerateProduct)
+		v1.POST("/voice/generate", optionalAuth, voiceHandler.GenerateProduct)
+		v1.POST("/voice/generate/stream", optionalAuth, voiceHandler.GenerateProductStream)
+
+		// Display currencies and exchange rates
+		v1.GET("/currencies", currencyHandler.GetCurrencies)
+
+		// Shipping quotes for carts
+		v1.POST("/shipping/quote", shippingHandler.QuoteShipping)
+
+		// Payment provider webhooks (authenticated by signature)
+		v1.POST("/payments/webhook", paymentHandler.HandleWebhook)
+
+		// Carrier tracking webhooks (authenticated by signature)
+		v1.POST("/shipping/webhooks/:carrier", trackingHandler.HandleCarrierWebhook)
 	}
 
 	// Authentication required routes
@@ -132,11 +383,45 @@ func main() {
 		auth.GET("/profile", authHandler.GetProfile)
 		auth.PUT("/profile", authHandler.UpdateProfile)
 
+		// Product likes
+		auth.POST("/products/:id/like", productHandler.LikeProduct)
+		auth.DELETE("/products/:id/like", productHandler.UnlikeProduct)
+
+		// Reviews
+		auth.POST("/products/:id/reviews", reviewHandler.CreateReview)
+		auth.PUT("/reviews/:id", reviewHandler.UpdateReview)
+		auth.DELETE("/reviews/:id", reviewHandler.DeleteReview)
+		auth.POST("/reviews/:id/helpful", reviewHandler.MarkReviewHelpful)
+
+		// Wishlists ("default" is the buyer's default list)
+		auth.GET("/wishlists", wishlistHandler.GetWishlists)
+		auth.POST("/wishlists", wishlistHandler.CreateWishlist)
+		auth.GET("/wishlists/:id", wishlistHandler.GetWishlist)
+		auth.PUT("/wishlists/:id", wishlistHandler.RenameWishlist)
+		auth.DELETE("/wishlists/:id", wishlistHandler.DeleteWishlist)
+		auth.POST("/wishlists/:id/items", wishlistHandler.AddWishlistItem)
+		auth.DELETE("/wishlists/:id/items/:productId", wishlistHandler.RemoveWishlistItem)
+
+		// Follows and personalised feed
+		auth.POST("/artisans/:id/follow", followHandler.FollowArtisan)
+		auth.DELETE("/artisans/:id/follow", followHandler.UnfollowArtisan)
+		auth.GET("/following", followHandler.GetFollowing)
+		auth.GET("/feed", followHandler.GetFeed)
+
 		// Orders
 		auth.GET("/orders", orderHandler.GetUserOrders)
 		auth.POST("/orders", orderHandler.CreateOrder)
 		auth.GET("/orders/:id", orderHandler.GetOrder)
 		auth.PUT("/orders/:id/cancel", orderHandler.CancelOrder)
+		auth.POST("/orders/:id/payment/verify", paymentHandler.VerifyPayment)
+		auth.POST("/orders/:id/refunds", refundHandler.RequestRefund)
+		auth.GET("/orders/:id/refunds", refundHandler.GetOrderRefunds)
+		auth.GET("/orders/:id/tracking", trackingHandler.GetOrderTracking)
+		auth.GET("/orders/:id/invoices", invoiceHandler.GetOrderInvoices)
+		auth.GET("/invoices/:id/pdf", invoiceHandler.DownloadInvoice)
+
+		// Coupons
+		auth.POST("/coupons/validate", couponHandler.ValidateCoupon)
 	}
 
 	// Artisan routes
@@ -155,10 +440,42 @@ func main() {
 		artisan.PUT("/products/:id", productHandler.UpdateProduct)
 		artisan.DELETE("/products/:id", productHandler.DeleteProduct)
 		artisan.POST("/products/:id/images", productHandler.UploadProductImages)
+		artisan.PUT("/products/:id/images", productHandler.ReorderProductImages)
+		artisan.PUT("/products/:id/images/cover", productHandler.SetCoverImage)
+		artisan.DELETE("/products/:id/images/:imageId", productHandler.DeleteProductImage)
+		artisan.GET("/products/:id/generated-images", productHandler.GetGeneratedImages)
+		artisan.POST("/products/:id/generated-images", productHandler.GenerateProductImages)
+		artisan.POST("/products/:id/generated-images/:imageId/approve", productHandler.ApproveGeneratedImage)
+		artisan.DELETE("/products/:id/generated-images/:imageId", productHandler.RejectGeneratedImage)
+		artisan.GET("/products/:id/voice-story/audio", productHandler.GetVoiceStoryAudio)
+
+		// Direct-to-bucket uploads
+		artisan.POST("/uploads", uploadHandler.CreateUploadSession)
+		artisan.GET("/uploads/:id", uploadHandler.GetUploadSession)
+		artisan.POST("/uploads/:id/finalize", uploadHandler.FinalizeUpload)
 
 		// Order management
 		artisan.GET("/orders", orderHandler.GetArtisanOrders)
 		artisan.PUT("/orders/:id/status", orderHandler.UpdateOrderStatus)
+		artisan.PUT("/orders/:id/production", orderHandler.StartProduction)
+
+		// Refunds (admins review refunds spanning several artisans and retry failed ones)
+		artisan.GET("/refunds", refundHandler.GetRefunds)
+		artisan.PUT("/refunds/:id/approve", refundHandler.ApproveRefund)
+		artisan.PUT("/refunds/:id/reject", refundHandler.RejectRefund)
+		artisan.PUT("/refunds/:id/return-received", refundHandler.ReceiveReturn)
+
+		// Review replies
+		artisan.PUT("/reviews/:id/reply", reviewHandler.ReplyToReview)
+
+		// Coupons for the artisan's own products
+		artisan.GET("/coupons", couponHandler.GetArtisanCoupons)
+		artisan.POST("/coupons", couponHandler.CreateArtisanCoupon)
+		artisan.PUT("/coupons/:id", couponHandler.UpdateCoupon)
+
+		// Sales analytics
+		artisan.GET("/analytics", artisanHandler.GetAnalytics)
+		artisan.GET("/analytics/products/:id", artisanHandler.GetProductAnalytics)
 	}
 
 	// Admin routes
@@ -167,10 +484,7 @@ func main() {
 	admin.Use(middleware.AdminMiddleware())
 	{
 		// Admin dashboard stats
-		admin.GET("/stats", func(c *gin.Context) {
-			// TODO: Implement admin stats
-			c.JSON(http.StatusOK, gin.H{"message": "Admin stats endpoint"})
-		})
+		admin.GET("/stats", adminHandler.GetStats)
 
 		// User management
 		admin.GET("/users", authHandler.GetAllUsers)
@@ -178,11 +492,28 @@ func main() {
 		admin.DELETE("/users/:id", authHandler.DeleteUser)
 
 		// Product moderation
-		admin.GET("/products/pending", productHandler.GetProducts) // Filter pending products
-		admin.PUT("/products/:id/approve", func(c *gin.Context) {
-			// TODO: Implement product approval
-			c.JSON(http.StatusOK, gin.H{"message": "Product approved"})
-		})
+		admin.GET("/products/pending", adminHandler.GetPendingProducts)
+		admin.PUT("/products/:id/approve", adminHandler.ApproveProduct)
+		admin.PUT("/products/:id/reject", adminHandler.RejectProduct)
+		admin.PUT("/products/:id/request-changes", adminHandler.RequestProductChanges)
+		admin.GET("/products/:id/moderation", adminHandler.GetProductModerationHistory)
+
+		// Refunds
+		admin.GET("/refunds", refundHandler.GetRefunds)
+
+		// Coupons (platform coupons apply across artisans)
+		admin.GET("/coupons", couponHandler.GetAllCoupons)
+		admin.POST("/coupons", couponHandler.CreatePlatformCoupon)
+		admin.PUT("/coupons/:id", couponHandler.UpdateCoupon)
+
+		// Exchange rates
+		admin.GET("/exchange-rates", currencyHandler.GetExchangeRates)
+		admin.PUT("/exchange-rates", currencyHandler.UpdateExchangeRates)
+
+		// AI prompt templates
+		admin.GET("/prompt-templates", promptHandler.GetPromptTemplates)
+		admin.POST("/prompt-templates", promptHandler.SavePromptTemplate)
+		admin.POST("/prompt-templates/preview", promptHandler.PreviewPromptTemplate)
 	}
 
 	// Start server